@@ -99,9 +99,6 @@ func main() {
 		log.Fatalf("register routes: %v", err)
 	}
 
-	// Register import handler with config dependencies
-	routes.RegisterImportHandler(router, db, cfg.CaddyBinary, cfg.ImportDir)
-
 	// Check for mounted Caddyfile on startup
 	if err := handlers.CheckMountedImport(db, cfg.ImportCaddyfile, cfg.CaddyBinary, cfg.ImportDir); err != nil {
 		log.Printf("WARNING: failed to process mounted Caddyfile: %v", err)
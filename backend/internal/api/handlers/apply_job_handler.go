@@ -0,0 +1,35 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/caddy"
+)
+
+// ApplyJobHandler reports the state of queued config applies.
+type ApplyJobHandler struct {
+	queue *caddy.ApplyQueue
+}
+
+// NewApplyJobHandler creates a new apply job handler.
+func NewApplyJobHandler(queue *caddy.ApplyQueue) *ApplyJobHandler {
+	return &ApplyJobHandler{queue: queue}
+}
+
+// RegisterRoutes registers apply job routes.
+func (h *ApplyJobHandler) RegisterRoutes(router *gin.RouterGroup) {
+	router.GET("/config/jobs/:id", h.Get)
+}
+
+// Get returns whether a job is queued, applying, applied or failed.
+func (h *ApplyJobHandler) Get(c *gin.Context) {
+	job, err := h.queue.Job(c.Param("id"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, job)
+}
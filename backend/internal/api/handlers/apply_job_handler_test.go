@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/caddy"
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/models"
+)
+
+func TestApplyJobHandler(t *testing.T) {
+	var loads int32
+	caddyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/load" {
+			atomic.AddInt32(&loads, 1)
+		}
+	}))
+	defer caddyServer.Close()
+
+	dsn := "file:" + t.Name() + "?mode=memory&cache=shared"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.ProxyHost{}, &models.Location{}, &models.UpstreamGroup{}, &models.AccessList{}, &models.Setting{}, &models.CaddyConfig{}))
+
+	manager := caddy.NewManager(caddy.NewClient(caddyServer.URL), db, t.TempDir())
+	queue := caddy.NewApplyQueue(manager, 20*time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go queue.Run(ctx)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	api := r.Group("/api/v1")
+	h := NewProxyHostHandler(db, manager)
+	h.SetApplyQueue(queue)
+	h.RegisterRoutes(api)
+	NewApplyJobHandler(queue).RegisterRoutes(api)
+
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/v1"+path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		return resp
+	}
+
+	// Waits for the apply by default
+	resp := send(http.MethodPost, "/proxy-hosts", `{"domain_names": "app.example.com", "forward_host": "app", "forward_port": 80}`)
+	require.Equal(t, http.StatusCreated, resp.Code)
+	require.Equal(t, int32(1), atomic.LoadInt32(&loads))
+
+	// Async requests get the job and are coalesced
+	var jobs []caddy.ApplyJob
+	for _, domain := range []string{"a.example.com", "b.example.com"} {
+		resp = send(http.MethodPost, "/proxy-hosts?async=true", `{"domain_names": "`+domain+`", "forward_host": "app", "forward_port": 80}`)
+		require.Equal(t, http.StatusAccepted, resp.Code)
+
+		var accepted struct {
+			Job    caddy.ApplyJob   `json:"job"`
+			Result models.ProxyHost `json:"result"`
+		}
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &accepted))
+		require.Equal(t, caddy.JobQueued, accepted.Job.Status)
+		require.Equal(t, domain, accepted.Result.DomainNames)
+		jobs = append(jobs, accepted.Job)
+	}
+
+	for _, job := range jobs {
+		require.Eventually(t, func() bool {
+			resp := send(http.MethodGet, "/config/jobs/"+job.ID, "")
+			var status caddy.ApplyJob
+			json.Unmarshal(resp.Body.Bytes(), &status)
+			return resp.Code == http.StatusOK && status.Status == caddy.JobApplied
+		}, time.Second, 10*time.Millisecond)
+	}
+	require.Equal(t, int32(2), atomic.LoadInt32(&loads))
+
+	require.Equal(t, http.StatusNotFound, send(http.MethodGet, "/config/jobs/missing", "").Code)
+}
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/caddy"
+)
+
+// CaddyBinaryHandler reports the installed Caddy binary, so the UI can hide
+// options whose plugins are missing.
+type CaddyBinaryHandler struct {
+	binary *caddy.Binary
+}
+
+// NewCaddyBinaryHandler creates a new Caddy binary handler.
+func NewCaddyBinaryHandler(binary *caddy.Binary) *CaddyBinaryHandler {
+	return &CaddyBinaryHandler{binary: binary}
+}
+
+// RegisterRoutes registers Caddy binary routes.
+func (h *CaddyBinaryHandler) RegisterRoutes(router *gin.RouterGroup) {
+	router.GET("/system/caddy", h.Info)
+}
+
+// Info returns the Caddy version, modules and plugin features.
+func (h *CaddyBinaryHandler) Info(c *gin.Context) {
+	if h.binary == nil {
+		c.JSON(http.StatusOK, caddy.BinaryInfo{Features: map[string]bool{}})
+		return
+	}
+	c.JSON(http.StatusOK, h.binary.Info())
+}
@@ -0,0 +1,42 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/caddy"
+)
+
+func TestCaddyBinaryHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	get := func(binary *caddy.Binary) caddy.BinaryInfo {
+		r := gin.New()
+		NewCaddyBinaryHandler(binary).RegisterRoutes(r.Group("/api/v1"))
+
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/api/v1/system/caddy", nil))
+		require.Equal(t, http.StatusOK, resp.Code)
+
+		var info caddy.BinaryInfo
+		require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &info))
+		return info
+	}
+
+	// A missing binary is reported, not an error
+	info := get(caddy.NewBinary(filepath.Join(t.TempDir(), "caddy")))
+	assert.False(t, info.Available)
+	assert.NotEmpty(t, info.Error)
+	assert.Empty(t, info.Modules)
+
+	info = get(nil)
+	assert.False(t, info.Available)
+	assert.NotNil(t, info.Features)
+}
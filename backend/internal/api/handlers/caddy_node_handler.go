@@ -0,0 +1,236 @@
+package handlers
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/caddy"
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/models"
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/services"
+)
+
+// CaddyNodeHandler handles HTTP requests for Caddy node management.
+type CaddyNodeHandler struct {
+	service      *services.CaddyNodeService
+	caddyManager *caddy.Manager
+}
+
+// NewCaddyNodeHandler creates a new Caddy node handler.
+func NewCaddyNodeHandler(db *gorm.DB, caddyManager *caddy.Manager) *CaddyNodeHandler {
+	return &CaddyNodeHandler{
+		service:      services.NewCaddyNodeService(db),
+		caddyManager: caddyManager,
+	}
+}
+
+// RegisterRoutes registers Caddy node routes.
+func (h *CaddyNodeHandler) RegisterRoutes(router *gin.RouterGroup) {
+	router.GET("/caddy-nodes", h.List)
+	router.POST("/caddy-nodes", h.Create)
+	router.GET("/caddy-nodes/:uuid", h.Get)
+	router.PUT("/caddy-nodes/:uuid", h.Update)
+	router.DELETE("/caddy-nodes/:uuid", h.Delete)
+	router.GET("/caddy-nodes/:uuid/config", h.Config)
+	router.POST("/caddy-nodes/:uuid/apply", h.Apply)
+	router.POST("/caddy-nodes/:uuid/check", h.Check)
+}
+
+// CaddyNodeRequest holds the node fields clients set, those not sent are
+// left unchanged. The status fields are only written by applies and checks.
+type CaddyNodeRequest struct {
+	Name           *string   `json:"name"`
+	AdminURL       *string   `json:"admin_url"`
+	AuthType       *string   `json:"auth_type"`
+	AuthUser       *string   `json:"auth_user"`
+	AuthSecret     *string   `json:"auth_secret"`
+	Labels         *[]string `json:"labels"`
+	Enabled        *bool     `json:"enabled"`
+	Origin         *string   `json:"origin"`
+	CACertFile     *string   `json:"ca_cert_file"`
+	ClientCertFile *string   `json:"client_cert_file"`
+	ClientKeyFile  *string   `json:"client_key_file"`
+}
+
+// applyTo sets the fields sent on node. An empty auth secret keeps the
+// current one, as secrets are never sent back to clients.
+func (r CaddyNodeRequest) applyTo(node *models.CaddyNode) {
+	set := func(field *string, value *string) {
+		if value != nil {
+			*field = *value
+		}
+	}
+	set(&node.Name, r.Name)
+	set(&node.AdminURL, r.AdminURL)
+	set(&node.AuthType, r.AuthType)
+	set(&node.AuthUser, r.AuthUser)
+	if r.AuthSecret != nil && *r.AuthSecret != "" {
+		node.AuthSecret = *r.AuthSecret
+	}
+	if r.Labels != nil {
+		node.Labels = *r.Labels
+	}
+	if r.Enabled != nil {
+		node.Enabled = *r.Enabled
+	}
+	set(&node.Origin, r.Origin)
+	set(&node.CACertFile, r.CACertFile)
+	set(&node.ClientCertFile, r.ClientCertFile)
+	set(&node.ClientKeyFile, r.ClientKeyFile)
+}
+
+// List retrieves all nodes.
+func (h *CaddyNodeHandler) List(c *gin.Context) {
+	nodes, err := h.service.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	for i := range nodes {
+		nodes[i].AuthSecret = ""
+	}
+	c.JSON(http.StatusOK, nodes)
+}
+
+// Create registers a new node and applies its config.
+func (h *CaddyNodeHandler) Create(c *gin.Context) {
+	var req CaddyNodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	var node models.CaddyNode
+	req.applyTo(&node)
+	node.UUID = uuid.NewString()
+
+	if err := h.service.Create(&node); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The outcome is part of the node's status
+	if h.caddyManager != nil && node.Enabled {
+		h.caddyManager.ApplyNode(c.Request.Context(), &node)
+	}
+
+	node.AuthSecret = ""
+	c.JSON(http.StatusCreated, node)
+}
+
+// Get retrieves a node by UUID.
+func (h *CaddyNodeHandler) Get(c *gin.Context) {
+	node, ok := h.node(c)
+	if !ok {
+		return
+	}
+
+	node.AuthSecret = ""
+	c.JSON(http.StatusOK, node)
+}
+
+// Update updates the fields sent of an existing node. The auth secret is
+// kept unless a new one is sent. A node moved to another admin API gets
+// its config there.
+func (h *CaddyNodeHandler) Update(c *gin.Context) {
+	node, ok := h.node(c)
+	if !ok {
+		return
+	}
+
+	var req CaddyNodeRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	previousURL := node.AdminURL
+	req.applyTo(node)
+	if err := h.service.Update(node); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// The outcome is part of the node's status
+	if h.caddyManager != nil && node.Enabled && node.AdminURL != previousURL {
+		h.caddyManager.ApplyNode(c.Request.Context(), node)
+	}
+
+	node.AuthSecret = ""
+	c.JSON(http.StatusOK, node)
+}
+
+// Delete removes a node. Caddy keeps running its last config.
+func (h *CaddyNodeHandler) Delete(c *gin.Context) {
+	node, ok := h.node(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.Delete(node.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.Status(http.StatusNoContent)
+}
+
+// Config returns the config generated for a node.
+func (h *CaddyNodeHandler) Config(c *gin.Context) {
+	node, ok := h.node(c)
+	if !ok {
+		return
+	}
+
+	config, err := h.caddyManager.NodeConfig(*node)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, config)
+}
+
+// Apply loads a node's generated config into it.
+func (h *CaddyNodeHandler) Apply(c *gin.Context) {
+	node, ok := h.node(c)
+	if !ok {
+		return
+	}
+
+	if err := h.caddyManager.ApplyNode(c.Request.Context(), node); err != nil {
+		node.AuthSecret = ""
+		c.JSON(http.StatusBadGateway, gin.H{"error": "Failed to apply configuration: " + err.Error(), "node": node})
+		return
+	}
+
+	node.AuthSecret = ""
+	c.JSON(http.StatusOK, node)
+}
+
+// Check refreshes a node's reachability, version and drift status.
+func (h *CaddyNodeHandler) Check(c *gin.Context) {
+	node, ok := h.node(c)
+	if !ok {
+		return
+	}
+
+	// Failures are reported in the node's status
+	h.caddyManager.CheckNode(c.Request.Context(), node)
+
+	node.AuthSecret = ""
+	c.JSON(http.StatusOK, node)
+}
+
+// node loads the node named by the :uuid parameter, responding 404 when missing.
+func (h *CaddyNodeHandler) node(c *gin.Context) (*models.CaddyNode, bool) {
+	node, err := h.service.GetByUUID(c.Param("uuid"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "node not found"})
+		return nil, false
+	}
+	return node, true
+}
@@ -0,0 +1,119 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/caddy"
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/models"
+)
+
+func TestCaddyNodeHandler(t *testing.T) {
+	var loads int
+	var auth string
+	nodeServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		auth = r.Header.Get("Authorization")
+		switch r.URL.Path {
+		case "/load":
+			loads++
+		case "/config/":
+			w.Write([]byte(`{"apps": {}}`))
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer nodeServer.Close()
+	localServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer localServer.Close()
+
+	dsn := "file:" + t.Name() + "?mode=memory&cache=shared"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.ProxyHost{}, &models.Location{}, &models.UpstreamGroup{}, &models.AccessList{}, &models.Setting{}, &models.CaddyConfig{}, &models.CaddyNode{}))
+
+	manager := caddy.NewManager(caddy.NewClient(localServer.URL), db, t.TempDir())
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	NewCaddyNodeHandler(db, manager).RegisterRoutes(r.Group("/api/v1"))
+
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/v1"+path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		return resp
+	}
+
+	require.NoError(t, db.Create(&models.ProxyHost{UUID: "uuid-a", DomainNames: "a.example.com", ForwardHost: "a", ForwardPort: 80, Enabled: true, Nodes: []string{"edge"}}).Error)
+
+	// Registering a node applies its config
+	resp := send(http.MethodPost, "/caddy-nodes", `{"name": "edge1", "admin_url": "`+nodeServer.URL+`", "auth_type": "bearer", "auth_secret": "token", "labels": ["edge"], "enabled": true}`)
+	require.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+	require.NotContains(t, resp.Body.String(), "token")
+	var node models.CaddyNode
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &node))
+	require.Equal(t, 1, loads)
+	require.Equal(t, "Bearer token", auth)
+	require.Empty(t, node.ApplyError)
+	require.NotNil(t, node.LastApplied)
+
+	require.Equal(t, http.StatusBadRequest, send(http.MethodPost, "/caddy-nodes", `{"name": "local", "admin_url": "`+nodeServer.URL+`"}`).Code)
+
+	// Generated config
+	resp = send(http.MethodGet, "/caddy-nodes/"+node.UUID+"/config", "")
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.Contains(t, resp.Body.String(), "a.example.com")
+
+	// The secret survives updates without it
+	resp = send(http.MethodPut, "/caddy-nodes/"+node.UUID, `{"labels": ["edge", "eu"]}`)
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	require.Equal(t, http.StatusOK, send(http.MethodPost, "/caddy-nodes/"+node.UUID+"/apply", "").Code)
+	require.Equal(t, 2, loads)
+	require.Equal(t, "Bearer token", auth)
+
+	// Check reports the drift
+	resp = send(http.MethodPost, "/caddy-nodes/"+node.UUID+"/check", "")
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &node))
+	require.True(t, node.Reachable)
+	require.False(t, node.InSync)
+
+	resp = send(http.MethodGet, "/caddy-nodes", "")
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.NotContains(t, resp.Body.String(), "token")
+
+	// Status fields can't be set by clients
+	resp = send(http.MethodPut, "/caddy-nodes/"+node.UUID, `{"in_sync": true, "applied_hash": "forged", "live_hash": "forged"}`)
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	require.NoError(t, db.First(&node, node.ID).Error)
+	require.False(t, node.InSync)
+	require.NotEqual(t, "forged", node.AppliedHash)
+	require.NotEqual(t, "forged", node.LiveHash)
+	require.Equal(t, 2, loads)
+
+	// A node moved to another admin API gets its config there
+	var movedLoads int
+	movedServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/load" {
+			movedLoads++
+		}
+	}))
+	defer movedServer.Close()
+	resp = send(http.MethodPut, "/caddy-nodes/"+node.UUID, `{"admin_url": "`+movedServer.URL+`"}`)
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	require.Equal(t, 1, movedLoads)
+	require.Equal(t, 2, loads)
+
+	resp = send(http.MethodDelete, "/caddy-nodes/"+node.UUID, "")
+	require.Equal(t, http.StatusNoContent, resp.Code)
+	require.Empty(t, resp.Body.String())
+	require.Equal(t, http.StatusNotFound, send(http.MethodGet, "/caddy-nodes/"+node.UUID, "").Code)
+}
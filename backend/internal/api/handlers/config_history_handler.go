@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/caddy"
+)
+
+// ConfigHistoryHandler browses applied configs and rolls back to them.
+type ConfigHistoryHandler struct {
+	caddyManager *caddy.Manager
+}
+
+// NewConfigHistoryHandler creates a new config history handler.
+func NewConfigHistoryHandler(caddyManager *caddy.Manager) *ConfigHistoryHandler {
+	return &ConfigHistoryHandler{caddyManager: caddyManager}
+}
+
+// RegisterRoutes registers config history routes.
+func (h *ConfigHistoryHandler) RegisterRoutes(router *gin.RouterGroup) {
+	router.GET("/config/history", h.List)
+	router.GET("/config/history/:id", h.Get)
+	router.GET("/config/history/:id/diff/:other", h.Diff)
+	router.POST("/config/history/:id/rollback", h.Rollback)
+	router.GET("/config/caddyfile", h.ExportCaddyfile)
+}
+
+// ExportCaddyfile downloads the current configuration as a Caddyfile named
+// after its generation time.
+func (h *ConfigHistoryHandler) ExportCaddyfile(c *gin.Context) {
+	generated := time.Now()
+	caddyfile, err := h.caddyManager.ExportCaddyfile(generated)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	filename := fmt.Sprintf("Caddyfile-%s", generated.UTC().Format("20060102-150405"))
+	c.Header("Content-Disposition", fmt.Sprintf("attachment; filename=%q", filename))
+	c.Data(http.StatusOK, "text/plain; charset=utf-8", []byte(caddyfile))
+}
+
+// List returns the config history, newest first.
+func (h *ConfigHistoryHandler) List(c *gin.Context) {
+	history, err := h.caddyManager.History()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, history)
+}
+
+// Get returns a history entry with its config snapshot.
+func (h *ConfigHistoryHandler) Get(c *gin.Context) {
+	id, ok := historyID(c, "id")
+	if !ok {
+		return
+	}
+
+	entry, err := h.caddyManager.HistoryEntry(id)
+	if err != nil {
+		c.JSON(historyErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, entry)
+}
+
+// Diff compares the snapshot of :id with the snapshot of :other.
+func (h *ConfigHistoryHandler) Diff(c *gin.Context) {
+	id, ok := historyID(c, "id")
+	if !ok {
+		return
+	}
+	other, ok := historyID(c, "other")
+	if !ok {
+		return
+	}
+
+	diff, err := h.caddyManager.DiffHistory(id, other)
+	if err != nil {
+		c.JSON(historyErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, diff)
+}
+
+// Rollback restores the hosts of a history entry and applies them.
+func (h *ConfigHistoryHandler) Rollback(c *gin.Context) {
+	id, ok := historyID(c, "id")
+	if !ok {
+		return
+	}
+
+	if err := h.caddyManager.RollbackTo(applyContext(c, ""), id); err != nil {
+		c.JSON(historyErrorStatus(err), gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "Rolled back configuration"})
+}
+
+// historyID parses a history entry ID path parameter, responding 400 when invalid.
+func historyID(c *gin.Context, param string) (uint, bool) {
+	id, err := strconv.ParseUint(c.Param(param), 10, 32)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "invalid history ID"})
+		return 0, false
+	}
+	return uint(id), true
+}
+
+func historyErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, caddy.ErrHistoryNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, caddy.ErrSnapshotUnavailable):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
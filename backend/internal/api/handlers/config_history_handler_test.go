@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/caddy"
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/models"
+)
+
+func TestConfigHistoryHandler(t *testing.T) {
+	caddyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer caddyServer.Close()
+
+	dsn := "file:" + t.Name() + "?mode=memory&cache=shared"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.ProxyHost{}, &models.Location{}, &models.UpstreamGroup{}, &models.TrafficSplitChange{}, &models.AccessList{}, &models.Setting{}, &models.CaddyConfig{}))
+
+	manager := caddy.NewManager(caddy.NewClient(caddyServer.URL), db, t.TempDir())
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	api := r.Group("/api/v1")
+	api.Use(func(c *gin.Context) { c.Set("userID", uint(5)) })
+	NewProxyHostHandler(db, manager).RegisterRoutes(api)
+	NewConfigHistoryHandler(manager).RegisterRoutes(api)
+
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/v1"+path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		return resp
+	}
+
+	resp := send(http.MethodPost, "/proxy-hosts", `{"domain_names": "app.example.com", "forward_host": "app", "forward_port": 80}`)
+	require.Equal(t, http.StatusCreated, resp.Code)
+	require.Equal(t, http.StatusCreated, send(http.MethodPost, "/proxy-hosts", `{"domain_names": "api.example.com", "forward_host": "api", "forward_port": 80}`).Code)
+
+	resp = send(http.MethodGet, "/config/history", "")
+	require.Equal(t, http.StatusOK, resp.Code)
+	var history []models.CaddyConfig
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &history))
+	require.Len(t, history, 2)
+	require.Equal(t, "create proxy host api.example.com", history[0].Reason)
+	require.Equal(t, uint(5), history[0].AppliedBy)
+	require.Equal(t, []string{"api.example.com"}, history[0].HostsChanged)
+
+	first, latest := history[1].ID, history[0].ID
+
+	resp = send(http.MethodGet, fmt.Sprintf("/config/history/%d", first), "")
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.Contains(t, resp.Body.String(), `"config":{`)
+
+	resp = send(http.MethodGet, fmt.Sprintf("/config/history/%d/diff/%d", first, latest), "")
+	require.Equal(t, http.StatusOK, resp.Code)
+	var diff caddy.ConfigDiff
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &diff))
+	require.True(t, diff.Changed)
+
+	resp = send(http.MethodPost, fmt.Sprintf("/config/history/%d/rollback", first), "")
+	require.Equal(t, http.StatusOK, resp.Code)
+	var count int64
+	db.Model(&models.ProxyHost{}).Count(&count)
+	require.Equal(t, int64(1), count)
+
+	require.Equal(t, http.StatusNotFound, send(http.MethodGet, "/config/history/999", "").Code)
+	require.Equal(t, http.StatusBadRequest, send(http.MethodGet, "/config/history/abc", "").Code)
+
+	// Snapshots removed by retention can no longer be rolled back to
+	db.Model(&models.CaddyConfig{}).Where("id = ?", first).Update("snapshot", "")
+	require.Equal(t, http.StatusConflict, send(http.MethodPost, fmt.Sprintf("/config/history/%d/rollback", first), "").Code)
+}
+
+func TestConfigHistoryHandler_ExportCaddyfile(t *testing.T) {
+	dsn := "file:" + t.Name() + "?mode=memory&cache=shared"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.ProxyHost{}, &models.Location{}, &models.UpstreamGroup{}, &models.AccessList{}, &models.Setting{}))
+	require.NoError(t, db.Create(&models.ProxyHost{UUID: "uuid-app", DomainNames: "app.example.com", ForwardScheme: "http", ForwardHost: "app", ForwardPort: 8080, Enabled: true}).Error)
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	NewConfigHistoryHandler(caddy.NewManager(nil, db, t.TempDir())).RegisterRoutes(r.Group("/api/v1"))
+
+	resp := httptest.NewRecorder()
+	r.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/api/v1/config/caddyfile", nil))
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.Equal(t, "text/plain; charset=utf-8", resp.Header().Get("Content-Type"))
+	require.Regexp(t, `^attachment; filename="Caddyfile-\d{8}-\d{6}"$`, resp.Header().Get("Content-Disposition"))
+	require.Contains(t, resp.Body.String(), "# Generated by CPM+ at ")
+	require.Contains(t, resp.Body.String(), "app.example.com {\n\treverse_proxy app:8080\n}\n")
+
+	// An unusable configuration is reported instead of downloaded
+	db.Model(&models.ProxyHost{}).Where("uuid = ?", "uuid-app").Update("certificate_issuer", "unknown")
+	resp = httptest.NewRecorder()
+	r.ServeHTTP(resp, httptest.NewRequest(http.MethodGet, "/api/v1/config/caddyfile", nil))
+	require.Equal(t, http.StatusInternalServerError, resp.Code)
+	require.Contains(t, resp.Body.String(), "unknown certificate issuer")
+}
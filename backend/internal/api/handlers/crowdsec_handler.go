@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/services"
+)
+
+// CrowdSecHandler exposes CrowdSec decisions and manual bans.
+type CrowdSecHandler struct {
+	service *services.CrowdSecService
+}
+
+// NewCrowdSecHandler creates a new CrowdSec handler.
+func NewCrowdSecHandler(service *services.CrowdSecService) *CrowdSecHandler {
+	return &CrowdSecHandler{service: service}
+}
+
+// RegisterRoutes registers CrowdSec routes.
+func (h *CrowdSecHandler) RegisterRoutes(router *gin.RouterGroup) {
+	router.GET("/crowdsec/decisions", h.ListDecisions)
+	router.POST("/crowdsec/decisions", h.Ban)
+}
+
+// ListDecisions returns the active bans and other decisions from the LAPI.
+func (h *CrowdSecHandler) ListDecisions(c *gin.Context) {
+	decisions, err := h.service.Decisions(c.Request.Context())
+	if errors.Is(err, services.ErrCrowdSecNotConfigured) {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, decisions)
+}
+
+// Ban pushes a manual ban decision.
+func (h *CrowdSecHandler) Ban(c *gin.Context) {
+	var ban services.CrowdSecBan
+	if err := c.ShouldBindJSON(&ban); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.service.Ban(c.Request.Context(), ban); err != nil {
+		status := http.StatusBadGateway
+		if errors.Is(err, services.ErrCrowdSecNotConfigured) || errors.Is(err, services.ErrInvalidCrowdSecBan) {
+			status = http.StatusBadRequest
+		}
+		c.JSON(status, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusCreated, gin.H{"message": "Ban added", "ip": ban.IP})
+}
@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/models"
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/services"
+)
+
+func TestCrowdSecHandler(t *testing.T) {
+	lapi := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/v1/decisions":
+			w.Write([]byte(`[{"id": 1, "type": "ban", "scope": "Ip", "value": "203.0.113.9", "duration": "1h"}]`))
+		case "/v1/watchers/login":
+			w.Write([]byte(`{"token": "jwt"}`))
+		case "/v1/alerts":
+			w.WriteHeader(http.StatusCreated)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer lapi.Close()
+
+	dsn := "file:" + t.Name() + "?mode=memory&cache=shared"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.Setting{}))
+
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	NewCrowdSecHandler(services.NewCrowdSecService(db)).RegisterRoutes(r.Group("/api/v1"))
+
+	send := func(method, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/v1/crowdsec/decisions", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		return resp
+	}
+
+	// Not configured yet
+	require.Equal(t, http.StatusBadRequest, send(http.MethodGet, "").Code)
+
+	db.Create(&models.Setting{Key: services.CrowdSecAPIURLSetting, Value: lapi.URL})
+	db.Create(&models.Setting{Key: services.CrowdSecBouncerKeySetting, Value: "key"})
+	db.Create(&models.Setting{Key: services.CrowdSecMachineIDSetting, Value: "cpm"})
+	db.Create(&models.Setting{Key: services.CrowdSecMachinePasswordSetting, Value: "secret"})
+
+	resp := send(http.MethodGet, "")
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.Contains(t, resp.Body.String(), "203.0.113.9")
+
+	require.Equal(t, http.StatusCreated, send(http.MethodPost, `{"ip": "198.51.100.7", "duration": "2h"}`).Code)
+	require.Equal(t, http.StatusBadRequest, send(http.MethodPost, `{"ip": "bogus"}`).Code)
+	require.Equal(t, http.StatusBadRequest, send(http.MethodPost, `{}`).Code)
+}
@@ -7,6 +7,7 @@ import (
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -15,6 +16,7 @@ import (
 	"gorm.io/gorm"
 
 	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/api/handlers"
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/caddy"
 	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/models"
 )
 
@@ -28,6 +30,7 @@ func setupTestDB() *gorm.DB {
 	db.AutoMigrate(
 		&models.ProxyHost{},
 		&models.Location{},
+		&models.UpstreamGroup{},
 		&models.RemoteServer{},
 		&models.ImportSession{},
 	)
@@ -329,6 +332,28 @@ func TestHealthHandler(t *testing.T) {
 	assert.Equal(t, "ok", result["status"])
 }
 
+func TestNewHealthHandler(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+
+	router := gin.New()
+	router.GET("/health", handlers.NewHealthHandler(caddy.NewReconciler(nil, nil, time.Minute)))
+
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("GET", "/health", nil)
+	router.ServeHTTP(w, req)
+
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var result struct {
+		Status    string                `json:"status"`
+		Reconcile caddy.ReconcileStatus `json:"reconcile"`
+	}
+	err := json.Unmarshal(w.Body.Bytes(), &result)
+	assert.NoError(t, err)
+	assert.Equal(t, "ok", result.Status)
+	assert.False(t, result.Reconcile.Applied)
+}
+
 func TestRemoteServerHandler_Errors(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	db := setupTestDB()
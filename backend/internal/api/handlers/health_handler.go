@@ -3,17 +3,32 @@ package handlers
 import (
 	"net/http"
 
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/caddy"
 	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/version"
 	"github.com/gin-gonic/gin"
 )
 
 // HealthHandler responds with basic service metadata for uptime checks.
 func HealthHandler(c *gin.Context) {
-	c.JSON(http.StatusOK, gin.H{
+	c.JSON(http.StatusOK, healthBody())
+}
+
+// NewHealthHandler returns a health handler that also reports whether
+// Caddy runs the config generated from the database.
+func NewHealthHandler(reconciler *caddy.Reconciler) gin.HandlerFunc {
+	return func(c *gin.Context) {
+		body := healthBody()
+		body["reconcile"] = reconciler.Status()
+		c.JSON(http.StatusOK, body)
+	}
+}
+
+func healthBody() gin.H {
+	return gin.H{
 		"status":     "ok",
 		"service":    version.Name,
 		"version":    version.Version,
 		"git_commit": version.GitCommit,
 		"build_time": version.BuildTime,
-	})
+	}
 }
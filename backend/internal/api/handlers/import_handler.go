@@ -6,6 +6,7 @@ import (
 	"net/http"
 	"os"
 	"path/filepath"
+	"strings"
 	"time"
 
 	"github.com/gin-gonic/gin"
@@ -21,8 +22,11 @@ import (
 type ImportHandler struct {
 	db              *gorm.DB
 	proxyHostSvc    *services.ProxyHostService
+	rawRouteSvc     *services.RawRouteService
 	importerservice *caddy.Importer
 	importDir       string
+	caddyClient     *caddy.Client
+	staticBaseDir   string
 }
 
 // NewImportHandler creates a new import handler.
@@ -30,16 +34,29 @@ func NewImportHandler(db *gorm.DB, caddyBinary, importDir string) *ImportHandler
 	return &ImportHandler{
 		db:              db,
 		proxyHostSvc:    services.NewProxyHostService(db),
+		rawRouteSvc:     services.NewRawRouteService(db),
 		importerservice: caddy.NewImporter(caddyBinary),
 		importDir:       importDir,
 	}
 }
 
+// SetCaddyClient enables adopting the config of the running Caddy.
+func (h *ImportHandler) SetCaddyClient(client *caddy.Client) {
+	h.caddyClient = client
+}
+
+// SetStaticBaseDir restricts the roots of imported static hosts to dir,
+// caddy.DefaultStaticBaseDir when unset.
+func (h *ImportHandler) SetStaticBaseDir(dir string) {
+	h.staticBaseDir = dir
+}
+
 // RegisterRoutes registers import-related routes.
 func (h *ImportHandler) RegisterRoutes(router *gin.RouterGroup) {
 	router.GET("/import/status", h.GetStatus)
 	router.GET("/import/preview", h.GetPreview)
 	router.POST("/import/upload", h.Upload)
+	router.POST("/import/live", h.ImportLive)
 	router.POST("/import/commit", h.Commit)
 	router.DELETE("/import/cancel", h.Cancel)
 }
@@ -123,11 +140,13 @@ func (h *ImportHandler) GetPreview(c *gin.Context) {
 	})
 }
 
-// Upload handles manual Caddyfile upload or paste.
+// Upload handles manual Caddyfile upload or paste. Caddy JSON configs,
+// with format "json" or a .json filename, are read without caddy adapt.
 func (h *ImportHandler) Upload(c *gin.Context) {
 	var req struct {
 		Content  string `json:"content" binding:"required"`
 		Filename string `json:"filename"`
+		Format   string `json:"format"` // "caddyfile" (default) or "json"
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -135,6 +154,15 @@ func (h *ImportHandler) Upload(c *gin.Context) {
 		return
 	}
 
+	if req.Format == "json" || strings.HasSuffix(req.Filename, ".json") {
+		if err := h.processJSON([]byte(req.Content), "upload"); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		c.JSON(http.StatusOK, gin.H{"message": "upload processed, ready for review"})
+		return
+	}
+
 	// Create temporary file
 	tempPath := filepath.Join(h.importDir, fmt.Sprintf("upload-%s.caddyfile", uuid.NewString()))
 	if err := os.MkdirAll(h.importDir, 0755); err != nil {
@@ -156,11 +184,33 @@ func (h *ImportHandler) Upload(c *gin.Context) {
 	c.JSON(http.StatusOK, gin.H{"message": "upload processed, ready for review"})
 }
 
+// ImportLive reads the config of the running Caddy for review, so an
+// existing Caddy can be adopted without rewriting its config.
+func (h *ImportHandler) ImportLive(c *gin.Context) {
+	if h.caddyClient == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "caddy admin API not configured"})
+		return
+	}
+
+	caddyJSON, err := h.caddyClient.GetRawConfig(c.Request.Context())
+	if err != nil {
+		c.JSON(http.StatusBadGateway, gin.H{"error": fmt.Sprintf("read live config: %v", err)})
+		return
+	}
+
+	if err := h.processJSON(caddyJSON, "live"); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"message": "live config read, ready for review"})
+}
+
 // Commit finalizes the import with user's conflict resolutions.
 func (h *ImportHandler) Commit(c *gin.Context) {
 	var req struct {
 		SessionUUID string            `json:"session_uuid" binding:"required"`
-		Resolutions map[string]string `json:"resolutions"` // domain -> action (skip, rename, merge)
+		Resolutions map[string]string `json:"resolutions"` // domain or passthrough route name -> action (skip, rename, merge)
 	}
 
 	if err := c.ShouldBindJSON(&req); err != nil {
@@ -188,18 +238,54 @@ func (h *ImportHandler) Commit(c *gin.Context) {
 	errors := []string{}
 
 	for _, host := range proxyHosts {
+		domains := strings.Split(host.DomainNames, ",")
+
+		// Resolutions are given for the host or for one of its domains
 		action := req.Resolutions[host.DomainNames]
+		for _, domain := range domains {
+			if action == "" {
+				action = req.Resolutions[strings.TrimSpace(domain)]
+			}
+		}
 
-		if action == "skip" {
+		if action == "skip" || action == "keep" {
 			skipped++
 			continue
 		}
 
 		if action == "rename" {
-			host.DomainNames = host.DomainNames + "-imported"
+			for i, domain := range domains {
+				domains[i] = strings.TrimSpace(domain) + "-imported"
+			}
+			host.DomainNames = strings.Join(domains, ", ")
+		}
+
+		// A host must not take over a domain another host serves
+		used, err := h.proxyHostSvc.UsedDomains(host.DomainNames, 0)
+		if err != nil {
+			errors = append(errors, fmt.Sprintf("%s: %s", host.DomainNames, err.Error()))
+			continue
+		}
+		if len(used) > 0 {
+			errors = append(errors, fmt.Sprintf("%s: domain %s already exists", host.DomainNames, strings.Join(used, ", ")))
+			continue
+		}
+
+		// A root outside the base directory would fail every later apply
+		if host.HostType == models.HostTypeStatic {
+			if err := caddy.ValidateStaticRoot(host.StaticRoot, h.staticBaseDir); err != nil {
+				errors = append(errors, fmt.Sprintf("%s: %s", host.DomainNames, err.Error()))
+				continue
+			}
 		}
 
 		host.UUID = uuid.NewString()
+		for i := range host.Locations {
+			host.Locations[i].UUID = uuid.NewString()
+		}
+		for i := range host.UpstreamGroups {
+			host.UpstreamGroups[i].UUID = uuid.NewString()
+		}
 
 		if err := h.proxyHostSvc.Create(&host); err != nil {
 			errors = append(errors, fmt.Sprintf("%s: %s", host.DomainNames, err.Error()))
@@ -208,6 +294,39 @@ func (h *ImportHandler) Commit(c *gin.Context) {
 		}
 	}
 
+	// Keep the routes no host represents verbatim
+	passthrough := 0
+	for _, route := range result.Passthrough {
+		if req.Resolutions[route.Name] == "skip" {
+			skipped++
+			continue
+		}
+
+		raw := models.RawRoute{
+			UUID:    uuid.NewString(),
+			Name:    route.Name,
+			Source:  session.SourceFile,
+			Route:   string(route.Route),
+			Enabled: true,
+		}
+		// Committing the same live config again must not duplicate them
+		if err := h.rawRouteSvc.Create(&raw); err == services.ErrRawRouteExists {
+			skipped++
+		} else if err != nil {
+			errors = append(errors, fmt.Sprintf("%s: %s", route.Name, err.Error()))
+		} else {
+			passthrough++
+		}
+	}
+
+	// Carry over global settings such as server timeouts, keeping any existing values
+	for key, value := range result.Settings {
+		setting := models.Setting{Key: key, Value: value, Type: "string", Category: "caddy"}
+		if err := h.db.Where(models.Setting{Key: key}).FirstOrCreate(&setting).Error; err != nil {
+			errors = append(errors, fmt.Sprintf("setting %s: %s", key, err.Error()))
+		}
+	}
+
 	// Mark session as committed
 	now := time.Now()
 	session.Status = "committed"
@@ -216,9 +335,10 @@ func (h *ImportHandler) Commit(c *gin.Context) {
 	h.db.Save(&session)
 
 	c.JSON(http.StatusOK, gin.H{
-		"created": created,
-		"skipped": skipped,
-		"errors":  errors,
+		"created":     created,
+		"skipped":     skipped,
+		"passthrough": passthrough,
+		"errors":      errors,
 	})
 }
 
@@ -255,24 +375,58 @@ func (h *ImportHandler) processImport(caddyfilePath, originalName string) error
 		return fmt.Errorf("import failed: %w", err)
 	}
 
-	// Check for conflicts with existing hosts
-	existingHosts, _ := h.proxyHostSvc.List()
-	existingDomains := make(map[string]bool)
-	for _, host := range existingHosts {
-		existingDomains[host.DomainNames] = true
+	if err := h.createSession(result, originalName); err != nil {
+		return err
 	}
 
+	// Backup original file
+	if _, err := caddy.BackupCaddyfile(caddyfilePath, filepath.Join(h.importDir, "backups")); err != nil {
+		// Non-fatal, log and continue
+		fmt.Printf("Warning: failed to backup Caddyfile: %v\n", err)
+	}
+
+	return nil
+}
+
+// processJSON handles the import of a Caddy JSON config, which needs no
+// adapting. The config is kept in the backups directory as the session's
+// source, where the preview reads it from.
+func (h *ImportHandler) processJSON(caddyJSON []byte, origin string) error {
+	result, err := h.importerservice.ExtractHosts(caddyJSON)
+	if err != nil {
+		return fmt.Errorf("import failed: %w", err)
+	}
+
+	backupDir := filepath.Join(h.importDir, "backups")
+	if err := os.MkdirAll(backupDir, 0755); err != nil {
+		return fmt.Errorf("failed to create backup directory: %w", err)
+	}
+	sourcePath := filepath.Join(backupDir, fmt.Sprintf("caddy-%s-%s.json", origin, time.Now().UTC().Format("20060102-150405")))
+	if err := os.WriteFile(sourcePath, caddyJSON, 0644); err != nil {
+		return fmt.Errorf("failed to save config: %w", err)
+	}
+
+	return h.createSession(result, sourcePath)
+}
+
+// createSession records an import for review, with its conflicts.
+func (h *ImportHandler) createSession(result *caddy.ImportResult, sourceFile string) error {
+	// Check each domain for conflicts with existing hosts
 	for _, parsed := range result.Hosts {
-		if existingDomains[parsed.DomainNames] {
+		used, err := h.proxyHostSvc.UsedDomains(parsed.DomainNames, 0)
+		if err != nil {
+			return err
+		}
+		for _, domain := range used {
 			result.Conflicts = append(result.Conflicts,
-				fmt.Sprintf("Domain '%s' already exists in CPM+", parsed.DomainNames))
+				fmt.Sprintf("Domain '%s' already exists in CPM+", domain))
 		}
 	}
 
 	// Create import session
 	session := models.ImportSession{
 		UUID:           uuid.NewString(),
-		SourceFile:     originalName,
+		SourceFile:     sourceFile,
 		Status:         "pending",
 		ParsedData:     string(mustMarshal(result)),
 		ConflictReport: string(mustMarshal(result.Conflicts)),
@@ -282,12 +436,6 @@ func (h *ImportHandler) processImport(caddyfilePath, originalName string) error
 		return fmt.Errorf("failed to create session: %w", err)
 	}
 
-	// Backup original file
-	if _, err := caddy.BackupCaddyfile(caddyfilePath, filepath.Join(h.importDir, "backups")); err != nil {
-		// Non-fatal, log and continue
-		fmt.Printf("Warning: failed to backup Caddyfile: %v\n", err)
-	}
-
 	return nil
 }
 
@@ -16,6 +16,7 @@ import (
 	"gorm.io/gorm"
 
 	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/api/handlers"
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/caddy"
 	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/models"
 )
 
@@ -25,7 +26,7 @@ func setupImportTestDB(t *testing.T) *gorm.DB {
 	if err != nil {
 		panic("failed to connect to test database")
 	}
-	db.AutoMigrate(&models.ImportSession{}, &models.ProxyHost{}, &models.Location{})
+	db.AutoMigrate(&models.ImportSession{}, &models.ProxyHost{}, &models.Location{}, &models.UpstreamGroup{}, &models.Setting{}, &models.RawRoute{})
 	return db
 }
 
@@ -168,6 +169,107 @@ func TestImportHandler_Commit(t *testing.T) {
 	assert.Equal(t, "committed", updatedSession.Status)
 }
 
+func TestImportHandler_Commit_UpstreamGroups(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupImportTestDB(t)
+	handler := handlers.NewImportHandler(db, "echo", "/tmp")
+	router := gin.New()
+	router.POST("/import/commit", handler.Commit)
+
+	db.Create(&models.ImportSession{
+		UUID:   "test-uuid",
+		Status: "reviewing",
+		ParsedData: `{"hosts": [{"domain_names": "app.example.com", "forward_scheme": "http", "forward_host": "app1", "forward_port": 8080,
+			"upstreams": [{"forward_host": "app1", "forward_port": 8080, "weight": 50}, {"forward_host": "app2", "forward_port": 8080, "weight": 50}]}]}`,
+	})
+
+	body, _ := json.Marshal(map[string]interface{}{"session_uuid": "test-uuid"})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/import/commit", bytes.NewBuffer(body))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var groups []models.UpstreamGroup
+	assert.NoError(t, db.Order("name").Find(&groups).Error)
+	if assert.Len(t, groups, 2) {
+		assert.Equal(t, "app2", groups[1].ForwardHost)
+		assert.NotEmpty(t, groups[0].UUID)
+		assert.NotEqual(t, groups[0].UUID, groups[1].UUID)
+	}
+}
+
+func TestImportHandler_Commit_StaticRoot(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupImportTestDB(t)
+	handler := handlers.NewImportHandler(db, "echo", "/tmp")
+	handler.SetStaticBaseDir("/srv")
+	router := gin.New()
+	router.POST("/import/commit", handler.Commit)
+
+	db.Create(&models.ImportSession{
+		UUID:   "test-uuid",
+		Status: "reviewing",
+		ParsedData: `{"hosts": [
+			{"domain_names": "docs.example.com", "host_type": "static", "static_root": "/srv/docs"},
+			{"domain_names": "etc.example.com", "host_type": "static", "static_root": "/etc"}]}`,
+	})
+
+	body, _ := json.Marshal(map[string]interface{}{"session_uuid": "test-uuid"})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/import/commit", bytes.NewBuffer(body))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var resp map[string]interface{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &resp))
+	assert.Equal(t, float64(1), resp["created"])
+	if assert.Len(t, resp["errors"], 1) {
+		assert.Contains(t, resp["errors"].([]interface{})[0], "etc.example.com: static root /etc is outside the allowed base directory")
+	}
+
+	var count int64
+	db.Model(&models.ProxyHost{}).Where("domain_names = ?", "etc.example.com").Count(&count)
+	assert.Zero(t, count)
+}
+
+func TestImportHandler_Commit_Settings(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupImportTestDB(t)
+	handler := handlers.NewImportHandler(db, "echo", "/tmp")
+	router := gin.New()
+	router.POST("/import/commit", handler.Commit)
+
+	// An existing value must not be overwritten by the import
+	db.Create(&models.Setting{Key: "caddy.server_idle_timeout", Value: "10m"})
+
+	session := models.ImportSession{
+		UUID:   "settings-uuid",
+		Status: "reviewing",
+		ParsedData: `{"hosts": [{"domain_names": "cloud.example.com", "forward_host": "nextcloud", "forward_port": 80, "max_body_size": 10000000, "response_header_timeout": "5m0s"}],
+			"settings": {"caddy.server_read_timeout": "30s", "caddy.server_idle_timeout": "5m0s"}}`,
+	}
+	db.Create(&session)
+
+	body, _ := json.Marshal(map[string]interface{}{"session_uuid": "settings-uuid"})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/import/commit", bytes.NewBuffer(body))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	var host models.ProxyHost
+	assert.NoError(t, db.Where("domain_names = ?", "cloud.example.com").First(&host).Error)
+	assert.Equal(t, int64(10000000), host.MaxBodySize)
+	assert.Equal(t, "5m0s", host.ResponseHeaderTimeout)
+
+	var setting models.Setting
+	assert.NoError(t, db.Where("key = ?", "caddy.server_read_timeout").First(&setting).Error)
+	assert.Equal(t, "30s", setting.Value)
+
+	setting = models.Setting{}
+	assert.NoError(t, db.Where("key = ?", "caddy.server_idle_timeout").First(&setting).Error)
+	assert.Equal(t, "10m", setting.Value)
+}
+
 func TestImportHandler_Upload(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	db := setupImportTestDB(t)
@@ -393,6 +495,59 @@ func TestImportHandler_Upload_Conflict(t *testing.T) {
 	assert.Contains(t, session.ConflictReport, "Domain 'example.com' already exists")
 }
 
+func TestImportHandler_MultiDomainConflicts(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupImportTestDB(t)
+	db.Create(&models.ProxyHost{UUID: "uuid-b", DomainNames: "b.com", ForwardHost: "b", ForwardPort: 80})
+
+	handler := handlers.NewImportHandler(db, "/nonexistent/caddy", t.TempDir())
+	router := gin.New()
+	router.POST("/import/upload", handler.Upload)
+	router.POST("/import/commit", handler.Commit)
+
+	config := `{"apps": {"http": {"servers": {"srv0": {"routes": [
+		{"match": [{"host": ["a.com", "b.com"]}], "handle": [{"handler": "reverse_proxy", "upstreams": [{"dial": "app:80"}]}]},
+		{"match": [{"host": ["c.com", "d.com"]}], "handle": [{"handler": "reverse_proxy", "upstreams": [{"dial": "other:80"}]}]}
+	]}}}}}`
+	body, _ := json.Marshal(map[string]string{"content": config, "format": "json"})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/import/upload", bytes.NewBuffer(body))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	// The conflict is found for the one domain already served
+	var session models.ImportSession
+	db.First(&session)
+	assert.Equal(t, `["Domain 'b.com' already exists in CPM+"]`, session.ConflictReport)
+	db.Model(&session).Update("status", "reviewing")
+
+	commit := func(resolutions map[string]string) map[string]interface{} {
+		body, _ := json.Marshal(map[string]interface{}{"session_uuid": session.UUID, "resolutions": resolutions})
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/import/commit", bytes.NewBuffer(body))
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+		var resp map[string]interface{}
+		json.Unmarshal(w.Body.Bytes(), &resp)
+		return resp
+	}
+
+	// Without a resolution the host sharing a domain is not created
+	resp := commit(nil)
+	assert.EqualValues(t, 1, resp["created"])
+	assert.Equal(t, []interface{}{"a.com, b.com: domain b.com already exists"}, resp["errors"])
+
+	var host models.ProxyHost
+	assert.NoError(t, db.Where("domain_names = ?", "c.com, d.com").First(&host).Error)
+
+	// A resolution for the conflicting domain applies to its host
+	db.Where("domain_names = ?", "c.com, d.com").Delete(&models.ProxyHost{})
+	db.Model(&session).Update("status", "reviewing")
+	resp = commit(map[string]string{"b.com": "skip"})
+	assert.EqualValues(t, 1, resp["created"])
+	assert.EqualValues(t, 1, resp["skipped"])
+}
+
 func TestImportHandler_GetPreview_BackupContent(t *testing.T) {
 	gin.SetMode(gin.TestMode)
 	db := setupImportTestDB(t)
@@ -483,3 +638,129 @@ func TestImportHandler_Errors(t *testing.T) {
 	router.ServeHTTP(w, req)
 	assert.Equal(t, http.StatusNotFound, w.Code)
 }
+
+// liveCaddyConfig is a running config with a proxy host, a route no host
+// can represent and an app CPM+ doesn't manage.
+const liveCaddyConfig = `{
+	"apps": {
+		"http": {"servers": {"srv0": {"listen": [":443"], "routes": [
+			{"match": [{"host": ["app.example.com"]}], "handle": [{"handler": "reverse_proxy", "upstreams": [{"dial": "app:8080"}]}]},
+			{"match": [{"host": ["taken.example.com"]}], "handle": [{"handler": "reverse_proxy", "upstreams": [{"dial": "taken:80"}]}]},
+			{"match": [{"expression": "{http.request.uri.path}.startsWith('/health')"}], "handle": [{"handler": "static_response", "body": "OK"}]}
+		]}}},
+		"layer4": {"servers": {}}
+	}
+}`
+
+func TestImportHandler_ImportLive(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupImportTestDB(t)
+	assert.NoError(t, db.Create(&models.ProxyHost{UUID: uuid.NewString(), DomainNames: "taken.example.com", ForwardHost: "old", ForwardPort: 80}).Error)
+
+	caddyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/config/", r.URL.Path)
+		w.Write([]byte(liveCaddyConfig))
+	}))
+	defer caddyServer.Close()
+
+	handler := handlers.NewImportHandler(db, "echo", t.TempDir())
+	router := gin.New()
+	api := router.Group("/api/v1")
+	handler.RegisterRoutes(api)
+
+	send := func(method, path string, body interface{}) *httptest.ResponseRecorder {
+		raw, _ := json.Marshal(body)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest(method, "/api/v1"+path, bytes.NewBuffer(raw))
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	// Without an admin API there is nothing to read
+	assert.Equal(t, http.StatusServiceUnavailable, send("POST", "/import/live", nil).Code)
+
+	handler.SetCaddyClient(caddy.NewClient(caddyServer.URL))
+	w := send("POST", "/import/live", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+
+	w = send("GET", "/import/preview", nil)
+	assert.Equal(t, http.StatusOK, w.Code)
+	var preview struct {
+		Session          struct{ ID string }
+		Preview          caddy.ImportResult
+		CaddyfileContent string `json:"caddyfile_content"`
+	}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &preview))
+	assert.Len(t, preview.Preview.Hosts, 2)
+	assert.Equal(t, []string{"Domain 'taken.example.com' already exists in CPM+"}, preview.Preview.Conflicts)
+	assert.Equal(t, []string{"App 'layer4' is not supported and will not be imported"}, preview.Preview.Errors)
+	if assert.Len(t, preview.Preview.Passthrough, 1) {
+		assert.Equal(t, "srv0 route 2", preview.Preview.Passthrough[0].Name)
+	}
+	assert.JSONEq(t, liveCaddyConfig, preview.CaddyfileContent)
+
+	w = send("POST", "/import/commit", map[string]interface{}{
+		"session_uuid": preview.Session.ID,
+		"resolutions":  map[string]string{"taken.example.com": "skip"},
+	})
+	assert.Equal(t, http.StatusOK, w.Code)
+	var result map[string]interface{}
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.EqualValues(t, 1, result["created"])
+	assert.EqualValues(t, 1, result["skipped"])
+	assert.EqualValues(t, 1, result["passthrough"])
+
+	var raw models.RawRoute
+	assert.NoError(t, db.First(&raw).Error)
+	assert.JSONEq(t, `{"match": [{"expression": "{http.request.uri.path}.startsWith('/health')"}], "handle": [{"handler": "static_response", "body": "OK"}]}`, raw.Route)
+	assert.True(t, raw.Enabled)
+
+	// Adopting the same live config again doesn't duplicate the route
+	assert.Equal(t, http.StatusOK, send("POST", "/import/live", nil).Code)
+	w = send("GET", "/import/preview", nil)
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &preview))
+	w = send("POST", "/import/commit", map[string]interface{}{
+		"session_uuid": preview.Session.ID,
+		"resolutions":  map[string]string{"app.example.com": "skip", "taken.example.com": "skip"},
+	})
+	assert.Equal(t, http.StatusOK, w.Code)
+	result = nil
+	assert.NoError(t, json.Unmarshal(w.Body.Bytes(), &result))
+	assert.EqualValues(t, 0, result["passthrough"])
+	assert.EqualValues(t, 3, result["skipped"])
+	var count int64
+	db.Model(&models.RawRoute{}).Count(&count)
+	assert.EqualValues(t, 1, count)
+}
+
+func TestImportHandler_Upload_JSON(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db := setupImportTestDB(t)
+
+	// No caddy binary is needed for JSON
+	handler := handlers.NewImportHandler(db, "/nonexistent/caddy", t.TempDir())
+	router := gin.New()
+	router.POST("/import/upload", handler.Upload)
+
+	for _, payload := range []map[string]string{
+		{"content": liveCaddyConfig, "format": "json"},
+		{"content": liveCaddyConfig, "filename": "caddy.json"},
+	} {
+		body, _ := json.Marshal(payload)
+		w := httptest.NewRecorder()
+		req, _ := http.NewRequest("POST", "/import/upload", bytes.NewBuffer(body))
+		router.ServeHTTP(w, req)
+		assert.Equal(t, http.StatusOK, w.Code)
+	}
+
+	var count int64
+	db.Model(&models.ImportSession{}).Count(&count)
+	assert.EqualValues(t, 2, count)
+
+	// Invalid JSON is rejected
+	body, _ := json.Marshal(map[string]string{"content": "{invalid", "format": "json"})
+	w := httptest.NewRecorder()
+	req, _ := http.NewRequest("POST", "/import/upload", bytes.NewBuffer(body))
+	router.ServeHTTP(w, req)
+	assert.Equal(t, http.StatusBadRequest, w.Code)
+}
@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"errors"
+	"net"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/services"
+)
+
+// OnDemandHandler answers Caddy's on-demand TLS permission checks.
+type OnDemandHandler struct {
+	service *services.OnDemandService
+}
+
+// NewOnDemandHandler creates a new on-demand TLS handler.
+func NewOnDemandHandler(service *services.OnDemandService) *OnDemandHandler {
+	return &OnDemandHandler{service: service}
+}
+
+// Ask is called by Caddy with ?domain=<name> before it obtains a certificate.
+// Any 2xx response approves issuance. The endpoint is unauthenticated,
+// so it only answers requests from loopback or private networks.
+func (h *OnDemandHandler) Ask(c *gin.Context) {
+	ip := net.ParseIP(c.ClientIP())
+	if ip == nil || !(ip.IsLoopback() || ip.IsPrivate()) {
+		c.JSON(http.StatusForbidden, gin.H{"error": "forbidden"})
+		return
+	}
+
+	domain := c.Query("domain")
+	if domain == "" {
+		c.JSON(http.StatusBadRequest, gin.H{"error": "domain required"})
+		return
+	}
+
+	allowed, err := h.service.Check(domain)
+	if errors.Is(err, services.ErrOnDemandRateLimited) {
+		c.JSON(http.StatusTooManyRequests, gin.H{"error": err.Error()})
+		return
+	}
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if !allowed {
+		c.JSON(http.StatusNotFound, gin.H{"error": "domain not allowed"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{"domain": domain, "allowed": true})
+}
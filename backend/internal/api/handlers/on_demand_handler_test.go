@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/models"
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/services"
+)
+
+func setupOnDemandTestRouter(t *testing.T) (*gin.Engine, *gorm.DB) {
+	t.Helper()
+
+	dsn := "file:" + t.Name() + "?mode=memory&cache=shared"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.ProxyHost{}, &models.Domain{}, &models.Setting{}))
+
+	h := NewOnDemandHandler(services.NewOnDemandService(db))
+	r := gin.New()
+	r.GET("/api/v1/tls/ask", h.Ask)
+
+	return r, db
+}
+
+func TestOnDemandHandler_Ask(t *testing.T) {
+	router, db := setupOnDemandTestRouter(t)
+	require.NoError(t, db.Create(&models.Domain{Name: "vanity.customer.com"}).Error)
+	require.NoError(t, db.Create(&models.Setting{Key: "caddy.on_demand_interval", Value: "1h"}).Error)
+	require.NoError(t, db.Create(&models.Setting{Key: "caddy.on_demand_burst", Value: "1"}).Error)
+
+	ask := func(query, remoteAddr string) int {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/tls/ask"+query, nil)
+		req.RemoteAddr = remoteAddr
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp.Code
+	}
+
+	require.Equal(t, http.StatusForbidden, ask("?domain=vanity.customer.com", "203.0.113.9:5000"))
+	require.Equal(t, http.StatusBadRequest, ask("", "127.0.0.1:5000"))
+	require.Equal(t, http.StatusNotFound, ask("?domain=unknown.com", "127.0.0.1:5000"))
+	require.Equal(t, http.StatusOK, ask("?domain=vanity.customer.com", "127.0.0.1:5000"))
+	require.Equal(t, http.StatusTooManyRequests, ask("?domain=vanity.customer.com", "10.0.0.5:5000"))
+}
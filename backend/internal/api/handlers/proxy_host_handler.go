@@ -1,9 +1,12 @@
 package handlers
 
 import (
+	"context"
+	"errors"
 	"net/http"
 
 	"github.com/gin-gonic/gin"
+	"github.com/gin-gonic/gin/binding"
 	"github.com/google/uuid"
 	"gorm.io/gorm"
 
@@ -16,6 +19,7 @@ import (
 type ProxyHostHandler struct {
 	service      *services.ProxyHostService
 	caddyManager *caddy.Manager
+	applyQueue   *caddy.ApplyQueue
 }
 
 // NewProxyHostHandler creates a new proxy host handler.
@@ -26,6 +30,11 @@ func NewProxyHostHandler(db *gorm.DB, caddyManager *caddy.Manager) *ProxyHostHan
 	}
 }
 
+// SetApplyQueue makes changes apply through queue instead of calling the manager directly.
+func (h *ProxyHostHandler) SetApplyQueue(queue *caddy.ApplyQueue) {
+	h.applyQueue = queue
+}
+
 // RegisterRoutes registers proxy host routes.
 func (h *ProxyHostHandler) RegisterRoutes(router *gin.RouterGroup) {
 	router.GET("/proxy-hosts", h.List)
@@ -34,6 +43,10 @@ func (h *ProxyHostHandler) RegisterRoutes(router *gin.RouterGroup) {
 	router.PUT("/proxy-hosts/:uuid", h.Update)
 	router.DELETE("/proxy-hosts/:uuid", h.Delete)
 	router.POST("/proxy-hosts/test", h.TestConnection)
+	router.POST("/proxy-hosts/plan", h.Plan)
+	router.GET("/proxy-hosts/:uuid/split", h.GetSplit)
+	router.PUT("/proxy-hosts/:uuid/split", h.UpdateSplit)
+	router.GET("/proxy-hosts/:uuid/split/history", h.SplitHistory)
 }
 
 // List retrieves all proxy hosts.
@@ -55,6 +68,11 @@ func (h *ProxyHostHandler) Create(c *gin.Context) {
 		return
 	}
 
+	if err := h.validateStaticRoot(&host); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
 	host.UUID = uuid.NewString()
 
 	// Assign UUIDs to locations
@@ -67,14 +85,184 @@ func (h *ProxyHostHandler) Create(c *gin.Context) {
 		return
 	}
 
+	h.respondAfterApply(c, hostChange{
+		host:   &host,
+		reason: "create proxy host " + host.DomainNames,
+		revert: func() error { return h.service.Purge(host.ID) },
+	}, http.StatusCreated, host)
+}
+
+// hostChange is a saved change to a proxy host awaiting its config apply.
+type hostChange struct {
+	host   *models.ProxyHost
+	reason string
+	revert func() error // Undoes the change in the database, nil when it is kept
+}
+
+// respondAfterApply applies the config after a change, then responds with
+// status and result. When the config is not applied because of the change,
+// it is reverted so that the database keeps matching Caddy, and the response
+// names the host at fault. With the apply queue enabled, the queue worker
+// reverts failed changes in order, and ?async=true requests get 202 with the
+// apply job instead of waiting for it.
+func (h *ProxyHostHandler) respondAfterApply(c *gin.Context, change hostChange, status int, result interface{}) {
+	if h.caddyManager == nil {
+		c.JSON(status, result)
+		return
+	}
+
+	info := caddy.ApplyInfo{UserID: requestUserID(c), Reason: change.reason}
+	if h.applyQueue == nil {
+		err := h.caddyManager.ApplyConfig(caddy.WithApplyInfo(c.Request.Context(), info))
+		if err == nil {
+			c.JSON(status, result)
+			return
+		}
+		body := h.applyErrorBody(change, err)
+		if change.revert != nil {
+			if revertErr := change.revert(); revertErr != nil {
+				body["revert_error"] = revertErr.Error()
+			} else {
+				body["reverted"] = true
+			}
+		}
+		c.JSON(applyErrorStatus(err), body)
+		return
+	}
+
+	job := h.applyQueue.EnqueueChange(info, caddy.HostChange{HostUUID: change.host.UUID, Revert: change.revert})
+	if c.Query("async") == "true" {
+		c.JSON(http.StatusAccepted, gin.H{"job": job, "result": result})
+		return
+	}
+
+	err := h.applyQueue.Wait(c.Request.Context(), job.ID)
+	if err == nil {
+		c.JSON(status, result)
+		return
+	}
+	if c.Request.Context().Err() != nil {
+		// The job is still queued, the client can follow it up
+		c.JSON(http.StatusAccepted, gin.H{"job": job, "result": result})
+		return
+	}
+
+	body := h.applyErrorBody(change, err)
+	if job, jobErr := h.applyQueue.Job(job.ID); jobErr == nil {
+		if job.Reverted {
+			body["reverted"] = true
+		}
+		if job.RevertError != "" {
+			body["revert_error"] = job.RevertError
+		}
+	}
+	c.JSON(applyErrorStatus(err), body)
+}
+
+// applyErrorBody describes a failed apply, naming the host at fault.
+func (h *ProxyHostHandler) applyErrorBody(change hostChange, err error) gin.H {
+	body := gin.H{"error": "Failed to apply configuration: " + err.Error()}
+	faulty := change.host
+	var applyErr *caddy.ApplyError
+	if errors.As(err, &applyErr) {
+		body["stage"] = applyErr.Stage
+		if applyErr.HostUUID != "" && applyErr.HostUUID != change.host.UUID {
+			faulty = &models.ProxyHost{UUID: applyErr.HostUUID}
+			if other, err := h.service.GetByUUID(applyErr.HostUUID); err == nil {
+				faulty = other
+			}
+		}
+	}
+	body["host"] = gin.H{"uuid": faulty.UUID, "domain_names": faulty.DomainNames}
+	return body
+}
+
+// applyErrorStatus is 400 for configs rejected before loading, 500 otherwise.
+func applyErrorStatus(err error) int {
+	var applyErr *caddy.ApplyError
+	if errors.As(err, &applyErr) && applyErr.Stage != caddy.ApplyStageLoad {
+		return http.StatusBadRequest
+	}
+	return http.StatusInternalServerError
+}
+
+// applyContext records who triggered a config apply and why in the history.
+func applyContext(c *gin.Context, reason string) context.Context {
+	return caddy.WithApplyInfo(c.Request.Context(), caddy.ApplyInfo{UserID: requestUserID(c), Reason: reason})
+}
+
+// requestUserID returns the authenticated user's ID, 0 when unauthenticated.
+func requestUserID(c *gin.Context) uint {
+	userID, _ := c.Get("userID")
+	id, _ := userID.(uint)
+	return id
+}
+
+// validateStaticRoot rejects static hosts serving files outside the allowed base directory.
+func (h *ProxyHostHandler) validateStaticRoot(host *models.ProxyHost) error {
+	if host.HostType != models.HostTypeStatic {
+		return nil
+	}
+
+	baseDir := caddy.DefaultStaticBaseDir
 	if h.caddyManager != nil {
-		if err := h.caddyManager.ApplyConfig(c.Request.Context()); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to apply configuration: " + err.Error()})
+		baseDir = h.caddyManager.StaticBaseDir()
+	}
+	return caddy.ValidateStaticRoot(host.StaticRoot, baseDir)
+}
+
+// Plan previews the config that would be applied without saving or
+// loading anything. With a host in the body, the plan includes it as if it
+// were created, or updated when its UUID matches an existing host.
+func (h *ProxyHostHandler) Plan(c *gin.Context) {
+	if h.caddyManager == nil {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"error": "caddy manager not configured"})
+		return
+	}
+
+	var proposed *models.ProxyHost
+	if c.Request.ContentLength != 0 {
+		var target struct {
+			UUID string `json:"uuid"`
+		}
+		if err := c.ShouldBindBodyWith(&target, binding.JSON); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 			return
 		}
+
+		// Like Update, the payload is bound onto the stored host, so
+		// omitted fields keep their values. New hosts get Create's defaults.
+		existing := false
+		proposed = &models.ProxyHost{}
+		if target.UUID != "" {
+			if host, err := h.service.GetByUUID(target.UUID); err == nil {
+				proposed, existing = host, true
+			}
+		}
+		if err := c.ShouldBindBodyWith(proposed, binding.JSON); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+		if !existing {
+			if err := h.service.ApplyDefaults(proposed); err != nil {
+				c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+				return
+			}
+		}
+
+		if err := h.service.ValidateUniqueDomain(proposed.DomainNames, proposed.CanonicalHost, proposed.ID); err != nil {
+			c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+			return
+		}
+	}
+
+	plan, err := h.caddyManager.Plan(c.Request.Context(), proposed)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
-	c.JSON(http.StatusCreated, host)
+	c.JSON(http.StatusOK, plan)
 }
 
 // Get retrieves a proxy host by UUID.
@@ -99,25 +287,32 @@ func (h *ProxyHostHandler) Update(c *gin.Context) {
 		c.JSON(http.StatusNotFound, gin.H{"error": "proxy host not found"})
 		return
 	}
+	previous, err := h.service.GetByUUID(uuid)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
 
 	if err := c.ShouldBindJSON(host); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	if err := h.service.Update(host); err != nil {
+	if err := h.validateStaticRoot(host); err != nil {
 		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
 		return
 	}
 
-	if h.caddyManager != nil {
-		if err := h.caddyManager.ApplyConfig(c.Request.Context()); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to apply configuration: " + err.Error()})
-			return
-		}
+	if err := h.service.Update(host); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
 	}
 
-	c.JSON(http.StatusOK, host)
+	h.respondAfterApply(c, hostChange{
+		host:   host,
+		reason: "update proxy host " + host.DomainNames,
+		revert: func() error { return h.service.Restore(previous) },
+	}, http.StatusOK, host)
 }
 
 // Delete removes a proxy host.
@@ -135,14 +330,85 @@ func (h *ProxyHostHandler) Delete(c *gin.Context) {
 		return
 	}
 
-	if h.caddyManager != nil {
-		if err := h.caddyManager.ApplyConfig(c.Request.Context()); err != nil {
-			c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to apply configuration: " + err.Error()})
-			return
-		}
+	h.respondAfterApply(c, hostChange{
+		host:   host,
+		reason: "delete proxy host " + host.DomainNames,
+		revert: func() error { return h.service.Restore(host) },
+	}, http.StatusOK, gin.H{"message": "proxy host deleted"})
+}
+
+// GetSplit returns the traffic split of a proxy host.
+func (h *ProxyHostHandler) GetSplit(c *gin.Context) {
+	host, err := h.service.GetByUUID(c.Param("uuid"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "proxy host not found"})
+		return
+	}
+
+	c.JSON(http.StatusOK, gin.H{
+		"groups":          host.UpstreamGroups,
+		"sticky_cookie":   host.SplitStickyCookie,
+		"override_header": host.SplitOverrideHeader,
+	})
+}
+
+// UpdateSplit replaces the upstream groups and weights of a proxy host.
+func (h *ProxyHostHandler) UpdateSplit(c *gin.Context) {
+	host, err := h.service.GetByUUID(c.Param("uuid"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "proxy host not found"})
+		return
+	}
+
+	var req services.TrafficSplitUpdate
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := caddy.ValidateUpstreamGroups(req.Groups, req.StickyCookie, req.OverrideHeader); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	// Loaded apart from host, which the update modifies
+	previous, err := h.service.GetByUUID(host.UUID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	if err := h.service.UpdateTrafficSplit(host, req, requestUserID(c)); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.respondAfterApply(c, hostChange{
+		host:   host,
+		reason: "update traffic split of " + host.DomainNames,
+		revert: func() error { return h.service.Restore(previous) },
+	}, http.StatusOK, gin.H{
+		"groups":          host.UpstreamGroups,
+		"sticky_cookie":   req.StickyCookie,
+		"override_header": req.OverrideHeader,
+	})
+}
+
+// SplitHistory returns the traffic split audit trail of a proxy host.
+func (h *ProxyHostHandler) SplitHistory(c *gin.Context) {
+	host, err := h.service.GetByUUID(c.Param("uuid"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "proxy host not found"})
+		return
+	}
+
+	changes, err := h.service.ListTrafficSplitChanges(host.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "proxy host deleted"})
+	c.JSON(http.StatusOK, changes)
 }
 
 // TestConnection checks if the proxy host is reachable.
@@ -1,13 +1,16 @@
 package handlers
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"net/http/httptest"
 	"strings"
 	"testing"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
@@ -25,7 +28,7 @@ func setupTestRouter(t *testing.T) (*gin.Engine, *gorm.DB) {
 	dsn := "file:" + t.Name() + "?mode=memory&cache=shared"
 	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
 	require.NoError(t, err)
-	require.NoError(t, db.AutoMigrate(&models.ProxyHost{}, &models.Location{}))
+	require.NoError(t, db.AutoMigrate(&models.ProxyHost{}, &models.Location{}, &models.UpstreamGroup{}, &models.TrafficSplitChange{}))
 
 	h := NewProxyHostHandler(db, nil)
 	r := gin.New()
@@ -106,7 +109,7 @@ func TestProxyHostErrors(t *testing.T) {
 	dsn := "file:" + t.Name() + "?mode=memory&cache=shared"
 	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
 	require.NoError(t, err)
-	require.NoError(t, db.AutoMigrate(&models.ProxyHost{}, &models.Location{}, &models.Setting{}, &models.CaddyConfig{}))
+	require.NoError(t, db.AutoMigrate(&models.ProxyHost{}, &models.Location{}, &models.UpstreamGroup{}, &models.AccessList{}, &models.Setting{}, &models.CaddyConfig{}))
 
 	// Setup Caddy Manager
 	tmpDir := t.TempDir()
@@ -279,7 +282,7 @@ func TestProxyHostWithCaddyIntegration(t *testing.T) {
 	dsn := "file:" + t.Name() + "?mode=memory&cache=shared"
 	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
 	require.NoError(t, err)
-	require.NoError(t, db.AutoMigrate(&models.ProxyHost{}, &models.Location{}, &models.Setting{}, &models.CaddyConfig{}))
+	require.NoError(t, db.AutoMigrate(&models.ProxyHost{}, &models.Location{}, &models.UpstreamGroup{}, &models.AccessList{}, &models.Setting{}, &models.CaddyConfig{}))
 
 	// Setup Caddy Manager
 	tmpDir := t.TempDir()
@@ -319,3 +322,316 @@ func TestProxyHostWithCaddyIntegration(t *testing.T) {
 	r.ServeHTTP(resp, req)
 	require.Equal(t, http.StatusOK, resp.Code)
 }
+
+func TestProxyHostTrafficSplit(t *testing.T) {
+	router, db := setupTestRouter(t)
+
+	host := models.ProxyHost{UUID: uuid.NewString(), DomainNames: "split.example.com", ForwardHost: "app", ForwardPort: 8080, Enabled: true}
+	require.NoError(t, db.Create(&host).Error)
+
+	put := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/api/v1/proxy-hosts/"+host.UUID+"/split", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		router.ServeHTTP(resp, req)
+		return resp
+	}
+
+	// Weights must add up to 100
+	resp := put(`{"groups":[{"name":"stable","forward_host":"v1","forward_port":80,"weight":90}]}`)
+	require.Equal(t, http.StatusBadRequest, resp.Code)
+
+	resp = put(`{"groups":[{"name":"stable","forward_host":"v1","forward_port":80,"weight":95},{"name":"canary","forward_host":"v2","forward_port":80,"weight":5}],"override_header":"X-Upstream-Group","reason":"canary 5%"}`)
+	require.Equal(t, http.StatusOK, resp.Code)
+
+	resp = put(`{"groups":[{"name":"stable","forward_host":"v1","forward_port":80,"weight":50},{"name":"canary","forward_host":"v2","forward_port":80,"weight":50}],"override_header":"X-Upstream-Group","reason":"canary 50%"}`)
+	require.Equal(t, http.StatusOK, resp.Code)
+
+	getReq := httptest.NewRequest(http.MethodGet, "/api/v1/proxy-hosts/"+host.UUID+"/split", nil)
+	getResp := httptest.NewRecorder()
+	router.ServeHTTP(getResp, getReq)
+	require.Equal(t, http.StatusOK, getResp.Code)
+
+	var split struct {
+		Groups         []models.UpstreamGroup `json:"groups"`
+		OverrideHeader string                 `json:"override_header"`
+	}
+	require.NoError(t, json.Unmarshal(getResp.Body.Bytes(), &split))
+	require.Len(t, split.Groups, 2)
+	require.Equal(t, 50, split.Groups[1].Weight)
+	require.Equal(t, "X-Upstream-Group", split.OverrideHeader)
+
+	histReq := httptest.NewRequest(http.MethodGet, "/api/v1/proxy-hosts/"+host.UUID+"/split/history", nil)
+	histResp := httptest.NewRecorder()
+	router.ServeHTTP(histResp, histReq)
+	require.Equal(t, http.StatusOK, histResp.Code)
+
+	var history []models.TrafficSplitChange
+	require.NoError(t, json.Unmarshal(histResp.Body.Bytes(), &history))
+	require.Len(t, history, 2)
+	require.Equal(t, "canary 50%", history[0].Reason)
+
+	notFound := httptest.NewRequest(http.MethodGet, "/api/v1/proxy-hosts/missing/split", nil)
+	notFoundResp := httptest.NewRecorder()
+	router.ServeHTTP(notFoundResp, notFound)
+	require.Equal(t, http.StatusNotFound, notFoundResp.Code)
+}
+
+func TestProxyHostStaticRootValidation(t *testing.T) {
+	router, _ := setupTestRouter(t)
+
+	body := `{"domain_names":"spa.example.com","host_type":"static","static_root":"/etc","enabled":true}`
+	req := httptest.NewRequest(http.MethodPost, "/api/v1/proxy-hosts", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp := httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	require.Equal(t, http.StatusBadRequest, resp.Code)
+	require.Contains(t, resp.Body.String(), "outside the allowed base directory")
+
+	body = `{"domain_names":"spa.example.com","host_type":"static","static_root":"/srv/spa","static_spa_fallback":true,"enabled":true}`
+	req = httptest.NewRequest(http.MethodPost, "/api/v1/proxy-hosts", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	resp = httptest.NewRecorder()
+	router.ServeHTTP(resp, req)
+	require.Equal(t, http.StatusCreated, resp.Code)
+
+	var created models.ProxyHost
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &created))
+	require.Equal(t, models.HostTypeStatic, created.HostType)
+
+	updateBody := `{"domain_names":"spa.example.com","host_type":"static","static_root":"/srv/../root","enabled":true}`
+	updateReq := httptest.NewRequest(http.MethodPut, "/api/v1/proxy-hosts/"+created.UUID, strings.NewReader(updateBody))
+	updateReq.Header.Set("Content-Type", "application/json")
+	updateResp := httptest.NewRecorder()
+	router.ServeHTTP(updateResp, updateReq)
+	require.Equal(t, http.StatusBadRequest, updateResp.Code)
+}
+
+func TestProxyHostPlan(t *testing.T) {
+	caddyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/config/" {
+			w.Write([]byte(`{"apps": {}}`))
+			return
+		}
+		t.Errorf("unexpected request to %s", r.URL.Path)
+		w.WriteHeader(http.StatusInternalServerError)
+	}))
+	defer caddyServer.Close()
+
+	dsn := "file:" + t.Name() + "?mode=memory&cache=shared"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.ProxyHost{}, &models.Location{}, &models.UpstreamGroup{}, &models.AccessList{}, &models.Setting{}, &models.CaddyConfig{}))
+	require.NoError(t, db.Create(&models.ProxyHost{
+		UUID: "uuid-app", DomainNames: "app.example.com", ForwardHost: "app", ForwardPort: 80,
+		Locations: []models.Location{{UUID: "uuid-loc", Path: "/api", ForwardHost: "api", ForwardPort: 9000}},
+	}).Error)
+
+	manager := caddy.NewManager(caddy.NewClient(caddyServer.URL), db, t.TempDir())
+	h := NewProxyHostHandler(db, manager)
+	r := gin.New()
+	h.RegisterRoutes(r.Group("/api/v1"))
+
+	plan := func(body string) (int, caddy.Plan) {
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/proxy-hosts/plan", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		var p caddy.Plan
+		json.Unmarshal(resp.Body.Bytes(), &p)
+		return resp.Code, p
+	}
+
+	code, p := plan("")
+	require.Equal(t, http.StatusOK, code)
+	require.True(t, p.Valid)
+	require.Nil(t, p.SnapshotDiff)
+	require.Equal(t, "app.example.com", p.LiveDiff.Hosts[len(p.LiveDiff.Hosts)-1].Host)
+
+	// A new host gets Create's defaults, so it is enabled without "enabled"
+	code, p = plan(`{"domain_names":"new.example.com","forward_host":"new","forward_port":80}`)
+	require.Equal(t, http.StatusOK, code)
+	require.Len(t, p.Config.Apps.HTTP.Servers["cpm_server"].Routes, 3)
+
+	// Updating the existing host does not conflict with itself, and fields
+	// left out of the payload keep their stored values, like its location
+	code, p = plan(`{"uuid":"uuid-app","forward_port":9000}`)
+	require.Equal(t, http.StatusOK, code)
+	routes := p.Config.Apps.HTTP.Servers["cpm_server"].Routes
+	require.Len(t, routes, 2)
+	raw, err := json.Marshal(routes)
+	require.NoError(t, err)
+	require.Contains(t, string(raw), `"dial":"api:9000"`)
+	require.Contains(t, string(raw), `"dial":"app:9000"`)
+
+	code, _ = plan(`{"domain_names":"app.example.com","forward_host":"dup","forward_port":80,"enabled":true}`)
+	require.Equal(t, http.StatusBadRequest, code)
+
+	// Nothing was saved
+	var count int64
+	db.Model(&models.ProxyHost{}).Count(&count)
+	require.Equal(t, int64(1), count)
+}
+
+func TestProxyHostRevertOnRejectedConfig(t *testing.T) {
+	// Fake admin API rejecting any config that routes to bad.example.com
+	var current []byte
+	caddyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), "bad.example.com") {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error": "loading new config: http app module: start: listening on :443: address already in use"}`))
+			return
+		}
+		current = body
+	}))
+	defer caddyServer.Close()
+
+	dsn := "file:" + t.Name() + "?mode=memory&cache=shared"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.ProxyHost{}, &models.Location{}, &models.UpstreamGroup{}, &models.AccessList{}, &models.Setting{}, &models.CaddyConfig{}))
+
+	manager := caddy.NewManager(caddy.NewClient(caddyServer.URL), db, t.TempDir())
+	r := gin.New()
+	NewProxyHostHandler(db, manager).RegisterRoutes(r.Group("/api/v1"))
+
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/v1"+path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		return resp
+	}
+	type failure struct {
+		Error    string `json:"error"`
+		Stage    string `json:"stage"`
+		Reverted bool   `json:"reverted"`
+		Host     struct {
+			UUID        string `json:"uuid"`
+			DomainNames string `json:"domain_names"`
+		} `json:"host"`
+	}
+	countHosts := func() int64 {
+		var count int64
+		db.Model(&models.ProxyHost{}).Count(&count)
+		return count
+	}
+
+	resp := send(http.MethodPost, "/proxy-hosts", `{"domain_names": "app.example.com", "forward_host": "app", "forward_port": 80, "locations": [{"path": "/api", "forward_host": "api", "forward_port": 8080}]}`)
+	require.Equal(t, http.StatusCreated, resp.Code)
+	var app models.ProxyHost
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &app))
+
+	// Rejected create leaves nothing behind
+	resp = send(http.MethodPost, "/proxy-hosts", `{"domain_names": "bad.example.com", "forward_host": "bad", "forward_port": 80, "locations": [{"path": "/x", "forward_host": "x", "forward_port": 80}]}`)
+	require.Equal(t, http.StatusInternalServerError, resp.Code)
+	var fail failure
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &fail))
+	require.Equal(t, caddy.ApplyStageLoad, fail.Stage)
+	require.Equal(t, "bad.example.com", fail.Host.DomainNames)
+	require.True(t, fail.Reverted)
+	require.Contains(t, fail.Error, "address already in use")
+	require.Equal(t, int64(1), countHosts())
+	var locations int64
+	db.Model(&models.Location{}).Count(&locations)
+	require.Equal(t, int64(1), locations)
+
+	// ...so the next change still applies
+	require.Equal(t, http.StatusCreated, send(http.MethodPost, "/proxy-hosts", `{"domain_names": "ok.example.com", "forward_host": "ok", "forward_port": 80}`).Code)
+	require.Equal(t, int64(2), countHosts())
+
+	// Rejected update restores the host and its locations
+	resp = send(http.MethodPut, "/proxy-hosts/"+app.UUID, `{"domain_names": "bad.example.com", "forward_host": "other", "forward_port": 81, "block_exploits": false, "locations": []}`)
+	require.Equal(t, http.StatusInternalServerError, resp.Code)
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &fail))
+	require.Equal(t, app.UUID, fail.Host.UUID)
+	require.True(t, fail.Reverted)
+	var restored models.ProxyHost
+	require.NoError(t, db.Preload("Locations").Where("uuid = ?", app.UUID).First(&restored).Error)
+	require.Equal(t, "app.example.com", restored.DomainNames)
+	require.Equal(t, "app", restored.ForwardHost)
+	require.True(t, restored.BlockExploits)
+	require.Len(t, restored.Locations, 1)
+
+	// Deleting the host Caddy rejects is accepted
+	require.NoError(t, db.Model(&models.ProxyHost{}).Where("id = ?", app.ID).Update("forward_host", "bad.example.com").Error)
+	current = nil
+	resp = send(http.MethodDelete, "/proxy-hosts/"+app.UUID, "")
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.NotContains(t, string(current), "bad.example.com")
+
+	// Rejected delete puts the host back
+
+	resp = send(http.MethodPost, "/proxy-hosts", `{"domain_names": "app.example.com", "forward_host": "app", "forward_port": 80}`)
+	require.Equal(t, http.StatusCreated, resp.Code)
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &app))
+	require.NoError(t, db.Create(&models.ProxyHost{UUID: uuid.NewString(), DomainNames: "bad.example.com", ForwardHost: "bad", ForwardPort: 80}).Error)
+	resp = send(http.MethodDelete, "/proxy-hosts/"+app.UUID, "")
+	require.Equal(t, http.StatusInternalServerError, resp.Code)
+	require.NoError(t, db.Where("uuid = ?", app.UUID).First(&models.ProxyHost{}).Error)
+
+	// Generation errors name the host and are the client's fault
+	resp = send(http.MethodPost, "/proxy-hosts", `{"domain_names": "typo.example.com", "forward_host": "app", "forward_port": 80, "canonical_host": "bogus"}`)
+	require.Equal(t, http.StatusBadRequest, resp.Code)
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &fail))
+	require.Equal(t, caddy.ApplyStageGenerate, fail.Stage)
+	require.Equal(t, "typo.example.com", fail.Host.DomainNames)
+	require.True(t, fail.Reverted)
+}
+
+func TestProxyHostSplitRevertOnRejectedConfig(t *testing.T) {
+	// Fake admin API rejecting any config that routes to bad.example.com
+	caddyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), "bad.example.com") {
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write([]byte(`{"error": "loading new config: dial bad.example.com: no such host"}`))
+		}
+	}))
+	defer caddyServer.Close()
+
+	dsn := "file:" + t.Name() + "?mode=memory&cache=shared"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.ProxyHost{}, &models.Location{}, &models.UpstreamGroup{}, &models.TrafficSplitChange{}, &models.AccessList{}, &models.Setting{}, &models.CaddyConfig{}))
+
+	manager := caddy.NewManager(caddy.NewClient(caddyServer.URL), db, t.TempDir())
+	queue := caddy.NewApplyQueue(manager, time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go queue.Run(ctx)
+
+	handler := NewProxyHostHandler(db, manager)
+	handler.SetApplyQueue(queue)
+	r := gin.New()
+	handler.RegisterRoutes(r.Group("/api/v1"))
+
+	host := models.ProxyHost{UUID: uuid.NewString(), DomainNames: "split.example.com", ForwardHost: "app", ForwardPort: 8080, Enabled: true}
+	require.NoError(t, db.Create(&host).Error)
+	put := func(body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPut, "/api/v1/proxy-hosts/"+host.UUID+"/split", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		return resp
+	}
+
+	resp := put(`{"groups":[{"name":"stable","forward_host":"v1","forward_port":80,"weight":95},{"name":"canary","forward_host":"v2","forward_port":80,"weight":5}]}`)
+	require.Equal(t, http.StatusOK, resp.Code)
+
+	// Rejected split is undone by the queue worker
+	resp = put(`{"groups":[{"name":"stable","forward_host":"v1","forward_port":80,"weight":50},{"name":"canary","forward_host":"bad.example.com","forward_port":80,"weight":50}]}`)
+	require.Equal(t, http.StatusInternalServerError, resp.Code)
+	var fail struct {
+		Reverted bool `json:"reverted"`
+	}
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &fail))
+	require.True(t, fail.Reverted)
+
+	var groups []models.UpstreamGroup
+	require.NoError(t, db.Where("proxy_host_id = ?", host.ID).Order("name ASC").Find(&groups).Error)
+	require.Len(t, groups, 2)
+	require.Equal(t, "v2", groups[0].ForwardHost)
+	require.Equal(t, 5, groups[0].Weight)
+}
@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"gorm.io/gorm"
+
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/caddy"
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/models"
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/services"
+)
+
+// RawRouteHandler handles HTTP requests for routes adopted verbatim from an
+// existing Caddy config.
+type RawRouteHandler struct {
+	service      *services.RawRouteService
+	caddyManager *caddy.Manager
+}
+
+// NewRawRouteHandler creates a new raw route handler.
+func NewRawRouteHandler(db *gorm.DB, caddyManager *caddy.Manager) *RawRouteHandler {
+	return &RawRouteHandler{
+		service:      services.NewRawRouteService(db),
+		caddyManager: caddyManager,
+	}
+}
+
+// RegisterRoutes registers raw route routes.
+func (h *RawRouteHandler) RegisterRoutes(router *gin.RouterGroup) {
+	router.GET("/raw-routes", h.List)
+	router.POST("/raw-routes", h.Create)
+	router.GET("/raw-routes/:uuid", h.Get)
+	router.PUT("/raw-routes/:uuid", h.Update)
+	router.DELETE("/raw-routes/:uuid", h.Delete)
+}
+
+// List retrieves all raw routes.
+func (h *RawRouteHandler) List(c *gin.Context) {
+	routes, err := h.service.List()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	c.JSON(http.StatusOK, routes)
+}
+
+// Create adds a raw route and applies the config.
+func (h *RawRouteHandler) Create(c *gin.Context) {
+	var route models.RawRoute
+	if err := c.ShouldBindJSON(&route); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+
+	route.UUID = uuid.NewString()
+	if err := h.service.Create(&route); err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	h.respondAfterApply(c, "create raw route "+route.Name, func() error { return h.service.Delete(route.ID) }, http.StatusCreated, route)
+}
+
+// Get retrieves a raw route by UUID.
+func (h *RawRouteHandler) Get(c *gin.Context) {
+	route, ok := h.route(c)
+	if !ok {
+		return
+	}
+
+	c.JSON(http.StatusOK, route)
+}
+
+// Update changes a raw route, e.g. to disable it, and applies the config.
+func (h *RawRouteHandler) Update(c *gin.Context) {
+	route, ok := h.route(c)
+	if !ok {
+		return
+	}
+	previous := *route
+
+	if err := c.ShouldBindJSON(route); err != nil {
+		c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+		return
+	}
+	route.ID, route.UUID = previous.ID, previous.UUID
+
+	if err := h.service.Update(route); err != nil {
+		h.respondError(c, err)
+		return
+	}
+
+	h.respondAfterApply(c, "update raw route "+route.Name, func() error { return h.service.Update(&previous) }, http.StatusOK, route)
+}
+
+// Delete removes a raw route and applies the config.
+func (h *RawRouteHandler) Delete(c *gin.Context) {
+	route, ok := h.route(c)
+	if !ok {
+		return
+	}
+
+	if err := h.service.Delete(route.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, gin.H{"error": err.Error()})
+		return
+	}
+
+	h.respondAfterApply(c, "delete raw route "+route.Name, func() error { return h.service.Create(route) }, http.StatusOK, gin.H{"message": "Raw route deleted"})
+}
+
+// respondAfterApply applies the config after a change, reverting the change
+// when Caddy doesn't take it so that the database keeps matching Caddy.
+func (h *RawRouteHandler) respondAfterApply(c *gin.Context, reason string, revert func() error, status int, result interface{}) {
+	if h.caddyManager == nil {
+		c.JSON(status, result)
+		return
+	}
+
+	err := h.caddyManager.ApplyConfig(applyContext(c, reason))
+	if err == nil {
+		c.JSON(status, result)
+		return
+	}
+
+	body := gin.H{"error": "Failed to apply configuration: " + err.Error()}
+	var applyErr *caddy.ApplyError
+	if errors.As(err, &applyErr) {
+		body["stage"] = applyErr.Stage
+	}
+	if revertErr := revert(); revertErr != nil {
+		body["revert_error"] = revertErr.Error()
+	} else {
+		body["reverted"] = true
+	}
+	c.JSON(applyErrorStatus(err), body)
+}
+
+// respondError reports a rejected raw route, 409 when it is a duplicate.
+func (h *RawRouteHandler) respondError(c *gin.Context, err error) {
+	if errors.Is(err, services.ErrRawRouteExists) {
+		c.JSON(http.StatusConflict, gin.H{"error": err.Error()})
+		return
+	}
+	c.JSON(http.StatusBadRequest, gin.H{"error": err.Error()})
+}
+
+// route loads the raw route named by the :uuid parameter, responding 404 when missing.
+func (h *RawRouteHandler) route(c *gin.Context) (*models.RawRoute, bool) {
+	route, err := h.service.GetByUUID(c.Param("uuid"))
+	if err != nil {
+		c.JSON(http.StatusNotFound, gin.H{"error": "raw route not found"})
+		return nil, false
+	}
+	return route, true
+}
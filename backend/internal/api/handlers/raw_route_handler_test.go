@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/caddy"
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/models"
+)
+
+func TestRawRouteHandler(t *testing.T) {
+	// Fake admin API rejecting any config that routes to bad.example.com
+	var current string
+	caddyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if strings.Contains(string(body), "bad.example.com") {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		current = string(body)
+	}))
+	defer caddyServer.Close()
+
+	dsn := "file:" + t.Name() + "?mode=memory&cache=shared"
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.ProxyHost{}, &models.Location{}, &models.UpstreamGroup{}, &models.AccessList{}, &models.Setting{}, &models.CaddyConfig{}, &models.RawRoute{}))
+
+	manager := caddy.NewManager(caddy.NewClient(caddyServer.URL), db, t.TempDir())
+	gin.SetMode(gin.TestMode)
+	r := gin.New()
+	NewRawRouteHandler(db, manager).RegisterRoutes(r.Group("/api/v1"))
+
+	send := func(method, path, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, "/api/v1"+path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		resp := httptest.NewRecorder()
+		r.ServeHTTP(resp, req)
+		return resp
+	}
+	countRoutes := func() int64 {
+		var count int64
+		db.Model(&models.RawRoute{}).Count(&count)
+		return count
+	}
+
+	resp := send(http.MethodPost, "/raw-routes", `{"name": "health", "route": "{\"match\": [{\"host\": [\"health.example.com\"]}], \"handle\": [{\"handler\": \"static_response\", \"body\": \"OK\"}]}"}`)
+	require.Equal(t, http.StatusCreated, resp.Code, resp.Body.String())
+	var route models.RawRoute
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &route))
+	require.True(t, route.Enabled)
+	require.Contains(t, current, "health.example.com")
+
+	// The same route, formatted differently, is a duplicate
+	resp = send(http.MethodPost, "/raw-routes", `{"route": "{\"handle\":[{\"body\":\"OK\",\"handler\":\"static_response\"}],\"match\":[{\"host\":[\"health.example.com\"]}]}"}`)
+	require.Equal(t, http.StatusConflict, resp.Code)
+	require.Equal(t, http.StatusBadRequest, send(http.MethodPost, "/raw-routes", `{"route": "{\"match\": []}"}`).Code)
+
+	resp = send(http.MethodGet, "/raw-routes", "")
+	require.Equal(t, http.StatusOK, resp.Code)
+	var routes []models.RawRoute
+	require.NoError(t, json.Unmarshal(resp.Body.Bytes(), &routes))
+	require.Len(t, routes, 1)
+
+	// Disabling takes the route out of the config
+	resp = send(http.MethodPut, "/raw-routes/"+route.UUID, `{"enabled": false}`)
+	require.Equal(t, http.StatusOK, resp.Code, resp.Body.String())
+	require.NotContains(t, current, "health.example.com")
+	require.NoError(t, db.First(&route, route.ID).Error)
+	require.False(t, route.Enabled)
+
+	// A change Caddy rejects is undone
+	resp = send(http.MethodPut, "/raw-routes/"+route.UUID, `{"enabled": true, "route": "{\"handle\": [{\"handler\": \"reverse_proxy\", \"upstreams\": [{\"dial\": \"bad.example.com:80\"}]}]}"}`)
+	require.Equal(t, http.StatusInternalServerError, resp.Code)
+	require.Contains(t, resp.Body.String(), `"reverted":true`)
+	require.NoError(t, db.First(&route, route.ID).Error)
+	require.False(t, route.Enabled)
+	require.Contains(t, route.Route, "health.example.com")
+
+	resp = send(http.MethodDelete, "/raw-routes/"+route.UUID, "")
+	require.Equal(t, http.StatusOK, resp.Code)
+	require.Zero(t, countRoutes())
+	require.Equal(t, http.StatusNotFound, send(http.MethodGet, "/raw-routes/"+route.UUID, "").Code)
+}
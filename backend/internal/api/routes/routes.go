@@ -1,6 +1,7 @@
 package routes
 
 import (
+	"context"
 	"fmt"
 	"time"
 
@@ -21,6 +22,8 @@ func Register(router *gin.Engine, db *gorm.DB, cfg config.Config) error {
 	if err := db.AutoMigrate(
 		&models.ProxyHost{},
 		&models.Location{},
+		&models.UpstreamGroup{},
+		&models.TrafficSplitChange{},
 		&models.CaddyConfig{},
 		&models.RemoteServer{},
 		&models.SSLCertificate{},
@@ -30,11 +33,37 @@ func Register(router *gin.Engine, db *gorm.DB, cfg config.Config) error {
 		&models.ImportSession{},
 		&models.Notification{},
 		&models.Domain{},
+		&models.CaddyNode{},
+		&models.RawRoute{},
 	); err != nil {
 		return fmt.Errorf("auto migrate: %w", err)
 	}
 
-	router.GET("/api/v1/health", handlers.HealthHandler)
+	// Caddy Manager
+	caddyClient, err := newCaddyClient(cfg)
+	if err != nil {
+		return err
+	}
+	caddyManager := caddy.NewManager(caddyClient, db, cfg.CaddyConfigDir)
+	caddyManager.SetStaticBaseDir(cfg.StaticBaseDir)
+	caddyManager.SetPublicURL(cfg.PublicURL)
+	caddyManager.SetBinary(caddy.NewBinary(cfg.CaddyBinary))
+
+	// Serializes applies and coalesces bulk changes into one reload
+	applyQueue := caddy.NewApplyQueue(caddyManager, cfg.ApplyDebounce)
+	go applyQueue.Run(context.Background())
+
+	// Applies the config at startup, then keeps Caddy in sync with the
+	// database every CPM_RECONCILE_INTERVAL, when set
+	reconciler := caddy.NewReconciler(caddyManager, services.NewNotificationService(db), cfg.ReconcileInterval)
+	reconciler.SetApplyQueue(applyQueue)
+	go reconciler.Run(context.Background())
+
+	router.GET("/api/v1/health", handlers.NewHealthHandler(reconciler))
+
+	// On-demand TLS permission check, called by Caddy without credentials
+	onDemandHandler := handlers.NewOnDemandHandler(services.NewOnDemandService(db))
+	router.GET("/api/v1/tls/ask", onDemandHandler.Ask)
 
 	api := router.Group("/api/v1")
 
@@ -49,6 +78,7 @@ func Register(router *gin.Engine, db *gorm.DB, cfg config.Config) error {
 
 	// Log routes
 	logService := services.NewLogService(&cfg)
+	logService.GeoIP = services.NewGeoIPService(db)
 	logsHandler := handlers.NewLogsHandler(logService)
 
 	api.POST("/auth/login", authHandler.Login)
@@ -102,6 +132,10 @@ func Register(router *gin.Engine, db *gorm.DB, cfg config.Config) error {
 		protected.POST("/domains", domainHandler.Create)
 		protected.DELETE("/domains/:id", domainHandler.Delete)
 
+		// CrowdSec
+		crowdSecHandler := handlers.NewCrowdSecHandler(services.NewCrowdSecService(db))
+		crowdSecHandler.RegisterRoutes(protected)
+
 		// Docker
 		dockerService, err := services.NewDockerService()
 		if err == nil { // Only register if Docker is available
@@ -130,12 +164,32 @@ func Register(router *gin.Engine, db *gorm.DB, cfg config.Config) error {
 		})
 	}
 
-	// Caddy Manager
-	caddyClient := caddy.NewClient(cfg.CaddyAdminAPI)
-	caddyManager := caddy.NewManager(caddyClient, db, cfg.CaddyConfigDir)
-
+	// Authenticated, so the config history records who applied each change
 	proxyHostHandler := handlers.NewProxyHostHandler(db, caddyManager)
-	proxyHostHandler.RegisterRoutes(api)
+	proxyHostHandler.SetApplyQueue(applyQueue)
+	proxyHostHandler.RegisterRoutes(protected)
+
+	applyJobHandler := handlers.NewApplyJobHandler(applyQueue)
+	applyJobHandler.RegisterRoutes(protected)
+
+	configHistoryHandler := handlers.NewConfigHistoryHandler(caddyManager)
+	configHistoryHandler.RegisterRoutes(protected)
+
+	caddyNodeHandler := handlers.NewCaddyNodeHandler(db, caddyManager)
+	caddyNodeHandler.RegisterRoutes(protected)
+
+	rawRouteHandler := handlers.NewRawRouteHandler(db, caddyManager)
+	rawRouteHandler.RegisterRoutes(protected)
+
+	// Previews expose the live config, with its secrets, and commits add
+	// routes Caddy loads verbatim
+	importHandler := handlers.NewImportHandler(db, cfg.CaddyBinary, cfg.ImportDir)
+	importHandler.SetCaddyClient(caddyClient)
+	importHandler.SetStaticBaseDir(caddyManager.StaticBaseDir())
+	importHandler.RegisterRoutes(protected)
+
+	caddyBinaryHandler := handlers.NewCaddyBinaryHandler(caddyManager.Binary())
+	caddyBinaryHandler.RegisterRoutes(protected)
 
 	remoteServerHandler := handlers.NewRemoteServerHandler(db)
 	remoteServerHandler.RegisterRoutes(api)
@@ -153,9 +207,16 @@ func Register(router *gin.Engine, db *gorm.DB, cfg config.Config) error {
 	return nil
 }
 
-// RegisterImportHandler wires up import routes with config dependencies.
-func RegisterImportHandler(router *gin.Engine, db *gorm.DB, caddyBinary, importDir string) {
-	importHandler := handlers.NewImportHandler(db, caddyBinary, importDir)
-	api := router.Group("/api/v1")
-	importHandler.RegisterRoutes(api)
+// newCaddyClient creates the client for the Caddy admin API.
+func newCaddyClient(cfg config.Config) (*caddy.Client, error) {
+	client, err := caddy.NewClientWithOptions(cfg.CaddyAdminAPI, caddy.ClientOptions{
+		Origin:         cfg.CaddyAdminOrigin,
+		CACertFile:     cfg.CaddyAdminCACert,
+		ClientCertFile: cfg.CaddyAdminClientCert,
+		ClientKeyFile:  cfg.CaddyAdminClientKey,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("caddy admin client: %w", err)
+	}
+	return client, nil
 }
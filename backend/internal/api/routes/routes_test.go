@@ -1,6 +1,8 @@
 package routes
 
 import (
+"net/http"
+"net/http/httptest"
 "testing"
 
 "github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/config"
@@ -39,3 +41,19 @@ break
 }
 assert.True(t, foundHealth, "Health route should be registered")
 }
+
+func TestRegister_ProxyHostsRequireAuth(t *testing.T) {
+gin.SetMode(gin.TestMode)
+router := gin.New()
+
+db, err := gorm.Open(sqlite.Open("file:"+t.Name()+"?mode=memory&cache=shared"), &gorm.Config{})
+require.NoError(t, err)
+require.NoError(t, Register(router, db, config.Config{JWTSecret: "test-secret"}))
+
+// Changes must be attributed to a user in the config history
+for _, path := range []string{"/api/v1/proxy-hosts", "/api/v1/config/jobs/some-job", "/api/v1/import/preview", "/api/v1/import/status"} {
+w := httptest.NewRecorder()
+router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+assert.Equal(t, http.StatusUnauthorized, w.Code, path)
+}
+}
@@ -0,0 +1,141 @@
+package caddy
+
+import (
+	"encoding/json"
+	"fmt"
+	"net"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/models"
+)
+
+// Access list types (models.AccessList.Type).
+const (
+	AccessListAllow     = "allow"
+	AccessListDeny      = "deny"
+	AccessListBasicAuth = "basic_auth"
+	// AccessListForwardAuth is accepted by the model but not rendered yet.
+	AccessListForwardAuth = "forward_auth"
+)
+
+var countryPattern = regexp.MustCompile(`^[A-Z]{2}$`)
+
+// AccessListHandler builds the handler enforcing an access list.
+// Country rules are looked up in the MaxMind database at geoIPDatabase.
+// It returns nil for disabled lists and for types it cannot enforce, which
+// are logged and skipped so one list does not block every apply.
+func AccessListHandler(list *models.AccessList, geoIPDatabase string) (Handler, error) {
+	if list == nil || !list.Enabled {
+		return nil, nil
+	}
+
+	switch list.Type {
+	case AccessListAllow, AccessListDeny, AccessListBasicAuth:
+	default:
+		fmt.Printf("warning: access list %s: unsupported type %q, not enforced\n", list.Name, list.Type)
+		return nil, nil
+	}
+
+	var rules []models.AccessListRule
+	if strings.TrimSpace(list.Rules) != "" {
+		if err := json.Unmarshal([]byte(list.Rules), &rules); err != nil {
+			return nil, fmt.Errorf("access list %s: invalid rules: %w", list.Name, err)
+		}
+	}
+
+	switch list.Type {
+	case AccessListAllow, AccessListDeny:
+		ranges, err := ruleRanges(rules)
+		if err != nil {
+			return nil, fmt.Errorf("access list %s: %w", list.Name, err)
+		}
+		countries, err := ruleCountries(rules)
+		if err != nil {
+			return nil, fmt.Errorf("access list %s: %w", list.Name, err)
+		}
+		if len(countries) > 0 && geoIPDatabase == "" {
+			return nil, fmt.Errorf("access list %s: country rules require a GeoIP database", list.Name)
+		}
+
+		// A client is listed if its address or its country is
+		listed := make([]Match, 0, 2)
+		if len(ranges) > 0 {
+			listed = append(listed, Match{RemoteIP: &MatchRemoteIP{Ranges: ranges}})
+		}
+		if len(countries) > 0 {
+			listed = append(listed, Match{MaxMind: &MatchMaxMind{DBPath: geoIPDatabase, AllowCountries: countries}})
+		}
+
+		// An allow list with no entries rejects everyone
+		if len(listed) == 0 {
+			if list.Type == AccessListDeny {
+				return nil, nil
+			}
+			return StatusHandler(http.StatusForbidden), nil
+		}
+
+		match := listed
+		if list.Type == AccessListAllow {
+			match = []Match{{Not: listed}}
+		}
+
+		return SubrouteHandler([]*Route{
+			{
+				Match:  match,
+				Handle: []Handler{StatusHandler(http.StatusForbidden)},
+			},
+		}), nil
+
+	case AccessListBasicAuth:
+		accounts := make([]map[string]string, 0, len(rules))
+		for _, rule := range rules {
+			if rule.Username == "" || !strings.HasPrefix(rule.Password, "$2") {
+				return nil, fmt.Errorf("access list %s: basic auth rules need a username and bcrypt password hash", list.Name)
+			}
+			accounts = append(accounts, map[string]string{
+				"username": rule.Username,
+				"password": rule.Password,
+			})
+		}
+		if len(accounts) == 0 {
+			return nil, fmt.Errorf("access list %s: basic auth requires at least one account", list.Name)
+		}
+		return BasicAuthHandler(accounts), nil
+	}
+
+	return nil, nil
+}
+
+// ruleCountries returns the upper-cased country codes of allow/deny rules.
+func ruleCountries(rules []models.AccessListRule) ([]string, error) {
+	countries := make([]string, 0)
+	for _, rule := range rules {
+		code := strings.ToUpper(strings.TrimSpace(rule.Country))
+		if code == "" {
+			continue
+		}
+		if !countryPattern.MatchString(code) {
+			return nil, fmt.Errorf("invalid country code %q", rule.Country)
+		}
+		countries = append(countries, code)
+	}
+	return countries, nil
+}
+
+// ruleRanges converts allow/deny rules to CIDR ranges.
+func ruleRanges(rules []models.AccessListRule) ([]string, error) {
+	ranges := make([]string, 0, len(rules))
+	for _, rule := range rules {
+		addr := strings.TrimSpace(rule.Address)
+		if addr == "" {
+			continue
+		}
+		if _, _, err := net.ParseCIDR(addr); err != nil && net.ParseIP(addr) == nil {
+			return nil, fmt.Errorf("invalid address %q", addr)
+		}
+		ranges = append(ranges, addr)
+	}
+	return ranges, nil
+}
@@ -0,0 +1,96 @@
+package caddy
+
+import (
+	"regexp"
+	"strconv"
+
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/models"
+)
+
+// Apply stages reported by ApplyError.
+const (
+	ApplyStageGenerate = "generate"
+	ApplyStageValidate = "validate"
+	ApplyStageLoad     = "load"
+)
+
+// ApplyError is returned by ApplyConfig. It tells which stage failed and,
+// when the failure can be attributed to one, the proxy host at fault.
+type ApplyError struct {
+	Stage    string
+	HostUUID string // Empty when no single host is at fault
+	Err      error
+}
+
+func (e *ApplyError) Error() string {
+	return e.Err.Error()
+}
+
+func (e *ApplyError) Unwrap() error {
+	return e.Err
+}
+
+var (
+	generateHostPattern = regexp.MustCompile(`^proxy host ([^\s:]+)`)
+	invalidRoutePattern = regexp.MustCompile(`^invalid route (\d+) in server (\S+):`)
+	// As printed by "caddy validate", and returned by /load, when a route
+	// fails to provision
+	provisionRoutePattern = regexp.MustCompile(`server (\S+): setting up route handlers: route (\d+):`)
+)
+
+// generateErrorHost finds the host named by a GenerateConfig error.
+func generateErrorHost(err error) string {
+	if m := generateHostPattern.FindStringSubmatch(err.Error()); m != nil {
+		return m[1]
+	}
+	return ""
+}
+
+// validateErrorHost finds the host whose route failed validation.
+func validateErrorHost(err error, config *Config, hosts []models.ProxyHost) string {
+	m := invalidRoutePattern.FindStringSubmatch(err.Error())
+	if m == nil {
+		return ""
+	}
+	index, _ := strconv.Atoi(m[1])
+	return routeHost(config, m[2], index, hosts)
+}
+
+// provisionErrorHost finds the host whose route Caddy failed to provision.
+func provisionErrorHost(err error, config *Config, hosts []models.ProxyHost) string {
+	m := provisionRoutePattern.FindStringSubmatch(err.Error())
+	if m == nil {
+		return ""
+	}
+	index, _ := strconv.Atoi(m[2])
+	return routeHost(config, m[1], index, hosts)
+}
+
+// routeHost finds the host a route was generated for, by the route's @id
+// or else its host matcher.
+func routeHost(config *Config, serverName string, index int, hosts []models.ProxyHost) string {
+	if config.Apps.HTTP == nil {
+		return ""
+	}
+	server, ok := config.Apps.HTTP.Servers[serverName]
+	if !ok || index < 0 || index >= len(server.Routes) {
+		return ""
+	}
+	route := server.Routes[index]
+	if uuid := routeIDHost(route.ID); uuid != "" {
+		return uuid
+	}
+
+	for _, match := range route.Match {
+		for _, name := range match.Host {
+			for _, host := range hosts {
+				for _, subject := range hostSubjects(host) {
+					if subject == name {
+						return host.UUID
+					}
+				}
+			}
+		}
+	}
+	return ""
+}
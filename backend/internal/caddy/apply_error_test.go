@@ -0,0 +1,69 @@
+package caddy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/models"
+)
+
+func TestApplyError_Stages(t *testing.T) {
+	reject := false
+	manager, db := setupHistoryTest(t, func(w http.ResponseWriter, r *http.Request) {
+		if reject && r.URL.Path == "/load" {
+			w.WriteHeader(http.StatusBadRequest)
+		}
+	})
+	require.NoError(t, db.Create(&models.ProxyHost{UUID: "uuid-app", DomainNames: "app.example.com", ForwardHost: "app", ForwardPort: 80}).Error)
+
+	reject = true
+	var applyErr *ApplyError
+	err := manager.ApplyConfig(context.Background())
+	require.ErrorAs(t, err, &applyErr)
+	assert.Equal(t, ApplyStageLoad, applyErr.Stage)
+	assert.Empty(t, applyErr.HostUUID)
+	assert.Contains(t, err.Error(), "apply failed")
+
+	reject = false
+	require.NoError(t, db.Create(&models.ProxyHost{UUID: "uuid-typo", DomainNames: "typo.example.com", ForwardHost: "app", ForwardPort: 80, CanonicalHost: "bogus"}).Error)
+	err = manager.ApplyConfig(context.Background())
+	require.ErrorAs(t, err, &applyErr)
+	assert.Equal(t, ApplyStageGenerate, applyErr.Stage)
+	assert.Equal(t, "uuid-typo", applyErr.HostUUID)
+	assert.Contains(t, err.Error(), "generate config")
+}
+
+func TestValidateErrorHost(t *testing.T) {
+	hosts := []models.ProxyHost{
+		{UUID: "uuid-app", DomainNames: "app.example.com", ForwardHost: "app", ForwardPort: 80},
+		{UUID: "uuid-www", DomainNames: "example.com", ForwardHost: "www", ForwardPort: 80, CanonicalHost: "www"},
+	}
+	config, err := GenerateConfig(hosts, t.TempDir(), ConfigOptions{})
+	require.NoError(t, err)
+
+	for name, server := range config.Apps.HTTP.Servers {
+		for i, route := range server.Routes {
+			if len(route.Match) == 0 || len(route.Match[0].Host) == 0 {
+				continue
+			}
+			want := "uuid-app"
+			if route.Match[0].Host[0] != "app.example.com" {
+				want = "uuid-www" // Including the www. alias
+			}
+			err := fmt.Errorf("invalid route %d in server %s: %w", i, name, errors.New("bad handler"))
+			assert.Equal(t, want, validateErrorHost(err, config, hosts), route.Match[0].Host)
+		}
+	}
+
+	assert.Empty(t, validateErrorHost(errors.New("server cpm_server has no listen addresses"), config, hosts))
+	assert.Empty(t, validateErrorHost(errors.New("invalid route 99 in server cpm_server: bad"), config, hosts))
+	assert.Equal(t, "uuid-app", generateErrorHost(errors.New("proxy host uuid-app: access list 1 not found")))
+	assert.Equal(t, "uuid-app", generateErrorHost(errors.New("proxy host uuid-app location /api: bad")))
+	assert.Empty(t, generateErrorHost(errors.New("marshal config")))
+}
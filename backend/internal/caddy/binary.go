@@ -0,0 +1,259 @@
+package caddy
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/models"
+)
+
+// pluginModules maps the features that need a Caddy plugin to the module
+// the plugin registers.
+var pluginModules = map[string]string{
+	"crowdsec": "http.handlers.crowdsec",
+	"geoip":    "http.matchers.maxmind_geolocation",
+	"waf":      "http.handlers.waf",
+}
+
+// BinaryInfo describes the installed Caddy binary.
+type BinaryInfo struct {
+	Available bool            `json:"available"`
+	Version   string          `json:"version,omitempty"`
+	Modules   []string        `json:"modules,omitempty"`
+	Features  map[string]bool `json:"features"` // Plugin features by name, see pluginModules
+	Error     string          `json:"error,omitempty"`
+}
+
+// Binary runs the local caddy binary to validate configs with Caddy's own
+// provisioning and to report its version and modules. Everything is
+// skipped when the binary is not installed.
+type Binary struct {
+	path     string
+	executor Executor
+
+	mu      sync.Mutex
+	version string
+	modules map[string]bool
+}
+
+// NewBinary creates a Binary running the caddy binary at path.
+func NewBinary(path string) *Binary {
+	return &Binary{path: path, executor: &DefaultExecutor{}}
+}
+
+// Version returns the version of the binary, e.g. "v2.9.1".
+func (b *Binary) Version() (string, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.version != "" {
+		return b.version, nil
+	}
+
+	output, err := b.executor.Execute(b.path, "version")
+	if err != nil {
+		return "", fmt.Errorf("caddy version: %w", commandError(output, err))
+	}
+	fields := strings.Fields(string(output))
+	if len(fields) == 0 {
+		return "", errors.New("caddy version: empty output")
+	}
+	b.version = fields[0]
+	return b.version, nil
+}
+
+// Modules returns the modules compiled into the binary, sorted.
+func (b *Binary) Modules() ([]string, error) {
+	modules, err := b.moduleSet()
+	if err != nil {
+		return nil, err
+	}
+	list := make([]string, 0, len(modules))
+	for module := range modules {
+		list = append(list, module)
+	}
+	sort.Strings(list)
+	return list, nil
+}
+
+// HasModule reports whether the binary includes module. ok is false when
+// the modules can't be listed.
+func (b *Binary) HasModule(module string) (has, ok bool) {
+	modules, err := b.moduleSet()
+	if err != nil {
+		return false, false
+	}
+	return modules[module], true
+}
+
+func (b *Binary) moduleSet() (map[string]bool, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.modules != nil {
+		return b.modules, nil
+	}
+
+	output, err := b.executor.Execute(b.path, "list-modules")
+	if err != nil {
+		return nil, fmt.Errorf("caddy list-modules: %w", commandError(output, err))
+	}
+	// Module IDs, one per line, grouped and followed by counts such as
+	// "  Standard modules: 106"
+	modules := make(map[string]bool)
+	for _, line := range strings.Split(string(output), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.ContainsAny(line, ": ") {
+			continue
+		}
+		modules[line] = true
+	}
+	b.modules = modules
+	return modules, nil
+}
+
+// Info describes the binary, with the plugin features it supports.
+func (b *Binary) Info() BinaryInfo {
+	info := BinaryInfo{Features: make(map[string]bool)}
+	version, err := b.Version()
+	if err != nil {
+		info.Error = err.Error()
+		return info
+	}
+	info.Available = true
+	info.Version = version
+
+	modules, err := b.Modules()
+	if err != nil {
+		info.Error = err.Error()
+		return info
+	}
+	info.Modules = modules
+	for feature, module := range pluginModules {
+		info.Features[feature], _ = b.HasModule(module)
+	}
+	return info
+}
+
+// Validate runs "caddy validate" on config, which provisions every module
+// like a load would without starting anything.
+func (b *Binary) Validate(config *Config) error {
+	raw, err := json.Marshal(config)
+	if err != nil {
+		return fmt.Errorf("marshal config: %w", err)
+	}
+	file, err := os.CreateTemp("", "cpm-validate-*.json")
+	if err != nil {
+		return fmt.Errorf("create temp config: %w", err)
+	}
+	defer os.Remove(file.Name())
+	if _, err := file.Write(raw); err != nil {
+		file.Close()
+		return fmt.Errorf("write temp config: %w", err)
+	}
+	file.Close()
+
+	output, err := b.executor.Execute(b.path, "validate", "--config", file.Name(), "--adapter", "json")
+	if err != nil {
+		return commandError(output, err)
+	}
+	return nil
+}
+
+// commandError returns Caddy's own message for a failed command: the
+// "Error:" line it prints last, or its whole output.
+func commandError(output []byte, err error) error {
+	var exitErr *exec.ExitError
+	if errors.As(err, &exitErr) && len(exitErr.Stderr) > 0 {
+		output = append(output, exitErr.Stderr...)
+	}
+
+	message := ""
+	for _, line := range strings.Split(strings.TrimSpace(string(output)), "\n") {
+		if strings.HasPrefix(line, "Error: ") {
+			message = strings.TrimPrefix(line, "Error: ")
+		}
+	}
+	if message == "" {
+		message = strings.TrimSpace(string(output))
+	}
+	if message == "" {
+		return err
+	}
+	return errors.New(message)
+}
+
+// missingModules returns the plugin modules config needs that the binary
+// lacks, with the route needing each. Nothing is reported when the
+// modules can't be listed.
+func (b *Binary) missingModules(config *Config) []missingModule {
+	var missing []missingModule
+	if config.Apps.HTTP == nil {
+		return nil
+	}
+	for serverName, server := range config.Apps.HTTP.Servers {
+		for i, route := range server.Routes {
+			raw, err := json.Marshal(route)
+			if err != nil {
+				continue
+			}
+			for _, module := range pluginModules {
+				if !strings.Contains(string(raw), moduleMarker(module)) {
+					continue
+				}
+				if has, ok := b.HasModule(module); ok && !has {
+					missing = append(missing, missingModule{module: module, server: serverName, route: i})
+				}
+			}
+		}
+	}
+	sort.Slice(missing, func(i, j int) bool { return missing[i].route < missing[j].route })
+	return missing
+}
+
+// missingModule is a module a route needs but the binary lacks.
+type missingModule struct {
+	module string
+	server string
+	route  int
+}
+
+// moduleMarker is how a module appears in config JSON: the handler name
+// for http.handlers.* and the matcher key for http.matchers.*.
+func moduleMarker(module string) string {
+	name := module[strings.LastIndex(module, ".")+1:]
+	if strings.HasPrefix(module, "http.handlers.") {
+		return `"handler":"` + name + `"`
+	}
+	return `"` + name + `":`
+}
+
+// validateWithBinary checks config with the local caddy binary: first that
+// it has the plugins the routes use, then with "caddy validate". It does
+// nothing when no binary is installed.
+func (m *Manager) validateWithBinary(config *Config, hosts []models.ProxyHost) error {
+	if m.binary == nil {
+		return nil
+	}
+	if _, err := m.binary.Version(); err != nil {
+		return nil
+	}
+
+	if missing := m.binary.missingModules(config); len(missing) > 0 {
+		first := missing[0]
+		return &ApplyError{
+			Stage:    ApplyStageValidate,
+			HostUUID: routeHost(config, first.server, first.route, hosts),
+			Err:      fmt.Errorf("validation failed: caddy binary lacks module %s used by route %d in server %s", first.module, first.route, first.server),
+		}
+	}
+
+	if err := m.binary.Validate(config); err != nil {
+		return &ApplyError{Stage: ApplyStageValidate, HostUUID: provisionErrorHost(err, config, hosts), Err: fmt.Errorf("caddy validate: %w", err)}
+	}
+	return nil
+}
@@ -0,0 +1,164 @@
+package caddy
+
+import (
+	"context"
+	"errors"
+	"os"
+	"os/exec"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/models"
+)
+
+// fakeCaddy answers caddy subcommands with canned output.
+type fakeCaddy struct {
+	outputs map[string]string
+	errs    map[string]error
+	calls   map[string]int
+	config  string // Contents of the config passed to validate
+}
+
+func (f *fakeCaddy) Execute(name string, args ...string) ([]byte, error) {
+	if f.calls == nil {
+		f.calls = make(map[string]int)
+	}
+	f.calls[args[0]]++
+	if args[0] == "validate" {
+		raw, err := os.ReadFile(args[2])
+		if err != nil {
+			return nil, err
+		}
+		f.config = string(raw)
+	}
+	return []byte(f.outputs[args[0]]), f.errs[args[0]]
+}
+
+const testModules = `admin.api.load
+http.handlers.reverse_proxy
+http.handlers.waf
+
+  Standard modules: 2
+
+http.handlers.crowdsec
+
+  Non-standard modules: 2
+
+  Unknown modules: 0
+`
+
+func newTestBinary(caddy *fakeCaddy) *Binary {
+	b := NewBinary("caddy")
+	b.executor = caddy
+	return b
+}
+
+func TestBinary_Info(t *testing.T) {
+	caddy := &fakeCaddy{outputs: map[string]string{
+		"version":      "v2.9.1 h1:OEYiZ7DbCzAWVb6TNEkjRcSCRGHVoZsJinoDR/n9oaY=\n",
+		"list-modules": testModules,
+	}}
+	b := newTestBinary(caddy)
+
+	info := b.Info()
+	assert.True(t, info.Available)
+	assert.Equal(t, "v2.9.1", info.Version)
+	assert.Equal(t, []string{"admin.api.load", "http.handlers.crowdsec", "http.handlers.reverse_proxy", "http.handlers.waf"}, info.Modules)
+	assert.Equal(t, map[string]bool{"waf": true, "crowdsec": true, "geoip": false}, info.Features)
+
+	// Cached after the first run
+	b.Info()
+	assert.Equal(t, 1, caddy.calls["version"])
+	assert.Equal(t, 1, caddy.calls["list-modules"])
+}
+
+func TestBinary_Unavailable(t *testing.T) {
+	b := newTestBinary(&fakeCaddy{errs: map[string]error{"version": exec.ErrNotFound}})
+
+	info := b.Info()
+	assert.False(t, info.Available)
+	assert.NotEmpty(t, info.Error)
+	assert.Empty(t, info.Features)
+}
+
+func TestBinary_Validate(t *testing.T) {
+	caddy := &fakeCaddy{}
+	b := newTestBinary(caddy)
+
+	config := &Config{Apps: Apps{HTTP: &HTTPApp{Servers: map[string]*Server{}}}}
+	require.NoError(t, b.Validate(config))
+	assert.Contains(t, caddy.config, `"http":{"servers":{}}`)
+
+	// Caddy's own message is reported, from output or stderr
+	caddy.outputs = map[string]string{"validate": "2025/01/01 INFO using config\nError: loading new config: bad thing\n"}
+	caddy.errs = map[string]error{"validate": errors.New("exit status 1")}
+	assert.EqualError(t, b.Validate(config), "loading new config: bad thing")
+
+	caddy.outputs = nil
+	caddy.errs = map[string]error{"validate": &exec.ExitError{Stderr: []byte("Error: from stderr\n")}}
+	assert.EqualError(t, b.Validate(config), "from stderr")
+}
+
+func TestManager_ApplyConfig_CaddyValidate(t *testing.T) {
+	admin := &fakeAdmin{}
+	manager, db := setupHistoryTest(t, admin.ServeHTTP)
+	require.NoError(t, db.Create(&models.ProxyHost{UUID: "uuid-a", DomainNames: "a.example.com", ForwardHost: "a", ForwardPort: 80, Enabled: true}).Error)
+	require.NoError(t, db.Create(&models.ProxyHost{UUID: "uuid-b", DomainNames: "b.example.com", ForwardHost: "b", ForwardPort: 80, Enabled: true}).Error)
+
+	caddy := &fakeCaddy{outputs: map[string]string{"version": "v2.9.1", "list-modules": testModules}}
+	manager.SetBinary(newTestBinary(caddy))
+
+	// A passing validate is applied
+	require.NoError(t, manager.ApplyConfig(context.Background()))
+	assert.Equal(t, 1, caddy.calls["validate"])
+	assert.Equal(t, 1, admin.loads)
+
+	// Caddy's error names the route, which is mapped back to its host
+	config := manager.mustGenerate(t)
+	index := -1
+	for i, route := range config.Apps.HTTP.Servers["cpm_server"].Routes {
+		if route.ID == "host_uuid-b" {
+			index = i
+		}
+	}
+	require.GreaterOrEqual(t, index, 0)
+	caddy.outputs["validate"] = "Error: loading http app module: provision http: server cpm_server: setting up route handlers: route " +
+		strconv.Itoa(index) + ": loading handler modules: position 0: unknown module\n"
+	caddy.errs = map[string]error{"validate": errors.New("exit status 1")}
+
+	err := manager.ApplyConfig(context.Background())
+	var applyErr *ApplyError
+	require.ErrorAs(t, err, &applyErr)
+	assert.Equal(t, ApplyStageValidate, applyErr.Stage)
+	assert.Equal(t, "uuid-b", applyErr.HostUUID)
+	assert.Contains(t, err.Error(), "unknown module")
+	assert.Equal(t, 1, admin.loads)
+}
+
+func TestManager_ApplyConfig_MissingPlugin(t *testing.T) {
+	admin := &fakeAdmin{}
+	manager, db := setupHistoryTest(t, admin.ServeHTTP)
+	require.NoError(t, db.Create(&models.ProxyHost{UUID: "uuid-a", DomainNames: "a.example.com", ForwardHost: "a", ForwardPort: 80, Enabled: true}).Error)
+	require.NoError(t, db.Create(&models.ProxyHost{UUID: "uuid-waf", DomainNames: "waf.example.com", ForwardHost: "b", ForwardPort: 80, Enabled: true, WAFMode: "blocking"}).Error)
+
+	// Without the coraza plugin the WAF host can't be served
+	caddy := &fakeCaddy{outputs: map[string]string{"version": "v2.9.1", "list-modules": "http.handlers.reverse_proxy\n"}}
+	manager.SetBinary(newTestBinary(caddy))
+
+	err := manager.ApplyConfig(context.Background())
+	var applyErr *ApplyError
+	require.ErrorAs(t, err, &applyErr)
+	assert.Equal(t, ApplyStageValidate, applyErr.Stage)
+	assert.Equal(t, "uuid-waf", applyErr.HostUUID)
+	assert.Contains(t, err.Error(), "http.handlers.waf")
+	assert.Zero(t, caddy.calls["validate"])
+	assert.Zero(t, admin.loads)
+
+	// Without a binary nothing is checked
+	manager.SetBinary(newTestBinary(&fakeCaddy{errs: map[string]error{"version": exec.ErrNotFound}}))
+	require.NoError(t, manager.ApplyConfig(context.Background()))
+	assert.Equal(t, 1, admin.loads)
+}
@@ -0,0 +1,596 @@
+package caddy
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/models"
+)
+
+// ExportCaddyfile renders hosts as an idiomatic Caddyfile, for running them
+// with plain Caddy or for reading the configuration. Features that need a
+// plugin or have no Caddyfile equivalent, such as access lists or the WAF,
+// are listed in a comment above the site block instead.
+func ExportCaddyfile(hosts []models.ProxyHost, opts ConfigOptions, generated time.Time) (string, error) {
+	if err := validateACMEOptions(opts.ACME); err != nil {
+		return "", err
+	}
+
+	w := &caddyfileWriter{}
+	w.comment("Generated by CPM+ at %s", generated.UTC().Format(time.RFC3339))
+	if n := len(opts.RawRoutes); n > 0 {
+		w.comment("%d raw route(s) adopted from a Caddy JSON config are not exported", n)
+	}
+
+	writeGlobalOptions(w, hosts, opts)
+
+	for _, host := range hosts {
+		w.blank()
+		if !host.Enabled {
+			w.comment("Disabled: %s", hostLabel(host))
+			continue
+		}
+		if err := writeSite(w, host, opts.ACME); err != nil {
+			return "", err
+		}
+	}
+
+	return w.String(), nil
+}
+
+// writeGlobalOptions writes the global options block, if any option is set.
+func writeGlobalOptions(w *caddyfileWriter, hosts []models.ProxyHost, opts ConfigOptions) {
+	options := &caddyfileWriter{depth: 1}
+
+	acme := opts.ACME
+	if acme.Email != "" {
+		options.line("email", acme.Email)
+	}
+	switch {
+	case acme.Directory != "":
+		options.line("acme_ca", acme.Directory)
+		if acme.CARoot != "" {
+			options.line("acme_ca_root", acme.CARoot)
+		}
+		if acme.EABKeyID != "" {
+			options.open("acme_eab")
+			options.line("key_id", acme.EABKeyID)
+			options.line("mac_key", acme.EABMACKey)
+			options.close()
+		}
+	case acme.Staging:
+		options.line("acme_ca", letsEncryptStagingDirectory)
+	}
+
+	for _, host := range hosts {
+		if host.Enabled && host.OnDemandTLS {
+			askURL := opts.OnDemand.AskURL
+			if askURL == "" {
+				askURL = DefaultOnDemandAskURL
+			}
+			options.open("on_demand_tls")
+			options.line("ask", askURL)
+			options.close()
+			break
+		}
+	}
+
+	timeouts := [][2]string{
+		{"read_body", opts.Server.ReadTimeout},
+		{"read_header", opts.Server.ReadHeaderTimeout},
+		{"write", opts.Server.WriteTimeout},
+		{"idle", opts.Server.IdleTimeout},
+	}
+	set := &caddyfileWriter{depth: 3}
+	for _, timeout := range timeouts {
+		if timeout[1] != "" {
+			set.line(timeout[0], timeout[1])
+		}
+	}
+	if set.Len() > 0 {
+		options.open("servers")
+		options.open("timeouts")
+		options.raw(set.String())
+		options.close()
+		options.close()
+	}
+
+	if options.Len() == 0 {
+		return
+	}
+	w.blank()
+	w.open()
+	w.raw(options.String())
+	w.close()
+}
+
+// writeSite writes the site block of an enabled host, followed by the
+// blocks redirecting its canonical aliases.
+func writeSite(w *caddyfileWriter, host models.ProxyHost, acme ACMEOptions) error {
+	addresses := splitDomains(host.DomainNames)
+	if len(addresses) == 0 {
+		return fmt.Errorf("proxy host %s has empty domain names", host.UUID)
+	}
+
+	if host.Name != "" && host.Name != host.DomainNames {
+		w.comment("%s", host.Name)
+	}
+	for _, note := range unexportedFeatures(host) {
+		w.comment("Not exported: %s", note)
+	}
+
+	for i := range addresses[:len(addresses)-1] {
+		addresses[i] += ","
+	}
+	if host.OnDemandTLS {
+		addresses = []string{"https://"}
+	}
+	w.open(addresses...)
+
+	if err := writeSiteTLS(w, host, acme); err != nil {
+		return err
+	}
+
+	responseHeaders := make(map[string][]string)
+	if host.HSTSEnabled {
+		hsts := "max-age=31536000"
+		if host.HSTSSubdomains {
+			hsts += "; includeSubDomains"
+		}
+		responseHeaders["Strict-Transport-Security"] = []string{hsts}
+	}
+	for name, values := range host.ResponseHeaders {
+		responseHeaders[name] = values
+	}
+	writeHeaders(w, "header", responseHeaders)
+	writeHeaders(w, "request_header", host.RequestHeaders)
+
+	if host.MaxBodySize > 0 {
+		w.open("request_body")
+		w.line("max_size", fmt.Sprint(host.MaxBodySize))
+		w.close()
+	}
+	if host.EnableCompression {
+		w.line("encode", "zstd", "gzip")
+	}
+
+	if host.HostType == models.HostTypeStatic {
+		writeStaticSite(w, host)
+	}
+
+	locations := sortLocations(host.Locations)
+	for i, loc := range locations {
+		if err := validateLocation(loc); err != nil {
+			return fmt.Errorf("proxy host %s location %s: %w", host.UUID, locationLabel(loc), err)
+		}
+		writeLocation(w, host, loc, fmt.Sprintf("loc%d", i))
+	}
+
+	// Locations are handled first, anything else falls through to the host
+	if len(locations) > 0 {
+		w.open("handle")
+	}
+	if host.HostType == models.HostTypeStatic {
+		writeFileServer(w, host)
+	} else {
+		writeProxy(w, host, proxyOptions{
+			scheme:        host.ForwardScheme,
+			host:          host.ForwardHost,
+			port:          host.ForwardPort,
+			websocket:     host.WebsocketSupport,
+			tlsSkipVerify: host.UpstreamTLSSkipVerify,
+			tlsServerName: host.UpstreamTLSServerName,
+		})
+	}
+	if len(locations) > 0 {
+		w.close()
+	}
+
+	w.close()
+
+	for _, alias := range models.CanonicalAliases(host.DomainNames, host.CanonicalHost) {
+		target := strings.TrimPrefix(alias, "www.")
+		if host.CanonicalHost == models.CanonicalHostWWW {
+			target = "www." + alias
+		}
+		w.blank()
+		w.open(alias)
+		w.line("redir", "https://"+target+"{uri}", "308")
+		w.close()
+	}
+
+	return nil
+}
+
+// writeSiteTLS writes the tls directive for a host's issuer override.
+func writeSiteTLS(w *caddyfileWriter, host models.ProxyHost, acme ACMEOptions) error {
+	if host.OnDemandTLS {
+		w.open("tls")
+		w.line("on_demand")
+		w.close()
+		return nil
+	}
+
+	var directory string
+	switch host.CertificateIssuer {
+	case IssuerDefault:
+		return nil
+	case IssuerInternal:
+		w.line("tls", "internal")
+		return nil
+	case IssuerLetsEncrypt:
+		directory = letsEncryptDirectory
+	case IssuerLetsEncryptStaging:
+		directory = letsEncryptStagingDirectory
+	case IssuerZeroSSL:
+		// Caddy registers with ZeroSSL through the email when no EAB is set
+		directory = zeroSSLDirectory
+	case IssuerCustom:
+		if acme.Directory == "" {
+			return fmt.Errorf("proxy host %s: issuer %q requires a custom ACME directory", host.UUID, host.CertificateIssuer)
+		}
+		directory = acme.Directory
+	default:
+		return fmt.Errorf("proxy host %s: unknown certificate issuer %q", host.UUID, host.CertificateIssuer)
+	}
+
+	w.open("tls")
+	w.open("issuer", "acme")
+	w.line("dir", directory)
+	if acme.Email != "" {
+		w.line("email", acme.Email)
+	}
+	if host.CertificateIssuer == IssuerCustom {
+		if acme.CARoot != "" {
+			w.line("trusted_roots", acme.CARoot)
+		}
+		if acme.EABKeyID != "" {
+			w.line("eab", acme.EABKeyID, acme.EABMACKey)
+		}
+	}
+	if host.CertificateIssuer == IssuerZeroSSL && acme.EABKeyID != "" && acme.Directory == "" {
+		w.line("eab", acme.EABKeyID, acme.EABMACKey)
+	}
+	w.close()
+	w.close()
+	return nil
+}
+
+// writeHeaders writes header operations with directive ("header" or
+// "request_header"): the first value sets the header, further values are
+// added and an empty list deletes it.
+func writeHeaders(w *caddyfileWriter, directive string, headers map[string][]string) {
+	if len(headers) == 0 {
+		return
+	}
+
+	names := make([]string, 0, len(headers))
+	for name := range headers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	for _, name := range names {
+		values := headers[name]
+		if len(values) == 0 {
+			w.line(directive, "-"+name)
+			continue
+		}
+		for i, value := range values {
+			field := name
+			if i > 0 {
+				field = "+" + name
+			}
+			w.line(directive, field, value)
+		}
+	}
+}
+
+// writeLocation writes a location as a named matcher and a handle block.
+func writeLocation(w *caddyfileWriter, host models.ProxyHost, loc models.Location, name string) {
+	writeLocationMatcher(w, loc, name, false)
+
+	if loc.TrailingSlashRedirect {
+		writeLocationMatcher(w, loc, name+"_bare", true)
+		w.line("redir", "@"+name+"_bare", loc.Path+"/{http.request.uri.prefixed_query}", "308")
+	}
+
+	w.open("handle", "@"+name)
+
+	if loc.EnableCompression != nil && *loc.EnableCompression && !host.EnableCompression {
+		w.line("encode", "zstd", "gzip")
+	}
+	writeHeaders(w, "header", loc.ResponseHeaders)
+	writeHeaders(w, "request_header", loc.RequestHeaders)
+
+	replace := strings.TrimSuffix(loc.ReplacePrefix, "/")
+	switch {
+	case replace != "":
+		w.line("uri", "path_regexp", "^"+regexp.QuoteMeta(loc.Path), replace)
+	case loc.StripPrefix || loc.ReplacePrefix != "":
+		w.line("uri", "strip_prefix", loc.Path)
+	}
+	if loc.RewriteRegex != "" {
+		w.line("uri", "path_regexp", loc.RewriteRegex, loc.RewriteReplacement)
+	}
+
+	proxy := proxyOptions{
+		scheme:        loc.ForwardScheme,
+		host:          loc.ForwardHost,
+		port:          loc.ForwardPort,
+		websocket:     host.WebsocketSupport,
+		tlsSkipVerify: host.UpstreamTLSSkipVerify,
+		tlsServerName: loc.UpstreamTLSServerName,
+	}
+	if loc.WebsocketSupport != nil {
+		proxy.websocket = *loc.WebsocketSupport
+	}
+	if loc.UpstreamTLSSkipVerify != nil {
+		proxy.tlsSkipVerify = *loc.UpstreamTLSSkipVerify
+	}
+	writeProxy(w, host, proxy)
+
+	w.close()
+}
+
+// writeLocationMatcher writes the named matcher of a location. bare
+// matches only the path itself, for the trailing slash redirect.
+func writeLocationMatcher(w *caddyfileWriter, loc models.Location, name string, bare bool) {
+	w.open("@" + name)
+	switch {
+	case bare:
+		w.line("path", loc.Path)
+	case loc.PathRegex != "":
+		w.line("path_regexp", loc.PathRegex)
+	default:
+		w.line("path", loc.Path, loc.Path+"/*")
+	}
+
+	methods := make([]string, 0)
+	for _, method := range strings.Split(loc.Methods, ",") {
+		if method = strings.ToUpper(strings.TrimSpace(method)); method != "" {
+			methods = append(methods, method)
+		}
+	}
+	if len(methods) > 0 {
+		w.line(append([]string{"method"}, methods...)...)
+	}
+
+	for _, field := range sortedFields(loc.MatchHeaders) {
+		for _, value := range loc.MatchHeaders[field] {
+			w.line("header", field, value)
+		}
+	}
+	for _, key := range sortedFields(loc.MatchQuery) {
+		for _, value := range loc.MatchQuery[key] {
+			w.line("query", key+"="+value)
+		}
+	}
+	w.close()
+}
+
+// proxyOptions are the settings of a reverse_proxy directive.
+type proxyOptions struct {
+	scheme        string
+	host          string
+	port          int
+	websocket     bool
+	tlsSkipVerify bool
+	tlsServerName string
+}
+
+// writeProxy writes a reverse_proxy directive with the host's upstream
+// timeouts and, for https upstreams, TLS settings.
+func writeProxy(w *caddyfileWriter, host models.ProxyHost, p proxyOptions) {
+	upstream := fmt.Sprintf("%s:%d", p.host, p.port)
+	https := p.scheme == "https"
+	if https {
+		upstream = "https://" + upstream
+	}
+
+	body := &caddyfileWriter{depth: w.depth + 1}
+	if p.websocket {
+		body.line("header_up", "Connection", "{http.request.header.Connection}")
+		body.line("header_up", "Upgrade", "{http.request.header.Upgrade}")
+	}
+
+	transport := &caddyfileWriter{depth: w.depth + 2}
+	if https {
+		transport.line("tls")
+		if p.tlsSkipVerify {
+			transport.line("tls_insecure_skip_verify")
+		}
+		if p.tlsServerName != "" {
+			transport.line("tls_server_name", p.tlsServerName)
+		}
+	}
+	if host.ResponseHeaderTimeout != "" {
+		transport.line("response_header_timeout", host.ResponseHeaderTimeout)
+	}
+	switch {
+	case host.UpstreamKeepAlive == "off":
+		transport.line("keepalive", "off")
+	case host.UpstreamIdleTimeout != "":
+		transport.line("keepalive", host.UpstreamIdleTimeout)
+	}
+	if host.UpstreamKeepAlive != "" && host.UpstreamKeepAlive != "off" {
+		transport.line("keepalive_interval", host.UpstreamKeepAlive)
+	}
+	if transport.Len() > 0 {
+		body.open("transport", "http")
+		body.raw(transport.String())
+		body.close()
+	}
+
+	if body.Len() == 0 {
+		w.line("reverse_proxy", upstream)
+		return
+	}
+	w.open("reverse_proxy", upstream)
+	w.raw(body.String())
+	w.close()
+}
+
+// writeStaticSite writes the site-wide directives of a static host.
+func writeStaticSite(w *caddyfileWriter, host models.ProxyHost) {
+	w.line("root", "*", host.StaticRoot)
+}
+
+// writeFileServer writes the directives serving a static host's files.
+// Caddy sorts header directives by path length, so cache-control rules go
+// in a route block, which keeps them in the order written.
+func writeFileServer(w *caddyfileWriter, host models.ProxyHost) {
+	if len(host.StaticCacheControl) > 0 {
+		w.open("route")
+		defer w.close()
+	}
+
+	// Later header directives win, so the first matching rule is written last
+	for i := len(host.StaticCacheControl) - 1; i >= 0; i-- {
+		rule := host.StaticCacheControl[i]
+		name := fmt.Sprintf("@cache%d", i)
+		w.line(name, "path", rule.Path)
+		w.line("header", name, "Cache-Control", rule.Value)
+	}
+
+	indexNames := staticIndexNames(host)
+	if host.StaticSPAFallback {
+		w.line("try_files", "{path}", "{path}/", "/"+indexNames[0])
+	}
+
+	body := &caddyfileWriter{depth: w.depth + 1}
+	if host.StaticIndexFiles != "" {
+		body.line(append([]string{"index"}, indexNames...)...)
+	}
+	if host.StaticBrowse {
+		body.line("browse")
+	}
+	if host.StaticPrecompressed {
+		body.line("precompressed", "br", "zstd", "gzip")
+	}
+	if body.Len() == 0 {
+		w.line("file_server")
+		return
+	}
+	w.open("file_server")
+	w.raw(body.String())
+	w.close()
+}
+
+// unexportedFeatures lists the host settings the Caddyfile leaves out.
+func unexportedFeatures(host models.ProxyHost) []string {
+	notes := make([]string, 0)
+	if host.AccessList != nil {
+		notes = append(notes, fmt.Sprintf("access list %q", host.AccessList.Name))
+	}
+	if host.WAFMode != "" {
+		notes = append(notes, fmt.Sprintf("WAF in %s mode (coraza plugin)", host.WAFMode))
+	}
+	if host.CrowdSecEnabled {
+		notes = append(notes, "CrowdSec bouncer (caddy-crowdsec-bouncer plugin)")
+	}
+	if host.BlockExploits {
+		notes = append(notes, "exploit blocking")
+	}
+	if len(host.UpstreamGroups) > 0 {
+		notes = append(notes, "traffic split across upstream groups, the forward host is used instead")
+	}
+	for _, loc := range host.Locations {
+		switch {
+		case loc.AccessList != nil:
+			notes = append(notes, fmt.Sprintf("access list %q of location %s", loc.AccessList.Name, locationLabel(loc)))
+		case loc.DisableAccessList && host.AccessList != nil:
+			notes = append(notes, fmt.Sprintf("access list exemption of location %s", locationLabel(loc)))
+		}
+		if loc.EnableCompression != nil && !*loc.EnableCompression && host.EnableCompression {
+			notes = append(notes, fmt.Sprintf("compression disabled for location %s", locationLabel(loc)))
+		}
+	}
+	return notes
+}
+
+// hostLabel identifies a host in comments.
+func hostLabel(host models.ProxyHost) string {
+	if host.Name != "" && host.Name != host.DomainNames {
+		return fmt.Sprintf("%s (%s)", host.Name, host.DomainNames)
+	}
+	return host.DomainNames
+}
+
+// sortedFields returns the keys of a header or query matcher in order.
+func sortedFields(fields map[string][]string) []string {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
+// caddyfileWriter builds a Caddyfile with tab indentation.
+type caddyfileWriter struct {
+	b     strings.Builder
+	depth int
+}
+
+// line writes a directive, quoting tokens as needed.
+func (w *caddyfileWriter) line(tokens ...string) {
+	quoted := make([]string, len(tokens))
+	for i, token := range tokens {
+		quoted[i] = quoteToken(token)
+	}
+	w.b.WriteString(strings.Repeat("\t", w.depth))
+	w.b.WriteString(strings.Join(quoted, " "))
+	w.b.WriteString("\n")
+}
+
+// open starts a block, a global options block without tokens.
+func (w *caddyfileWriter) open(tokens ...string) {
+	if len(tokens) == 0 {
+		w.b.WriteString(strings.Repeat("\t", w.depth) + "{\n")
+	} else {
+		quoted := make([]string, len(tokens))
+		for i, token := range tokens {
+			quoted[i] = quoteToken(token)
+		}
+		w.b.WriteString(strings.Repeat("\t", w.depth) + strings.Join(quoted, " ") + " {\n")
+	}
+	w.depth++
+}
+
+func (w *caddyfileWriter) close() {
+	w.depth--
+	w.b.WriteString(strings.Repeat("\t", w.depth) + "}\n")
+}
+
+func (w *caddyfileWriter) comment(format string, args ...interface{}) {
+	w.b.WriteString(strings.Repeat("\t", w.depth) + "# " + fmt.Sprintf(format, args...) + "\n")
+}
+
+func (w *caddyfileWriter) blank() {
+	w.b.WriteString("\n")
+}
+
+// raw appends text written by another writer at the right depth.
+func (w *caddyfileWriter) raw(text string) {
+	w.b.WriteString(text)
+}
+
+func (w *caddyfileWriter) Len() int {
+	return w.b.Len()
+}
+
+func (w *caddyfileWriter) String() string {
+	return w.b.String()
+}
+
+// quoteToken quotes a Caddyfile token containing whitespace or quotes.
+func quoteToken(token string) string {
+	if token != "" && !strings.ContainsAny(token, " \t\n\"") {
+		return token
+	}
+	return `"` + strings.ReplaceAll(token, `"`, `\"`) + `"`
+}
@@ -0,0 +1,280 @@
+package caddy
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/models"
+)
+
+var caddyfileGenerated = time.Date(2026, 3, 1, 12, 30, 0, 0, time.UTC)
+
+func caddyfileHosts() []models.ProxyHost {
+	enabled := true
+	return []models.ProxyHost{
+		{
+			UUID:              "uuid-app",
+			Name:              "App",
+			DomainNames:       "app.example.com",
+			ForwardScheme:     "http",
+			ForwardHost:       "app",
+			ForwardPort:       8080,
+			Enabled:           true,
+			WebsocketSupport:  true,
+			EnableCompression: true,
+			HSTSEnabled:       true,
+			MaxBodySize:       1048576,
+			CertificateIssuer: IssuerLetsEncryptStaging,
+			RequestHeaders:    map[string][]string{"X-Forwarded-Env": {"prod"}},
+			ResponseHeaders:   map[string][]string{"Server": {}, "X-Frame-Options": {"DENY"}},
+			CrowdSecEnabled:   true,
+			BlockExploits:     true,
+			Locations: []models.Location{
+				{Path: "/grafana", ForwardScheme: "http", ForwardHost: "grafana", ForwardPort: 3000, StripPrefix: true},
+				{Path: "/api", Methods: "post, get", ForwardScheme: "https", ForwardHost: "api", ForwardPort: 9443, UpstreamTLSSkipVerify: &enabled},
+			},
+		},
+		{
+			UUID:          "uuid-old",
+			DomainNames:   "old.example.com",
+			ForwardScheme: "http",
+			ForwardHost:   "old",
+			ForwardPort:   80,
+		},
+		{
+			UUID:                "uuid-docs",
+			DomainNames:         "www.example.com",
+			HostType:            models.HostTypeStatic,
+			Enabled:             true,
+			CanonicalHost:       models.CanonicalHostWWW,
+			CertificateIssuer:   IssuerInternal,
+			StaticRoot:          "/srv/docs",
+			StaticSPAFallback:   true,
+			StaticPrecompressed: true,
+			StaticCacheControl: []models.CacheControlRule{
+				{Path: "/assets/*", Value: "public, max-age=31536000"},
+				{Path: "*", Value: "no-cache"},
+			},
+		},
+	}
+}
+
+func TestExportCaddyfile(t *testing.T) {
+	opts := ConfigOptions{
+		ACME:   ACMEOptions{Email: "admin@example.com"},
+		Server: ServerOptions{ReadHeaderTimeout: "10s", IdleTimeout: "5m"},
+	}
+
+	caddyfile, err := ExportCaddyfile(caddyfileHosts(), opts, caddyfileGenerated)
+	require.NoError(t, err)
+
+	assert.Equal(t, `# Generated by CPM+ at 2026-03-01T12:30:00Z
+
+{
+	email admin@example.com
+	servers {
+		timeouts {
+			read_header 10s
+			idle 5m
+		}
+	}
+}
+
+# App
+# Not exported: CrowdSec bouncer (caddy-crowdsec-bouncer plugin)
+# Not exported: exploit blocking
+app.example.com {
+	tls {
+		issuer acme {
+			dir https://acme-staging-v02.api.letsencrypt.org/directory
+			email admin@example.com
+		}
+	}
+	header -Server
+	header Strict-Transport-Security max-age=31536000
+	header X-Frame-Options DENY
+	request_header X-Forwarded-Env prod
+	request_body {
+		max_size 1048576
+	}
+	encode zstd gzip
+	@loc0 {
+		path /api /api/*
+		method POST GET
+	}
+	handle @loc0 {
+		reverse_proxy https://api:9443 {
+			header_up Connection {http.request.header.Connection}
+			header_up Upgrade {http.request.header.Upgrade}
+			transport http {
+				tls
+				tls_insecure_skip_verify
+			}
+		}
+	}
+	@loc1 {
+		path /grafana /grafana/*
+	}
+	handle @loc1 {
+		uri strip_prefix /grafana
+		reverse_proxy grafana:3000 {
+			header_up Connection {http.request.header.Connection}
+			header_up Upgrade {http.request.header.Upgrade}
+		}
+	}
+	handle {
+		reverse_proxy app:8080 {
+			header_up Connection {http.request.header.Connection}
+			header_up Upgrade {http.request.header.Upgrade}
+		}
+	}
+}
+
+# Disabled: old.example.com
+
+www.example.com {
+	tls internal
+	root * /srv/docs
+	route {
+		@cache1 path *
+		header @cache1 Cache-Control no-cache
+		@cache0 path /assets/*
+		header @cache0 Cache-Control "public, max-age=31536000"
+		try_files {path} {path}/ /index.html
+		file_server {
+			precompressed br zstd gzip
+		}
+	}
+}
+
+example.com {
+	redir https://www.example.com{uri} 308
+}
+`, caddyfile)
+}
+
+func TestExportCaddyfile_OnDemandAndCustomCA(t *testing.T) {
+	hosts := []models.ProxyHost{
+		{UUID: "uuid-tenants", DomainNames: "tenants.example.com", ForwardScheme: "http", ForwardHost: "saas", ForwardPort: 80, Enabled: true, OnDemandTLS: true},
+		{UUID: "uuid-internal", DomainNames: "a.corp.example, b.corp.example", ForwardScheme: "http", ForwardHost: "intranet", ForwardPort: 80, Enabled: true, CertificateIssuer: IssuerCustom},
+	}
+	opts := ConfigOptions{ACME: ACMEOptions{Directory: "https://ca.corp.example/acme/directory", CARoot: "/etc/ssl/corp-root.pem"}}
+
+	caddyfile, err := ExportCaddyfile(hosts, opts, caddyfileGenerated)
+	require.NoError(t, err)
+
+	assert.Contains(t, caddyfile, "\tacme_ca https://ca.corp.example/acme/directory\n\tacme_ca_root /etc/ssl/corp-root.pem\n")
+	assert.Contains(t, caddyfile, "\ton_demand_tls {\n\t\task "+DefaultOnDemandAskURL+"\n\t}\n")
+	assert.Contains(t, caddyfile, "https:// {\n\ttls {\n\t\ton_demand\n\t}\n")
+	assert.Contains(t, caddyfile, "a.corp.example, b.corp.example {\n")
+	assert.Contains(t, caddyfile, "\t\t\ttrusted_roots /etc/ssl/corp-root.pem\n")
+
+	hosts[1].CertificateIssuer = "unknown"
+	_, err = ExportCaddyfile(hosts, opts, caddyfileGenerated)
+	assert.ErrorContains(t, err, `unknown certificate issuer "unknown"`)
+}
+
+func TestManager_ExportCaddyfile(t *testing.T) {
+	manager, db := setupHistoryTest(t, (&fakeAdmin{}).ServeHTTP)
+	require.NoError(t, db.AutoMigrate(&models.RawRoute{}))
+	require.NoError(t, db.Create(&models.ProxyHost{
+		UUID: "uuid-app", DomainNames: "app.example.com", ForwardScheme: "http", ForwardHost: "app", ForwardPort: 8080, Enabled: true,
+		Locations: []models.Location{{UUID: "uuid-loc", Path: "/api", ForwardScheme: "http", ForwardHost: "api", ForwardPort: 9000}},
+	}).Error)
+	require.NoError(t, db.Create(&models.RawRoute{UUID: "uuid-raw", Name: "srv0 route 0", Route: `{"handle":[{"handler":"static_response"}]}`, Enabled: true}).Error)
+
+	caddyfile, err := manager.ExportCaddyfile(caddyfileGenerated)
+	require.NoError(t, err)
+
+	assert.Contains(t, caddyfile, "# 1 raw route(s) adopted from a Caddy JSON config are not exported\n")
+	assert.Contains(t, caddyfile, "app.example.com {\n")
+	assert.Contains(t, caddyfile, "\thandle @loc0 {\n\t\treverse_proxy api:9000\n\t}\n")
+}
+
+// recordedAdapt stands in for `caddy adapt` when no caddy binary is
+// installed, returning the output recorded for testdata/export.Caddyfile.
+type recordedAdapt struct {
+	t *testing.T
+}
+
+func (r recordedAdapt) Execute(name string, args ...string) ([]byte, error) {
+	caddyfile, err := os.ReadFile(args[len(args)-3])
+	require.NoError(r.t, err)
+	recorded, err := os.ReadFile(filepath.Join("testdata", "export.Caddyfile"))
+	require.NoError(r.t, err)
+	require.Equal(r.t, string(recorded), string(caddyfile),
+		"export changed, re-record testdata/export.Caddyfile and the output of caddy adapt --adapter caddyfile in testdata/export.json")
+	return os.ReadFile(filepath.Join("testdata", "export.json"))
+}
+
+// TestExportCaddyfile_RoundTrip adapts the export with the caddy binary, or
+// the recorded output without one, and imports it again, the hosts must
+// come back unchanged.
+func TestExportCaddyfile_RoundTrip(t *testing.T) {
+	hosts := caddyfileHosts()
+	caddyfile, err := ExportCaddyfile(hosts, ConfigOptions{}, caddyfileGenerated)
+	require.NoError(t, err)
+
+	path := filepath.Join(t.TempDir(), "Caddyfile")
+	require.NoError(t, os.WriteFile(path, []byte(caddyfile), 0o644))
+
+	importer := NewImporter("caddy")
+	if binary, err := exec.LookPath("caddy"); err == nil {
+		importer = NewImporter(binary)
+	} else {
+		importer.executor = recordedAdapt{t: t}
+	}
+	result, err := importer.ImportFile(path)
+	require.NoError(t, err)
+	imported := make(map[string]models.ProxyHost)
+	for _, host := range ConvertToProxyHosts(result.Hosts) {
+		imported[host.DomainNames] = host
+	}
+
+	for _, want := range hosts {
+		got, ok := imported[want.DomainNames]
+		if !want.Enabled {
+			assert.False(t, ok, "disabled host %s exported", want.DomainNames)
+			continue
+		}
+		require.True(t, ok, "host %s not imported", want.DomainNames)
+
+		assert.Equal(t, want.EnableCompression, got.EnableCompression, want.DomainNames)
+		assert.Equal(t, want.MaxBodySize, got.MaxBodySize, want.DomainNames)
+		assert.Equal(t, want.CertificateIssuer, got.CertificateIssuer, want.DomainNames)
+		assert.Equal(t, want.HSTSEnabled, got.HSTSEnabled, want.DomainNames)
+		assert.Equal(t, want.RequestHeaders, got.RequestHeaders, want.DomainNames)
+		assert.Equal(t, want.ResponseHeaders, got.ResponseHeaders, want.DomainNames)
+		if want.HostType == models.HostTypeStatic {
+			assert.Equal(t, models.HostTypeStatic, got.HostType, want.DomainNames)
+			assert.Equal(t, want.StaticRoot, got.StaticRoot, want.DomainNames)
+			assert.Equal(t, want.StaticSPAFallback, got.StaticSPAFallback, want.DomainNames)
+			assert.Equal(t, want.StaticPrecompressed, got.StaticPrecompressed, want.DomainNames)
+			assert.Equal(t, want.StaticCacheControl, got.StaticCacheControl, want.DomainNames)
+			continue
+		}
+
+		assert.Equal(t, want.WebsocketSupport, got.WebsocketSupport, want.DomainNames)
+
+		assert.Equal(t, want.ForwardScheme, got.ForwardScheme, want.DomainNames)
+		assert.Equal(t, want.ForwardHost, got.ForwardHost, want.DomainNames)
+		assert.Equal(t, want.ForwardPort, got.ForwardPort, want.DomainNames)
+		require.Len(t, got.Locations, len(want.Locations), want.DomainNames)
+		locations := make(map[string]models.Location)
+		for _, loc := range got.Locations {
+			locations[loc.Path] = loc
+		}
+		for _, loc := range want.Locations {
+			assert.Equal(t, loc.ForwardScheme, locations[loc.Path].ForwardScheme, loc.Path)
+			assert.Equal(t, loc.ForwardHost, locations[loc.Path].ForwardHost, loc.Path)
+			assert.Equal(t, loc.ForwardPort, locations[loc.Path].ForwardPort, loc.Path)
+			assert.Equal(t, loc.StripPrefix, locations[loc.Path].StripPrefix, loc.Path)
+		}
+	}
+}
@@ -1,31 +1,137 @@
 package caddy
 
 import (
+	"bufio"
 	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"net/http"
+	"os"
+	"regexp"
+	"strings"
 	"time"
 )
 
 // Client wraps the Caddy admin API.
 type Client struct {
-	baseURL    string
-	httpClient *http.Client
+	baseURL       string
+	httpClient    *http.Client
+	authorization string
+	origin        string
 }
 
-// NewClient creates a Caddy API client.
+// unixPrefix starts admin API addresses on a Unix socket, written as in
+// Caddy's admin listen option, e.g. "unix//run/caddy/admin.sock".
+const unixPrefix = "unix/"
+
+// ClientOptions secures the connection to the admin API.
+type ClientOptions struct {
+	Origin         string // Sent as the Origin header, for admin APIs enforcing origins
+	CACertFile     string // PEM CA verifying the admin API's certificate, e.g. Caddy's remote admin identity
+	ClientCertFile string // PEM client certificate for mutual TLS
+	ClientKeyFile  string // PEM key of the client certificate
+}
+
+// NewClient creates a Caddy API client for an admin API URL or a Unix
+// socket address.
 func NewClient(adminAPIURL string) *Client {
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	baseURL := adminAPIURL
+
+	if path, ok := unixSocketPath(adminAPIURL); ok {
+		transport.DialContext = func(ctx context.Context, _, _ string) (net.Conn, error) {
+			var dialer net.Dialer
+			return dialer.DialContext(ctx, "unix", path)
+		}
+		// Requests need a host, Caddy's own CLI uses the same one for sockets
+		baseURL = "http://127.0.0.1"
+	}
+
 	return &Client{
-		baseURL: adminAPIURL,
+		baseURL: baseURL,
 		httpClient: &http.Client{
-			Timeout: 30 * time.Second,
+			Timeout:   30 * time.Second,
+			Transport: transport,
 		},
 	}
 }
 
+// NewClientWithOptions creates a Caddy API client like NewClient, sending
+// opts.Origin and authenticating with a client certificate when set.
+func NewClientWithOptions(adminAPIURL string, opts ClientOptions) (*Client, error) {
+	client := NewClient(adminAPIURL)
+	client.origin = opts.Origin
+
+	if opts.CACertFile == "" && opts.ClientCertFile == "" && opts.ClientKeyFile == "" {
+		return client, nil
+	}
+	if !strings.HasPrefix(adminAPIURL, "https://") {
+		return nil, fmt.Errorf("TLS certificates require an https admin API URL, got %q", adminAPIURL)
+	}
+	if (opts.ClientCertFile == "") != (opts.ClientKeyFile == "") {
+		return nil, errors.New("client certificate and key must be set together")
+	}
+
+	tlsConfig := &tls.Config{MinVersion: tls.VersionTLS12}
+	if opts.CACertFile != "" {
+		pem, err := os.ReadFile(opts.CACertFile)
+		if err != nil {
+			return nil, fmt.Errorf("read CA certificate: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificates in %s", opts.CACertFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+	if opts.ClientCertFile != "" {
+		cert, err := tls.LoadX509KeyPair(opts.ClientCertFile, opts.ClientKeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("load client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+	client.httpClient.Transport.(*http.Transport).TLSClientConfig = tlsConfig
+
+	return client, nil
+}
+
+// unixSocketPath returns the socket path of a "unix//path" address,
+// without the optional "|0220" permission bits.
+func unixSocketPath(address string) (string, bool) {
+	if !strings.HasPrefix(address, unixPrefix) {
+		return "", false
+	}
+	path := strings.TrimPrefix(address, unixPrefix)
+	if i := strings.LastIndex(path, "|"); i >= 0 {
+		path = path[:i]
+	}
+	return path, true
+}
+
+// SetAuthorization sets the Authorization header sent with every request,
+// for admin APIs behind an authenticating proxy.
+func (c *Client) SetAuthorization(value string) {
+	c.authorization = value
+}
+
+// do sends req with the client's credentials and origin.
+func (c *Client) do(req *http.Request) (*http.Response, error) {
+	if c.authorization != "" {
+		req.Header.Set("Authorization", c.authorization)
+	}
+	if c.origin != "" {
+		req.Header.Set("Origin", c.origin)
+	}
+	return c.httpClient.Do(req)
+}
+
 // Load atomically replaces Caddy's entire configuration.
 // This is the primary method for applying configuration changes.
 func (c *Client) Load(ctx context.Context, config *Config) error {
@@ -40,7 +146,7 @@ func (c *Client) Load(ctx context.Context, config *Config) error {
 	}
 	req.Header.Set("Content-Type", "application/json")
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return fmt.Errorf("execute request: %w", err)
 	}
@@ -54,32 +160,96 @@ func (c *Client) Load(ctx context.Context, config *Config) error {
 	return nil
 }
 
-// GetConfig retrieves the current running configuration from Caddy.
-func (c *Client) GetConfig(ctx context.Context) (*Config, error) {
-	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/config/", nil)
+// PatchID replaces the config object tagged with an @id. path is the @id,
+// optionally followed by a path inside the object, e.g. "host_x/handle/0".
+func (c *Client) PatchID(ctx context.Context, path string, value interface{}) error {
+	return c.idRequest(ctx, http.MethodPatch, path, value)
+}
+
+// PutID creates a value inside the config object tagged with an @id, or
+// inserts it when path ends at an array index.
+func (c *Client) PutID(ctx context.Context, path string, value interface{}) error {
+	return c.idRequest(ctx, http.MethodPut, path, value)
+}
+
+// DeleteID removes the config object tagged with an @id, or a value inside it.
+func (c *Client) DeleteID(ctx context.Context, path string) error {
+	return c.idRequest(ctx, http.MethodDelete, path, nil)
+}
+
+// idRequest sends a request to /id/<path> with value, if any, as the JSON body.
+func (c *Client) idRequest(ctx context.Context, method, path string, value interface{}) error {
+	var body io.Reader
+	if value != nil {
+		raw, err := json.Marshal(value)
+		if err != nil {
+			return fmt.Errorf("marshal value: %w", err)
+		}
+		body = bytes.NewReader(raw)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, c.baseURL+"/id/"+path, body)
 	if err != nil {
-		return nil, fmt.Errorf("create request: %w", err)
+		return fmt.Errorf("create request: %w", err)
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
 	}
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
-		return nil, fmt.Errorf("execute request: %w", err)
+		return fmt.Errorf("execute request: %w", err)
 	}
 	defer resp.Body.Close()
 
 	if resp.StatusCode != http.StatusOK {
 		bodyBytes, _ := io.ReadAll(resp.Body)
-		return nil, fmt.Errorf("caddy returned status %d: %s", resp.StatusCode, string(bodyBytes))
+		return fmt.Errorf("caddy returned status %d: %s", resp.StatusCode, string(bodyBytes))
+	}
+
+	return nil
+}
+
+// GetConfig retrieves the current running configuration from Caddy.
+func (c *Client) GetConfig(ctx context.Context) (*Config, error) {
+	raw, err := c.GetRawConfig(ctx)
+	if err != nil {
+		return nil, err
 	}
 
 	var config Config
-	if err := json.NewDecoder(resp.Body).Decode(&config); err != nil {
+	if err := json.Unmarshal(raw, &config); err != nil {
 		return nil, fmt.Errorf("decode response: %w", err)
 	}
 
 	return &config, nil
 }
 
+// GetRawConfig fetches the running config as Caddy returns it, including
+// apps and fields Config doesn't model.
+func (c *Client) GetRawConfig(ctx context.Context) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/config/", nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return nil, fmt.Errorf("execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("read response: %w", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("caddy returned status %d: %s", resp.StatusCode, string(body))
+	}
+
+	return body, nil
+}
+
 // Ping checks if Caddy admin API is reachable.
 func (c *Client) Ping(ctx context.Context) error {
 	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/config/", nil)
@@ -87,7 +257,7 @@ func (c *Client) Ping(ctx context.Context) error {
 		return fmt.Errorf("create request: %w", err)
 	}
 
-	resp, err := c.httpClient.Do(req)
+	resp, err := c.do(req)
 	if err != nil {
 		return fmt.Errorf("caddy unreachable: %w", err)
 	}
@@ -99,3 +269,33 @@ func (c *Client) Ping(ctx context.Context) error {
 
 	return nil
 }
+
+// buildInfoPattern matches the build info gauge of the metrics endpoint.
+var buildInfoPattern = regexp.MustCompile(`^\w*build_info\{[^}]*\bversion="([^"]+)"`)
+
+// Version returns the Caddy version reported by the admin API's metrics
+// endpoint, or "" when the build does not report it.
+func (c *Client) Version(ctx context.Context) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, c.baseURL+"/metrics", nil)
+	if err != nil {
+		return "", fmt.Errorf("create request: %w", err)
+	}
+
+	resp, err := c.do(req)
+	if err != nil {
+		return "", fmt.Errorf("execute request: %w", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", nil
+	}
+
+	scanner := bufio.NewScanner(resp.Body)
+	for scanner.Scan() {
+		if m := buildInfoPattern.FindStringSubmatch(scanner.Text()); m != nil {
+			return m[1], nil
+		}
+	}
+	return "", scanner.Err()
+}
@@ -3,6 +3,7 @@ package caddy
 import (
 	"context"
 	"encoding/json"
+	"io"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -30,7 +31,7 @@ func TestClient_Load_Success(t *testing.T) {
 			ForwardPort: 8080,
 			Enabled:     true,
 		},
-	}, "/tmp/caddy-data", "admin@example.com")
+	}, "/tmp/caddy-data", ConfigOptions{ACME: ACMEOptions{Email: "admin@example.com"}})
 
 	err := client.Load(context.Background(), config)
 	require.NoError(t, err)
@@ -93,3 +94,37 @@ func TestClient_Ping_Unreachable(t *testing.T) {
 	err := client.Ping(context.Background())
 	require.Error(t, err)
 }
+
+func TestClient_IDRequests(t *testing.T) {
+	type request struct {
+		method, path string
+		body         string
+	}
+	var requests []request
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		requests = append(requests, request{r.Method, r.URL.Path, string(body)})
+		if r.URL.Path == "/id/missing" {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error": "unknown object ID 'missing'"}`))
+		}
+	}))
+	defer server.Close()
+
+	client := NewClient(server.URL)
+	ctx := context.Background()
+	require.NoError(t, client.PatchID(ctx, "host_a", &Route{ID: "host_a", Terminal: true}))
+	require.NoError(t, client.PutID(ctx, "host_a/handle/0", Handler{"handler": "encode"}))
+	require.NoError(t, client.DeleteID(ctx, "host_a"))
+
+	err := client.DeleteID(ctx, "missing")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "unknown object ID")
+
+	require.Equal(t, []request{
+		{http.MethodPatch, "/id/host_a", `{"@id":"host_a","handle":null,"terminal":true}`},
+		{http.MethodPut, "/id/host_a/handle/0", `{"handler":"encode"}`},
+		{http.MethodDelete, "/id/host_a", ""},
+		{http.MethodDelete, "/id/missing", ""},
+	}, requests)
+}
@@ -0,0 +1,136 @@
+package caddy
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/models"
+)
+
+// checkTransport exercises the client methods every transport must support.
+func checkTransport(t *testing.T, client *Client, admin *fakeAdmin) {
+	t.Helper()
+	ctx := context.Background()
+
+	require.NoError(t, client.Load(ctx, &Config{Apps: Apps{HTTP: &HTTPApp{Servers: map[string]*Server{
+		"cpm_server": {Listen: []string{":80"}},
+	}}}}))
+	require.NoError(t, client.Ping(ctx))
+	config, err := client.GetConfig(ctx)
+	require.NoError(t, err)
+	require.NotNil(t, config.Apps.HTTP)
+	assert.Equal(t, []string{":80"}, config.Apps.HTTP.Servers["cpm_server"].Listen)
+	assert.Equal(t, 1, admin.loads)
+}
+
+func TestClient_UnixSocket(t *testing.T) {
+	dir, err := os.MkdirTemp("", "cpm") // Short enough for a socket path
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	socket := filepath.Join(dir, "admin.sock")
+
+	listener, err := net.Listen("unix", socket)
+	require.NoError(t, err)
+	admin := &fakeAdmin{}
+	var origins []string
+	server := &http.Server{Handler: http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		origins = append(origins, r.Header.Get("Origin"))
+		admin.ServeHTTP(w, r)
+	})}
+	go server.Serve(listener)
+	defer server.Close()
+
+	// Permission bits are part of Caddy's listen address, not the path
+	client, err := NewClientWithOptions("unix/"+socket+"|0660", ClientOptions{Origin: "http://cpm.internal"})
+	require.NoError(t, err)
+	checkTransport(t, client, admin)
+	assert.Equal(t, []string{"http://cpm.internal", "http://cpm.internal", "http://cpm.internal"}, origins)
+
+	require.Error(t, NewClient("unix/"+filepath.Join(dir, "missing.sock")).Ping(context.Background()))
+}
+
+func TestClient_MutualTLS(t *testing.T) {
+	dir := t.TempDir()
+	clientCertFile, clientKeyFile, clientCert := writeTestCert(t, dir, "cpm")
+
+	admin := &fakeAdmin{}
+	server := httptest.NewUnstartedServer(admin)
+	clientCAs := x509.NewCertPool()
+	clientCAs.AddCert(clientCert)
+	server.TLS = &tls.Config{ClientAuth: tls.RequireAndVerifyClientCert, ClientCAs: clientCAs}
+	server.StartTLS()
+	defer server.Close()
+
+	caFile := filepath.Join(dir, "ca.pem")
+	require.NoError(t, os.WriteFile(caFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw}), 0o600))
+
+	client, err := NewClientWithOptions(server.URL, ClientOptions{CACertFile: caFile, ClientCertFile: clientCertFile, ClientKeyFile: clientKeyFile})
+	require.NoError(t, err)
+	checkTransport(t, client, admin)
+
+	// Fleet nodes take the same options
+	client, err = NodeClient(models.CaddyNode{AdminURL: server.URL, CACertFile: caFile, ClientCertFile: clientCertFile, ClientKeyFile: clientKeyFile})
+	require.NoError(t, err)
+	require.NoError(t, client.Ping(context.Background()))
+	_, err = NodeClient(models.CaddyNode{AdminURL: server.URL, ClientCertFile: clientCertFile})
+	assert.ErrorContains(t, err, "set together")
+
+	// Without a client certificate the admin API refuses the connection
+	client, err = NewClientWithOptions(server.URL, ClientOptions{CACertFile: caFile})
+	require.NoError(t, err)
+	require.Error(t, client.Ping(context.Background()))
+
+	// Misconfigurations are caught upfront
+	_, err = NewClientWithOptions("http://localhost:2019", ClientOptions{CACertFile: caFile})
+	assert.ErrorContains(t, err, "https")
+	_, err = NewClientWithOptions(server.URL, ClientOptions{ClientCertFile: clientCertFile})
+	assert.ErrorContains(t, err, "set together")
+	_, err = NewClientWithOptions(server.URL, ClientOptions{CACertFile: clientKeyFile})
+	assert.ErrorContains(t, err, "no certificates")
+	_, err = NewClientWithOptions(server.URL, ClientOptions{ClientCertFile: clientCertFile, ClientKeyFile: caFile})
+	assert.ErrorContains(t, err, "load client certificate")
+}
+
+// writeTestCert writes a self-signed client certificate and its key.
+func writeTestCert(t *testing.T, dir, name string) (certFile, keyFile string, cert *x509.Certificate) {
+	t.Helper()
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageClientAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	cert, err = x509.ParseCertificate(der)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certFile = filepath.Join(dir, name+".pem")
+	keyFile = filepath.Join(dir, name+"-key.pem")
+	require.NoError(t, os.WriteFile(certFile, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyFile, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+	return certFile, keyFile, cert
+}
@@ -1,16 +1,19 @@
 package caddy
 
 import (
+	"encoding/json"
 	"fmt"
+	"net/http"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/models"
 )
 
 // GenerateConfig creates a Caddy JSON configuration from proxy hosts.
 // This is the core transformation layer from our database model to Caddy config.
-func GenerateConfig(hosts []models.ProxyHost, storageDir string, acmeEmail string) (*Config, error) {
+func GenerateConfig(hosts []models.ProxyHost, storageDir string, opts ConfigOptions) (*Config, error) {
 	// Define log file paths
 	// We assume storageDir is like ".../data/caddy/data", so we go up to ".../data/logs"
 	// storageDir is .../data/caddy/data
@@ -18,6 +21,7 @@ func GenerateConfig(hosts []models.ProxyHost, storageDir string, acmeEmail strin
 	// Dir -> .../data
 	logDir := filepath.Join(filepath.Dir(filepath.Dir(storageDir)), "logs")
 	logFile := filepath.Join(logDir, "access.log")
+	wafAuditLog := filepath.Join(logDir, "waf-audit.log")
 
 	config := &Config{
 		Logging: &LoggingConfig{
@@ -50,34 +54,33 @@ func GenerateConfig(hosts []models.ProxyHost, storageDir string, acmeEmail strin
 		},
 	}
 
-	if acmeEmail != "" {
-		config.Apps.TLS = &TLSApp{
-			Automation: &AutomationConfig{
-				Policies: []*AutomationPolicy{
-					{
-						IssuersRaw: []interface{}{
-							map[string]interface{}{
-								"module": "acme",
-								"email":  acmeEmail,
-							},
-							map[string]interface{}{
-								"module": "zerossl",
-								"email":  acmeEmail,
-							},
-						},
-					},
-				},
-			},
-		}
+	tlsApp, err := buildTLSApp(hosts, opts)
+	if err != nil {
+		return nil, err
+	}
+	config.Apps.TLS = tlsApp
+
+	timeouts, err := parseServerTimeouts(opts.Server)
+	if err != nil {
+		return nil, err
+	}
+
+	crowdSec, err := buildCrowdSecApp(hosts, opts.CrowdSec)
+	if err != nil {
+		return nil, err
 	}
+	config.Apps.CrowdSec = crowdSec
 
-	if len(hosts) == 0 {
+	if len(hosts) == 0 && len(opts.RawRoutes) == 0 {
 		return config, nil
 	}
 
 	// We already initialized srv0 above, so we just append routes to it
 	routes := make([]*Route, 0)
 
+	// The on-demand TLS host has no host matcher, so it must come last
+	var catchAll *Route
+
 	for _, host := range hosts {
 		if !host.Enabled {
 			continue
@@ -88,52 +91,66 @@ func GenerateConfig(hosts []models.ProxyHost, storageDir string, acmeEmail strin
 		}
 
 		// Parse comma-separated domains
-		domains := strings.Split(host.DomainNames, ",")
-		for i := range domains {
-			domains[i] = strings.TrimSpace(domains[i])
+		domains := splitDomains(host.DomainNames)
+
+		// Routes from here on belong to this host
+		first := len(routes)
+
+		// Secondary www/apex names redirect to the canonical name
+		redirects, err := canonicalRedirectRoutes(host)
+		if err != nil {
+			return nil, err
+		}
+		routes = append(routes, redirects...)
+
+		features, err := hostFeatures(host, opts, wafAuditLog)
+		if err != nil {
+			return nil, err
 		}
 
 		// Build handlers for this host
-		handlers := make([]Handler, 0)
+		handlers, err := featureHandlers(host, features)
+		if err != nil {
+			return nil, fmt.Errorf("proxy host %s: %w", host.UUID, err)
+		}
 
-		// Add HSTS header if enabled
-		if host.HSTSEnabled {
-			hstsValue := "max-age=31536000"
-			if host.HSTSSubdomains {
-				hstsValue += "; includeSubDomains"
-			}
-			handlers = append(handlers, HeaderHandler(map[string][]string{
-				"Strict-Transport-Security": {hstsValue},
-			}))
+		// Handle custom locations first (more specific routes)
+		locRoutes, err := locationRoutes(host, domains, features)
+		if err != nil {
+			return nil, err
 		}
+		routes = append(routes, locRoutes...)
 
-		// Add exploit blocking if enabled
-		if host.BlockExploits {
-			handlers = append(handlers, BlockExploitsHandler())
+		// Main handler: static files, or a proxy split across upstream groups when configured
+		var mainHandlers []Handler
+		switch {
+		case host.HostType == models.HostTypeStatic:
+			static, err := staticHandlers(host, opts.StaticBaseDir)
+			if err != nil {
+				return nil, fmt.Errorf("proxy host %s: %w", host.UUID, err)
+			}
+			mainHandlers = append(handlers, static...)
+		case len(host.UpstreamGroups) > 0:
+			if err := ValidateUpstreamGroups(host.UpstreamGroups, host.SplitStickyCookie, host.SplitOverrideHeader); err != nil {
+				return nil, fmt.Errorf("proxy host %s: %w", host.UUID, err)
+			}
+			mainHandlers = append(handlers, TrafficSplitHandler(host, features))
+		default:
+			mainHandlers = append(handlers, proxyHandler(host, features, host.ForwardScheme, host.ForwardHost, host.ForwardPort))
 		}
 
-		// Handle custom locations first (more specific routes)
-		for _, loc := range host.Locations {
-			dial := fmt.Sprintf("%s:%d", loc.ForwardHost, loc.ForwardPort)
-			locRoute := &Route{
-				Match: []Match{
-					{
-						Host: domains,
-						Path: []string{loc.Path, loc.Path + "/*"},
-					},
-				},
-				Handle: []Handler{
-					ReverseProxyHandler(dial, host.WebsocketSupport),
-				},
+		if host.OnDemandTLS {
+			if catchAll != nil {
+				return nil, fmt.Errorf("proxy host %s: only one on-demand TLS host is allowed", host.UUID)
+			}
+			catchAll = &Route{
+				Handle:   mainHandlers,
 				Terminal: true,
 			}
-			routes = append(routes, locRoute)
+			tagHostRoutes(host.UUID, catchAll, routes[first:])
+			continue
 		}
 
-		// Main proxy handler
-		dial := fmt.Sprintf("%s:%d", host.ForwardHost, host.ForwardPort)
-		mainHandlers := append(handlers, ReverseProxyHandler(dial, host.WebsocketSupport))
-
 		route := &Route{
 			Match: []Match{
 				{Host: domains},
@@ -141,11 +158,28 @@ func GenerateConfig(hosts []models.ProxyHost, storageDir string, acmeEmail strin
 			Handle:   mainHandlers,
 			Terminal: true,
 		}
+		tagHostRoutes(host.UUID, route, routes[first:])
 
 		routes = append(routes, route)
 	}
 
-	config.Apps.HTTP.Servers["cpm_server"] = &Server{
+	// Adopted routes no host represents, before the catch-all like any host
+	for _, raw := range opts.RawRoutes {
+		if !raw.Enabled {
+			continue
+		}
+		route := &Route{}
+		if err := json.Unmarshal([]byte(raw.Route), route); err != nil {
+			return nil, fmt.Errorf("raw route %s: %w", raw.UUID, err)
+		}
+		routes = append(routes, route)
+	}
+
+	if catchAll != nil {
+		routes = append(routes, catchAll)
+	}
+
+	server := &Server{
 		Listen: []string{":80", ":443"},
 		Routes: routes,
 		AutoHTTPS: &AutoHTTPSConfig{
@@ -156,6 +190,141 @@ func GenerateConfig(hosts []models.ProxyHost, storageDir string, acmeEmail strin
 			DefaultLoggerName: "access_log",
 		},
 	}
+	timeouts.applyTo(server)
+	config.Apps.HTTP.Servers["cpm_server"] = server
 
 	return config, nil
 }
+
+// splitDomains parses a comma-separated domain list, dropping empty entries.
+func splitDomains(domainNames string) []string {
+	domains := make([]string, 0)
+	for _, d := range strings.Split(domainNames, ",") {
+		if d = strings.TrimSpace(d); d != "" {
+			domains = append(domains, d)
+		}
+	}
+	return domains
+}
+
+// buildCrowdSecApp configures the bouncer when an enabled host uses CrowdSec.
+func buildCrowdSecApp(hosts []models.ProxyHost, opts CrowdSecOptions) (*CrowdSecApp, error) {
+	for _, host := range hosts {
+		if !host.Enabled || !host.CrowdSecEnabled {
+			continue
+		}
+		if opts.APIURL == "" || opts.APIKey == "" {
+			return nil, fmt.Errorf("proxy host %s: CrowdSec requires a LAPI URL and bouncer key", host.UUID)
+		}
+		return &CrowdSecApp{APIURL: opts.APIURL, APIKey: opts.APIKey}, nil
+	}
+	return nil, nil
+}
+
+// canonicalRedirectRoutes builds the permanent redirects from a host's
+// secondary www/apex names to its canonical names, keeping path and query.
+func canonicalRedirectRoutes(host models.ProxyHost) ([]*Route, error) {
+	switch host.CanonicalHost {
+	case models.CanonicalHostNone:
+		return nil, nil
+	case models.CanonicalHostApex, models.CanonicalHostWWW:
+	default:
+		return nil, fmt.Errorf("proxy host %s: invalid canonical host %q", host.UUID, host.CanonicalHost)
+	}
+
+	routes := make([]*Route, 0)
+	for _, alias := range models.CanonicalAliases(host.DomainNames, host.CanonicalHost) {
+		target := strings.TrimPrefix(alias, "www.")
+		if host.CanonicalHost == models.CanonicalHostWWW {
+			target = "www." + alias
+		}
+		routes = append(routes, &Route{
+			Match: []Match{{Host: []string{alias}}},
+			Handle: []Handler{
+				RedirectHandler("https://"+target+"{http.request.uri}", http.StatusPermanentRedirect),
+			},
+			Terminal: true,
+		})
+	}
+	return routes, nil
+}
+
+// hostSubjects returns the names a host needs certificates for,
+// including its canonical redirect aliases.
+func hostSubjects(host models.ProxyHost) []string {
+	return append(splitDomains(host.DomainNames), models.CanonicalAliases(host.DomainNames, host.CanonicalHost)...)
+}
+
+// upstreamTransport builds the reverse_proxy HTTP transport for a host's
+// upstream timeouts and, when tls is non-nil, an https upstream.
+// It returns nil when the host uses Caddy's defaults.
+func upstreamTransport(host models.ProxyHost, tls map[string]interface{}) map[string]interface{} {
+	if host.ResponseHeaderTimeout == "" && host.UpstreamIdleTimeout == "" && host.UpstreamKeepAlive == "" && tls == nil {
+		return nil
+	}
+
+	transport := map[string]interface{}{
+		"protocol": "http",
+	}
+	if tls != nil {
+		transport["tls"] = tls
+	}
+	if host.ResponseHeaderTimeout != "" {
+		transport["response_header_timeout"] = host.ResponseHeaderTimeout
+	}
+
+	keepAlive := map[string]interface{}{}
+	if host.UpstreamKeepAlive == "off" {
+		keepAlive["enabled"] = false
+	} else if host.UpstreamKeepAlive != "" {
+		keepAlive["probe_interval"] = host.UpstreamKeepAlive
+	}
+	if host.UpstreamIdleTimeout != "" {
+		keepAlive["idle_timeout"] = host.UpstreamIdleTimeout
+	}
+	if len(keepAlive) > 0 {
+		transport["keep_alive"] = keepAlive
+	}
+
+	return transport
+}
+
+// serverTimeouts holds parsed server-level timeouts.
+type serverTimeouts struct {
+	read, readHeader, write, idle Duration
+}
+
+// parseServerTimeouts parses the server timeout settings. Empty values keep Caddy's defaults.
+func parseServerTimeouts(opts ServerOptions) (serverTimeouts, error) {
+	var t serverTimeouts
+	fields := []struct {
+		name  string
+		value string
+		dest  *Duration
+	}{
+		{"read", opts.ReadTimeout, &t.read},
+		{"read header", opts.ReadHeaderTimeout, &t.readHeader},
+		{"write", opts.WriteTimeout, &t.write},
+		{"idle", opts.IdleTimeout, &t.idle},
+	}
+
+	for _, f := range fields {
+		if f.value == "" {
+			continue
+		}
+		d, err := time.ParseDuration(f.value)
+		if err != nil || d < 0 {
+			return t, fmt.Errorf("invalid server %s timeout: %s", f.name, f.value)
+		}
+		*f.dest = Duration(d)
+	}
+
+	return t, nil
+}
+
+func (t serverTimeouts) applyTo(server *Server) {
+	server.ReadTimeout = t.read
+	server.ReadHeaderTimeout = t.readHeader
+	server.WriteTimeout = t.write
+	server.IdleTimeout = t.idle
+}
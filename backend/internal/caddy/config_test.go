@@ -1,7 +1,9 @@
 package caddy
 
 import (
+	"encoding/json"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/require"
 
@@ -9,7 +11,7 @@ import (
 )
 
 func TestGenerateConfig_Empty(t *testing.T) {
-	config, err := GenerateConfig([]models.ProxyHost{}, "/tmp/caddy-data", "admin@example.com")
+	config, err := GenerateConfig([]models.ProxyHost{}, "/tmp/caddy-data", ConfigOptions{ACME: ACMEOptions{Email: "admin@example.com"}})
 	require.NoError(t, err)
 	require.NotNil(t, config)
 	require.NotNil(t, config.Apps.HTTP)
@@ -31,7 +33,7 @@ func TestGenerateConfig_SingleHost(t *testing.T) {
 		},
 	}
 
-	config, err := GenerateConfig(hosts, "/tmp/caddy-data", "admin@example.com")
+	config, err := GenerateConfig(hosts, "/tmp/caddy-data", ConfigOptions{ACME: ACMEOptions{Email: "admin@example.com"}})
 	require.NoError(t, err)
 	require.NotNil(t, config)
 	require.NotNil(t, config.Apps.HTTP)
@@ -71,7 +73,7 @@ func TestGenerateConfig_MultipleHosts(t *testing.T) {
 		},
 	}
 
-	config, err := GenerateConfig(hosts, "/tmp/caddy-data", "admin@example.com")
+	config, err := GenerateConfig(hosts, "/tmp/caddy-data", ConfigOptions{ACME: ACMEOptions{Email: "admin@example.com"}})
 	require.NoError(t, err)
 	require.Len(t, config.Apps.HTTP.Servers["cpm_server"].Routes, 2)
 }
@@ -88,7 +90,7 @@ func TestGenerateConfig_WebSocketEnabled(t *testing.T) {
 		},
 	}
 
-	config, err := GenerateConfig(hosts, "/tmp/caddy-data", "admin@example.com")
+	config, err := GenerateConfig(hosts, "/tmp/caddy-data", ConfigOptions{ACME: ACMEOptions{Email: "admin@example.com"}})
 	require.NoError(t, err)
 
 	route := config.Apps.HTTP.Servers["cpm_server"].Routes[0]
@@ -109,14 +111,14 @@ func TestGenerateConfig_EmptyDomain(t *testing.T) {
 		},
 	}
 
-	_, err := GenerateConfig(hosts, "/tmp/caddy-data", "admin@example.com")
+	_, err := GenerateConfig(hosts, "/tmp/caddy-data", ConfigOptions{ACME: ACMEOptions{Email: "admin@example.com"}})
 	require.Error(t, err)
 	require.Contains(t, err.Error(), "empty domain")
 }
 
 func TestGenerateConfig_Logging(t *testing.T) {
 	hosts := []models.ProxyHost{}
-	config, err := GenerateConfig(hosts, "/tmp/caddy-data", "admin@example.com")
+	config, err := GenerateConfig(hosts, "/tmp/caddy-data", ConfigOptions{ACME: ACMEOptions{Email: "admin@example.com"}})
 	require.NoError(t, err)
 
 	// Verify logging configuration
@@ -154,7 +156,7 @@ func TestGenerateConfig_Advanced(t *testing.T) {
 		},
 	}
 
-	config, err := GenerateConfig(hosts, "/tmp/caddy-data", "admin@example.com")
+	config, err := GenerateConfig(hosts, "/tmp/caddy-data", ConfigOptions{ACME: ACMEOptions{Email: "admin@example.com"}})
 	require.NoError(t, err)
 	require.NotNil(t, config)
 
@@ -189,3 +191,157 @@ func TestGenerateConfig_Advanced(t *testing.T) {
 	require.Equal(t, "headers", hstsHandler["handler"])
 	// We can't easily check the map content without casting, but we know it's there.
 }
+
+func TestGenerateConfig_RequestLimitsAndTimeouts(t *testing.T) {
+	hosts := []models.ProxyHost{
+		{
+			UUID:                  "uuid-cloud",
+			DomainNames:           "cloud.example.com",
+			ForwardHost:           "nextcloud",
+			ForwardPort:           80,
+			Enabled:               true,
+			MaxBodySize:           10 << 30,
+			ResponseHeaderTimeout: "5m",
+			UpstreamIdleTimeout:   "2m",
+			UpstreamKeepAlive:     "30s",
+		},
+		{
+			UUID:              "uuid-api",
+			DomainNames:       "api.example.com",
+			ForwardHost:       "api",
+			ForwardPort:       8080,
+			Enabled:           true,
+			MaxBodySize:       1 << 20,
+			UpstreamKeepAlive: "off",
+		},
+	}
+
+	opts := ConfigOptions{Server: ServerOptions{ReadTimeout: "30s", WriteTimeout: "1m", IdleTimeout: "5m"}}
+	config, err := GenerateConfig(hosts, "/tmp/caddy-data", opts)
+	require.NoError(t, err)
+	require.NoError(t, Validate(config))
+
+	server := config.Apps.HTTP.Servers["cpm_server"]
+	require.Equal(t, Duration(30*time.Second), server.ReadTimeout)
+	require.Zero(t, server.ReadHeaderTimeout)
+	require.Equal(t, Duration(time.Minute), server.WriteTimeout)
+	require.Equal(t, Duration(5*time.Minute), server.IdleTimeout)
+
+	serverJSON, err := json.Marshal(server)
+	require.NoError(t, err)
+	require.Contains(t, string(serverJSON), `"read_timeout":"30s"`)
+	require.NotContains(t, string(serverJSON), `read_header_timeout`)
+
+	cloud := server.Routes[0].Handle
+	require.Equal(t, "request_body", cloud[0]["handler"])
+	require.Equal(t, int64(10<<30), cloud[0]["max_size"])
+	require.Equal(t, map[string]interface{}{
+		"protocol":                "http",
+		"response_header_timeout": "5m",
+		"keep_alive": map[string]interface{}{
+			"probe_interval": "30s",
+			"idle_timeout":   "2m",
+		},
+	}, cloud[len(cloud)-1]["transport"])
+
+	api := server.Routes[1].Handle
+	require.Equal(t, int64(1<<20), api[0]["max_size"])
+	require.Equal(t, map[string]interface{}{
+		"protocol":   "http",
+		"keep_alive": map[string]interface{}{"enabled": false},
+	}, api[len(api)-1]["transport"])
+}
+
+func TestGenerateConfig_NoTransportByDefault(t *testing.T) {
+	hosts := []models.ProxyHost{
+		{UUID: "uuid-1", DomainNames: "a.example.com", ForwardHost: "app", ForwardPort: 80, Enabled: true},
+	}
+
+	config, err := GenerateConfig(hosts, "/tmp/caddy-data", ConfigOptions{})
+	require.NoError(t, err)
+
+	handlers := config.Apps.HTTP.Servers["cpm_server"].Routes[0].Handle
+	require.Len(t, handlers, 1)
+	require.NotContains(t, handlers[0], "transport")
+}
+
+func TestGenerateConfig_InvalidServerTimeout(t *testing.T) {
+	_, err := GenerateConfig([]models.ProxyHost{}, "/tmp/caddy-data", ConfigOptions{Server: ServerOptions{WriteTimeout: "soon"}})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "invalid server write timeout")
+
+	_, err = GenerateConfig([]models.ProxyHost{}, "/tmp/caddy-data", ConfigOptions{Server: ServerOptions{IdleTimeout: "-1s"}})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "invalid server idle timeout")
+}
+
+func TestGenerateConfig_CanonicalHostRedirect(t *testing.T) {
+	hosts := []models.ProxyHost{
+		{UUID: "uuid-apex", DomainNames: "example.com, *.example.com", ForwardHost: "app", ForwardPort: 80, Enabled: true, CanonicalHost: models.CanonicalHostApex, CertificateIssuer: IssuerZeroSSL},
+		{UUID: "uuid-www", DomainNames: "www.shop.com", ForwardHost: "shop", ForwardPort: 80, Enabled: true, CanonicalHost: models.CanonicalHostWWW},
+	}
+
+	config, err := GenerateConfig(hosts, "/tmp/caddy-data", ConfigOptions{ACME: ACMEOptions{Email: "admin@example.com"}})
+	require.NoError(t, err)
+	require.NoError(t, Validate(config))
+
+	routes := config.Apps.HTTP.Servers["cpm_server"].Routes
+	require.Len(t, routes, 4)
+
+	// Wildcards get no alias
+	require.Equal(t, []string{"www.example.com"}, routes[0].Match[0].Host)
+	require.Equal(t, "static_response", routes[0].Handle[0]["handler"])
+	require.Equal(t, 308, routes[0].Handle[0]["status_code"])
+	require.Equal(t, map[string][]string{"Location": {"https://example.com{http.request.uri}"}}, routes[0].Handle[0]["headers"])
+	require.Equal(t, []string{"example.com", "*.example.com"}, routes[1].Match[0].Host)
+
+	require.Equal(t, []string{"shop.com"}, routes[2].Match[0].Host)
+	require.Equal(t, map[string][]string{"Location": {"https://www.shop.com{http.request.uri}"}}, routes[2].Handle[0]["headers"])
+
+	policies := config.Apps.TLS.Automation.Policies
+	require.Equal(t, []string{"example.com", "*.example.com", "www.example.com"}, policies[0].Subjects)
+}
+
+func TestGenerateConfig_InvalidCanonicalHost(t *testing.T) {
+	hosts := []models.ProxyHost{
+		{UUID: "uuid-1", DomainNames: "example.com", ForwardHost: "app", ForwardPort: 80, Enabled: true, CanonicalHost: "mobile"},
+	}
+
+	_, err := GenerateConfig(hosts, "/tmp/caddy-data", ConfigOptions{})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "invalid canonical host")
+}
+
+func TestGenerateConfig_CrowdSec(t *testing.T) {
+	hosts := []models.ProxyHost{
+		{UUID: "uuid-1", DomainNames: "app.example.com", ForwardHost: "app", ForwardPort: 80, Enabled: true, CrowdSecEnabled: true, HSTSEnabled: true},
+		{UUID: "uuid-2", DomainNames: "internal.example.com", ForwardHost: "internal", ForwardPort: 80, Enabled: true},
+	}
+	opts := ConfigOptions{CrowdSec: CrowdSecOptions{APIURL: "http://crowdsec:8080", APIKey: "bouncer-key"}}
+
+	config, err := GenerateConfig(hosts, "/tmp/caddy-data", opts)
+	require.NoError(t, err)
+	require.NoError(t, Validate(config))
+	require.Equal(t, &CrowdSecApp{APIURL: "http://crowdsec:8080", APIKey: "bouncer-key"}, config.Apps.CrowdSec)
+
+	routes := config.Apps.HTTP.Servers["cpm_server"].Routes
+	require.Equal(t, "crowdsec", routes[0].Handle[0]["handler"])
+	require.Equal(t, "headers", routes[0].Handle[1]["handler"])
+	require.Equal(t, "reverse_proxy", routes[1].Handle[0]["handler"])
+
+	// Without a host using it the bouncer is not configured
+	hosts[0].CrowdSecEnabled = false
+	config, err = GenerateConfig(hosts, "/tmp/caddy-data", opts)
+	require.NoError(t, err)
+	require.Nil(t, config.Apps.CrowdSec)
+
+	hosts[0].CrowdSecEnabled = true
+	_, err = GenerateConfig(hosts, "/tmp/caddy-data", ConfigOptions{})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "CrowdSec requires a LAPI URL and bouncer key")
+
+	opts.CrowdSec.APIURL = "crowdsec:8080"
+	config, err = GenerateConfig(hosts, "/tmp/caddy-data", opts)
+	require.NoError(t, err)
+	require.ErrorContains(t, Validate(config), "invalid CrowdSec LAPI URL")
+}
@@ -0,0 +1,218 @@
+package caddy
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// Change operations.
+const (
+	ChangeAdd     = "add"
+	ChangeRemove  = "remove"
+	ChangeReplace = "replace"
+)
+
+// GlobalGroup is the diff group for everything outside the HTTP routes:
+// TLS automation, logging, apps and server settings.
+const GlobalGroup = "global"
+
+// Change is a single difference between two configs. Path is a JSON
+// pointer relative to the group, e.g. "/0/handle/1/upstreams/0/dial".
+type Change struct {
+	Path   string      `json:"path"`
+	Op     string      `json:"op"`
+	Before interface{} `json:"before,omitempty"`
+	After  interface{} `json:"after,omitempty"`
+}
+
+// HostDiff groups the changes to the routes of one host, identified by
+// the host matcher of its routes ("*" for the catch-all), or to the
+// global settings.
+type HostDiff struct {
+	Host    string   `json:"host"`
+	Status  string   `json:"status"` // "added", "removed" or "changed"
+	Changes []Change `json:"changes"`
+}
+
+// ConfigDiff is a structural diff between two configs, grouped by host.
+type ConfigDiff struct {
+	Changed bool       `json:"changed"`
+	Hosts   []HostDiff `json:"hosts"`
+}
+
+// DiffConfigs compares two configs. A nil config is treated as empty.
+func DiffConfigs(before, after *Config) (*ConfigDiff, error) {
+	beforeGlobal, beforeRoutes, err := splitConfig(before)
+	if err != nil {
+		return nil, err
+	}
+	afterGlobal, afterRoutes, err := splitConfig(after)
+	if err != nil {
+		return nil, err
+	}
+
+	diff := &ConfigDiff{Hosts: []HostDiff{}}
+
+	if changes := diffValues("", beforeGlobal, afterGlobal); len(changes) > 0 {
+		diff.Hosts = append(diff.Hosts, HostDiff{Host: GlobalGroup, Status: "changed", Changes: changes})
+	}
+
+	keys := make([]string, 0, len(beforeRoutes)+len(afterRoutes))
+	for key := range beforeRoutes {
+		keys = append(keys, key)
+	}
+	for key := range afterRoutes {
+		if _, ok := beforeRoutes[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		b, inBefore := beforeRoutes[key]
+		a, inAfter := afterRoutes[key]
+
+		status := "changed"
+		switch {
+		case !inBefore:
+			status = "added"
+		case !inAfter:
+			status = "removed"
+		}
+
+		changes := diffValues("", b, a)
+		if len(changes) == 0 {
+			continue
+		}
+		diff.Hosts = append(diff.Hosts, HostDiff{Host: key, Status: status, Changes: changes})
+	}
+
+	diff.Changed = len(diff.Hosts) > 0
+	return diff, nil
+}
+
+// splitConfig converts a config to generic JSON and separates the HTTP
+// routes, grouped by host, from the rest of the config.
+func splitConfig(cfg *Config) (map[string]interface{}, map[string][]interface{}, error) {
+	global := map[string]interface{}{}
+	routes := map[string][]interface{}{}
+	if cfg == nil {
+		return global, routes, nil
+	}
+
+	raw, err := json.Marshal(cfg)
+	if err != nil {
+		return nil, nil, fmt.Errorf("marshal config: %w", err)
+	}
+	if err := json.Unmarshal(raw, &global); err != nil {
+		return nil, nil, fmt.Errorf("unmarshal config: %w", err)
+	}
+
+	apps, _ := global["apps"].(map[string]interface{})
+	httpApp, _ := apps["http"].(map[string]interface{})
+	servers, _ := httpApp["servers"].(map[string]interface{})
+	for _, s := range servers {
+		server, _ := s.(map[string]interface{})
+		serverRoutes, _ := server["routes"].([]interface{})
+		for _, route := range serverRoutes {
+			key := routeHostKey(route)
+			routes[key] = append(routes[key], route)
+		}
+		delete(server, "routes")
+	}
+
+	return global, routes, nil
+}
+
+// routeHostKey identifies the host a generic route belongs to.
+func routeHostKey(route interface{}) string {
+	r, _ := route.(map[string]interface{})
+	match, _ := r["match"].([]interface{})
+	if len(match) == 0 {
+		return "*"
+	}
+	first, _ := match[0].(map[string]interface{})
+	hosts, _ := first["host"].([]interface{})
+	if len(hosts) == 0 {
+		return "*"
+	}
+
+	names := make([]string, 0, len(hosts))
+	for _, h := range hosts {
+		names = append(names, fmt.Sprint(h))
+	}
+	return strings.Join(names, ", ")
+}
+
+// diffValues compares two generic JSON values. Objects are compared by
+// key and arrays by index.
+func diffValues(path string, before, after interface{}) []Change {
+	if reflect.DeepEqual(before, after) {
+		return nil
+	}
+	if before == nil {
+		return []Change{{Path: pathOrRoot(path), Op: ChangeAdd, After: after}}
+	}
+	if after == nil {
+		return []Change{{Path: pathOrRoot(path), Op: ChangeRemove, Before: before}}
+	}
+
+	switch b := before.(type) {
+	case map[string]interface{}:
+		a, ok := after.(map[string]interface{})
+		if !ok {
+			break
+		}
+		keys := make([]string, 0, len(b)+len(a))
+		for k := range b {
+			keys = append(keys, k)
+		}
+		for k := range a {
+			if _, ok := b[k]; !ok {
+				keys = append(keys, k)
+			}
+		}
+		sort.Strings(keys)
+
+		changes := make([]Change, 0)
+		for _, k := range keys {
+			changes = append(changes, diffValues(path+"/"+escapePointer(k), b[k], a[k])...)
+		}
+		return changes
+
+	case []interface{}:
+		a, ok := after.([]interface{})
+		if !ok {
+			break
+		}
+		changes := make([]Change, 0)
+		for i := 0; i < len(b) || i < len(a); i++ {
+			var bv, av interface{}
+			if i < len(b) {
+				bv = b[i]
+			}
+			if i < len(a) {
+				av = a[i]
+			}
+			changes = append(changes, diffValues(fmt.Sprintf("%s/%d", path, i), bv, av)...)
+		}
+		return changes
+	}
+
+	return []Change{{Path: pathOrRoot(path), Op: ChangeReplace, Before: before, After: after}}
+}
+
+func pathOrRoot(path string) string {
+	if path == "" {
+		return "/"
+	}
+	return path
+}
+
+// escapePointer escapes a key for use in a JSON pointer (RFC 6901).
+func escapePointer(key string) string {
+	return strings.ReplaceAll(strings.ReplaceAll(key, "~", "~0"), "/", "~1")
+}
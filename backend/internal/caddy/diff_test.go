@@ -0,0 +1,63 @@
+package caddy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/models"
+)
+
+func TestDiffConfigs(t *testing.T) {
+	before, err := GenerateConfig([]models.ProxyHost{
+		{UUID: "a", DomainNames: "a.example.com", ForwardHost: "a", ForwardPort: 80, Enabled: true},
+		{UUID: "b", DomainNames: "b.example.com", ForwardHost: "b", ForwardPort: 80, Enabled: true},
+	}, "/tmp/caddy-data", ConfigOptions{})
+	require.NoError(t, err)
+
+	after, err := GenerateConfig([]models.ProxyHost{
+		{UUID: "a", DomainNames: "a.example.com", ForwardHost: "a", ForwardPort: 8080, Enabled: true},
+		{UUID: "c", DomainNames: "c.example.com", ForwardHost: "c", ForwardPort: 80, Enabled: true},
+	}, "/tmp/caddy-data", ConfigOptions{ACME: ACMEOptions{Email: "admin@example.com"}})
+	require.NoError(t, err)
+
+	diff, err := DiffConfigs(before, after)
+	require.NoError(t, err)
+	require.True(t, diff.Changed)
+	require.Len(t, diff.Hosts, 4)
+
+	// Global settings first, then hosts in name order
+	require.Equal(t, GlobalGroup, diff.Hosts[0].Host)
+	require.Equal(t, "/apps/tls", diff.Hosts[0].Changes[0].Path)
+	require.Equal(t, ChangeAdd, diff.Hosts[0].Changes[0].Op)
+
+	require.Equal(t, HostDiff{
+		Host:   "a.example.com",
+		Status: "changed",
+		Changes: []Change{{
+			Path:   "/0/handle/0/upstreams/0/dial",
+			Op:     ChangeReplace,
+			Before: "a:80",
+			After:  "a:8080",
+		}},
+	}, diff.Hosts[1])
+
+	require.Equal(t, "b.example.com", diff.Hosts[2].Host)
+	require.Equal(t, "removed", diff.Hosts[2].Status)
+	require.Equal(t, ChangeRemove, diff.Hosts[2].Changes[0].Op)
+
+	require.Equal(t, "c.example.com", diff.Hosts[3].Host)
+	require.Equal(t, "added", diff.Hosts[3].Status)
+
+	// Identical configs
+	diff, err = DiffConfigs(after, after)
+	require.NoError(t, err)
+	require.False(t, diff.Changed)
+	require.Empty(t, diff.Hosts)
+
+	// Against nothing everything is added
+	diff, err = DiffConfigs(nil, before)
+	require.NoError(t, err)
+	require.True(t, diff.Changed)
+	require.Equal(t, "added", diff.Hosts[len(diff.Hosts)-1].Status)
+}
@@ -0,0 +1,181 @@
+package caddy
+
+import (
+	"fmt"
+
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/models"
+)
+
+// routeFeatures are the per-route settings a location inherits from its host
+// and may override.
+type routeFeatures struct {
+	websocket       bool
+	compression     bool
+	accessList      *models.AccessList
+	requestHeaders  map[string][]string
+	responseHeaders map[string][]string
+	tlsSkipVerify   bool
+	tlsServerName   string
+	geoIPDatabase   string
+	wafAuditLog     string
+}
+
+// hostFeatures returns the features of a host's main route.
+// WAF audit entries are written to wafAuditLog.
+func hostFeatures(host models.ProxyHost, opts ConfigOptions, wafAuditLog string) (routeFeatures, error) {
+	if host.AccessListID != nil && host.AccessList == nil {
+		fmt.Printf("warning: proxy host %s: access list %d not found, not enforced\n", host.UUID, *host.AccessListID)
+	}
+
+	return routeFeatures{
+		websocket:       host.WebsocketSupport,
+		compression:     host.EnableCompression,
+		accessList:      host.AccessList,
+		requestHeaders:  host.RequestHeaders,
+		responseHeaders: host.ResponseHeaders,
+		tlsSkipVerify:   host.UpstreamTLSSkipVerify,
+		tlsServerName:   host.UpstreamTLSServerName,
+		geoIPDatabase:   opts.GeoIPDatabase,
+		wafAuditLog:     wafAuditLog,
+	}, nil
+}
+
+// locationFeatures applies a location's overrides to the host's features.
+func locationFeatures(host routeFeatures, loc models.Location) (routeFeatures, error) {
+	f := host
+
+	if loc.WebsocketSupport != nil {
+		f.websocket = *loc.WebsocketSupport
+	}
+	if loc.EnableCompression != nil {
+		f.compression = *loc.EnableCompression
+	}
+
+	switch {
+	case loc.DisableAccessList:
+		f.accessList = nil
+	case loc.AccessListID != nil:
+		// A deleted list is skipped like on the host, the location keeps the host's
+		if loc.AccessList == nil {
+			fmt.Printf("warning: location %s: access list %d not found, not enforced\n", loc.Path, *loc.AccessListID)
+			break
+		}
+		f.accessList = loc.AccessList
+	}
+
+	f.requestHeaders = mergeHeaders(host.requestHeaders, loc.RequestHeaders)
+	f.responseHeaders = mergeHeaders(host.responseHeaders, loc.ResponseHeaders)
+
+	// The location proxies to its own upstream, so only the
+	// verification policy carries over, not the server name.
+	if loc.UpstreamTLSSkipVerify != nil {
+		f.tlsSkipVerify = *loc.UpstreamTLSSkipVerify
+	}
+	f.tlsServerName = loc.UpstreamTLSServerName
+
+	return f, nil
+}
+
+// mergeHeaders overlays override onto base, replacing whole headers by name.
+func mergeHeaders(base, override map[string][]string) map[string][]string {
+	if len(override) == 0 {
+		return base
+	}
+
+	merged := make(map[string][]string, len(base)+len(override))
+	for name, values := range base {
+		merged[name] = values
+	}
+	for name, values := range override {
+		merged[name] = values
+	}
+	return merged
+}
+
+// featureHandlers returns the handlers that run before any rewrite or proxy
+// on a host or location route, in order: CrowdSec, HSTS, exploit blocking,
+// access control, body limit, WAF, compression and custom headers.
+func featureHandlers(host models.ProxyHost, f routeFeatures) ([]Handler, error) {
+	handlers := make([]Handler, 0)
+
+	// Banned clients are rejected before anything else runs
+	if host.CrowdSecEnabled {
+		handlers = append(handlers, CrowdSecHandler())
+	}
+
+	// Add HSTS header if enabled
+	if host.HSTSEnabled {
+		hstsValue := "max-age=31536000"
+		if host.HSTSSubdomains {
+			hstsValue += "; includeSubDomains"
+		}
+		handlers = append(handlers, HeaderHandler(map[string][]string{
+			"Strict-Transport-Security": {hstsValue},
+		}))
+	}
+
+	// Add exploit blocking if enabled
+	if host.BlockExploits {
+		handlers = append(handlers, BlockExploitsHandler())
+	}
+
+	accessHandler, err := AccessListHandler(f.accessList, f.geoIPDatabase)
+	if err != nil {
+		return nil, err
+	}
+	if accessHandler != nil {
+		handlers = append(handlers, accessHandler)
+	}
+
+	// Reject request bodies over the host's limit
+	if host.MaxBodySize > 0 {
+		handlers = append(handlers, RequestBodyHandler(host.MaxBodySize))
+	}
+
+	waf, err := WAFHandler(host, f.wafAuditLog)
+	if err != nil {
+		return nil, err
+	}
+	if waf != nil {
+		handlers = append(handlers, waf)
+	}
+
+	if f.compression {
+		handlers = append(handlers, EncodeHandler())
+	}
+
+	if len(f.requestHeaders) > 0 || len(f.responseHeaders) > 0 {
+		handlers = append(handlers, CustomHeadersHandler(f.requestHeaders, f.responseHeaders))
+	}
+
+	return handlers, nil
+}
+
+// proxyHandler creates the reverse_proxy handler for a single upstream,
+// with the host's timeouts and TLS when the scheme is https.
+func proxyHandler(host models.ProxyHost, f routeFeatures, scheme, forwardHost string, forwardPort int) Handler {
+	dial := fmt.Sprintf("%s:%d", forwardHost, forwardPort)
+	handler := ReverseProxyHandler(dial, f.websocket)
+
+	var tls map[string]interface{}
+	if scheme == "https" {
+		tls = upstreamTLS(f)
+	}
+	if transport := upstreamTransport(host, tls); transport != nil {
+		handler["transport"] = transport
+	}
+
+	return handler
+}
+
+// upstreamTLS builds the transport TLS settings for an https upstream.
+func upstreamTLS(f routeFeatures) map[string]interface{} {
+	tls := map[string]interface{}{}
+	if f.tlsSkipVerify {
+		tls["insecure_skip_verify"] = true
+	}
+	if f.tlsServerName != "" {
+		tls["server_name"] = f.tlsServerName
+	}
+	return tls
+}
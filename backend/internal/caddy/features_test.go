@@ -0,0 +1,304 @@
+package caddy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/models"
+)
+
+func boolPtr(b bool) *bool { return &b }
+
+func handlerTypes(handlers []Handler) []string {
+	types := make([]string, 0, len(handlers))
+	for _, h := range handlers {
+		types = append(types, h["handler"].(string))
+	}
+	return types
+}
+
+func featureHost(locations ...models.Location) models.ProxyHost {
+	listID := uint(1)
+	return models.ProxyHost{
+		UUID:             "uuid-app",
+		DomainNames:      "app.example.com",
+		ForwardScheme:    "http",
+		ForwardHost:      "app",
+		ForwardPort:      8080,
+		Enabled:          true,
+		HSTSEnabled:      true,
+		BlockExploits:    true,
+		WebsocketSupport: true,
+		MaxBodySize:      1 << 20,
+		AccessListID:     &listID,
+		AccessList: &models.AccessList{
+			ID:      listID,
+			Name:    "office",
+			Type:    AccessListAllow,
+			Rules:   `[{"address": "10.0.0.0/8"}]`,
+			Enabled: true,
+		},
+		EnableCompression: true,
+		RequestHeaders:    map[string][]string{"X-Forwarded-App": {"app"}},
+		ResponseHeaders:   map[string][]string{"X-Frame-Options": {"DENY"}, "Server": {}},
+		Locations:         locations,
+	}
+}
+
+func TestGenerateConfig_LocationInheritsHostHandlers(t *testing.T) {
+	host := featureHost(models.Location{Path: "/grafana", ForwardScheme: "http", ForwardHost: "grafana", ForwardPort: 3000, StripPrefix: true})
+
+	config, err := GenerateConfig([]models.ProxyHost{host}, "/tmp/caddy-data", ConfigOptions{})
+	require.NoError(t, err)
+	require.NoError(t, Validate(config))
+
+	routes := config.Apps.HTTP.Servers["cpm_server"].Routes
+	require.Len(t, routes, 2)
+
+	expected := []string{"headers", "vars", "subroute", "request_body", "encode", "headers"}
+	require.Equal(t, append(expected, "rewrite", "reverse_proxy"), handlerTypes(routes[0].Handle))
+	require.Equal(t, append(expected, "reverse_proxy"), handlerTypes(routes[1].Handle))
+
+	// Everything before the rewrite is identical to the host's route
+	for i := range expected {
+		require.Equal(t, routes[1].Handle[i], routes[0].Handle[i])
+	}
+
+	// Websocket support is inherited as well
+	require.Contains(t, routes[0].Handle[len(routes[0].Handle)-1], "headers")
+}
+
+func TestGenerateConfig_LocationOverrides(t *testing.T) {
+	publicList := &models.AccessList{ID: 2, Name: "vpn", Type: AccessListDeny, Rules: `[{"address": "192.0.2.1"}]`, Enabled: true}
+	listID := uint(2)
+
+	host := featureHost(
+		models.Location{
+			Path:              "/health",
+			ForwardScheme:     "http",
+			ForwardHost:       "app",
+			ForwardPort:       8081,
+			DisableAccessList: true,
+			EnableCompression: boolPtr(false),
+			WebsocketSupport:  boolPtr(false),
+		},
+		models.Location{
+			Path:                  "/legacy",
+			ForwardScheme:         "https",
+			ForwardHost:           "legacy.internal",
+			ForwardPort:           443,
+			AccessListID:          &listID,
+			AccessList:            publicList,
+			RequestHeaders:        map[string][]string{"X-Forwarded-App": {"legacy"}},
+			ResponseHeaders:       map[string][]string{"X-Frame-Options": {"SAMEORIGIN"}},
+			UpstreamTLSSkipVerify: boolPtr(true),
+			UpstreamTLSServerName: "legacy.example.com",
+		},
+	)
+
+	config, err := GenerateConfig([]models.ProxyHost{host}, "/tmp/caddy-data", ConfigOptions{})
+	require.NoError(t, err)
+	require.NoError(t, Validate(config))
+
+	routes := config.Apps.HTTP.Servers["cpm_server"].Routes
+	require.Len(t, routes, 3)
+
+	health, legacy := routes[0], routes[1]
+	require.Equal(t, []string{"/legacy", "/legacy/*"}, legacy.Match[0].Path)
+
+	require.Equal(t, []string{"headers", "vars", "request_body", "headers", "reverse_proxy"}, handlerTypes(health.Handle))
+	require.NotContains(t, health.Handle[4], "headers")
+
+	require.Equal(t, []string{"headers", "vars", "subroute", "request_body", "encode", "headers", "reverse_proxy"}, handlerTypes(legacy.Handle))
+	accessJSON, err := json.Marshal(legacy.Handle[2])
+	require.NoError(t, err)
+	require.Contains(t, string(accessJSON), `"ranges":["192.0.2.1"]`)
+	require.NotContains(t, string(accessJSON), `"not"`)
+
+	require.Equal(t, CustomHeadersHandler(
+		map[string][]string{"X-Forwarded-App": {"legacy"}},
+		map[string][]string{"X-Frame-Options": {"SAMEORIGIN"}, "Server": {}},
+	), legacy.Handle[5])
+
+	require.Equal(t, map[string]interface{}{
+		"protocol": "http",
+		"tls": map[string]interface{}{
+			"insecure_skip_verify": true,
+			"server_name":          "legacy.example.com",
+		},
+	}, legacy.Handle[6]["transport"])
+
+	// Host upstream is plain http, so it has no transport
+	main := routes[2].Handle
+	require.NotContains(t, main[len(main)-1], "transport")
+}
+
+func TestGenerateConfig_HostUpstreamTLS(t *testing.T) {
+	host := models.ProxyHost{
+		UUID:                  "uuid-tls",
+		DomainNames:           "nas.example.com",
+		ForwardScheme:         "https",
+		ForwardHost:           "nas",
+		ForwardPort:           5001,
+		Enabled:               true,
+		UpstreamTLSSkipVerify: true,
+		Locations: []models.Location{
+			{Path: "/api", ForwardScheme: "https", ForwardHost: "nas-api", ForwardPort: 5002},
+		},
+	}
+
+	config, err := GenerateConfig([]models.ProxyHost{host}, "/tmp/caddy-data", ConfigOptions{})
+	require.NoError(t, err)
+
+	routes := config.Apps.HTTP.Servers["cpm_server"].Routes
+	tlsOnly := map[string]interface{}{
+		"protocol": "http",
+		"tls":      map[string]interface{}{"insecure_skip_verify": true},
+	}
+	require.Equal(t, tlsOnly, routes[0].Handle[0]["transport"])
+	require.Equal(t, tlsOnly, routes[1].Handle[0]["transport"])
+}
+
+func TestGenerateConfig_MissingAccessList(t *testing.T) {
+	listID := uint(7)
+	host := models.ProxyHost{UUID: "uuid-1", DomainNames: "a.example.com", ForwardHost: "app", ForwardPort: 80, Enabled: true, AccessListID: &listID}
+
+	// A deleted list is skipped rather than blocking every apply
+	config, err := GenerateConfig([]models.ProxyHost{host}, "/tmp/caddy-data", ConfigOptions{})
+	require.NoError(t, err)
+	handle := config.Apps.HTTP.Servers["cpm_server"].Routes[0].Handle
+	require.Len(t, handle, 1)
+	require.Equal(t, "reverse_proxy", handle[0]["handler"])
+
+	host.Locations = []models.Location{{Path: "/api", ForwardHost: "api", ForwardPort: 80, AccessListID: &listID}}
+	_, err = GenerateConfig([]models.ProxyHost{host}, "/tmp/caddy-data", ConfigOptions{})
+	require.NoError(t, err)
+}
+
+func TestAccessListHandler(t *testing.T) {
+	h, err := AccessListHandler(&models.AccessList{Name: "off", Type: AccessListAllow, Enabled: false}, "")
+	require.NoError(t, err)
+	require.Nil(t, h)
+
+	h, err = AccessListHandler(&models.AccessList{Name: "empty", Type: AccessListAllow, Enabled: true}, "")
+	require.NoError(t, err)
+	require.Equal(t, StatusHandler(http.StatusForbidden), h)
+
+	h, err = AccessListHandler(&models.AccessList{
+		Name:    "admins",
+		Type:    AccessListBasicAuth,
+		Rules:   `[{"username": "admin", "password": "$2a$14$Zkx19XLiW6VYouLHR5NmfOFU0z2GTNmpkT/5qqR7hx4IjWJPDhjvG"}]`,
+		Enabled: true,
+	}, "")
+	require.NoError(t, err)
+	require.Equal(t, "authentication", h["handler"])
+
+	// Types that cannot be rendered yet are skipped
+	h, err = AccessListHandler(&models.AccessList{Name: "sso", Type: AccessListForwardAuth, Enabled: true}, "")
+	require.NoError(t, err)
+	require.Nil(t, h)
+
+	tests := []struct {
+		name string
+		list models.AccessList
+		want string
+	}{
+		{"bad json", models.AccessList{Type: AccessListAllow, Rules: "nope"}, "invalid rules"},
+		{"bad address", models.AccessList{Type: AccessListDeny, Rules: `[{"address": "10.0.0.300"}]`}, "invalid address"},
+		{"plain password", models.AccessList{Type: AccessListBasicAuth, Rules: `[{"username": "a", "password": "secret"}]`}, "bcrypt"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.list.Enabled = true
+			_, err := AccessListHandler(&tt.list, "")
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tt.want)
+		})
+	}
+}
+
+func TestAccessListHandler_Countries(t *testing.T) {
+	const db = "/data/geoip/GeoLite2-Country.mmdb"
+
+	h, err := AccessListHandler(&models.AccessList{
+		Name:    "office",
+		Type:    AccessListAllow,
+		Rules:   `[{"address": "10.0.0.0/8"}, {"country": "de"}, {"country": "AT"}]`,
+		Enabled: true,
+	}, db)
+	require.NoError(t, err)
+	routes := h["routes"].([]*Route)
+	require.Len(t, routes, 1)
+	// Rejected unless the address or the country is listed
+	require.Equal(t, []Match{{Not: []Match{
+		{RemoteIP: &MatchRemoteIP{Ranges: []string{"10.0.0.0/8"}}},
+		{MaxMind: &MatchMaxMind{DBPath: db, AllowCountries: []string{"DE", "AT"}}},
+	}}}, routes[0].Match)
+
+	h, err = AccessListHandler(&models.AccessList{
+		Name:    "blocked",
+		Type:    AccessListDeny,
+		Rules:   `[{"country": "KP"}]`,
+		Enabled: true,
+	}, db)
+	require.NoError(t, err)
+	routes = h["routes"].([]*Route)
+	require.Equal(t, []Match{{MaxMind: &MatchMaxMind{DBPath: db, AllowCountries: []string{"KP"}}}}, routes[0].Match)
+
+	_, err = AccessListHandler(&models.AccessList{Name: "no-db", Type: AccessListDeny, Rules: `[{"country": "KP"}]`, Enabled: true}, "")
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "require a GeoIP database")
+
+	_, err = AccessListHandler(&models.AccessList{Name: "bad", Type: AccessListDeny, Rules: `[{"country": "Germany"}]`, Enabled: true}, db)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "invalid country code")
+}
+
+func TestManager_ApplyConfig_LocationAccessList(t *testing.T) {
+	var loaded []byte
+	caddyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/load" {
+			loaded, _ = io.ReadAll(r.Body)
+		}
+		w.WriteHeader(http.StatusOK)
+	}))
+	defer caddyServer.Close()
+
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.ProxyHost{}, &models.Location{}, &models.UpstreamGroup{}, &models.AccessList{}, &models.Setting{}, &models.CaddyConfig{}))
+
+	list := models.AccessList{UUID: "list-1", Name: "office", Type: AccessListAllow, Rules: `[{"address": "10.0.0.0/8"}]`, Enabled: true}
+	require.NoError(t, db.Create(&list).Error)
+
+	host := models.ProxyHost{
+		UUID:        "uuid-app",
+		DomainNames: "app.example.com",
+		ForwardHost: "app",
+		ForwardPort: 8080,
+		Locations: []models.Location{
+			{UUID: "loc-1", Path: "/admin", ForwardHost: "admin", ForwardPort: 9000, AccessListID: &list.ID},
+		},
+	}
+	require.NoError(t, db.Create(&host).Error)
+
+	manager := NewManager(NewClient(caddyServer.URL), db, t.TempDir())
+	require.NoError(t, manager.ApplyConfig(context.Background()))
+
+	var config Config
+	require.NoError(t, json.Unmarshal(loaded, &config))
+	routes := config.Apps.HTTP.Servers["cpm_server"].Routes
+	require.Len(t, routes, 2)
+	require.Contains(t, handlerTypes(routes[0].Handle), "subroute")
+	require.NotContains(t, handlerTypes(routes[1].Handle), "subroute")
+}
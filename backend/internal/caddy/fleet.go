@@ -0,0 +1,188 @@
+package caddy
+
+import (
+	"context"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"time"
+
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/models"
+)
+
+// NodeClient creates the admin API client for a Caddy node.
+func NodeClient(node models.CaddyNode) (*Client, error) {
+	client, err := NewClientWithOptions(node.AdminURL, ClientOptions{
+		Origin:         node.Origin,
+		CACertFile:     node.CACertFile,
+		ClientCertFile: node.ClientCertFile,
+		ClientKeyFile:  node.ClientKeyFile,
+	})
+	if err != nil {
+		return nil, err
+	}
+	switch node.AuthType {
+	case models.NodeAuthBasic:
+		credentials := base64.StdEncoding.EncodeToString([]byte(node.AuthUser + ":" + node.AuthSecret))
+		client.SetAuthorization("Basic " + credentials)
+	case models.NodeAuthBearer:
+		client.SetAuthorization("Bearer " + node.AuthSecret)
+	}
+	return client, nil
+}
+
+// NodeConfig generates the config for the hosts assigned to node.
+func (m *Manager) NodeConfig(node models.CaddyNode) (*Config, error) {
+	all, err := m.loadAllHosts()
+	if err != nil {
+		return nil, err
+	}
+	hosts := make([]models.ProxyHost, 0)
+	for _, host := range all {
+		if host.OnNode(node) {
+			hosts = append(hosts, host)
+		}
+	}
+
+	// Adopted raw routes stay on the local Caddy they came from
+	config, err := GenerateConfig(hosts, filepath.Join(m.configDir, "data"), m.loadConfigOptions())
+	if err != nil {
+		return nil, fmt.Errorf("generate config: %w", err)
+	}
+	if err := Validate(config); err != nil {
+		return nil, fmt.Errorf("validation failed: %w", err)
+	}
+	return config, nil
+}
+
+// ApplyNode loads the node's generated config into it and records the outcome.
+func (m *Manager) ApplyNode(ctx context.Context, node *models.CaddyNode) error {
+	m.applyMu.Lock()
+	defer m.applyMu.Unlock()
+	return m.applyNode(ctx, node, true)
+}
+
+// applyNodes applies the config of every enabled node, skipping nodes
+// already running it.
+func (m *Manager) applyNodes(ctx context.Context) error {
+	nodes, err := m.enabledNodes()
+	if err != nil {
+		return err
+	}
+
+	var errs []error
+	for i := range nodes {
+		if err := m.applyNode(ctx, &nodes[i], false); err != nil {
+			errs = append(errs, fmt.Errorf("node %s: %w", nodes[i].Name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// allNodes lists all Caddy nodes.
+func (m *Manager) allNodes() ([]models.CaddyNode, error) {
+	var nodes []models.CaddyNode
+	if !m.db.Migrator().HasTable(&models.CaddyNode{}) {
+		return nil, nil
+	}
+	if err := m.db.Order("name ASC").Find(&nodes).Error; err != nil {
+		return nil, fmt.Errorf("fetch caddy nodes: %w", err)
+	}
+	return nodes, nil
+}
+
+// enabledNodes lists the enabled Caddy nodes.
+func (m *Manager) enabledNodes() ([]models.CaddyNode, error) {
+	var nodes []models.CaddyNode
+	if !m.db.Migrator().HasTable(&models.CaddyNode{}) {
+		return nil, nil
+	}
+	if err := m.db.Where("enabled = ?", true).Order("name ASC").Find(&nodes).Error; err != nil {
+		return nil, fmt.Errorf("fetch caddy nodes: %w", err)
+	}
+	return nodes, nil
+}
+
+func (m *Manager) applyNode(ctx context.Context, node *models.CaddyNode, force bool) error {
+	config, err := m.NodeConfig(*node)
+	if err == nil {
+		var hash string
+		if hash, err = configHash(config); err == nil {
+			if !force && node.AppliedHash == hash && node.ApplyError == "" && node.InSync {
+				return nil
+			}
+			var client *Client
+			if client, err = NodeClient(*node); err == nil {
+				err = client.Load(ctx, config)
+			}
+			if err == nil {
+				node.AppliedHash = hash
+				node.LiveHash = hash
+				node.InSync = true
+				node.Reachable = true
+			}
+		}
+	}
+
+	now := time.Now()
+	node.LastApplied = &now
+	node.ApplyError = ""
+	if err != nil {
+		node.ApplyError = err.Error()
+	}
+	m.saveNodeStatus(node)
+	return err
+}
+
+// CheckNode fetches the node's running config and version and records
+// whether it still runs its generated config.
+func (m *Manager) CheckNode(ctx context.Context, node *models.CaddyNode) error {
+	err := m.checkNode(ctx, node)
+	now := time.Now()
+	node.LastChecked = &now
+	m.saveNodeStatus(node)
+	return err
+}
+
+func (m *Manager) checkNode(ctx context.Context, node *models.CaddyNode) error {
+	client, err := NodeClient(*node)
+	if err != nil {
+		node.Reachable = false
+		node.InSync = false
+		return fmt.Errorf("admin API client: %w", err)
+	}
+	live, err := client.GetRawConfig(ctx)
+	if err != nil {
+		node.Reachable = false
+		node.InSync = false
+		return fmt.Errorf("get live config: %w", err)
+	}
+	node.Reachable = true
+
+	// Best effort, not every build reports it
+	if version, err := client.Version(ctx); err == nil && version != "" {
+		node.Version = version
+	}
+
+	if node.LiveHash, err = rawConfigHash(live); err != nil {
+		return err
+	}
+	expected, err := m.NodeConfig(*node)
+	if err != nil {
+		node.InSync = false
+		return err
+	}
+	expectedHash, err := configHash(expected)
+	if err != nil {
+		return err
+	}
+	node.InSync = node.LiveHash == expectedHash
+	return nil
+}
+
+// saveNodeStatus stores the status fields of node.
+func (m *Manager) saveNodeStatus(node *models.CaddyNode) {
+	// Best effort, like the config audit trail
+	m.db.Model(node).Select("last_applied", "apply_error", "applied_hash", "last_checked", "reachable", "in_sync", "live_hash", "version").Updates(node)
+}
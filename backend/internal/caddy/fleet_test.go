@@ -0,0 +1,145 @@
+package caddy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/models"
+)
+
+// liveDomains returns the host matchers of a fake admin's live config.
+func liveDomains(t *testing.T, admin *fakeAdmin) []string {
+	t.Helper()
+	admin.mu.Lock()
+	defer admin.mu.Unlock()
+
+	var config Config
+	require.NoError(t, json.Unmarshal(admin.live, &config))
+	domains := []string{}
+	for _, route := range serverRoutes(&config) {
+		for _, match := range route.Match {
+			domains = append(domains, match.Host...)
+		}
+	}
+	return domains
+}
+
+func TestManager_Nodes(t *testing.T) {
+	local := &fakeAdmin{}
+	manager, db := setupHistoryTest(t, local.ServeHTTP)
+	require.NoError(t, db.AutoMigrate(&models.CaddyNode{}))
+
+	eu := &fakeAdmin{}
+	euServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if user, pass, ok := r.BasicAuth(); !ok || user != "cpm" || pass != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		if r.URL.Path == "/metrics" {
+			w.Write([]byte("# HELP caddy_build_info Caddy build\ncaddy_build_info{version=\"v2.9.1\"} 1\n"))
+			return
+		}
+		eu.ServeHTTP(w, r)
+	}))
+	defer euServer.Close()
+	us := &fakeAdmin{}
+	usServer := httptest.NewServer(us)
+	defer usServer.Close()
+
+	euNode := models.CaddyNode{UUID: "uuid-eu1", Name: "eu1", AdminURL: euServer.URL, AuthType: models.NodeAuthBasic, AuthUser: "cpm", AuthSecret: "secret", Labels: []string{"eu"}, Enabled: true}
+	usNode := models.CaddyNode{UUID: "uuid-us1", Name: "us1", AdminURL: usServer.URL, Labels: []string{"us"}, Enabled: true}
+	require.NoError(t, db.Create(&euNode).Error)
+	require.NoError(t, db.Create(&usNode).Error)
+
+	require.NoError(t, db.Create(&models.ProxyHost{UUID: "uuid-a", DomainNames: "a.example.com", ForwardHost: "a", ForwardPort: 80, Enabled: true}).Error)
+	require.NoError(t, db.Create(&models.ProxyHost{UUID: "uuid-b", DomainNames: "b.example.com", ForwardHost: "b", ForwardPort: 80, Enabled: true, Nodes: []string{"eu"}}).Error)
+	require.NoError(t, db.Create(&models.ProxyHost{UUID: "uuid-c", DomainNames: "c.example.com", ForwardHost: "c", ForwardPort: 80, Enabled: true, Nodes: []string{"us1", models.LocalNode}}).Error)
+
+	// Each Caddy gets the hosts assigned to it
+	require.NoError(t, manager.ApplyConfig(context.Background()))
+	assert.ElementsMatch(t, []string{"a.example.com", "c.example.com"}, liveDomains(t, local))
+	assert.Equal(t, []string{"b.example.com"}, liveDomains(t, eu))
+	assert.Equal(t, []string{"c.example.com"}, liveDomains(t, us))
+
+	var stored models.CaddyNode
+	stored = models.CaddyNode{}
+	require.NoError(t, db.First(&stored, euNode.ID).Error)
+	assert.NotNil(t, stored.LastApplied)
+	assert.Empty(t, stored.ApplyError)
+	assert.True(t, stored.InSync)
+	assert.NotEmpty(t, stored.AppliedHash)
+
+	// Unchanged nodes are not reloaded
+	require.NoError(t, db.Model(&models.ProxyHost{}).Where("uuid = ?", "uuid-a").Update("forward_port", 81).Error)
+	require.NoError(t, manager.ApplyConfig(context.Background()))
+	assert.Equal(t, 1, eu.loads)
+	assert.Equal(t, 1, us.loads)
+
+	// An unreachable node doesn't fail the apply
+	us.mu.Lock()
+	us.down = true
+	us.mu.Unlock()
+	require.NoError(t, db.Model(&models.ProxyHost{}).Where("uuid = ?", "uuid-c").Update("forward_port", 81).Error)
+	require.NoError(t, manager.ApplyConfig(context.Background()))
+	stored = models.CaddyNode{}
+	require.NoError(t, db.First(&stored, usNode.ID).Error)
+	assert.Contains(t, stored.ApplyError, "503")
+
+	// Checks track version and drift
+	stored = models.CaddyNode{}
+	require.NoError(t, db.First(&stored, euNode.ID).Error)
+	require.NoError(t, manager.CheckNode(context.Background(), &stored))
+	assert.True(t, stored.Reachable)
+	assert.True(t, stored.InSync)
+	assert.Equal(t, "v2.9.1", stored.Version)
+
+	eu.set(`{"apps": {}}`)
+	require.NoError(t, manager.CheckNode(context.Background(), &stored))
+	assert.False(t, stored.InSync)
+	stored = models.CaddyNode{}
+	require.NoError(t, db.First(&stored, euNode.ID).Error)
+	assert.False(t, stored.InSync)
+	assert.NotNil(t, stored.LastChecked)
+
+	stored = models.CaddyNode{}
+	require.NoError(t, db.First(&stored, usNode.ID).Error)
+	require.Error(t, manager.CheckNode(context.Background(), &stored))
+	assert.False(t, stored.Reachable)
+}
+
+func TestReconciler_Nodes(t *testing.T) {
+	manager, db := setupHistoryTest(t, (&fakeAdmin{}).ServeHTTP)
+	require.NoError(t, db.AutoMigrate(&models.CaddyNode{}))
+
+	edge := &fakeAdmin{}
+	edgeServer := httptest.NewServer(edge)
+	defer edgeServer.Close()
+	require.NoError(t, db.Create(&models.CaddyNode{UUID: "uuid-edge", Name: "edge", AdminURL: edgeServer.URL, Enabled: true}).Error)
+	require.NoError(t, db.Create(&models.ProxyHost{UUID: "uuid-a", DomainNames: "a.example.com", ForwardHost: "a", ForwardPort: 80, Enabled: true, Nodes: []string{"edge"}}).Error)
+
+	notifier := &recordingNotifier{}
+	reconciler := NewReconciler(manager, notifier, 0)
+	require.NoError(t, reconciler.ApplyStartup(context.Background()))
+	assert.Equal(t, 1, edge.loads)
+
+	// Drift is reapplied by default
+	edge.set(`{"apps": {}}`)
+	require.NoError(t, reconciler.ReconcileNodes(context.Background()))
+	assert.Equal(t, 2, edge.loads)
+	assert.Equal(t, []string{"a.example.com"}, liveDomains(t, edge))
+
+	// ...or notified once
+	require.NoError(t, db.Create(&models.Setting{Key: DriftActionSetting, Value: DriftActionNotify}).Error)
+	edge.set(`{"apps": {}}`)
+	require.NoError(t, reconciler.ReconcileNodes(context.Background()))
+	require.NoError(t, reconciler.ReconcileNodes(context.Background()))
+	assert.Equal(t, 2, edge.loads)
+	require.Len(t, notifier.notifications, 1)
+	assert.Contains(t, notifier.notifications[0].Message, "edge")
+}
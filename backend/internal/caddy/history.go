@@ -0,0 +1,344 @@
+package caddy
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+
+	"gorm.io/gorm"
+
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/database"
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/models"
+)
+
+// HistoryRetentionSetting is the number of applied snapshots kept on disk.
+const HistoryRetentionSetting = "caddy.config_history_retention"
+
+// DefaultHistoryRetention applies when the retention setting is unset or invalid.
+const DefaultHistoryRetention = 10
+
+var (
+	// ErrHistoryNotFound is returned for an unknown history entry.
+	ErrHistoryNotFound = errors.New("config history entry not found")
+	// ErrSnapshotUnavailable is returned for entries whose apply failed or
+	// whose snapshot was removed by retention.
+	ErrSnapshotUnavailable = errors.New("snapshot no longer available")
+)
+
+// ApplyInfo describes who triggered an apply and why, for the history.
+type ApplyInfo struct {
+	UserID uint   // 0 when unauthenticated or automatic
+	Reason string // e.g. "update proxy host app.example.com"
+}
+
+type applyInfoKey struct{}
+
+// WithApplyInfo attaches info to ctx for ApplyConfig to record.
+func WithApplyInfo(ctx context.Context, info ApplyInfo) context.Context {
+	return context.WithValue(ctx, applyInfoKey{}, info)
+}
+
+func applyInfoFrom(ctx context.Context) ApplyInfo {
+	info, _ := ctx.Value(applyInfoKey{}).(ApplyInfo)
+	return info
+}
+
+// configSettings are the settings loadConfigOptions reads.
+var configSettings = []string{
+	"caddy.acme_email",
+	"caddy.acme_staging",
+	"caddy.acme_directory",
+	"caddy.acme_ca_root",
+	"caddy.acme_eab_key_id",
+	"caddy.acme_eab_hmac_key",
+	"caddy.on_demand_ask_url",
+	"caddy.server_read_timeout",
+	"caddy.server_read_header_timeout",
+	"caddy.server_write_timeout",
+	"caddy.server_idle_timeout",
+	"caddy.geoip_database",
+	"crowdsec.api_url",
+	"crowdsec.bouncer_key",
+}
+
+// ConfigState is the set of database rows a config is generated from,
+// stored with each history entry so that rolling back restores them.
+type ConfigState struct {
+	ProxyHosts  []models.ProxyHost  `json:"proxy_hosts"` // With their locations and upstream groups
+	AccessLists []models.AccessList `json:"access_lists"`
+	// Settings holds the configSettings that were set, nil in entries
+	// recorded before settings were captured.
+	Settings map[string]string `json:"settings,omitempty"`
+	// Nodes holds which hosts each Caddy node serves, through its labels.
+	Nodes []NodeAssignment `json:"nodes,omitempty"`
+	// RawRoutes are the adopted routes, none in entries recorded before
+	// any were adopted.
+	RawRoutes []models.RawRoute `json:"raw_routes,omitempty"`
+}
+
+// NodeAssignment is the part of a Caddy node that decides which hosts it
+// serves. Addresses, credentials and status are not rolled back.
+type NodeAssignment struct {
+	Name    string   `json:"name"`
+	Labels  []string `json:"labels"`
+	Enabled bool     `json:"enabled"`
+}
+
+// HistoryEntry is a history record with its snapshot, nil when unavailable.
+type HistoryEntry struct {
+	models.CaddyConfig
+	Config *Config `json:"config"`
+}
+
+// History lists config changes, newest first.
+func (m *Manager) History() ([]models.CaddyConfig, error) {
+	var records []models.CaddyConfig
+	if err := m.db.Order("id desc").Find(&records).Error; err != nil {
+		return nil, fmt.Errorf("fetch config history: %w", err)
+	}
+	return records, nil
+}
+
+// HistoryEntry returns a history record with its snapshot.
+func (m *Manager) HistoryEntry(id uint) (*HistoryEntry, error) {
+	var record models.CaddyConfig
+	if err := m.db.First(&record, id).Error; err != nil {
+		if errors.Is(err, gorm.ErrRecordNotFound) {
+			return nil, ErrHistoryNotFound
+		}
+		return nil, fmt.Errorf("fetch config history: %w", err)
+	}
+
+	entry := &HistoryEntry{CaddyConfig: record}
+	config, err := m.readSnapshot(record.Snapshot)
+	if err != nil && !errors.Is(err, ErrSnapshotUnavailable) {
+		return nil, err
+	}
+	entry.Config = config
+	return entry, nil
+}
+
+// DiffHistory compares the snapshots of two history entries.
+func (m *Manager) DiffHistory(fromID, toID uint) (*ConfigDiff, error) {
+	from, err := m.HistoryEntry(fromID)
+	if err != nil {
+		return nil, err
+	}
+	to, err := m.HistoryEntry(toID)
+	if err != nil {
+		return nil, err
+	}
+	if from.Config == nil || to.Config == nil {
+		return nil, ErrSnapshotUnavailable
+	}
+	return DiffConfigs(from.Config, to.Config)
+}
+
+// RollbackTo restores the proxy hosts, access lists, settings and node
+// assignments of a history entry and applies the config generated from
+// them. When Caddy rejects it, the database is put back as it was. No other
+// apply runs between the restore and its apply.
+func (m *Manager) RollbackTo(ctx context.Context, id uint) error {
+	m.applyMu.Lock()
+	defer m.applyMu.Unlock()
+
+	entry, err := m.HistoryEntry(id)
+	if err != nil {
+		return err
+	}
+	if entry.Config == nil || entry.State == "" {
+		return ErrSnapshotUnavailable
+	}
+
+	var target ConfigState
+	if err := json.Unmarshal([]byte(entry.State), &target); err != nil {
+		return fmt.Errorf("unmarshal config state: %w", err)
+	}
+
+	currentJSON, err := m.captureState()
+	if err != nil {
+		return err
+	}
+	var current ConfigState
+	if err := json.Unmarshal([]byte(currentJSON), &current); err != nil {
+		return fmt.Errorf("unmarshal config state: %w", err)
+	}
+
+	if err := m.restoreState(target); err != nil {
+		return err
+	}
+
+	info := applyInfoFrom(ctx)
+	if info.Reason == "" {
+		info.Reason = fmt.Sprintf("rollback to #%d", id)
+	}
+	if err := m.applyConfig(WithApplyInfo(ctx, info)); err != nil {
+		if restoreErr := m.restoreState(current); restoreErr != nil {
+			return fmt.Errorf("%w, restoring database also failed: %v", err, restoreErr)
+		}
+		return err
+	}
+	return nil
+}
+
+// captureState serializes the rows the config is generated from.
+func (m *Manager) captureState() (string, error) {
+	var state ConfigState
+	if err := m.db.Preload("Locations").Preload("UpstreamGroups").Find(&state.ProxyHosts).Error; err != nil {
+		return "", fmt.Errorf("fetch proxy hosts: %w", err)
+	}
+	if err := m.db.Find(&state.AccessLists).Error; err != nil {
+		return "", fmt.Errorf("fetch access lists: %w", err)
+	}
+
+	var settings []models.Setting
+	if err := m.db.Where("key IN ?", configSettings).Find(&settings).Error; err != nil {
+		return "", fmt.Errorf("fetch settings: %w", err)
+	}
+	state.Settings = make(map[string]string, len(settings))
+	for _, setting := range settings {
+		state.Settings[setting.Key] = setting.Value
+	}
+
+	nodes, err := m.allNodes()
+	if err != nil {
+		return "", err
+	}
+	for _, node := range nodes {
+		state.Nodes = append(state.Nodes, NodeAssignment{Name: node.Name, Labels: node.Labels, Enabled: node.Enabled})
+	}
+
+	if state.RawRoutes, err = m.loadRawRoutes(); err != nil {
+		return "", err
+	}
+
+	stateJSON, err := json.Marshal(state)
+	if err != nil {
+		return "", fmt.Errorf("marshal config state: %w", err)
+	}
+	return string(stateJSON), nil
+}
+
+// restoreState replaces all proxy hosts, locations, upstream groups, access
+// lists and raw routes with those of state, keeping their IDs, and puts back
+// its settings and the labels of nodes that still exist.
+func (m *Manager) restoreState(state ConfigState) error {
+	hasNodes := m.db.Migrator().HasTable(&models.CaddyNode{})
+	hasRawRoutes := m.db.Migrator().HasTable(&models.RawRoute{})
+	return m.db.Session(&gorm.Session{AllowGlobalUpdate: true}).Transaction(func(tx *gorm.DB) error {
+		if state.Settings != nil {
+			for _, key := range configSettings {
+				value, ok := state.Settings[key]
+				if !ok {
+					if err := tx.Where("key = ?", key).Delete(&models.Setting{}).Error; err != nil {
+						return fmt.Errorf("restore setting %s: %w", key, err)
+					}
+					continue
+				}
+				var setting models.Setting
+				if err := tx.Where(models.Setting{Key: key}).Assign(models.Setting{Value: value}).FirstOrCreate(&setting).Error; err != nil {
+					return fmt.Errorf("restore setting %s: %w", key, err)
+				}
+			}
+		}
+
+		for _, node := range state.Nodes {
+			if !hasNodes {
+				break
+			}
+			err := tx.Model(&models.CaddyNode{}).Where("name = ?", node.Name).Select("labels", "enabled").
+				Updates(&models.CaddyNode{Labels: node.Labels, Enabled: node.Enabled}).Error
+			if err != nil {
+				return fmt.Errorf("restore node %s: %w", node.Name, err)
+			}
+		}
+
+		tables := []interface{}{&models.Location{}, &models.UpstreamGroup{}, &models.ProxyHost{}, &models.AccessList{}}
+		if hasRawRoutes {
+			tables = append(tables, &models.RawRoute{})
+		}
+		for _, model := range tables {
+			if err := tx.Delete(model).Error; err != nil {
+				return fmt.Errorf("clear %T: %w", model, err)
+			}
+		}
+
+		for i := range state.AccessLists {
+			if err := database.InsertRow(tx, &state.AccessLists[i]); err != nil {
+				return fmt.Errorf("restore access list %s: %w", state.AccessLists[i].Name, err)
+			}
+		}
+		for i := range state.RawRoutes {
+			if !hasRawRoutes {
+				break
+			}
+			if err := database.InsertRow(tx, &state.RawRoutes[i]); err != nil {
+				return fmt.Errorf("restore raw route %s: %w", state.RawRoutes[i].Name, err)
+			}
+		}
+		for i := range state.ProxyHosts {
+			host := &state.ProxyHosts[i]
+			if err := database.InsertRow(tx, host); err != nil {
+				return fmt.Errorf("restore proxy host %s: %w", host.DomainNames, err)
+			}
+			for j := range host.Locations {
+				if err := database.InsertRow(tx, &host.Locations[j]); err != nil {
+					return fmt.Errorf("restore location %s of %s: %w", host.Locations[j].Path, host.DomainNames, err)
+				}
+			}
+			for j := range host.UpstreamGroups {
+				if err := database.InsertRow(tx, &host.UpstreamGroups[j]); err != nil {
+					return fmt.Errorf("restore upstream group %s of %s: %w", host.UpstreamGroups[j].Name, host.DomainNames, err)
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// readSnapshot loads a snapshot by file name.
+func (m *Manager) readSnapshot(name string) (*Config, error) {
+	if name == "" {
+		return nil, ErrSnapshotUnavailable
+	}
+
+	configJSON, err := os.ReadFile(filepath.Join(m.configDir, filepath.Base(name)))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, ErrSnapshotUnavailable
+		}
+		return nil, fmt.Errorf("read snapshot: %w", err)
+	}
+
+	var config Config
+	if err := json.Unmarshal(configJSON, &config); err != nil {
+		return nil, fmt.Errorf("unmarshal snapshot: %w", err)
+	}
+	return &config, nil
+}
+
+// historyRetention reads how many snapshots to keep.
+func (m *Manager) historyRetention() int {
+	keep, err := strconv.Atoi(m.loadSettings()[HistoryRetentionSetting])
+	if err != nil || keep < 1 {
+		return DefaultHistoryRetention
+	}
+	return keep
+}
+
+// changedHosts lists the diff groups that differ between two configs.
+func changedHosts(before, after *Config) []string {
+	hosts := []string{}
+	diff, err := DiffConfigs(before, after)
+	if err != nil {
+		return hosts
+	}
+	for _, h := range diff.Hosts {
+		hosts = append(hosts, h.Host)
+	}
+	return hosts
+}
@@ -0,0 +1,208 @@
+package caddy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/models"
+)
+
+func setupHistoryTest(t *testing.T, handler http.HandlerFunc) (*Manager, *gorm.DB) {
+	caddyServer := httptest.NewServer(handler)
+	t.Cleanup(caddyServer.Close)
+
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.ProxyHost{}, &models.Location{}, &models.UpstreamGroup{}, &models.AccessList{}, &models.Setting{}, &models.CaddyConfig{}))
+
+	return NewManager(NewClient(caddyServer.URL), db, t.TempDir()), db
+}
+
+func TestManager_History(t *testing.T) {
+	manager, db := setupHistoryTest(t, func(w http.ResponseWriter, r *http.Request) {})
+	ctx := WithApplyInfo(context.Background(), ApplyInfo{UserID: 7, Reason: "create proxy host app.example.com"})
+
+	app := models.ProxyHost{UUID: "uuid-app", DomainNames: "app.example.com", ForwardHost: "app", ForwardPort: 80}
+	require.NoError(t, db.Create(&app).Error)
+	require.NoError(t, manager.ApplyConfig(ctx))
+
+	require.NoError(t, db.Create(&models.ProxyHost{UUID: "uuid-api", DomainNames: "api.example.com", ForwardHost: "api", ForwardPort: 80}).Error)
+	require.NoError(t, manager.ApplyConfig(context.Background()))
+
+	history, err := manager.History()
+	require.NoError(t, err)
+	require.Len(t, history, 2)
+
+	// Newest first
+	assert.Equal(t, []string{"api.example.com"}, history[0].HostsChanged)
+	assert.Equal(t, uint(0), history[0].AppliedBy)
+	assert.Contains(t, history[1].HostsChanged, "app.example.com")
+	assert.Equal(t, uint(7), history[1].AppliedBy)
+	assert.Equal(t, "create proxy host app.example.com", history[1].Reason)
+	assert.True(t, history[1].Success)
+	assert.NotEmpty(t, history[1].Snapshot)
+
+	entry, err := manager.HistoryEntry(history[1].ID)
+	require.NoError(t, err)
+	require.NotNil(t, entry.Config)
+	assert.Len(t, entry.Config.Apps.HTTP.Servers["cpm_server"].Routes, 1)
+
+	// The state is not exposed by the API
+	raw, err := json.Marshal(entry)
+	require.NoError(t, err)
+	assert.NotContains(t, string(raw), "proxy_hosts")
+
+	diff, err := manager.DiffHistory(history[1].ID, history[0].ID)
+	require.NoError(t, err)
+	require.Len(t, diff.Hosts, 1)
+	assert.Equal(t, "api.example.com", diff.Hosts[0].Host)
+	assert.Equal(t, "added", diff.Hosts[0].Status)
+
+	_, err = manager.HistoryEntry(999)
+	assert.ErrorIs(t, err, ErrHistoryNotFound)
+}
+
+func TestManager_RollbackTo(t *testing.T) {
+	var loaded *Config
+	reject := false
+	manager, db := setupHistoryTest(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/load" {
+			var config Config
+			json.NewDecoder(r.Body).Decode(&config)
+			if reject {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			loaded = &config
+		}
+	})
+	ctx := context.Background()
+
+	list := models.AccessList{UUID: "acl", Name: "office", Type: AccessListAllow, Enabled: true, Rules: `[{"address": "10.0.0.0/8"}]`}
+	require.NoError(t, db.Create(&list).Error)
+	app := models.ProxyHost{
+		UUID: "uuid-app", DomainNames: "app.example.com", ForwardHost: "app", ForwardPort: 80, AccessListID: &list.ID,
+		Locations: []models.Location{{UUID: "loc", Path: "/api", ForwardHost: "api", ForwardPort: 8080}},
+	}
+	require.NoError(t, db.Create(&app).Error)
+	// false overrides the column default
+	require.NoError(t, db.Model(&models.ProxyHost{}).Where("id = ?", app.ID).Update("block_exploits", false).Error)
+	require.NoError(t, db.AutoMigrate(&models.CaddyNode{}))
+	require.NoError(t, db.Create(&models.CaddyNode{UUID: "node-edge", Name: "edge", AdminURL: "http://edge:2019", Labels: []string{"eu"}}).Error)
+	require.NoError(t, db.Model(&models.CaddyNode{}).Where("name = ?", "edge").Update("enabled", false).Error)
+	require.NoError(t, db.Create(&models.Setting{Key: "caddy.acme_email", Value: "ops@example.com"}).Error)
+	require.NoError(t, db.AutoMigrate(&models.RawRoute{}))
+	require.NoError(t, db.Create(&models.RawRoute{UUID: "raw-kept", Route: expressionRoute}).Error)
+	require.NoError(t, db.Model(&models.RawRoute{}).Where("uuid = ?", "raw-kept").Update("enabled", false).Error)
+	require.NoError(t, manager.ApplyConfig(ctx))
+
+	history, err := manager.History()
+	require.NoError(t, err)
+	first := history[0].ID
+	firstConfig := loaded
+
+	// Change everything, then go back
+	require.NoError(t, db.Model(&models.ProxyHost{}).Where("id = ?", app.ID).Updates(map[string]interface{}{"forward_host": "other", "block_exploits": true, "access_list_id": nil}).Error)
+	require.NoError(t, db.Where("id = ?", list.ID).Delete(&models.AccessList{}).Error)
+	require.NoError(t, db.Where("proxy_host_id = ?", app.ID).Delete(&models.Location{}).Error)
+	require.NoError(t, db.Create(&models.ProxyHost{UUID: "uuid-new", DomainNames: "new.example.com", ForwardHost: "new", ForwardPort: 80}).Error)
+	require.NoError(t, db.Model(&models.Setting{}).Where("key = ?", "caddy.acme_email").Update("value", "new@example.com").Error)
+	require.NoError(t, db.Create(&models.Setting{Key: "caddy.server_idle_timeout", Value: "5m"}).Error)
+	require.NoError(t, db.Model(&models.CaddyNode{}).Where("name = ?", "edge").Update("labels", `["us"]`).Error)
+	require.NoError(t, db.Model(&models.RawRoute{}).Where("uuid = ?", "raw-kept").Update("enabled", true).Error)
+	require.NoError(t, db.Create(&models.RawRoute{UUID: "raw-new", Route: `{"handle":[{"handler":"static_response"}]}`, Enabled: true}).Error)
+	require.NoError(t, manager.ApplyConfig(ctx))
+
+	require.NoError(t, manager.RollbackTo(WithApplyInfo(ctx, ApplyInfo{UserID: 3}), first))
+
+	// Settings and node labels go back too, settings unset then are removed
+	settings := manager.loadSettings()
+	assert.Equal(t, "ops@example.com", settings["caddy.acme_email"])
+	assert.NotContains(t, settings, "caddy.server_idle_timeout")
+	var edge models.CaddyNode
+	require.NoError(t, db.Where("name = ?", "edge").First(&edge).Error)
+	assert.Equal(t, []string{"eu"}, edge.Labels)
+	assert.False(t, edge.Enabled)
+
+	// Routes adopted since are dropped
+	var rawRoutes []models.RawRoute
+	require.NoError(t, db.Find(&rawRoutes).Error)
+	require.Len(t, rawRoutes, 1)
+	assert.Equal(t, "raw-kept", rawRoutes[0].UUID)
+	assert.False(t, rawRoutes[0].Enabled)
+
+	var hosts []models.ProxyHost
+	require.NoError(t, db.Preload("Locations").Find(&hosts).Error)
+	require.Len(t, hosts, 1)
+	assert.Equal(t, app.ID, hosts[0].ID)
+	assert.Equal(t, "app", hosts[0].ForwardHost)
+	assert.False(t, hosts[0].BlockExploits)
+	require.Len(t, hosts[0].Locations, 1)
+	assert.Equal(t, "/api", hosts[0].Locations[0].Path)
+	var restored models.AccessList
+	require.NoError(t, db.First(&restored, list.ID).Error)
+	assert.Equal(t, &restored.ID, hosts[0].AccessListID)
+
+	diff, err := DiffConfigs(firstConfig, loaded)
+	require.NoError(t, err)
+	assert.False(t, diff.Changed)
+
+	history, err = manager.History()
+	require.NoError(t, err)
+	assert.Equal(t, fmt.Sprintf("rollback to #%d", first), history[0].Reason)
+	assert.Equal(t, uint(3), history[0].AppliedBy)
+
+	// A rejected rollback leaves the database as it was
+	require.NoError(t, db.Create(&models.ProxyHost{UUID: "uuid-new", DomainNames: "new.example.com", ForwardHost: "new", ForwardPort: 80}).Error)
+	require.NoError(t, manager.ApplyConfig(ctx))
+	reject = true
+	require.Error(t, manager.RollbackTo(ctx, first))
+	var count int64
+	db.Model(&models.ProxyHost{}).Count(&count)
+	assert.Equal(t, int64(2), count)
+}
+
+func TestManager_HistoryRetention(t *testing.T) {
+	manager, db := setupHistoryTest(t, func(w http.ResponseWriter, r *http.Request) {})
+	require.NoError(t, db.Create(&models.Setting{Key: HistoryRetentionSetting, Value: "2"}).Error)
+	require.NoError(t, db.Create(&models.ProxyHost{UUID: "uuid-app", DomainNames: "app.example.com", ForwardHost: "app", ForwardPort: 80}).Error)
+
+	for i := 0; i < 3; i++ {
+		require.NoError(t, manager.ApplyConfig(context.Background()))
+	}
+
+	snapshots, err := filepath.Glob(filepath.Join(manager.configDir, "config-*.json"))
+	require.NoError(t, err)
+	assert.Len(t, snapshots, 2)
+
+	history, err := manager.History()
+	require.NoError(t, err)
+	require.Len(t, history, 3)
+	assert.NotEmpty(t, history[1].Snapshot)
+	assert.Empty(t, history[2].Snapshot)
+	assert.Empty(t, history[2].State)
+
+	err = manager.RollbackTo(context.Background(), history[2].ID)
+	assert.ErrorIs(t, err, ErrSnapshotUnavailable)
+	_, err = manager.DiffHistory(history[2].ID, history[0].ID)
+	assert.ErrorIs(t, err, ErrSnapshotUnavailable)
+
+	entry, err := manager.HistoryEntry(history[2].ID)
+	require.NoError(t, err)
+	assert.Nil(t, entry.Config)
+
+	_, err = os.Stat(filepath.Join(manager.configDir, history[0].Snapshot))
+	assert.NoError(t, err)
+}
@@ -7,7 +7,9 @@ import (
 	"os"
 	"os/exec"
 	"path/filepath"
+	"sort"
 	"strings"
+	"time"
 
 	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/models"
 )
@@ -32,6 +34,26 @@ type CaddyConfig struct {
 // CaddyApps contains application-specific configurations.
 type CaddyApps struct {
 	HTTP *CaddyHTTP `json:"http,omitempty"`
+	TLS  *CaddyTLS  `json:"tls,omitempty"`
+}
+
+// CaddyTLS represents the TLS app, read for the certificate issuer of each host.
+type CaddyTLS struct {
+	Automation *struct {
+		Policies []CaddyAutomationPolicy `json:"policies,omitempty"`
+	} `json:"automation,omitempty"`
+}
+
+// CaddyAutomationPolicy represents a certificate automation policy.
+type CaddyAutomationPolicy struct {
+	Subjects []string      `json:"subjects,omitempty"`
+	Issuers  []CaddyIssuer `json:"issuers,omitempty"`
+}
+
+// CaddyIssuer represents a certificate issuer of an automation policy.
+type CaddyIssuer struct {
+	Module string `json:"module"`
+	CA     string `json:"ca,omitempty"`
 }
 
 // CaddyHTTP represents the HTTP app configuration.
@@ -41,38 +63,183 @@ type CaddyHTTP struct {
 
 // CaddyServer represents a single server configuration.
 type CaddyServer struct {
+	Listen                []string      `json:"listen,omitempty"`
 	Routes                []*CaddyRoute `json:"routes,omitempty"`
 	TLSConnectionPolicies interface{}   `json:"tls_connection_policies,omitempty"`
+	ReadTimeout           Duration      `json:"read_timeout,omitempty"`
+	ReadHeaderTimeout     Duration      `json:"read_header_timeout,omitempty"`
+	WriteTimeout          Duration      `json:"write_timeout,omitempty"`
+	IdleTimeout           Duration      `json:"idle_timeout,omitempty"`
 }
 
 // CaddyRoute represents a single route with matchers and handlers.
 type CaddyRoute struct {
 	Match  []*CaddyMatcher `json:"match,omitempty"`
 	Handle []*CaddyHandler `json:"handle,omitempty"`
+
+	raw json.RawMessage // The route as read, for passthrough
+}
+
+// UnmarshalJSON decodes a route, remembering its original JSON.
+func (r *CaddyRoute) UnmarshalJSON(data []byte) error {
+	type route CaddyRoute
+	var decoded route
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	*r = CaddyRoute(decoded)
+	r.raw = append(json.RawMessage(nil), data...)
+	return nil
 }
 
 // CaddyMatcher represents route matching criteria.
 type CaddyMatcher struct {
-	Host []string `json:"host,omitempty"`
+	Host       []string            `json:"host,omitempty"`
+	Path       []string            `json:"path,omitempty"`
+	PathRegexp *MatchRegexp        `json:"path_regexp,omitempty"`
+	Method     []string            `json:"method,omitempty"`
+	Header     map[string][]string `json:"header,omitempty"`
+	Query      map[string][]string `json:"query,omitempty"`
+	File       *MatchFile          `json:"file,omitempty"`
 }
 
 // CaddyHandler represents a handler in the route.
 type CaddyHandler struct {
-	Handler   string      `json:"handler"`
-	Upstreams interface{} `json:"upstreams,omitempty"`
-	Headers   interface{} `json:"headers,omitempty"`
+	Handler         string              `json:"handler"`
+	Upstreams       interface{}         `json:"upstreams,omitempty"`
+	Headers         interface{}         `json:"headers,omitempty"` // reverse_proxy, static_response
+	MaxSize         int64               `json:"max_size,omitempty"`
+	Transport       *CaddyTransport     `json:"transport,omitempty"`
+	LoadBalancing   *CaddyLoadBalancing `json:"load_balancing,omitempty"`    // reverse_proxy
+	Request         *CaddyHeaderOps     `json:"request,omitempty"`           // headers
+	Response        *CaddyHeaderOps     `json:"response,omitempty"`          // headers
+	Routes          []*CaddyRoute       `json:"routes,omitempty"`            // subroute
+	StripPathPrefix string              `json:"strip_path_prefix,omitempty"` // rewrite
+	PathRegexp      []CaddyPathRegexp   `json:"path_regexp,omitempty"`       // rewrite
+	URI             string              `json:"uri,omitempty"`               // rewrite
+	Root            string              `json:"root,omitempty"`              // file_server, vars
+	IndexNames      []string            `json:"index_names,omitempty"`       // file_server
+	Browse          interface{}         `json:"browse,omitempty"`            // file_server
+	Precompressed   interface{}         `json:"precompressed,omitempty"`     // file_server
+}
+
+// CaddyHeaderOps represents the header operations of a headers handler,
+// or of the request headers of a reverse_proxy handler.
+type CaddyHeaderOps struct {
+	Add     map[string][]string `json:"add,omitempty"`
+	Set     map[string][]string `json:"set,omitempty"`
+	Delete  []string            `json:"delete,omitempty"`
+	Replace interface{}         `json:"replace,omitempty"`
+	Require interface{}         `json:"require,omitempty"`
+}
+
+// CaddyLoadBalancing represents the load balancing of a reverse_proxy handler.
+type CaddyLoadBalancing struct {
+	SelectionPolicy *CaddySelectionPolicy `json:"selection_policy,omitempty"`
+}
+
+// CaddySelectionPolicy represents an upstream selection policy.
+type CaddySelectionPolicy struct {
+	Policy   string                `json:"policy"`
+	Weights  []int                 `json:"weights,omitempty"`  // weighted_round_robin
+	Name     string                `json:"name,omitempty"`     // cookie
+	Fallback *CaddySelectionPolicy `json:"fallback,omitempty"` // cookie
+}
+
+// CaddyPathRegexp represents a regex replacement in a rewrite handler.
+type CaddyPathRegexp struct {
+	Find    string `json:"find"`
+	Replace string `json:"replace"`
+}
+
+// CaddyTransport represents the HTTP transport of a reverse_proxy handler.
+type CaddyTransport struct {
+	TLS                   *CaddyTransportTLS `json:"tls,omitempty"`
+	ResponseHeaderTimeout Duration           `json:"response_header_timeout,omitempty"`
+	KeepAlive             *CaddyKeepAlive    `json:"keep_alive,omitempty"`
+}
+
+// CaddyTransportTLS represents the TLS settings of an https upstream.
+type CaddyTransportTLS struct {
+	InsecureSkipVerify bool   `json:"insecure_skip_verify,omitempty"`
+	ServerName         string `json:"server_name,omitempty"`
+}
+
+// CaddyKeepAlive represents upstream keep-alive settings.
+type CaddyKeepAlive struct {
+	Enabled       *bool    `json:"enabled,omitempty"`
+	IdleTimeout   Duration `json:"idle_timeout,omitempty"`
+	ProbeInterval Duration `json:"probe_interval,omitempty"`
 }
 
 // ParsedHost represents a single host detected during Caddyfile import.
 type ParsedHost struct {
-	DomainNames      string   `json:"domain_names"`
-	ForwardScheme    string   `json:"forward_scheme"`
-	ForwardHost      string   `json:"forward_host"`
-	ForwardPort      int      `json:"forward_port"`
-	SSLForced        bool     `json:"ssl_forced"`
-	WebsocketSupport bool     `json:"websocket_support"`
-	RawJSON          string   `json:"raw_json"` // Original Caddy JSON for this route
-	Warnings         []string `json:"warnings"` // Unsupported features
+	DomainNames           string                    `json:"domain_names"`
+	ForwardScheme         string                    `json:"forward_scheme"`
+	ForwardHost           string                    `json:"forward_host"`
+	ForwardPort           int                       `json:"forward_port"`
+	SSLForced             bool                      `json:"ssl_forced"`
+	WebsocketSupport      bool                      `json:"websocket_support"`
+	MaxBodySize           int64                     `json:"max_body_size,omitempty"`
+	ResponseHeaderTimeout string                    `json:"response_header_timeout,omitempty"`
+	UpstreamIdleTimeout   string                    `json:"upstream_idle_timeout,omitempty"`
+	UpstreamKeepAlive     string                    `json:"upstream_keepalive,omitempty"`
+	Upstreams             []ParsedUpstream          `json:"upstreams,omitempty"`           // All upstreams when load balanced, the first is also the forward target
+	SplitStickyCookie     string                    `json:"split_sticky_cookie,omitempty"` // Cookie pinning clients to an upstream
+	UpstreamTLSSkipVerify bool                      `json:"upstream_tls_skip_verify,omitempty"`
+	UpstreamTLSServerName string                    `json:"upstream_tls_server_name,omitempty"`
+	Locations             []ParsedLocation          `json:"locations,omitempty"`
+	EnableCompression     bool                      `json:"enable_compression,omitempty"`
+	HSTSEnabled           bool                      `json:"hsts_enabled,omitempty"`
+	HSTSSubdomains        bool                      `json:"hsts_subdomains,omitempty"`
+	RequestHeaders        map[string][]string       `json:"request_headers,omitempty"`
+	ResponseHeaders       map[string][]string       `json:"response_headers,omitempty"` // An empty list deletes the header
+	CertificateIssuer     string                    `json:"certificate_issuer,omitempty"`
+	HostType              string                    `json:"host_type,omitempty"`
+	StaticRoot            string                    `json:"static_root,omitempty"`
+	StaticIndexFiles      string                    `json:"static_index_files,omitempty"`
+	StaticSPAFallback     bool                      `json:"static_spa_fallback,omitempty"`
+	StaticBrowse          bool                      `json:"static_browse,omitempty"`
+	StaticPrecompressed   bool                      `json:"static_precompressed,omitempty"`
+	StaticCacheControl    []models.CacheControlRule `json:"static_cache_control,omitempty"`
+	RawJSON               string                    `json:"raw_json"` // Original Caddy JSON for this route
+	Warnings              []string                  `json:"warnings"` // Unsupported features
+}
+
+// ParsedLocation represents a path-scoped proxy (handle or handle_path block) within a host.
+type ParsedLocation struct {
+	Path                  string              `json:"path"`
+	PathRegex             string              `json:"path_regex,omitempty"`
+	Methods               string              `json:"methods,omitempty"`
+	MatchHeaders          map[string][]string `json:"match_headers,omitempty"`
+	MatchQuery            map[string][]string `json:"match_query,omitempty"`
+	ForwardScheme         string              `json:"forward_scheme"`
+	ForwardHost           string              `json:"forward_host"`
+	ForwardPort           int                 `json:"forward_port"`
+	StripPrefix           bool                `json:"strip_prefix"`
+	RewriteRegex          string              `json:"rewrite_regex,omitempty"`
+	RewriteReplacement    string              `json:"rewrite_replacement,omitempty"`
+	WebsocketSupport      bool                `json:"websocket_support,omitempty"`
+	EnableCompression     bool                `json:"enable_compression,omitempty"`
+	RequestHeaders        map[string][]string `json:"request_headers,omitempty"`
+	ResponseHeaders       map[string][]string `json:"response_headers,omitempty"`
+	UpstreamTLSSkipVerify bool                `json:"upstream_tls_skip_verify,omitempty"`
+	UpstreamTLSServerName string              `json:"upstream_tls_server_name,omitempty"`
+}
+
+// ParsedUpstream is one of the load balanced upstreams of a host.
+type ParsedUpstream struct {
+	ForwardHost string `json:"forward_host"`
+	ForwardPort int    `json:"forward_port"`
+	Weight      int    `json:"weight"` // Percentage of traffic
+}
+
+// PassthroughRoute is a route no proxy host can represent. It is kept
+// verbatim as a RawRoute so it keeps working after the import.
+type PassthroughRoute struct {
+	Name   string          `json:"name"`   // e.g. "srv0 route 3", the resolution key when committing
+	Reason string          `json:"reason"` // Why no host represents the route
+	Route  json.RawMessage `json:"route"`
 }
 
 // ImportResult contains parsed hosts and detected conflicts.
@@ -80,6 +247,10 @@ type ImportResult struct {
 	Hosts     []ParsedHost `json:"hosts"`
 	Conflicts []string     `json:"conflicts"`
 	Errors    []string     `json:"errors"`
+	// Settings holds global settings found in the Caddyfile, such as server timeouts.
+	Settings map[string]string `json:"settings,omitempty"`
+	// Passthrough holds the routes that are kept verbatim.
+	Passthrough []PassthroughRoute `json:"passthrough,omitempty"`
 }
 
 // Importer handles Caddyfile parsing and conversion to CPM+ models.
@@ -126,98 +297,717 @@ func (i *Importer) ExtractHosts(caddyJSON []byte) (*ImportResult, error) {
 		Errors:    []string{},
 	}
 
+	result.Errors = append(result.Errors, unadoptedApps(caddyJSON)...)
+
 	if config.Apps == nil || config.Apps.HTTP == nil || config.Apps.HTTP.Servers == nil {
 		return result, nil // Empty config
 	}
 
 	seenDomains := make(map[string]bool)
+	issuers := policyIssuers(config.Apps.TLS)
+
+	for _, serverName := range sortedServerNames(config.Apps.HTTP.Servers) {
+		server := config.Apps.HTTP.Servers[serverName]
+		extractServerTimeouts(server, result)
 
-	for serverName, server := range config.Apps.HTTP.Servers {
 		for routeIdx, route := range server.Routes {
-			for _, match := range route.Match {
-				for _, hostMatcher := range match.Host {
-					domain := hostMatcher
+			hostsBefore := len(result.Hosts)
 
+			// A site block for several domains is one route with several
+			// host matchers, it becomes one host for all of them
+			hasHost := false
+			domains := make([]string, 0)
+			for _, match := range route.Match {
+				hasHost = hasHost || len(match.Host) > 0
+				for _, domain := range match.Host {
 					// Check for duplicate domains
-					if seenDomains[domain] {
+					if seenDomains[strings.ToLower(domain)] {
 						result.Conflicts = append(result.Conflicts,
 							fmt.Sprintf("Duplicate domain detected: %s", domain))
 						continue
 					}
-					seenDomains[domain] = true
+					seenDomains[strings.ToLower(domain)] = true
+					domains = append(domains, domain)
+				}
+			}
 
-					// Extract reverse proxy handler
-					host := ParsedHost{
-						DomainNames: domain,
-						SSLForced:   strings.HasPrefix(domain, "https") || server.TLSConnectionPolicies != nil,
-					}
+			if len(domains) > 0 {
+				host := ParsedHost{
+					DomainNames: strings.Join(domains, ", "),
+					SSLForced:   server.TLSConnectionPolicies != nil,
+				}
+				for _, domain := range domains {
+					host.SSLForced = host.SSLForced || strings.HasPrefix(domain, "https")
+				}
 
-					// Find reverse_proxy handler
-					for _, handler := range route.Handle {
-						if handler.Handler == "reverse_proxy" {
-							upstreams, _ := handler.Upstreams.([]interface{})
-							if len(upstreams) > 0 {
-								if upstream, ok := upstreams[0].(map[string]interface{}); ok {
-									dial, _ := upstream["dial"].(string)
-									if dial != "" {
-										parts := strings.Split(dial, ":")
-										if len(parts) == 2 {
-											host.ForwardHost = parts[0]
-											if _, err := fmt.Sscanf(parts[1], "%d", &host.ForwardPort); err != nil {
-												// Default to 80 if parsing fails, or handle error appropriately
-												// For now, just log or ignore, but at least we checked err
-												host.ForwardPort = 80
-											}
-										}
-									}
-								}
-							}
-
-							// Check for websocket support
-							if headers, ok := handler.Headers.(map[string]interface{}); ok {
-								if upgrade, ok := headers["Upgrade"].([]interface{}); ok {
-									for _, v := range upgrade {
-										if v == "websocket" {
-											host.WebsocketSupport = true
-											break
-										}
-									}
-								}
-							}
-
-							// Default scheme
-							host.ForwardScheme = "http"
-							if host.SSLForced {
-								host.ForwardScheme = "https"
-							}
-						}
-
-						// Detect unsupported features
-						if handler.Handler == "rewrite" {
-							host.Warnings = append(host.Warnings, "Rewrite rules not supported - manual configuration required")
-						}
-						if handler.Handler == "file_server" {
-							host.Warnings = append(host.Warnings, "File server directives not supported")
-						}
-					}
+				extractHandlers(route.Handle, &host, false)
+				extractIssuer(domainsIssuer(issuers, domains, &host), &host)
+				if len(host.StaticCacheControl) > 0 && host.HostType != models.HostTypeStatic {
+					addWarning(&host, "Cache-Control rules are only supported on static hosts")
+					host.StaticCacheControl = nil
+				}
 
-					// Store raw JSON for this route
-					routeJSON, _ := json.Marshal(map[string]interface{}{
-						"server": serverName,
-						"route":  routeIdx,
-						"data":   route,
-					})
-					host.RawJSON = string(routeJSON)
+				// Store raw JSON for this route
+				routeJSON, _ := json.Marshal(map[string]interface{}{
+					"server": serverName,
+					"route":  routeIdx,
+					"data":   route,
+				})
+				host.RawJSON = string(routeJSON)
 
-					result.Hosts = append(result.Hosts, host)
-				}
+				result.Hosts = append(result.Hosts, host)
+			}
+
+			// Routes for duplicate domains only are dropped as conflicts
+			if hasHost && len(result.Hosts) == hostsBefore {
+				continue
+			}
+			reason := passthroughReason(result.Hosts[hostsBefore:], hasHost)
+			if reason == "" {
+				continue
 			}
+			if !servesDefaultPorts(server.Listen) {
+				reason += fmt.Sprintf("; it was served on %s and will be served on :80 and :443", strings.Join(server.Listen, ", "))
+			}
+			raw, err := routeJSON(route)
+			if err != nil {
+				result.Errors = append(result.Errors, fmt.Sprintf("%s route %d: %v", serverName, routeIdx, err))
+				continue
+			}
+			result.Passthrough = append(result.Passthrough, PassthroughRoute{
+				Name:   fmt.Sprintf("%s route %d", serverName, routeIdx),
+				Reason: reason,
+				Route:  raw,
+			})
 		}
 	}
 
 	return result, nil
 }
 
+// passthroughReason tells why a route must be kept verbatim, given the
+// hosts parsed from it, or returns "" when a host represents it.
+func passthroughReason(hosts []ParsedHost, hasHost bool) string {
+	if !hasHost {
+		return "Route has no host matcher"
+	}
+	for _, host := range hosts {
+		if convertible(host) {
+			return ""
+		}
+	}
+	return "Route neither proxies to an upstream nor serves static files"
+}
+
+// servesDefaultPorts reports whether a server listens only where the
+// generated server does, Caddy's default when listen is empty.
+func servesDefaultPorts(listen []string) bool {
+	for _, addr := range listen {
+		if addr != ":80" && addr != ":443" {
+			return false
+		}
+	}
+	return true
+}
+
+// routeJSON returns a route's canonical JSON as read, keeping fields the
+// importer doesn't model.
+func routeJSON(route *CaddyRoute) (json.RawMessage, error) {
+	if route.raw != nil {
+		return canonicalJSON(route.raw)
+	}
+	raw, err := json.Marshal(route)
+	if err != nil {
+		return nil, err
+	}
+	return canonicalJSON(raw)
+}
+
+// policyIssuers maps each subject of the TLS app's automation policies to
+// the first issuer of the first policy listing it, the one Caddy uses.
+func policyIssuers(tls *CaddyTLS) map[string]CaddyIssuer {
+	issuers := make(map[string]CaddyIssuer)
+	if tls == nil || tls.Automation == nil {
+		return issuers
+	}
+	for _, policy := range tls.Automation.Policies {
+		if len(policy.Issuers) == 0 {
+			continue
+		}
+		for _, subject := range policy.Subjects {
+			subject = strings.ToLower(subject)
+			if _, ok := issuers[subject]; !ok {
+				issuers[subject] = policy.Issuers[0]
+			}
+		}
+	}
+	return issuers
+}
+
+// domainsIssuer returns the issuer of a host's domains. A host has one
+// issuer, so when its domains had different ones the first domain's is
+// kept and a warning added.
+func domainsIssuer(issuers map[string]CaddyIssuer, domains []string, host *ParsedHost) CaddyIssuer {
+	issuer := issuers[strings.ToLower(domains[0])]
+	for _, domain := range domains[1:] {
+		if issuers[strings.ToLower(domain)] != issuer {
+			addWarning(host, fmt.Sprintf("Domains use different certificate issuers, the one of %s is imported", domains[0]))
+			break
+		}
+	}
+	return issuer
+}
+
+// extractIssuer sets the certificate issuer override matching a host's
+// issuer. ACME directories other than the known CAs need the global custom
+// directory, so they are reported instead.
+func extractIssuer(issuer CaddyIssuer, host *ParsedHost) {
+	switch {
+	case issuer.Module == "":
+	case issuer.Module == "internal":
+		host.CertificateIssuer = IssuerInternal
+	case issuer.Module == "zerossl":
+		host.CertificateIssuer = IssuerZeroSSL
+	case issuer.Module != "acme":
+		addWarning(host, fmt.Sprintf("Certificate issuer '%s' is not supported", issuer.Module))
+	case issuer.CA == "":
+	case issuer.CA == letsEncryptDirectory:
+		host.CertificateIssuer = IssuerLetsEncrypt
+	case issuer.CA == letsEncryptStagingDirectory:
+		host.CertificateIssuer = IssuerLetsEncryptStaging
+	case issuer.CA == zeroSSLDirectory:
+		host.CertificateIssuer = IssuerZeroSSL
+	default:
+		addWarning(host, fmt.Sprintf("Certificates from the ACME directory %s need the custom ACME directory setting", issuer.CA))
+	}
+}
+
+// sortedServerNames returns the server names in a stable order.
+func sortedServerNames(servers map[string]*CaddyServer) []string {
+	names := make([]string, 0, len(servers))
+	for name := range servers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// adoptedApps are the apps an import carries over: hosts and routes from
+// http, and certificates that are managed again from the hosts.
+var adoptedApps = map[string]bool{"http": true, "tls": true, "pki": true}
+
+// unadoptedApps reports the apps of a config that an import drops.
+func unadoptedApps(caddyJSON []byte) []string {
+	var config struct {
+		Apps map[string]json.RawMessage `json:"apps"`
+	}
+	if err := json.Unmarshal(caddyJSON, &config); err != nil {
+		return nil
+	}
+	var errs []string
+	for name := range config.Apps {
+		if !adoptedApps[name] {
+			errs = append(errs, fmt.Sprintf("App '%s' is not supported and will not be imported", name))
+		}
+	}
+	sort.Strings(errs)
+	return errs
+}
+
+// extractHandlers walks a host's handlers, descending into subroutes.
+// Subroutes matching a path that end in a reverse_proxy become Locations.
+// Handlers limited to other matchers, or without an equivalent, are reported
+// as warnings.
+func extractHandlers(handlers []*CaddyHandler, host *ParsedHost, scoped bool) {
+	for _, handler := range handlers {
+		if scoped && handler.Handler != "subroute" && handler.Handler != "file_server" && handler.Handler != "vars" {
+			addWarning(host, fmt.Sprintf("Handler '%s' limited to a matcher is not supported - manual configuration required", handler.Handler))
+			continue
+		}
+
+		switch handler.Handler {
+		case "reverse_proxy":
+			// The first proxy found is the host's main upstream
+			if host.ForwardHost != "" {
+				addWarning(host, "Only the first reverse_proxy of a host is imported")
+				continue
+			}
+			extractProxy(handler, host)
+
+		case "request_body":
+			if handler.MaxSize > 0 {
+				host.MaxBodySize = handler.MaxSize
+			}
+
+		case "encode":
+			host.EnableCompression = true
+
+		case "headers":
+			for _, warning := range extractHeaders(handler, &host.RequestHeaders, &host.ResponseHeaders) {
+				addWarning(host, warning)
+			}
+			extractHSTS(host)
+
+		case "vars":
+			// Set by the root directive, file_server falls back to it
+			if handler.Root != "" && host.StaticRoot == "" && !scoped {
+				host.StaticRoot = handler.Root
+			}
+
+		case "file_server":
+			if scoped {
+				addWarning(host, "File server directives limited to a path are not supported")
+				continue
+			}
+			extractFileServer(handler, host)
+
+		case "subroute":
+			for _, route := range handler.Routes {
+				if loc, ok := extractLocation(route); ok {
+					host.Locations = append(host.Locations, loc)
+					continue
+				}
+				if extractTryFiles(route, host) || extractCacheControl(route, host) {
+					continue
+				}
+				extractHandlers(route.Handle, host, scoped || len(route.Match) > 0)
+			}
+
+		// Detect unsupported features
+		case "rewrite":
+			addWarning(host, "Rewrite rules not supported - manual configuration required")
+
+		default:
+			addWarning(host, fmt.Sprintf("Handler '%s' is not supported - manual configuration required", handler.Handler))
+		}
+	}
+}
+
+// addWarning adds a warning to a host, once.
+func addWarning(host *ParsedHost, warning string) {
+	for _, w := range host.Warnings {
+		if w == warning {
+			return
+		}
+	}
+	host.Warnings = append(host.Warnings, warning)
+}
+
+// extractProxy reads a host's main reverse_proxy: its upstreams with their
+// load balancing, request headers, transport and upstream TLS.
+func extractProxy(handler *CaddyHandler, host *ParsedHost) {
+	upstreams, skipped := parseUpstreams(handler.Upstreams)
+	if skipped > 0 {
+		addWarning(host, "Upstreams with placeholders or non-TCP addresses are not supported")
+	}
+	if len(upstreams) == 0 {
+		return
+	}
+	host.ForwardHost, host.ForwardPort = upstreams[0].ForwardHost, upstreams[0].ForwardPort
+	if len(upstreams) > 1 {
+		var policy *CaddySelectionPolicy
+		if handler.LoadBalancing != nil {
+			policy = handler.LoadBalancing.SelectionPolicy
+		}
+		host.Upstreams = balanceUpstreams(upstreams, policy, host)
+	}
+
+	websocket, headers := proxyRequestHeaders(handler.Headers)
+	host.WebsocketSupport = websocket
+	for name, values := range headers {
+		if host.RequestHeaders == nil {
+			host.RequestHeaders = make(map[string][]string)
+		}
+		host.RequestHeaders[name] = values
+	}
+
+	extractTransport(handler.Transport, host)
+
+	host.ForwardScheme = upstreamScheme(handler.Transport)
+	if handler.Transport != nil && handler.Transport.TLS != nil {
+		host.UpstreamTLSSkipVerify = handler.Transport.TLS.InsecureSkipVerify
+		host.UpstreamTLSServerName = handler.Transport.TLS.ServerName
+	}
+}
+
+// balanceUpstreams assigns each upstream its percentage of traffic under a
+// selection policy: the weights of weighted_round_robin, an even split
+// otherwise. A cookie policy pins clients with the host's sticky cookie.
+func balanceUpstreams(upstreams []ParsedUpstream, policy *CaddySelectionPolicy, host *ParsedHost) []ParsedUpstream {
+	if policy != nil && policy.Policy == "cookie" {
+		host.SplitStickyCookie = policy.Name
+		policy = policy.Fallback
+	}
+
+	weights := make([]int, len(upstreams))
+	for i := range weights {
+		weights[i] = 1
+	}
+	if policy != nil {
+		switch policy.Policy {
+		case "weighted_round_robin":
+			if len(policy.Weights) == len(upstreams) {
+				copy(weights, policy.Weights)
+			}
+		case "", "random", "round_robin":
+		default:
+			addWarning(host, fmt.Sprintf("Load balancing policy '%s' is imported as an even traffic split", policy.Policy))
+		}
+	}
+
+	total := 0
+	for _, w := range weights {
+		total += w
+	}
+	if total == 0 {
+		return upstreams
+	}
+
+	// Percentages must add up to 100, the first upstream takes the rounding
+	remaining := 100
+	for i := range upstreams {
+		upstreams[i].Weight = weights[i] * 100 / total
+		remaining -= upstreams[i].Weight
+	}
+	upstreams[0].Weight += remaining
+	return upstreams
+}
+
+// proxyRequestHeaders reads the request headers a reverse_proxy sets
+// (header_up). The Upgrade and Connection pass-through of websocket
+// support is reported apart from the other headers.
+func proxyRequestHeaders(raw interface{}) (bool, map[string][]string) {
+	if raw == nil {
+		return false, nil
+	}
+	data, err := json.Marshal(raw)
+	if err != nil {
+		return false, nil
+	}
+	var headers struct {
+		Request *CaddyHeaderOps `json:"request"`
+	}
+	if err := json.Unmarshal(data, &headers); err != nil || headers.Request == nil {
+		return false, nil
+	}
+
+	websocket := false
+	set := make(map[string][]string)
+	for name, values := range headers.Request.Set {
+		switch {
+		case strings.EqualFold(name, "Upgrade") || strings.EqualFold(name, "Connection"):
+			websocket = true
+		default:
+			set[name] = values
+		}
+	}
+	return websocket, set
+}
+
+// extractHeaders applies the operations of a headers handler to request
+// and response header maps, creating them as needed. It returns a warning
+// for each operation without an equivalent.
+func extractHeaders(handler *CaddyHandler, request, response *map[string][]string) []string {
+	var warnings []string
+
+	if ops := handler.Request; ops != nil {
+		for name, values := range ops.Set {
+			setHeader(request, name, values)
+		}
+		for name, values := range ops.Add {
+			setHeader(request, name, append((*request)[name], values...))
+		}
+		if len(ops.Delete) > 0 {
+			warnings = append(warnings, "Removing request headers is not supported")
+		}
+		if ops.Replace != nil {
+			warnings = append(warnings, "Header replacements are not supported")
+		}
+	}
+
+	if ops := handler.Response; ops != nil {
+		for name, values := range ops.Set {
+			setHeader(response, name, values)
+		}
+		for name, values := range ops.Add {
+			setHeader(response, name, append((*response)[name], values...))
+		}
+		for _, name := range ops.Delete {
+			setHeader(response, name, []string{})
+		}
+		if ops.Replace != nil {
+			warnings = append(warnings, "Header replacements are not supported")
+		}
+		if ops.Require != nil {
+			warnings = append(warnings, "Conditional response headers are not supported")
+		}
+	}
+
+	return warnings
+}
+
+func setHeader(headers *map[string][]string, name string, values []string) {
+	if *headers == nil {
+		*headers = make(map[string][]string)
+	}
+	(*headers)[name] = values
+}
+
+// extractHSTS turns a Strict-Transport-Security header as generated for
+// HSTS into the host's HSTS settings. Other values stay custom headers.
+func extractHSTS(host *ParsedHost) {
+	values := host.ResponseHeaders["Strict-Transport-Security"]
+	if len(values) != 1 {
+		return
+	}
+	switch values[0] {
+	case "max-age=31536000":
+		host.HSTSEnabled = true
+	case "max-age=31536000; includeSubDomains":
+		host.HSTSEnabled, host.HSTSSubdomains = true, true
+	default:
+		return
+	}
+	delete(host.ResponseHeaders, "Strict-Transport-Security")
+}
+
+// extractCacheControl recognizes the route produced by
+// `header @name Cache-Control <value>` with a single path matcher.
+// Rules are written in a route block so the first matching one comes last,
+// so each rule found goes first.
+func extractCacheControl(route *CaddyRoute, host *ParsedHost) bool {
+	if len(route.Match) != 1 || len(route.Handle) != 1 {
+		return false
+	}
+	match, handler := route.Match[0], route.Handle[0]
+	if len(match.Path) != 1 || len(match.Host) > 0 || match.PathRegexp != nil || len(match.Method) > 0 ||
+		len(match.Header) > 0 || len(match.Query) > 0 || match.File != nil {
+		return false
+	}
+	if handler.Handler != "headers" || handler.Request != nil || handler.Response == nil {
+		return false
+	}
+	ops := handler.Response
+	value := ops.Set["Cache-Control"]
+	if len(ops.Set) != 1 || len(value) != 1 || len(ops.Add) > 0 || len(ops.Delete) > 0 || ops.Replace != nil || ops.Require != nil {
+		return false
+	}
+
+	rule := models.CacheControlRule{Path: match.Path[0], Value: value[0]}
+	host.StaticCacheControl = append([]models.CacheControlRule{rule}, host.StaticCacheControl...)
+	return true
+}
+
+// extractFileServer turns the host into a static host.
+func extractFileServer(handler *CaddyHandler, host *ParsedHost) {
+	host.HostType = models.HostTypeStatic
+	if handler.Root != "" && !strings.HasPrefix(handler.Root, "{") {
+		host.StaticRoot = handler.Root
+	}
+	if len(handler.IndexNames) > 0 {
+		host.StaticIndexFiles = strings.Join(handler.IndexNames, ",")
+	}
+	host.StaticBrowse = handler.Browse != nil
+	host.StaticPrecompressed = handler.Precompressed != nil
+}
+
+// extractTryFiles recognizes the route produced by
+// `try_files {path} /index.html` and enables the SPA fallback.
+func extractTryFiles(route *CaddyRoute, host *ParsedHost) bool {
+	if len(route.Match) != 1 || route.Match[0].File == nil || len(route.Handle) != 1 {
+		return false
+	}
+	tryFiles := route.Match[0].File.TryFiles
+	rewrite := route.Handle[0]
+	if len(tryFiles) < 2 || rewrite.Handler != "rewrite" || rewrite.URI != "{http.matchers.file.relative}" {
+		return false
+	}
+
+	// Only a literal last entry is a fallback, placeholders just try other paths
+	fallback := tryFiles[len(tryFiles)-1]
+	if strings.Contains(fallback, "{") {
+		return false
+	}
+
+	host.StaticSPAFallback = true
+	if name := strings.TrimPrefix(fallback, "/"); name != "index.html" && host.StaticIndexFiles == "" {
+		host.StaticIndexFiles = name
+	}
+	return true
+}
+
+// extractLocation converts a path-matched route into a location.
+// Only prefix paths proxying to a single upstream are supported.
+func extractLocation(route *CaddyRoute) (ParsedLocation, bool) {
+	var loc ParsedLocation
+	if len(route.Match) != 1 || len(route.Match[0].Host) > 0 {
+		return loc, false
+	}
+	match := route.Match[0]
+
+	switch {
+	case len(match.Path) == 1 && match.PathRegexp == nil,
+		len(match.Path) == 2 && match.PathRegexp == nil && match.Path[1] == match.Path[0]+"/*":
+		// A path and its subtree, as generated and exported, is one prefix
+		loc.Path = strings.TrimSuffix(strings.TrimSuffix(match.Path[0], "*"), "/")
+		if !strings.HasPrefix(loc.Path, "/") || strings.ContainsAny(loc.Path, "*?[") {
+			return loc, false
+		}
+	case len(match.Path) == 0 && match.PathRegexp != nil:
+		loc.PathRegex = match.PathRegexp.Pattern
+	default:
+		return loc, false
+	}
+
+	loc.Methods = strings.Join(match.Method, ",")
+	loc.MatchHeaders = match.Header
+	loc.MatchQuery = match.Query
+
+	if !collectLocationHandlers(route.Handle, &loc) || loc.ForwardHost == "" {
+		return loc, false
+	}
+
+	return loc, true
+}
+
+// collectLocationHandlers reads the handlers of a location, as produced
+// by handle or handle_path. It reports false for anything it cannot represent.
+func collectLocationHandlers(handlers []*CaddyHandler, loc *ParsedLocation) bool {
+	for _, handler := range handlers {
+		switch handler.Handler {
+		case "reverse_proxy":
+			if loc.ForwardHost != "" {
+				return false
+			}
+			upstreams, skipped := parseUpstreams(handler.Upstreams)
+			if len(upstreams) != 1 || skipped > 0 {
+				return false
+			}
+			loc.ForwardHost, loc.ForwardPort = upstreams[0].ForwardHost, upstreams[0].ForwardPort
+			loc.ForwardScheme = upstreamScheme(handler.Transport)
+			if handler.Transport != nil && handler.Transport.TLS != nil {
+				loc.UpstreamTLSSkipVerify = handler.Transport.TLS.InsecureSkipVerify
+				loc.UpstreamTLSServerName = handler.Transport.TLS.ServerName
+			}
+			websocket, headers := proxyRequestHeaders(handler.Headers)
+			loc.WebsocketSupport = websocket
+			for name, values := range headers {
+				setHeader(&loc.RequestHeaders, name, values)
+			}
+		case "rewrite":
+			if handler.URI != "" || len(handler.PathRegexp) > 1 {
+				return false
+			}
+			if handler.StripPathPrefix != "" {
+				if handler.StripPathPrefix != loc.Path {
+					return false
+				}
+				loc.StripPrefix = true
+			}
+			if len(handler.PathRegexp) == 1 {
+				if loc.RewriteRegex != "" {
+					return false
+				}
+				loc.RewriteRegex = handler.PathRegexp[0].Find
+				loc.RewriteReplacement = handler.PathRegexp[0].Replace
+			}
+		case "headers":
+			if len(extractHeaders(handler, &loc.RequestHeaders, &loc.ResponseHeaders)) > 0 {
+				return false
+			}
+		case "encode":
+			loc.EnableCompression = true
+		case "subroute":
+			for _, route := range handler.Routes {
+				if len(route.Match) > 0 || !collectLocationHandlers(route.Handle, loc) {
+					return false
+				}
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// upstreamScheme reports https when the proxy transport dials upstreams over TLS.
+func upstreamScheme(transport *CaddyTransport) string {
+	if transport != nil && transport.TLS != nil {
+		return "https"
+	}
+	return "http"
+}
+
+// parseUpstreams returns the host and port of each upstream dial address,
+// and how many addresses were skipped, such as unix sockets.
+func parseUpstreams(raw interface{}) ([]ParsedUpstream, int) {
+	list, _ := raw.([]interface{})
+	upstreams := make([]ParsedUpstream, 0, len(list))
+	skipped := 0
+	for _, item := range list {
+		upstream, _ := item.(map[string]interface{})
+		dial, _ := upstream["dial"].(string)
+		parts := strings.Split(dial, ":")
+		if len(parts) != 2 || parts[0] == "" {
+			skipped++
+			continue
+		}
+
+		port := 80
+		if _, err := fmt.Sscanf(parts[1], "%d", &port); err != nil {
+			// Default to 80 if the port cannot be parsed
+			port = 80
+		}
+		upstreams = append(upstreams, ParsedUpstream{ForwardHost: parts[0], ForwardPort: port})
+	}
+	return upstreams, skipped
+}
+
+// extractServerTimeouts records server-level timeouts as settings.
+// The first server that sets a timeout wins.
+func extractServerTimeouts(server *CaddyServer, result *ImportResult) {
+	timeouts := map[string]Duration{
+		"caddy.server_read_timeout":        server.ReadTimeout,
+		"caddy.server_read_header_timeout": server.ReadHeaderTimeout,
+		"caddy.server_write_timeout":       server.WriteTimeout,
+		"caddy.server_idle_timeout":        server.IdleTimeout,
+	}
+
+	for key, d := range timeouts {
+		if d == 0 {
+			continue
+		}
+		if result.Settings == nil {
+			result.Settings = make(map[string]string)
+		}
+		if _, exists := result.Settings[key]; !exists {
+			result.Settings[key] = time.Duration(d).String()
+		}
+	}
+}
+
+// extractTransport copies upstream timeouts from a reverse_proxy transport.
+func extractTransport(transport *CaddyTransport, host *ParsedHost) {
+	if transport == nil {
+		return
+	}
+
+	if transport.ResponseHeaderTimeout != 0 {
+		host.ResponseHeaderTimeout = time.Duration(transport.ResponseHeaderTimeout).String()
+	}
+
+	if ka := transport.KeepAlive; ka != nil {
+		if ka.Enabled != nil && !*ka.Enabled {
+			host.UpstreamKeepAlive = "off"
+		} else if ka.ProbeInterval != 0 {
+			host.UpstreamKeepAlive = time.Duration(ka.ProbeInterval).String()
+		}
+		if ka.IdleTimeout != 0 {
+			host.UpstreamIdleTimeout = time.Duration(ka.IdleTimeout).String()
+		}
+	}
+}
+
 // ImportFile performs complete import: parse Caddyfile and extract hosts.
 func (i *Importer) ImportFile(caddyfilePath string) (*ImportResult, error) {
 	caddyJSON, err := i.ParseCaddyfile(caddyfilePath)
@@ -233,24 +1023,114 @@ func ConvertToProxyHosts(parsedHosts []ParsedHost) []models.ProxyHost {
 	hosts := make([]models.ProxyHost, 0, len(parsedHosts))
 
 	for _, parsed := range parsedHosts {
-		if parsed.ForwardHost == "" || parsed.ForwardPort == 0 {
+		if !convertible(parsed) {
 			continue // Skip invalid entries
 		}
 
 		hosts = append(hosts, models.ProxyHost{
-			Name:             parsed.DomainNames, // Can be customized by user during review
-			DomainNames:      parsed.DomainNames,
-			ForwardScheme:    parsed.ForwardScheme,
-			ForwardHost:      parsed.ForwardHost,
-			ForwardPort:      parsed.ForwardPort,
-			SSLForced:        parsed.SSLForced,
-			WebsocketSupport: parsed.WebsocketSupport,
+			Name:                  parsed.DomainNames, // Can be customized by user during review
+			DomainNames:           parsed.DomainNames,
+			ForwardScheme:         parsed.ForwardScheme,
+			ForwardHost:           parsed.ForwardHost,
+			ForwardPort:           parsed.ForwardPort,
+			SSLForced:             parsed.SSLForced,
+			WebsocketSupport:      parsed.WebsocketSupport,
+			MaxBodySize:           parsed.MaxBodySize,
+			ResponseHeaderTimeout: parsed.ResponseHeaderTimeout,
+			UpstreamIdleTimeout:   parsed.UpstreamIdleTimeout,
+			UpstreamKeepAlive:     parsed.UpstreamKeepAlive,
+			UpstreamGroups:        convertUpstreams(parsed),
+			SplitStickyCookie:     parsed.SplitStickyCookie,
+			UpstreamTLSSkipVerify: parsed.UpstreamTLSSkipVerify,
+			UpstreamTLSServerName: parsed.UpstreamTLSServerName,
+			Locations:             convertLocations(parsed),
+			EnableCompression:     parsed.EnableCompression,
+			HSTSEnabled:           parsed.HSTSEnabled,
+			HSTSSubdomains:        parsed.HSTSSubdomains,
+			RequestHeaders:        parsed.RequestHeaders,
+			ResponseHeaders:       parsed.ResponseHeaders,
+			CertificateIssuer:     parsed.CertificateIssuer,
+			HostType:              parsed.HostType,
+			StaticRoot:            parsed.StaticRoot,
+			StaticIndexFiles:      parsed.StaticIndexFiles,
+			StaticSPAFallback:     parsed.StaticSPAFallback,
+			StaticBrowse:          parsed.StaticBrowse,
+			StaticPrecompressed:   parsed.StaticPrecompressed,
+			StaticCacheControl:    parsed.StaticCacheControl,
 		})
 	}
 
 	return hosts
 }
 
+// convertible reports whether a parsed host has what a proxy host needs:
+// an upstream, or a root for static hosts.
+func convertible(parsed ParsedHost) bool {
+	if parsed.HostType == models.HostTypeStatic {
+		return parsed.StaticRoot != ""
+	}
+	return parsed.ForwardHost != "" && parsed.ForwardPort != 0
+}
+
+// convertUpstreams converts load balanced upstreams to an even or weighted
+// traffic split across upstream groups.
+func convertUpstreams(parsed ParsedHost) []models.UpstreamGroup {
+	if len(parsed.Upstreams) < 2 {
+		return nil
+	}
+
+	groups := make([]models.UpstreamGroup, 0, len(parsed.Upstreams))
+	for i, u := range parsed.Upstreams {
+		groups = append(groups, models.UpstreamGroup{
+			Name:          fmt.Sprintf("upstream-%d", i+1),
+			ForwardScheme: parsed.ForwardScheme,
+			ForwardHost:   u.ForwardHost,
+			ForwardPort:   u.ForwardPort,
+			Weight:        u.Weight,
+		})
+	}
+	return groups
+}
+
+// convertLocations converts a host's parsed locations to Location models.
+// Settings equal to the host's are inherited rather than overridden.
+func convertLocations(host ParsedHost) []models.Location {
+	if len(host.Locations) == 0 {
+		return nil
+	}
+
+	locations := make([]models.Location, 0, len(host.Locations))
+	for _, p := range host.Locations {
+		loc := models.Location{
+			Path:                  p.Path,
+			PathRegex:             p.PathRegex,
+			Methods:               p.Methods,
+			MatchHeaders:          p.MatchHeaders,
+			MatchQuery:            p.MatchQuery,
+			ForwardScheme:         p.ForwardScheme,
+			ForwardHost:           p.ForwardHost,
+			ForwardPort:           p.ForwardPort,
+			StripPrefix:           p.StripPrefix,
+			RewriteRegex:          p.RewriteRegex,
+			RewriteReplacement:    p.RewriteReplacement,
+			RequestHeaders:        p.RequestHeaders,
+			ResponseHeaders:       p.ResponseHeaders,
+			UpstreamTLSServerName: p.UpstreamTLSServerName,
+		}
+		if p.WebsocketSupport != host.WebsocketSupport {
+			loc.WebsocketSupport = &p.WebsocketSupport
+		}
+		if p.EnableCompression && !host.EnableCompression {
+			loc.EnableCompression = &p.EnableCompression
+		}
+		if p.UpstreamTLSSkipVerify != host.UpstreamTLSSkipVerify {
+			loc.UpstreamTLSSkipVerify = &p.UpstreamTLSSkipVerify
+		}
+		locations = append(locations, loc)
+	}
+	return locations
+}
+
 // ValidateCaddyBinary checks if the Caddy binary is available.
 func (i *Importer) ValidateCaddyBinary() error {
 	_, err := i.executor.Execute(i.caddyBinaryPath, "version")
@@ -3,9 +3,13 @@ package caddy
 import (
 	"os"
 	"path/filepath"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/models"
 )
 
 func TestNewImporter(t *testing.T) {
@@ -163,9 +167,10 @@ func TestImporter_ExtractHosts(t *testing.T) {
 	result, err = importer.ExtractHosts(unsupportedJSON)
 	assert.NoError(t, err)
 	assert.Len(t, result.Hosts, 1)
-	assert.Len(t, result.Hosts[0].Warnings, 2)
-	assert.Contains(t, result.Hosts[0].Warnings, "File server directives not supported")
+	assert.Len(t, result.Hosts[0].Warnings, 1)
 	assert.Contains(t, result.Hosts[0].Warnings, "Rewrite rules not supported - manual configuration required")
+	// file_server is converted to a static host rather than flagged
+	assert.Equal(t, "static", result.Hosts[0].HostType)
 }
 
 func TestImporter_ImportFile(t *testing.T) {
@@ -268,3 +273,581 @@ func TestBackupCaddyfile(t *testing.T) {
 	_, err = BackupCaddyfile("non-existent", backupDir)
 	assert.Error(t, err)
 }
+
+func TestImporter_ExtractHosts_LimitsAndTimeouts(t *testing.T) {
+	importer := NewImporter("caddy")
+
+	// Output of `caddy adapt` for request_body max_size 10MB, transport
+	// timeouts and global server timeouts; durations are nanoseconds.
+	caddyJSON := []byte(`{
+		"apps": {
+			"http": {
+				"servers": {
+					"srv0": {
+						"listen": [":443"],
+						"read_timeout": 30000000000,
+						"idle_timeout": "5m",
+						"routes": [{
+							"match": [{"host": ["cloud.example.com"]}],
+							"handle": [
+								{"handler": "request_body", "max_size": 10000000},
+								{
+									"handler": "reverse_proxy",
+									"upstreams": [{"dial": "nextcloud:80"}],
+									"transport": {
+										"protocol": "http",
+										"response_header_timeout": 300000000000,
+										"keep_alive": {"idle_timeout": 120000000000, "probe_interval": 30000000000}
+									}
+								}
+							]
+						}, {
+							"match": [{"host": ["api.example.com"]}],
+							"handle": [{
+								"handler": "reverse_proxy",
+								"upstreams": [{"dial": "api:8080"}],
+								"transport": {"protocol": "http", "keep_alive": {"enabled": false}}
+							}]
+						}]
+					}
+				}
+			}
+		}
+	}`)
+
+	result, err := importer.ExtractHosts(caddyJSON)
+	assert.NoError(t, err)
+	assert.Len(t, result.Hosts, 2)
+
+	cloud := result.Hosts[0]
+	assert.Equal(t, int64(10000000), cloud.MaxBodySize)
+	assert.Equal(t, "5m0s", cloud.ResponseHeaderTimeout)
+	assert.Equal(t, "2m0s", cloud.UpstreamIdleTimeout)
+	assert.Equal(t, "30s", cloud.UpstreamKeepAlive)
+	assert.Equal(t, "off", result.Hosts[1].UpstreamKeepAlive)
+
+	assert.Equal(t, map[string]string{
+		"caddy.server_read_timeout": "30s",
+		"caddy.server_idle_timeout": "5m0s",
+	}, result.Settings)
+
+	hosts := ConvertToProxyHosts(result.Hosts)
+	assert.Equal(t, int64(10000000), hosts[0].MaxBodySize)
+	assert.Equal(t, "5m0s", hosts[0].ResponseHeaderTimeout)
+	assert.Equal(t, "off", hosts[1].UpstreamKeepAlive)
+}
+
+func TestImporter_ExtractHosts_HandlePath(t *testing.T) {
+	importer := NewImporter("caddy")
+
+	// Output of `caddy adapt` for:
+	//   app.example.com {
+	//     handle_path /grafana/* {
+	//       reverse_proxy grafana:3000
+	//     }
+	//     handle /api/* {
+	//       reverse_proxy api:9000
+	//     }
+	//     reverse_proxy app:8080
+	//   }
+	caddyJSON := []byte(`{
+		"apps": {
+			"http": {
+				"servers": {
+					"srv0": {
+						"listen": [":443"],
+						"routes": [{
+							"match": [{"host": ["app.example.com"]}],
+							"handle": [{
+								"handler": "subroute",
+								"routes": [{
+									"group": "group2",
+									"match": [{"path": ["/grafana/*"]}],
+									"handle": [{
+										"handler": "subroute",
+										"routes": [
+											{"handle": [{"handler": "rewrite", "strip_path_prefix": "/grafana"}]},
+											{"handle": [{"handler": "reverse_proxy", "upstreams": [{"dial": "grafana:3000"}]}]}
+										]
+									}]
+								}, {
+									"group": "group2",
+									"match": [{"path": ["/api/*"]}],
+									"handle": [{
+										"handler": "subroute",
+										"routes": [{"handle": [{"handler": "reverse_proxy", "upstreams": [{"dial": "api:9000"}]}]}]
+									}]
+								}, {
+									"handle": [{"handler": "reverse_proxy", "upstreams": [{"dial": "app:8080"}]}]
+								}]
+							}],
+							"terminal": true
+						}]
+					}
+				}
+			}
+		}
+	}`)
+
+	result, err := importer.ExtractHosts(caddyJSON)
+	assert.NoError(t, err)
+	assert.Len(t, result.Hosts, 1)
+
+	host := result.Hosts[0]
+	assert.Empty(t, host.Warnings)
+	assert.Equal(t, "app", host.ForwardHost)
+	assert.Equal(t, 8080, host.ForwardPort)
+	assert.Equal(t, []ParsedLocation{
+		{Path: "/grafana", ForwardScheme: "http", ForwardHost: "grafana", ForwardPort: 3000, StripPrefix: true},
+		{Path: "/api", ForwardScheme: "http", ForwardHost: "api", ForwardPort: 9000},
+	}, host.Locations)
+
+	hosts := ConvertToProxyHosts(result.Hosts)
+	assert.Len(t, hosts[0].Locations, 2)
+	assert.True(t, hosts[0].Locations[0].StripPrefix)
+	assert.Equal(t, "/grafana", hosts[0].Locations[0].Path)
+}
+
+func TestImporter_ExtractHosts_ExportedLocations(t *testing.T) {
+	importer := NewImporter("caddy")
+
+	// Output of `caddy adapt` for a location as ExportCaddyfile writes it:
+	//   app.example.com {
+	//     @loc0 {
+	//       path /grafana /grafana/*
+	//     }
+	//     handle @loc0 {
+	//       uri strip_prefix /grafana
+	//       reverse_proxy grafana:3000
+	//     }
+	//     handle {
+	//       reverse_proxy app:8080
+	//     }
+	//   }
+	caddyJSON := []byte(`{
+		"apps": {"http": {"servers": {"srv0": {"routes": [{
+			"match": [{"host": ["app.example.com"]}],
+			"handle": [{
+				"handler": "subroute",
+				"routes": [{
+					"group": "group2",
+					"match": [{"path": ["/grafana", "/grafana/*"]}],
+					"handle": [{
+						"handler": "subroute",
+						"routes": [
+							{"handle": [{"handler": "rewrite", "strip_path_prefix": "/grafana"}]},
+							{"handle": [{"handler": "reverse_proxy", "upstreams": [{"dial": "grafana:3000"}]}]}
+						]
+					}]
+				}, {
+					"group": "group2",
+					"handle": [{
+						"handler": "subroute",
+						"routes": [{"handle": [{"handler": "reverse_proxy", "upstreams": [{"dial": "app:8080"}]}]}]
+					}]
+				}]
+			}],
+			"terminal": true
+		}]}}}}
+	}`)
+
+	result, err := importer.ExtractHosts(caddyJSON)
+	assert.NoError(t, err)
+	assert.Equal(t, "app", result.Hosts[0].ForwardHost)
+	assert.Equal(t, []ParsedLocation{
+		{Path: "/grafana", ForwardScheme: "http", ForwardHost: "grafana", ForwardPort: 3000, StripPrefix: true},
+	}, result.Hosts[0].Locations)
+
+	// Two unrelated paths are still not a location
+	unrelated := strings.Replace(string(caddyJSON), `"/grafana/*"`, `"/metrics"`, 1)
+	result, err = importer.ExtractHosts([]byte(unrelated))
+	assert.NoError(t, err)
+	assert.Empty(t, result.Hosts[0].Locations)
+}
+
+func TestImporter_ExtractHosts_UnsupportedRewrite(t *testing.T) {
+	importer := NewImporter("caddy")
+
+	caddyJSON := []byte(`{
+		"apps": {"http": {"servers": {"srv0": {"routes": [{
+			"match": [{"host": ["app.example.com"]}],
+			"handle": [
+				{"handler": "rewrite", "uri": "/index.php?{query}"},
+				{"handler": "reverse_proxy", "upstreams": [{"dial": "php:9000"}]}
+			]
+		}]}}}}
+	}`)
+
+	result, err := importer.ExtractHosts(caddyJSON)
+	assert.NoError(t, err)
+	assert.Contains(t, result.Hosts[0].Warnings, "Rewrite rules not supported - manual configuration required")
+	assert.Empty(t, result.Hosts[0].Locations)
+}
+
+func TestImporter_ExtractHosts_LocationMatchers(t *testing.T) {
+	importer := NewImporter("caddy")
+
+	caddyJSON := []byte(`{
+		"apps": {"http": {"servers": {"srv0": {"routes": [{
+			"match": [{"host": ["app.example.com"]}],
+			"handle": [{
+				"handler": "subroute",
+				"routes": [{
+					"match": [{"path": ["/api/*"], "method": ["POST"], "header": {"X-Tenant": ["acme"]}}],
+					"handle": [{"handler": "reverse_proxy", "upstreams": [{"dial": "api:9000"}]}]
+				}, {
+					"match": [{"path_regexp": {"pattern": "^/files/\\d+$"}}],
+					"handle": [{"handler": "reverse_proxy", "upstreams": [{"dial": "files:9001"}]}]
+				}, {
+					"handle": [{"handler": "reverse_proxy", "upstreams": [{"dial": "app:8080"}]}]
+				}]
+			}]
+		}]}}}}
+	}`)
+
+	result, err := importer.ExtractHosts(caddyJSON)
+	assert.NoError(t, err)
+	assert.Equal(t, []ParsedLocation{
+		{Path: "/api", Methods: "POST", MatchHeaders: map[string][]string{"X-Tenant": {"acme"}}, ForwardScheme: "http", ForwardHost: "api", ForwardPort: 9000},
+		{PathRegex: `^/files/\d+$`, ForwardScheme: "http", ForwardHost: "files", ForwardPort: 9001},
+	}, result.Hosts[0].Locations)
+}
+
+func TestImporter_ExtractHosts_MultiDomain(t *testing.T) {
+	importer := NewImporter("caddy")
+
+	// Output of `caddy adapt` for:
+	//   a.com, b.com {
+	//     reverse_proxy app:80
+	//   }
+	//   B.com, c.com {
+	//     tls internal
+	//     reverse_proxy other:80
+	//   }
+	caddyJSON := []byte(`{
+		"apps": {
+			"http": {"servers": {"srv0": {"routes": [
+				{"match": [{"host": ["a.com", "b.com"]}], "handle": [{"handler": "subroute", "routes": [{"handle": [{"handler": "reverse_proxy", "upstreams": [{"dial": "app:80"}]}]}]}], "terminal": true},
+				{"match": [{"host": ["B.com", "c.com"]}], "handle": [{"handler": "subroute", "routes": [{"handle": [{"handler": "reverse_proxy", "upstreams": [{"dial": "other:80"}]}]}]}], "terminal": true}
+			]}}},
+			"tls": {"automation": {"policies": [{"subjects": ["c.com"], "issuers": [{"module": "internal"}]}]}}
+		}
+	}`)
+
+	result, err := importer.ExtractHosts(caddyJSON)
+	require.NoError(t, err)
+	require.Len(t, result.Hosts, 2)
+	assert.Equal(t, "a.com, b.com", result.Hosts[0].DomainNames)
+	assert.Equal(t, "app", result.Hosts[0].ForwardHost)
+	assert.Equal(t, "c.com", result.Hosts[1].DomainNames)
+	assert.Equal(t, IssuerInternal, result.Hosts[1].CertificateIssuer)
+	assert.Equal(t, []string{"Duplicate domain detected: B.com"}, result.Conflicts)
+
+	hosts := ConvertToProxyHosts(result.Hosts)
+	require.Len(t, hosts, 2)
+	assert.Equal(t, "a.com, b.com", hosts[0].DomainNames)
+
+	// A host has a single issuer
+	mixed := strings.Replace(string(caddyJSON), `"subjects": ["c.com"]`, `"subjects": ["b.com"]`, 1)
+	result, err = importer.ExtractHosts([]byte(mixed))
+	require.NoError(t, err)
+	assert.Empty(t, result.Hosts[0].CertificateIssuer)
+	assert.Equal(t, []string{"Domains use different certificate issuers, the one of a.com is imported"}, result.Hosts[0].Warnings)
+}
+
+func TestImporter_ExtractHosts_FullFidelity(t *testing.T) {
+	importer := NewImporter("caddy")
+
+	// Output of `caddy adapt` for:
+	//   app.example.com {
+	//     tls internal
+	//     header Strict-Transport-Security "max-age=31536000; includeSubDomains"
+	//     header X-Frame-Options DENY
+	//     header -Server
+	//     request_header X-Env prod
+	//     encode zstd gzip
+	//     @bots header User-Agent *bot*
+	//     respond @bots 403
+	//     handle /admin/* {
+	//       header Cache-Control no-store
+	//       reverse_proxy https://admin:8443 {
+	//         transport http {
+	//           tls_insecure_skip_verify
+	//         }
+	//       }
+	//     }
+	//     handle {
+	//       reverse_proxy app1:8080 app2:8080 app3:8080 {
+	//         header_up Upgrade {http.request.header.Upgrade}
+	//         header_up Connection {http.request.header.Connection}
+	//         header_up X-Tenant acme
+	//         lb_policy cookie lb
+	//       }
+	//       metrics
+	//     }
+	//   }
+	caddyJSON := []byte(`{
+		"apps": {
+			"http": {"servers": {"srv0": {"listen": [":443"], "routes": [{
+				"match": [{"host": ["app.example.com"]}],
+				"handle": [{
+					"handler": "subroute",
+					"routes": [{
+						"handle": [
+							{"handler": "headers", "response": {
+								"set": {"Strict-Transport-Security": ["max-age=31536000; includeSubDomains"], "X-Frame-Options": ["DENY"]},
+								"delete": ["Server"],
+								"deferred": true
+							}},
+							{"handler": "headers", "request": {"set": {"X-Env": ["prod"]}}},
+							{"handler": "encode", "encodings": {"gzip": {}, "zstd": {}}, "prefer": ["zstd", "gzip"]}
+						]
+					}, {
+						"match": [{"header": {"User-Agent": ["*bot*"]}}],
+						"handle": [{"handler": "static_response", "status_code": 403}]
+					}, {
+						"group": "group2",
+						"match": [{"path": ["/admin/*"]}],
+						"handle": [{"handler": "subroute", "routes": [{"handle": [
+							{"handler": "headers", "response": {"set": {"Cache-Control": ["no-store"]}}},
+							{"handler": "reverse_proxy", "transport": {"protocol": "http", "tls": {"insecure_skip_verify": true}}, "upstreams": [{"dial": "admin:8443"}]}
+						]}]}]
+					}, {
+						"group": "group2",
+						"handle": [{"handler": "subroute", "routes": [{"handle": [
+							{
+								"handler": "reverse_proxy",
+								"headers": {"request": {"set": {
+									"Connection": ["{http.request.header.Connection}"],
+									"Upgrade": ["{http.request.header.Upgrade}"],
+									"X-Tenant": ["acme"]
+								}}},
+								"load_balancing": {"selection_policy": {"policy": "cookie", "name": "lb"}},
+								"upstreams": [{"dial": "app1:8080"}, {"dial": "app2:8080"}, {"dial": "app3:8080"}]
+							},
+							{"handler": "metrics"}
+						]}]}]
+					}]
+				}],
+				"terminal": true
+			}]}}},
+			"tls": {"automation": {"policies": [{"subjects": ["app.example.com"], "issuers": [{"module": "internal"}]}]}}
+		}
+	}`)
+
+	result, err := importer.ExtractHosts(caddyJSON)
+	require.NoError(t, err)
+	require.Len(t, result.Hosts, 1)
+	assert.Empty(t, result.Passthrough)
+
+	host := result.Hosts[0]
+	assert.Equal(t, []string{
+		"Handler 'static_response' limited to a matcher is not supported - manual configuration required",
+		"Handler 'metrics' is not supported - manual configuration required",
+	}, host.Warnings)
+	assert.Equal(t, IssuerInternal, host.CertificateIssuer)
+	assert.True(t, host.HSTSEnabled)
+	assert.True(t, host.HSTSSubdomains)
+	assert.True(t, host.EnableCompression)
+	assert.True(t, host.WebsocketSupport)
+	assert.Equal(t, map[string][]string{"X-Frame-Options": {"DENY"}, "Server": {}}, host.ResponseHeaders)
+	assert.Equal(t, map[string][]string{"X-Env": {"prod"}, "X-Tenant": {"acme"}}, host.RequestHeaders)
+	assert.Equal(t, "lb", host.SplitStickyCookie)
+	assert.Equal(t, []ParsedUpstream{
+		{ForwardHost: "app1", ForwardPort: 8080, Weight: 34},
+		{ForwardHost: "app2", ForwardPort: 8080, Weight: 33},
+		{ForwardHost: "app3", ForwardPort: 8080, Weight: 33},
+	}, host.Upstreams)
+	assert.Equal(t, []ParsedLocation{{
+		Path: "/admin", ForwardScheme: "https", ForwardHost: "admin", ForwardPort: 8443,
+		ResponseHeaders: map[string][]string{"Cache-Control": {"no-store"}}, UpstreamTLSSkipVerify: true,
+	}}, host.Locations)
+
+	hosts := ConvertToProxyHosts(result.Hosts)
+	require.Len(t, hosts, 1)
+	assert.Equal(t, "app1", hosts[0].ForwardHost)
+	require.Len(t, hosts[0].UpstreamGroups, 3)
+	assert.Equal(t, "upstream-3", hosts[0].UpstreamGroups[2].Name)
+	require.NoError(t, ValidateUpstreamGroups(hosts[0].UpstreamGroups, hosts[0].SplitStickyCookie, ""))
+	require.Len(t, hosts[0].Locations, 1)
+	require.NotNil(t, hosts[0].Locations[0].WebsocketSupport)
+	assert.False(t, *hosts[0].Locations[0].WebsocketSupport)
+	require.NotNil(t, hosts[0].Locations[0].UpstreamTLSSkipVerify)
+	assert.True(t, *hosts[0].Locations[0].UpstreamTLSSkipVerify)
+	assert.Nil(t, hosts[0].Locations[0].EnableCompression)
+
+	_, err = GenerateConfig(hosts, "/tmp/caddy-data", ConfigOptions{})
+	require.NoError(t, err)
+}
+
+func TestImporter_ExtractHosts_Upstreams(t *testing.T) {
+	importer := NewImporter("caddy")
+
+	extract := func(proxy string) ParsedHost {
+		caddyJSON := []byte(`{"apps": {"http": {"servers": {"srv0": {"routes": [{
+			"match": [{"host": ["app.example.com"]}],
+			"handle": [` + proxy + `]
+		}]}}},
+		"tls": {"automation": {"policies": [{"subjects": ["app.example.com"], "issuers": [{"module": "acme", "ca": "https://ca.corp.example/acme"}]}]}}}}`)
+		result, err := importer.ExtractHosts(caddyJSON)
+		require.NoError(t, err)
+		require.Len(t, result.Hosts, 1)
+		return result.Hosts[0]
+	}
+
+	host := extract(`{"handler": "reverse_proxy",
+		"load_balancing": {"selection_policy": {"policy": "weighted_round_robin", "weights": [3, 1]}},
+		"upstreams": [{"dial": "stable:80"}, {"dial": "canary:80"}, {"dial": "unix//run/app.sock"}]}`)
+	assert.Equal(t, []ParsedUpstream{{ForwardHost: "stable", ForwardPort: 80, Weight: 75}, {ForwardHost: "canary", ForwardPort: 80, Weight: 25}}, host.Upstreams)
+	assert.Empty(t, host.CertificateIssuer)
+	assert.Equal(t, []string{
+		"Upstreams with placeholders or non-TCP addresses are not supported",
+		"Certificates from the ACME directory https://ca.corp.example/acme need the custom ACME directory setting",
+	}, host.Warnings)
+
+	host = extract(`{"handler": "reverse_proxy",
+		"load_balancing": {"selection_policy": {"policy": "least_conn"}},
+		"upstreams": [{"dial": "a:80"}, {"dial": "b:80"}]}`)
+	assert.Equal(t, []ParsedUpstream{{ForwardHost: "a", ForwardPort: 80, Weight: 50}, {ForwardHost: "b", ForwardPort: 80, Weight: 50}}, host.Upstreams)
+	assert.Contains(t, host.Warnings, "Load balancing policy 'least_conn' is imported as an even traffic split")
+
+	// A single upstream is the forward target only
+	host = extract(`{"handler": "reverse_proxy", "upstreams": [{"dial": "a:80"}]}`)
+	assert.Empty(t, host.Upstreams)
+	assert.Nil(t, ConvertToProxyHosts([]ParsedHost{host})[0].UpstreamGroups)
+}
+
+func TestImporter_ExtractHosts_FileServer(t *testing.T) {
+	importer := NewImporter("caddy")
+
+	// Output of `caddy adapt` for:
+	//   spa.example.com {
+	//     root * /srv/spa
+	//     encode gzip
+	//     try_files {path} /index.html
+	//     file_server browse {
+	//       precompressed br gzip
+	//     }
+	//   }
+	caddyJSON := []byte(`{
+		"apps": {"http": {"servers": {"srv0": {"routes": [{
+			"match": [{"host": ["spa.example.com"]}],
+			"handle": [{
+				"handler": "subroute",
+				"routes": [
+					{"handle": [{"handler": "vars", "root": "/srv/spa"}]},
+					{"handle": [{"handler": "encode", "encodings": {"gzip": {}}}]},
+					{
+						"match": [{"file": {"try_files": ["{http.request.uri.path}", "/index.html"]}}],
+						"handle": [{"handler": "rewrite", "uri": "{http.matchers.file.relative}"}]
+					},
+					{"handle": [{
+						"handler": "file_server",
+						"browse": {},
+						"hide": ["./Caddyfile"],
+						"precompressed": {"br": {}, "gzip": {}},
+						"precompressed_order": ["br", "gzip"]
+					}]}
+				]
+			}],
+			"terminal": true
+		}]}}}}
+	}`)
+
+	result, err := importer.ExtractHosts(caddyJSON)
+	assert.NoError(t, err)
+	assert.Len(t, result.Hosts, 1)
+
+	host := result.Hosts[0]
+	assert.Empty(t, host.Warnings)
+	assert.Equal(t, "static", host.HostType)
+	assert.Equal(t, "/srv/spa", host.StaticRoot)
+	assert.True(t, host.StaticSPAFallback)
+	assert.True(t, host.StaticBrowse)
+	assert.True(t, host.StaticPrecompressed)
+	assert.True(t, host.EnableCompression)
+
+	hosts := ConvertToProxyHosts(result.Hosts)
+	assert.Len(t, hosts, 1)
+	assert.Equal(t, "static", hosts[0].HostType)
+	assert.Equal(t, "/srv/spa", hosts[0].StaticRoot)
+	assert.True(t, hosts[0].StaticSPAFallback)
+}
+
+func TestImporter_ExtractHosts_CacheControl(t *testing.T) {
+	importer := NewImporter("caddy")
+
+	// Output of `caddy adapt` for the cache rules of an exported static host:
+	//   @cache1 path *
+	//   header @cache1 Cache-Control no-cache
+	//   @cache0 path /assets/*
+	//   header @cache0 Cache-Control "public, max-age=31536000"
+	caddyJSON := []byte(`{
+		"apps": {"http": {"servers": {"srv0": {"routes": [{
+			"match": [{"host": ["docs.example.com"]}],
+			"handle": [{
+				"handler": "subroute",
+				"routes": [
+					{"handle": [{"handler": "vars", "root": "/srv/docs"}]},
+					{"match": [{"path": ["*"]}], "handle": [{"handler": "headers", "response": {"set": {"Cache-Control": ["no-cache"]}}}]},
+					{"match": [{"path": ["/assets/*"]}], "handle": [{"handler": "headers", "response": {"set": {"Cache-Control": ["public, max-age=31536000"]}}}]},
+					{"handle": [{"handler": "file_server"}]}
+				]
+			}]
+		}]}}}}
+	}`)
+
+	result, err := importer.ExtractHosts(caddyJSON)
+	require.NoError(t, err)
+	host := result.Hosts[0]
+	assert.Empty(t, host.Warnings)
+	assert.Equal(t, []models.CacheControlRule{
+		{Path: "/assets/*", Value: "public, max-age=31536000"},
+		{Path: "*", Value: "no-cache"},
+	}, host.StaticCacheControl)
+
+	// Proxy hosts have no cache rules
+	proxied := strings.Replace(string(caddyJSON), `{"handler": "file_server"}`, `{"handler": "reverse_proxy", "upstreams": [{"dial": "docs:80"}]}`, 1)
+	result, err = importer.ExtractHosts([]byte(proxied))
+	require.NoError(t, err)
+	assert.Empty(t, result.Hosts[0].StaticCacheControl)
+	assert.Equal(t, []string{"Cache-Control rules are only supported on static hosts"}, result.Hosts[0].Warnings)
+}
+
+func TestImporter_ExtractHosts_Passthrough(t *testing.T) {
+	importer := NewImporter("caddy")
+
+	caddyJSON := []byte(`{
+		"apps": {
+			"http": {"servers": {
+				"srv0": {"listen": [":443"], "routes": [
+					{"match": [{"host": ["app.example.com"]}], "handle": [{"handler": "reverse_proxy", "upstreams": [{"dial": "app:80"}]}]},
+					{"match": [{"host": ["gone.example.com"]}], "handle": [{"handler": "static_response", "status_code": 410}]},
+					{"handle": [{"handler": "static_response", "body": "fallback"}]}
+				]},
+				"metrics": {"listen": [":9180"], "routes": [
+					{"match": [{"path": ["/metrics"]}], "handle": [{"handler": "metrics"}]}
+				]}
+			}},
+			"tls": {},
+			"layer4": {}
+		}
+	}`)
+
+	result, err := importer.ExtractHosts(caddyJSON)
+	require.NoError(t, err)
+	assert.Len(t, result.Hosts, 2)
+	assert.Equal(t, []string{"App 'layer4' is not supported and will not be imported"}, result.Errors)
+
+	require.Len(t, result.Passthrough, 3)
+	assert.Equal(t, "metrics route 0", result.Passthrough[0].Name)
+	assert.Contains(t, result.Passthrough[0].Reason, "served on :9180")
+	assert.JSONEq(t, `{"match": [{"path": ["/metrics"]}], "handle": [{"handler": "metrics"}]}`, string(result.Passthrough[0].Route))
+
+	assert.Equal(t, "srv0 route 1", result.Passthrough[1].Name)
+	assert.Equal(t, "Route neither proxies to an upstream nor serves static files", result.Passthrough[1].Reason)
+	assert.JSONEq(t, `{"match": [{"host": ["gone.example.com"]}], "handle": [{"handler": "static_response", "status_code": 410}]}`, string(result.Passthrough[1].Route))
+
+	assert.Equal(t, "srv0 route 2", result.Passthrough[2].Name)
+	assert.Equal(t, "Route has no host matcher", result.Passthrough[2].Reason)
+}
@@ -0,0 +1,189 @@
+package caddy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// routeIDPrefix starts the @id of every route generated for a proxy host.
+const routeIDPrefix = "host_"
+
+// tagHostRoutes sets the @id of a host's routes: main gets the host's own
+// ID and the routes placed before it, redirects and locations, get the
+// host's ID with their position appended. Hosts without a UUID are left
+// untagged since their IDs would not be unique.
+func tagHostRoutes(hostUUID string, main *Route, others []*Route) {
+	if hostUUID == "" {
+		return
+	}
+	main.ID = routeIDPrefix + hostUUID
+	for i, route := range others {
+		route.ID = fmt.Sprintf("%s%s_%d", routeIDPrefix, hostUUID, i)
+	}
+}
+
+// routeIDHost returns the UUID of the host a route @id belongs to.
+func routeIDHost(id string) string {
+	id = strings.TrimPrefix(id, routeIDPrefix)
+	if i := strings.LastIndex(id, "_"); i >= 0 {
+		if _, err := strconv.Atoi(id[i+1:]); err == nil {
+			return id[:i]
+		}
+	}
+	return id
+}
+
+// routeUpdate is a targeted change to a single route through its @id.
+type routeUpdate struct {
+	ID    string
+	Route *Route // Replacement, nil to delete the route
+}
+
+// planRouteUpdates works out the targeted updates turning the running
+// config before into after. ok is false when the change is structural and
+// needs a full load: anything outside the routes changed, routes were
+// added or reordered, an untagged route changed, or more than one host's
+// routes changed.
+func planRouteUpdates(before, after *Config) (updates []routeUpdate, ok bool) {
+	if before == nil || after == nil {
+		return nil, false
+	}
+	beforeRest, err := withoutRoutes(before)
+	if err != nil {
+		return nil, false
+	}
+	afterRest, err := withoutRoutes(after)
+	if err != nil || beforeRest != afterRest {
+		return nil, false
+	}
+
+	beforeRoutes, afterRoutes := serverRoutes(before), serverRoutes(after)
+	hosts := make(map[string]bool)
+	j := 0
+	for _, route := range beforeRoutes {
+		if route.ID == "" {
+			// Untagged routes can only be left alone
+			if j >= len(afterRoutes) || !sameRoute(route, afterRoutes[j]) {
+				return nil, false
+			}
+			j++
+			continue
+		}
+
+		if j < len(afterRoutes) && afterRoutes[j].ID == route.ID {
+			if !sameRoute(route, afterRoutes[j]) {
+				updates = append(updates, routeUpdate{ID: route.ID, Route: afterRoutes[j]})
+				hosts[routeIDHost(route.ID)] = true
+			}
+			j++
+			continue
+		}
+
+		// Gone from after, e.g. a deleted host or location
+		updates = append(updates, routeUpdate{ID: route.ID})
+		hosts[routeIDHost(route.ID)] = true
+	}
+	if j != len(afterRoutes) || len(hosts) > 1 {
+		return nil, false
+	}
+
+	return updates, true
+}
+
+// serverRoutes returns the routes of the generated server, if any.
+func serverRoutes(config *Config) []*Route {
+	if config.Apps.HTTP == nil || config.Apps.HTTP.Servers["cpm_server"] == nil {
+		return nil
+	}
+	return config.Apps.HTTP.Servers["cpm_server"].Routes
+}
+
+// withoutRoutes returns the canonical JSON of config minus the generated
+// server's routes.
+func withoutRoutes(config *Config) (string, error) {
+	raw, err := json.Marshal(config)
+	if err != nil {
+		return "", err
+	}
+	var generic map[string]interface{}
+	if err := json.Unmarshal(raw, &generic); err != nil {
+		return "", err
+	}
+	if apps, ok := generic["apps"].(map[string]interface{}); ok {
+		if http, ok := apps["http"].(map[string]interface{}); ok {
+			if servers, ok := http["servers"].(map[string]interface{}); ok {
+				if server, ok := servers["cpm_server"].(map[string]interface{}); ok {
+					delete(server, "routes")
+				}
+			}
+		}
+	}
+	canonical, err := json.Marshal(generic)
+	return string(canonical), err
+}
+
+// sameRoute reports whether two routes marshal to the same JSON.
+func sameRoute(a, b *Route) bool {
+	rawA, errA := json.Marshal(a)
+	rawB, errB := json.Marshal(b)
+	return errA == nil && errB == nil && string(rawA) == string(rawB)
+}
+
+// load pushes config to Caddy. When only one host's routes changed since
+// the previously applied config they are patched or deleted by @id, which
+// keeps connections and is fast with many hosts. Caddy's running config is
+// then checked against config, and anything else, including a failed or
+// inconsistent targeted update, falls back to a full load.
+func (m *Manager) load(ctx context.Context, previous, config *Config) error {
+	if updates, ok := planRouteUpdates(previous, config); ok {
+		err := m.applyRouteUpdates(ctx, updates)
+		if err == nil {
+			err = m.checkRunning(ctx, config)
+		}
+		if err == nil {
+			return nil
+		}
+		fmt.Printf("warning: targeted config update failed, loading full config: %v\n", err)
+	}
+
+	return m.client.Load(ctx, config)
+}
+
+// applyRouteUpdates sends targeted route updates to Caddy.
+func (m *Manager) applyRouteUpdates(ctx context.Context, updates []routeUpdate) error {
+	for _, update := range updates {
+		if update.Route == nil {
+			if err := m.client.DeleteID(ctx, update.ID); err != nil {
+				return fmt.Errorf("delete route %s: %w", update.ID, err)
+			}
+			continue
+		}
+		if err := m.client.PatchID(ctx, update.ID, update.Route); err != nil {
+			return fmt.Errorf("patch route %s: %w", update.ID, err)
+		}
+	}
+	return nil
+}
+
+// checkRunning verifies that Caddy runs config.
+func (m *Manager) checkRunning(ctx context.Context, config *Config) error {
+	live, err := m.client.GetRawConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("get live config: %w", err)
+	}
+	liveHash, err := rawConfigHash(live)
+	if err != nil {
+		return err
+	}
+	expectedHash, err := configHash(config)
+	if err != nil {
+		return err
+	}
+	if liveHash != expectedHash {
+		return fmt.Errorf("running config does not match after update")
+	}
+	return nil
+}
@@ -0,0 +1,150 @@
+package caddy
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/models"
+)
+
+func TestGenerateConfig_RouteIDs(t *testing.T) {
+	hosts := []models.ProxyHost{
+		{
+			UUID:          "uuid-www",
+			DomainNames:   "www.example.com",
+			ForwardHost:   "www",
+			ForwardPort:   80,
+			Enabled:       true,
+			CanonicalHost: models.CanonicalHostWWW,
+			Locations:     []models.Location{{Path: "/api", ForwardHost: "api", ForwardPort: 8080}},
+		},
+		{UUID: "uuid-app", DomainNames: "app.example.com", ForwardHost: "app", ForwardPort: 80, Enabled: true},
+		{DomainNames: "legacy.example.com", ForwardHost: "legacy", ForwardPort: 80, Enabled: true},
+	}
+	config, err := GenerateConfig(hosts, t.TempDir(), ConfigOptions{})
+	require.NoError(t, err)
+
+	var ids []string
+	for _, route := range serverRoutes(config) {
+		ids = append(ids, route.ID)
+	}
+	assert.Equal(t, []string{"host_uuid-www_0", "host_uuid-www_1", "host_uuid-www", "host_uuid-app", ""}, ids) // www redirect and /api location first
+
+	assert.Equal(t, "uuid-www", routeIDHost("host_uuid-www_1"))
+	assert.Equal(t, "uuid-www", routeIDHost("host_uuid-www"))
+}
+
+func TestPlanRouteUpdates(t *testing.T) {
+	hosts := []models.ProxyHost{
+		{UUID: "uuid-a", DomainNames: "a.example.com", ForwardHost: "a", ForwardPort: 80, Enabled: true},
+		{UUID: "uuid-b", DomainNames: "b.example.com", ForwardHost: "b", ForwardPort: 80, Enabled: true,
+			Locations: []models.Location{{Path: "/api", ForwardHost: "api", ForwardPort: 8080}}},
+	}
+	generate := func(hosts []models.ProxyHost, opts ConfigOptions) *Config {
+		// Work on a copy so cases don't leak into each other
+		var copied []models.ProxyHost
+		raw, _ := json.Marshal(hosts)
+		require.NoError(t, json.Unmarshal(raw, &copied))
+		config, err := GenerateConfig(copied, "/tmp/caddy-data", opts)
+		require.NoError(t, err)
+		return config
+	}
+	before := generate(hosts, ConfigOptions{})
+
+	// Nothing to compare against
+	_, ok := planRouteUpdates(nil, before)
+	assert.False(t, ok)
+
+	// Unchanged
+	updates, ok := planRouteUpdates(before, generate(hosts, ConfigOptions{}))
+	require.True(t, ok)
+	assert.Empty(t, updates)
+
+	// One host edited in place
+	edited := append([]models.ProxyHost{}, hosts...)
+	edited[1].ForwardPort = 81
+	updates, ok = planRouteUpdates(before, generate(edited, ConfigOptions{}))
+	require.True(t, ok)
+	require.Len(t, updates, 1)
+	assert.Equal(t, "host_uuid-b", updates[0].ID)
+	require.NotNil(t, updates[0].Route)
+
+	// A removed location
+	edited = append([]models.ProxyHost{}, hosts...)
+	edited[1].Locations = nil
+	updates, ok = planRouteUpdates(before, generate(edited, ConfigOptions{}))
+	require.True(t, ok)
+	assert.Equal(t, []routeUpdate{{ID: "host_uuid-b_0"}}, updates)
+
+	// A deleted host
+	updates, ok = planRouteUpdates(before, generate(hosts[1:], ConfigOptions{}))
+	require.True(t, ok)
+	assert.Equal(t, []routeUpdate{{ID: "host_uuid-a"}}, updates)
+
+	// Structural changes
+	edited = append([]models.ProxyHost{}, hosts...)
+	edited[0].ForwardPort = 81
+	edited[1].ForwardPort = 81
+	_, ok = planRouteUpdates(before, generate(edited, ConfigOptions{}))
+	assert.False(t, ok, "two hosts changed")
+
+	added := append(append([]models.ProxyHost{}, hosts...), models.ProxyHost{UUID: "uuid-c", DomainNames: "c.example.com", ForwardHost: "c", ForwardPort: 80, Enabled: true})
+	_, ok = planRouteUpdates(before, generate(added, ConfigOptions{}))
+	assert.False(t, ok, "host added")
+
+	_, ok = planRouteUpdates(before, generate(hosts, ConfigOptions{Server: ServerOptions{IdleTimeout: "2m"}}))
+	assert.False(t, ok, "server settings changed")
+}
+
+func TestManager_TargetedUpdates(t *testing.T) {
+	admin := &fakeAdmin{}
+	manager, db := setupHistoryTest(t, admin.ServeHTTP)
+	require.NoError(t, db.Create(&models.ProxyHost{UUID: "uuid-a", DomainNames: "a.example.com", ForwardHost: "a", ForwardPort: 80, Enabled: true}).Error)
+	require.NoError(t, db.Create(&models.ProxyHost{UUID: "uuid-b", DomainNames: "b.example.com", ForwardHost: "b", ForwardPort: 80, Enabled: true}).Error)
+
+	apply := func() {
+		t.Helper()
+		require.NoError(t, manager.ApplyConfig(context.Background()))
+		require.NoError(t, manager.checkRunning(context.Background(), manager.mustGenerate(t)))
+	}
+
+	// First apply has nothing to patch against
+	apply()
+	assert.Equal(t, 1, admin.loads)
+
+	// An edit is patched
+	require.NoError(t, db.Model(&models.ProxyHost{}).Where("uuid = ?", "uuid-a").Update("forward_port", 81).Error)
+	apply()
+	assert.Equal(t, 1, admin.loads)
+	assert.Equal(t, 1, admin.updates)
+
+	// A delete removes the host's route
+	require.NoError(t, db.Where("uuid = ?", "uuid-b").Delete(&models.ProxyHost{}).Error)
+	apply()
+	assert.Equal(t, 1, admin.loads)
+	assert.Equal(t, 2, admin.updates)
+
+	// An added host is a structural change
+	require.NoError(t, db.Create(&models.ProxyHost{UUID: "uuid-c", DomainNames: "c.example.com", ForwardHost: "c", ForwardPort: 80, Enabled: true}).Error)
+	apply()
+	assert.Equal(t, 2, admin.loads)
+
+	// Caddy edited behind our back: the targeted update fails, so the config is loaded
+	admin.set(`{"apps": {}}`)
+	require.NoError(t, db.Model(&models.ProxyHost{}).Where("uuid = ?", "uuid-a").Update("forward_port", 82).Error)
+	apply()
+	assert.Equal(t, 3, admin.loads)
+}
+
+// mustGenerate generates the config for the hosts in the database.
+func (m *Manager) mustGenerate(t *testing.T) *Config {
+	hosts, err := m.loadHosts()
+	require.NoError(t, err)
+	config, err := m.generate(hosts)
+	require.NoError(t, err)
+	return config
+}
@@ -0,0 +1,191 @@
+package caddy
+
+import (
+	"fmt"
+	"net/http"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/models"
+)
+
+var methodPattern = regexp.MustCompile(`^[A-Za-z]+$`)
+
+// locationRoutes builds the routes for a host's custom locations.
+// They must come before the host's main route since they are more specific.
+func locationRoutes(host models.ProxyHost, domains []string, hostFeatures routeFeatures) ([]*Route, error) {
+	routes := make([]*Route, 0, len(host.Locations))
+
+	for _, loc := range sortLocations(host.Locations) {
+		if err := validateLocation(loc); err != nil {
+			return nil, fmt.Errorf("proxy host %s location %s: %w", host.UUID, locationLabel(loc), err)
+		}
+
+		// Locations inherit the host's handlers unless they override them
+		features, err := locationFeatures(hostFeatures, loc)
+		if err != nil {
+			return nil, fmt.Errorf("proxy host %s location %s: %w", host.UUID, locationLabel(loc), err)
+		}
+		handlers, err := featureHandlers(host, features)
+		if err != nil {
+			return nil, fmt.Errorf("proxy host %s location %s: %w", host.UUID, locationLabel(loc), err)
+		}
+
+		// A bare /path would otherwise resolve relative links against the parent directory
+		if loc.TrailingSlashRedirect {
+			match := locationMatch(loc, domains)
+			match.Path = []string{loc.Path}
+			routes = append(routes, &Route{
+				Match: []Match{match},
+				Handle: []Handler{
+					RedirectHandler(loc.Path+"/{http.request.uri.prefixed_query}", http.StatusPermanentRedirect),
+				},
+				Terminal: true,
+			})
+		}
+
+		handlers = append(handlers, locationRewriteHandlers(loc)...)
+		handlers = append(handlers, proxyHandler(host, features, loc.ForwardScheme, loc.ForwardHost, loc.ForwardPort))
+
+		routes = append(routes, &Route{
+			Match:    []Match{locationMatch(loc, domains)},
+			Handle:   handlers,
+			Terminal: true,
+		})
+	}
+
+	return routes, nil
+}
+
+// locationMatch builds the matcher set for a location.
+func locationMatch(loc models.Location, domains []string) Match {
+	match := Match{
+		Host:   domains,
+		Header: loc.MatchHeaders,
+		Query:  loc.MatchQuery,
+	}
+
+	if loc.PathRegex != "" {
+		match.PathRegexp = &MatchRegexp{Pattern: loc.PathRegex}
+	} else {
+		match.Path = []string{loc.Path, loc.Path + "/*"}
+	}
+
+	for _, method := range strings.Split(loc.Methods, ",") {
+		if method = strings.ToUpper(strings.TrimSpace(method)); method != "" {
+			match.Method = append(match.Method, method)
+		}
+	}
+
+	return match
+}
+
+// sortLocations orders locations by priority, then by specificity:
+// more matcher conditions first, literal paths before regexes and
+// longer paths before shorter ones. Ties keep their stored order.
+func sortLocations(locations []models.Location) []models.Location {
+	sorted := make([]models.Location, len(locations))
+	copy(sorted, locations)
+
+	sort.SliceStable(sorted, func(i, j int) bool {
+		a, b := sorted[i], sorted[j]
+		if a.Priority != b.Priority {
+			return a.Priority > b.Priority
+		}
+		if ca, cb := locationConditions(a), locationConditions(b); ca != cb {
+			return ca > cb
+		}
+		if (a.PathRegex == "") != (b.PathRegex == "") {
+			return a.PathRegex == ""
+		}
+		return len(a.Path) > len(b.Path)
+	})
+
+	return sorted
+}
+
+// locationConditions counts the non-path matchers of a location.
+func locationConditions(loc models.Location) int {
+	n := len(loc.MatchHeaders) + len(loc.MatchQuery)
+	if strings.TrimSpace(loc.Methods) != "" {
+		n++
+	}
+	return n
+}
+
+// locationLabel identifies a location in error messages.
+func locationLabel(loc models.Location) string {
+	if loc.PathRegex != "" {
+		return loc.PathRegex
+	}
+	return loc.Path
+}
+
+// locationRewriteHandlers returns the URI rewrites applied before proxying.
+// Prefix handling runs first so RewriteRegex sees the upstream path.
+func locationRewriteHandlers(loc models.Location) []Handler {
+	handlers := make([]Handler, 0, 2)
+
+	replace := strings.TrimSuffix(loc.ReplacePrefix, "/")
+	switch {
+	case replace != "":
+		handlers = append(handlers, PathRegexpHandler("^"+regexp.QuoteMeta(loc.Path), replace))
+	case loc.StripPrefix || loc.ReplacePrefix != "":
+		handlers = append(handlers, StripPrefixHandler(loc.Path))
+	}
+
+	if loc.RewriteRegex != "" {
+		handlers = append(handlers, PathRegexpHandler(loc.RewriteRegex, loc.RewriteReplacement))
+	}
+
+	return handlers
+}
+
+// validateLocation rejects locations that cannot be rendered into a valid route.
+func validateLocation(loc models.Location) error {
+	if loc.PathRegex != "" {
+		if loc.Path != "" {
+			return fmt.Errorf("path and path regex are mutually exclusive")
+		}
+		if _, err := regexp.Compile(loc.PathRegex); err != nil {
+			return fmt.Errorf("invalid path regex: %w", err)
+		}
+		if loc.StripPrefix || loc.ReplacePrefix != "" || loc.TrailingSlashRedirect {
+			return fmt.Errorf("prefix rewrites and redirects require a path, use a rewrite regex instead")
+		}
+	} else if !strings.HasPrefix(loc.Path, "/") {
+		return fmt.Errorf("path must start with /")
+	}
+	if loc.Path == "/" && (loc.StripPrefix || loc.TrailingSlashRedirect) {
+		return fmt.Errorf("root path cannot strip its prefix or redirect")
+	}
+	if loc.ReplacePrefix != "" && !strings.HasPrefix(loc.ReplacePrefix, "/") {
+		return fmt.Errorf("replacement prefix must start with /")
+	}
+	if loc.RewriteRegex == "" && loc.RewriteReplacement != "" {
+		return fmt.Errorf("rewrite replacement requires a rewrite regex")
+	}
+	if loc.RewriteRegex != "" {
+		if _, err := regexp.Compile(loc.RewriteRegex); err != nil {
+			return fmt.Errorf("invalid rewrite regex: %w", err)
+		}
+	}
+	for _, method := range strings.Split(loc.Methods, ",") {
+		method = strings.TrimSpace(method)
+		if method != "" && !methodPattern.MatchString(method) {
+			return fmt.Errorf("invalid HTTP method %q", method)
+		}
+	}
+	for name := range loc.MatchHeaders {
+		if strings.TrimSpace(name) == "" {
+			return fmt.Errorf("header matcher name cannot be empty")
+		}
+	}
+	for name := range loc.MatchQuery {
+		if name == "" {
+			return fmt.Errorf("query matcher name cannot be empty")
+		}
+	}
+	return nil
+}
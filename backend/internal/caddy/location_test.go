@@ -0,0 +1,271 @@
+package caddy
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/models"
+)
+
+func locationHost(locations ...models.Location) []models.ProxyHost {
+	return []models.ProxyHost{
+		{
+			UUID:        "uuid-app",
+			DomainNames: "app.example.com",
+			ForwardHost: "app",
+			ForwardPort: 8080,
+			Enabled:     true,
+			Locations:   locations,
+		},
+	}
+}
+
+func TestGenerateConfig_LocationStripPrefix(t *testing.T) {
+	hosts := locationHost(models.Location{
+		Path:                  "/grafana",
+		ForwardHost:           "grafana",
+		ForwardPort:           3000,
+		StripPrefix:           true,
+		TrailingSlashRedirect: true,
+	})
+
+	config, err := GenerateConfig(hosts, "/tmp/caddy-data", ConfigOptions{})
+	require.NoError(t, err)
+	require.NoError(t, Validate(config))
+
+	routes := config.Apps.HTTP.Servers["cpm_server"].Routes
+	require.Len(t, routes, 3)
+
+	// Bare path redirects to the slash-terminated path, keeping the query
+	require.Equal(t, []string{"/grafana"}, routes[0].Match[0].Path)
+	require.Equal(t, "static_response", routes[0].Handle[0]["handler"])
+	require.Equal(t, 308, routes[0].Handle[0]["status_code"])
+	require.Equal(t, map[string][]string{
+		"Location": {"/grafana/{http.request.uri.prefixed_query}"},
+	}, routes[0].Handle[0]["headers"])
+
+	require.Equal(t, []string{"/grafana", "/grafana/*"}, routes[1].Match[0].Path)
+	require.Len(t, routes[1].Handle, 2)
+	require.Equal(t, StripPrefixHandler("/grafana"), routes[1].Handle[0])
+	require.Equal(t, "reverse_proxy", routes[1].Handle[1]["handler"])
+
+	// Main host route comes last
+	require.Empty(t, routes[2].Match[0].Path)
+}
+
+func TestGenerateConfig_LocationReplacePrefixAndRegex(t *testing.T) {
+	hosts := locationHost(models.Location{
+		Path:               "/old.api",
+		ForwardHost:        "api",
+		ForwardPort:        9000,
+		ReplacePrefix:      "/v2/",
+		RewriteRegex:       `^/v2/users/(\d+)$`,
+		RewriteReplacement: "/v2/user?id=$1",
+	})
+
+	config, err := GenerateConfig(hosts, "/tmp/caddy-data", ConfigOptions{})
+	require.NoError(t, err)
+	require.NoError(t, Validate(config))
+
+	handlers := config.Apps.HTTP.Servers["cpm_server"].Routes[0].Handle
+	require.Len(t, handlers, 3)
+	require.Equal(t, PathRegexpHandler(`^/old\.api`, "/v2"), handlers[0])
+	require.Equal(t, PathRegexpHandler(`^/v2/users/(\d+)$`, "/v2/user?id=$1"), handlers[1])
+	require.Equal(t, "reverse_proxy", handlers[2]["handler"])
+}
+
+func TestGenerateConfig_LocationReplaceWithRoot(t *testing.T) {
+	// Replacing with "/" is the same as stripping
+	hosts := locationHost(models.Location{Path: "/app", ForwardHost: "app", ForwardPort: 80, ReplacePrefix: "/"})
+
+	config, err := GenerateConfig(hosts, "/tmp/caddy-data", ConfigOptions{})
+	require.NoError(t, err)
+	require.Equal(t, StripPrefixHandler("/app"), config.Apps.HTTP.Servers["cpm_server"].Routes[0].Handle[0])
+}
+
+func TestGenerateConfig_LocationPassThrough(t *testing.T) {
+	hosts := locationHost(models.Location{Path: "/api", ForwardHost: "api", ForwardPort: 9000})
+
+	config, err := GenerateConfig(hosts, "/tmp/caddy-data", ConfigOptions{})
+	require.NoError(t, err)
+
+	routes := config.Apps.HTTP.Servers["cpm_server"].Routes
+	require.Len(t, routes, 2)
+	require.Len(t, routes[0].Handle, 1)
+	require.Equal(t, "reverse_proxy", routes[0].Handle[0]["handler"])
+}
+
+func TestGenerateConfig_InvalidLocation(t *testing.T) {
+	tests := []struct {
+		name string
+		loc  models.Location
+		want string
+	}{
+		{"relative path", models.Location{Path: "api"}, "path must start with /"},
+		{"strip root", models.Location{Path: "/", StripPrefix: true}, "root path cannot strip"},
+		{"relative replacement", models.Location{Path: "/api", ReplacePrefix: "v2"}, "replacement prefix must start with /"},
+		{"replacement without regex", models.Location{Path: "/api", RewriteReplacement: "/x"}, "requires a rewrite regex"},
+		{"bad regex", models.Location{Path: "/api", RewriteRegex: "("}, "invalid rewrite regex"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.loc.ForwardHost = "api"
+			tt.loc.ForwardPort = 9000
+			_, err := GenerateConfig(locationHost(tt.loc), "/tmp/caddy-data", ConfigOptions{})
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tt.want)
+		})
+	}
+}
+
+func TestValidate_RewriteRegex(t *testing.T) {
+	config := &Config{
+		Apps: Apps{
+			HTTP: &HTTPApp{
+				Servers: map[string]*Server{
+					"srv": {
+						Listen: []string{":80"},
+						Routes: []*Route{
+							{
+								Match:  []Match{{Host: []string{"test.com"}}},
+								Handle: []Handler{PathRegexpHandler("[", "/"), ReverseProxyHandler("app:8080", false)},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	err := Validate(config)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "invalid pattern")
+}
+
+func TestGenerateConfig_LocationMatchers(t *testing.T) {
+	hosts := locationHost(
+		models.Location{Path: "/api", ForwardHost: "api", ForwardPort: 9000},
+		models.Location{Path: "/api", ForwardHost: "api-write", ForwardPort: 9001, Methods: "post, put,DELETE"},
+		models.Location{
+			Path:         "/api",
+			ForwardHost:  "tenant",
+			ForwardPort:  9002,
+			MatchHeaders: map[string][]string{"X-Tenant": {"acme"}},
+			MatchQuery:   map[string][]string{"debug": {"1"}},
+		},
+		models.Location{PathRegex: `^/files/\d+$`, ForwardHost: "files", ForwardPort: 9003},
+		models.Location{Path: "/api/v2", ForwardHost: "api-v2", ForwardPort: 9004},
+	)
+
+	config, err := GenerateConfig(hosts, "/tmp/caddy-data", ConfigOptions{})
+	require.NoError(t, err)
+	require.NoError(t, Validate(config))
+
+	routes := config.Apps.HTTP.Servers["cpm_server"].Routes
+	require.Len(t, routes, 6)
+
+	// Most conditions first, then longer literal paths, regexes after literal paths
+	tenant := routes[0].Match[0]
+	require.Equal(t, map[string][]string{"X-Tenant": {"acme"}}, tenant.Header)
+	require.Equal(t, map[string][]string{"debug": {"1"}}, tenant.Query)
+	require.Equal(t, []string{"POST", "PUT", "DELETE"}, routes[1].Match[0].Method)
+	require.Equal(t, []string{"/api/v2", "/api/v2/*"}, routes[2].Match[0].Path)
+	require.Equal(t, []string{"/api", "/api/*"}, routes[3].Match[0].Path)
+	require.Empty(t, routes[3].Match[0].Method)
+	require.Equal(t, &MatchRegexp{Pattern: `^/files/\d+$`}, routes[4].Match[0].PathRegexp)
+	require.Empty(t, routes[4].Match[0].Path)
+}
+
+func TestGenerateConfig_LocationPriority(t *testing.T) {
+	hosts := locationHost(
+		models.Location{Path: "/api/v2", ForwardHost: "api-v2", ForwardPort: 9004},
+		models.Location{Path: "/api", ForwardHost: "api", ForwardPort: 9000, Priority: 10},
+	)
+
+	config, err := GenerateConfig(hosts, "/tmp/caddy-data", ConfigOptions{})
+	require.NoError(t, err)
+
+	// Priority wins over specificity, which leaves /api/v2 unreachable
+	routes := config.Apps.HTTP.Servers["cpm_server"].Routes
+	require.Equal(t, []string{"/api", "/api/*"}, routes[0].Match[0].Path)
+
+	err = Validate(config)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "route 1 (app.example.com /api/v2,/api/v2/*) is shadowed by route 0")
+}
+
+func TestGenerateConfig_InvalidLocationMatchers(t *testing.T) {
+	tests := []struct {
+		name string
+		loc  models.Location
+		want string
+	}{
+		{"path and regex", models.Location{Path: "/api", PathRegex: "^/api"}, "mutually exclusive"},
+		{"bad path regex", models.Location{PathRegex: "("}, "invalid path regex"},
+		{"strip with regex", models.Location{PathRegex: "^/api", StripPrefix: true}, "require a path"},
+		{"bad method", models.Location{Path: "/api", Methods: "GET,PO ST"}, "invalid HTTP method"},
+		{"empty header", models.Location{Path: "/api", MatchHeaders: map[string][]string{" ": {"x"}}}, "header matcher name"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			tt.loc.ForwardHost = "api"
+			tt.loc.ForwardPort = 9000
+			_, err := GenerateConfig(locationHost(tt.loc), "/tmp/caddy-data", ConfigOptions{})
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tt.want)
+		})
+	}
+}
+
+func TestValidate_ShadowedRoutes(t *testing.T) {
+	route := func(match Match) *Route {
+		match.Host = []string{"app.example.com"}
+		return &Route{Match: []Match{match}, Handle: []Handler{ReverseProxyHandler("app:80", false)}, Terminal: true}
+	}
+
+	tests := []struct {
+		name     string
+		earlier  Match
+		later    Match
+		shadowed bool
+	}{
+		{"prefix covers longer prefix", Match{Path: []string{"/api/*"}}, Match{Path: []string{"/api/v2/*"}}, true},
+		{"longer prefix first", Match{Path: []string{"/api/v2/*"}}, Match{Path: []string{"/api/*"}}, false},
+		{"any method covers GET", Match{Path: []string{"/api"}}, Match{Path: []string{"/api"}, Method: []string{"GET"}}, true},
+		{"GET does not cover any method", Match{Path: []string{"/api"}, Method: []string{"GET"}}, Match{Path: []string{"/api"}}, false},
+		{"GET does not cover POST", Match{Path: []string{"/api"}, Method: []string{"GET"}}, Match{Path: []string{"/api"}, Method: []string{"POST"}}, false},
+		{"header narrows", Match{Path: []string{"/api"}, Header: map[string][]string{"X-Tenant": {"a"}}}, Match{Path: []string{"/api"}}, false},
+		{"header values cover", Match{Path: []string{"/x"}, Header: map[string][]string{"X-Tenant": {"a", "b"}}}, Match{Path: []string{"/x"}, Header: map[string][]string{"X-Tenant": {"a"}}}, true},
+		{"query narrows", Match{Path: []string{"/x"}, Query: map[string][]string{"v": {"1"}}}, Match{Path: []string{"/x"}, Query: map[string][]string{"v": {"2"}}}, false},
+		{"same regex", Match{PathRegexp: &MatchRegexp{Pattern: "^/a"}}, Match{PathRegexp: &MatchRegexp{Pattern: "^/a"}, Method: []string{"GET"}}, true},
+		{"regex vs path", Match{PathRegexp: &MatchRegexp{Pattern: "^/a"}}, Match{Path: []string{"/a"}}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := &Config{
+				Apps: Apps{
+					HTTP: &HTTPApp{
+						Servers: map[string]*Server{
+							"srv": {
+								Listen: []string{":80"},
+								Routes: []*Route{route(tt.earlier), route(tt.later)},
+							},
+						},
+					},
+				},
+			}
+
+			err := Validate(config)
+			if tt.shadowed {
+				require.Error(t, err)
+				require.Contains(t, err.Error(), "is shadowed by route 0")
+			} else {
+				require.NoError(t, err)
+			}
+		})
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"os"
 	"path/filepath"
 	"sort"
+	"sync"
 	"time"
 
 	"gorm.io/gorm"
@@ -17,9 +18,14 @@ import (
 
 // Manager orchestrates Caddy configuration lifecycle: generate, validate, apply, rollback.
 type Manager struct {
-	client    *Client
-	db        *gorm.DB
-	configDir string
+	client        *Client
+	db            *gorm.DB
+	configDir     string
+	staticBaseDir string
+	publicURL     string
+	binary        *Binary
+
+	applyMu sync.Mutex // Serializes applies, including their snapshots and /load calls
 }
 
 // NewManager creates a configuration manager.
@@ -31,31 +37,77 @@ func NewManager(client *Client, db *gorm.DB, configDir string) *Manager {
 	}
 }
 
+// SetStaticBaseDir restricts static host roots to dir.
+func (m *Manager) SetStaticBaseDir(dir string) {
+	m.staticBaseDir = dir
+}
+
+// SetPublicURL sets where Caddy reaches CPM+, the default on-demand TLS ask
+// endpoint is derived from it.
+func (m *Manager) SetPublicURL(url string) {
+	m.publicURL = url
+}
+
+// SetBinary validates configs with the local caddy binary before they are
+// applied, when it is installed.
+func (m *Manager) SetBinary(b *Binary) {
+	m.binary = b
+}
+
+// Binary returns the local caddy binary, nil when none is set.
+func (m *Manager) Binary() *Binary {
+	return m.binary
+}
+
+// StaticBaseDir returns the directory static host roots must be inside.
+func (m *Manager) StaticBaseDir() string {
+	if m.staticBaseDir == "" {
+		return DefaultStaticBaseDir
+	}
+	return m.staticBaseDir
+}
+
 // ApplyConfig generates configuration from database, validates it, applies to Caddy with rollback on failure.
+// Who triggered the apply and why are taken from ctx, see WithApplyInfo.
 func (m *Manager) ApplyConfig(ctx context.Context) error {
-	// Fetch all proxy hosts from database
-	var hosts []models.ProxyHost
-	if err := m.db.Find(&hosts).Error; err != nil {
-		return fmt.Errorf("fetch proxy hosts: %w", err)
-	}
+	m.applyMu.Lock()
+	defer m.applyMu.Unlock()
+	return m.applyConfig(ctx)
+}
 
-	// Fetch ACME email setting
-	var acmeEmailSetting models.Setting
-	var acmeEmail string
-	if err := m.db.Where("key = ?", "caddy.acme_email").First(&acmeEmailSetting).Error; err == nil {
-		acmeEmail = acmeEmailSetting.Value
+// applyConfig is ApplyConfig for callers holding applyMu.
+func (m *Manager) applyConfig(ctx context.Context) error {
+	info := applyInfoFrom(ctx)
+
+	// Fetch all proxy hosts from database
+	hosts, err := m.loadHosts()
+	if err != nil {
+		return err
 	}
 
 	// Generate Caddy config
-	config, err := GenerateConfig(hosts, filepath.Join(m.configDir, "data"), acmeEmail)
+	config, err := m.generate(hosts)
 	if err != nil {
-		return fmt.Errorf("generate config: %w", err)
+		return &ApplyError{Stage: ApplyStageGenerate, HostUUID: generateErrorHost(err), Err: fmt.Errorf("generate config: %w", err)}
 	}
 
 	// Validate before applying
 	if err := Validate(config); err != nil {
-		return fmt.Errorf("validation failed: %w", err)
+		return &ApplyError{Stage: ApplyStageValidate, HostUUID: validateErrorHost(err, config, hosts), Err: fmt.Errorf("validation failed: %w", err)}
 	}
+	if err := m.validateWithBinary(config, hosts); err != nil {
+		return err
+	}
+
+	// Capture the rows the config was generated from, for rollback to this version
+	state, err := m.captureState()
+	if err != nil {
+		return err
+	}
+
+	// An unreadable previous snapshot only means every host counts as changed
+	previous, _ := m.latestSnapshot()
+	hostsChanged := changedHosts(previous, config)
 
 	// Save snapshot for rollback
 	snapshotPath, err := m.saveSnapshot(config)
@@ -65,40 +117,171 @@ func (m *Manager) ApplyConfig(ctx context.Context) error {
 
 	// Calculate config hash for audit trail
 	configJSON, _ := json.Marshal(config)
-	configHash := fmt.Sprintf("%x", sha256.Sum256(configJSON))
+	record := models.CaddyConfig{
+		ConfigHash:   fmt.Sprintf("%x", sha256.Sum256(configJSON)),
+		AppliedBy:    info.UserID,
+		Reason:       info.Reason,
+		HostsChanged: hostsChanged,
+	}
 
-	// Apply to Caddy
-	if err := m.client.Load(ctx, config); err != nil {
+	// Apply to Caddy, by targeted updates when possible
+	if err := m.load(ctx, previous, config); err != nil {
 		// Remove the failed snapshot so rollback uses the previous one
 		os.Remove(snapshotPath)
+		record.ErrorMsg = err.Error()
+
+		// Caddy reports routes it fails to provision as "caddy validate" does
+		hostUUID := provisionErrorHost(err, config, hosts)
 
 		// Rollback on failure
 		if rollbackErr := m.rollback(ctx); rollbackErr != nil {
 			// If rollback fails, we still want to record the failure
-			m.recordConfigChange(configHash, false, err.Error())
-			return fmt.Errorf("apply failed: %w, rollback also failed: %v", err, rollbackErr)
+			m.recordConfigChange(record)
+			return &ApplyError{Stage: ApplyStageLoad, HostUUID: hostUUID, Err: fmt.Errorf("apply failed: %w, rollback also failed: %v", err, rollbackErr)}
 		}
 
 		// Record failed attempt
-		m.recordConfigChange(configHash, false, err.Error())
-		return fmt.Errorf("apply failed (rolled back): %w", err)
+		m.recordConfigChange(record)
+		return &ApplyError{Stage: ApplyStageLoad, HostUUID: hostUUID, Err: fmt.Errorf("apply failed (rolled back): %w", err)}
 	}
 
 	// Record successful application
-	m.recordConfigChange(configHash, true, "")
+	record.Success = true
+	record.Snapshot = filepath.Base(snapshotPath)
+	record.State = state
+	m.recordConfigChange(record)
 
-	// Cleanup old snapshots (keep last 10)
-	if err := m.rotateSnapshots(10); err != nil {
+	// Cleanup old snapshots
+	if err := m.rotateSnapshots(m.historyRetention()); err != nil {
 		// Non-fatal - log but don't fail
 		fmt.Printf("warning: snapshot rotation failed: %v\n", err)
 	}
 
+	// Nodes track their own outcome, a failing node doesn't fail the apply
+	if err := m.applyNodes(ctx); err != nil {
+		fmt.Printf("warning: caddy node apply failed: %v\n", err)
+	}
+
 	return nil
 }
 
+// loadHosts fetches the proxy hosts served by the local Caddy with the
+// associations GenerateConfig needs.
+func (m *Manager) loadHosts() ([]models.ProxyHost, error) {
+	all, err := m.loadAllHosts()
+	if err != nil {
+		return nil, err
+	}
+	hosts := make([]models.ProxyHost, 0, len(all))
+	for _, host := range all {
+		if host.OnLocal() {
+			hosts = append(hosts, host)
+		}
+	}
+	return hosts, nil
+}
+
+// loadAllHosts fetches all proxy hosts with the associations GenerateConfig needs.
+func (m *Manager) loadAllHosts() ([]models.ProxyHost, error) {
+	var hosts []models.ProxyHost
+	if err := m.db.Preload("AccessList").Preload("Locations.AccessList").Preload("UpstreamGroups").Find(&hosts).Error; err != nil {
+		return nil, fmt.Errorf("fetch proxy hosts: %w", err)
+	}
+	return hosts, nil
+}
+
+// generate builds the config for hosts with the current settings.
+func (m *Manager) generate(hosts []models.ProxyHost) (*Config, error) {
+	opts := m.loadConfigOptions()
+	rawRoutes, err := m.loadRawRoutes()
+	if err != nil {
+		return nil, err
+	}
+	opts.RawRoutes = rawRoutes
+	return GenerateConfig(hosts, filepath.Join(m.configDir, "data"), opts)
+}
+
+// ExportCaddyfile renders the hosts served by the local Caddy as a Caddyfile.
+func (m *Manager) ExportCaddyfile(generated time.Time) (string, error) {
+	hosts, err := m.loadHosts()
+	if err != nil {
+		return "", err
+	}
+	opts := m.loadConfigOptions()
+	if opts.RawRoutes, err = m.loadRawRoutes(); err != nil {
+		return "", err
+	}
+	return ExportCaddyfile(hosts, opts, generated)
+}
+
+// loadRawRoutes fetches the routes adopted verbatim, in the order they were adopted.
+func (m *Manager) loadRawRoutes() ([]models.RawRoute, error) {
+	// Databases from before route adoption have no table yet
+	if !m.db.Migrator().HasTable(&models.RawRoute{}) {
+		return nil, nil
+	}
+	var routes []models.RawRoute
+	if err := m.db.Order("id").Find(&routes).Error; err != nil {
+		return nil, fmt.Errorf("fetch raw routes: %w", err)
+	}
+	return routes, nil
+}
+
+// loadConfigOptions reads the global settings that feed GenerateConfig.
+func (m *Manager) loadConfigOptions() ConfigOptions {
+	settings := m.loadSettings()
+
+	// Keep configSettings in sync with the settings read here
+	askURL := settings["caddy.on_demand_ask_url"]
+	if askURL == "" && m.publicURL != "" {
+		askURL = OnDemandAskURL(m.publicURL)
+	}
+
+	return ConfigOptions{
+		ACME: ACMEOptions{
+			Email:     settings["caddy.acme_email"],
+			Staging:   settings["caddy.acme_staging"] == "true",
+			Directory: settings["caddy.acme_directory"],
+			CARoot:    settings["caddy.acme_ca_root"],
+			EABKeyID:  settings["caddy.acme_eab_key_id"],
+			EABMACKey: settings["caddy.acme_eab_hmac_key"],
+		},
+		OnDemand: OnDemandOptions{
+			AskURL: askURL,
+		},
+		Server: ServerOptions{
+			ReadTimeout:       settings["caddy.server_read_timeout"],
+			ReadHeaderTimeout: settings["caddy.server_read_header_timeout"],
+			WriteTimeout:      settings["caddy.server_write_timeout"],
+			IdleTimeout:       settings["caddy.server_idle_timeout"],
+		},
+		StaticBaseDir: m.StaticBaseDir(),
+		GeoIPDatabase: settings["caddy.geoip_database"],
+		CrowdSec: CrowdSecOptions{
+			APIURL: settings["crowdsec.api_url"],
+			APIKey: settings["crowdsec.bouncer_key"],
+		},
+	}
+}
+
+// loadSettings returns all settings as a key/value map.
+func (m *Manager) loadSettings() map[string]string {
+	values := make(map[string]string)
+
+	var settings []models.Setting
+	if err := m.db.Find(&settings).Error; err != nil {
+		return values
+	}
+	for _, s := range settings {
+		values[s.Key] = s.Value
+	}
+
+	return values
+}
+
 // saveSnapshot stores the config to disk with timestamp.
 func (m *Manager) saveSnapshot(config *Config) (string, error) {
-	timestamp := time.Now().Unix()
+	timestamp := time.Now().UnixNano()
 	filename := fmt.Sprintf("config-%d.json", timestamp)
 	path := filepath.Join(m.configDir, filename)
 
@@ -166,7 +349,9 @@ func (m *Manager) listSnapshots() ([]string, error) {
 	return snapshots, nil
 }
 
-// rotateSnapshots keeps only the N most recent snapshots.
+// rotateSnapshots keeps only the N most recent snapshots. History entries
+// of deleted snapshots stay in the audit trail but can no longer be shown
+// or rolled back to.
 func (m *Manager) rotateSnapshots(keep int) error {
 	snapshots, err := m.listSnapshots()
 	if err != nil {
@@ -183,19 +368,16 @@ func (m *Manager) rotateSnapshots(keep int) error {
 		if err := os.Remove(path); err != nil {
 			return fmt.Errorf("delete snapshot %s: %w", path, err)
 		}
+		m.db.Model(&models.CaddyConfig{}).Where("snapshot = ?", filepath.Base(path)).
+			Updates(map[string]interface{}{"snapshot": "", "state": ""})
 	}
 
 	return nil
 }
 
 // recordConfigChange stores an audit record in the database.
-func (m *Manager) recordConfigChange(configHash string, success bool, errorMsg string) {
-	record := models.CaddyConfig{
-		ConfigHash: configHash,
-		AppliedAt:  time.Now(),
-		Success:    success,
-		ErrorMsg:   errorMsg,
-	}
+func (m *Manager) recordConfigChange(record models.CaddyConfig) {
+	record.AppliedAt = time.Now()
 
 	// Best effort - don't fail if audit logging fails
 	m.db.Create(&record)
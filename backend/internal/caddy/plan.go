@@ -0,0 +1,137 @@
+package caddy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/models"
+)
+
+// Plan is the outcome of a dry run: the config that would be applied and
+// how it differs from what is applied now. Nothing is saved or loaded.
+type Plan struct {
+	Valid  bool    `json:"valid"`
+	Error  string  `json:"error,omitempty"` // Generation or validation error
+	Config *Config `json:"config,omitempty"`
+	// SnapshotDiff compares against the last applied snapshot, nil when there is none.
+	SnapshotDiff *ConfigDiff `json:"snapshot_diff,omitempty"`
+	// LiveDiff compares against Caddy's running config, nil when Caddy is unreachable.
+	LiveDiff  *ConfigDiff `json:"live_diff,omitempty"`
+	LiveError string      `json:"live_error,omitempty"`
+}
+
+// Plan generates and validates the config for the current database, with
+// proposed replacing the host with the same UUID or added as a new host
+// when non-nil, and diffs it against the last snapshot and the live config.
+func (m *Manager) Plan(ctx context.Context, proposed *models.ProxyHost) (*Plan, error) {
+	hosts, err := m.loadHosts()
+	if err != nil {
+		return nil, err
+	}
+
+	if proposed != nil {
+		if err := m.loadProposedAssociations(proposed); err != nil {
+			return nil, err
+		}
+		replaced := false
+		for i := range hosts {
+			if proposed.UUID != "" && hosts[i].UUID == proposed.UUID {
+				hosts[i] = *proposed
+				replaced = true
+				break
+			}
+		}
+		if !replaced {
+			hosts = append(hosts, *proposed)
+		}
+	}
+
+	plan := &Plan{}
+
+	config, err := m.generate(hosts)
+	if err != nil {
+		plan.Error = err.Error()
+		return plan, nil
+	}
+	plan.Config = config
+
+	if err := Validate(config); err != nil {
+		plan.Error = "validation failed: " + err.Error()
+	} else {
+		plan.Valid = true
+	}
+
+	snapshot, err := m.latestSnapshot()
+	if err != nil {
+		return nil, err
+	}
+	if snapshot != nil {
+		if plan.SnapshotDiff, err = DiffConfigs(snapshot, config); err != nil {
+			return nil, err
+		}
+	}
+
+	if m.client == nil {
+		plan.LiveError = "caddy client not configured"
+		return plan, nil
+	}
+	live, err := m.client.GetConfig(ctx)
+	if err != nil {
+		plan.LiveError = err.Error()
+		return plan, nil
+	}
+	if plan.LiveDiff, err = DiffConfigs(live, config); err != nil {
+		return nil, err
+	}
+
+	return plan, nil
+}
+
+// loadProposedAssociations loads the access lists a proposed host refers to
+// by ID, since API payloads only carry the IDs.
+func (m *Manager) loadProposedAssociations(host *models.ProxyHost) error {
+	load := func(id *uint) (*models.AccessList, error) {
+		var list models.AccessList
+		if err := m.db.First(&list, *id).Error; err != nil {
+			return nil, fmt.Errorf("access list %d not found", *id)
+		}
+		return &list, nil
+	}
+
+	var err error
+	if host.AccessListID != nil && host.AccessList == nil {
+		if host.AccessList, err = load(host.AccessListID); err != nil {
+			return err
+		}
+	}
+	for i := range host.Locations {
+		loc := &host.Locations[i]
+		if loc.AccessListID != nil && loc.AccessList == nil {
+			if loc.AccessList, err = load(loc.AccessListID); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// latestSnapshot reads the most recently applied config, nil if there is none.
+func (m *Manager) latestSnapshot() (*Config, error) {
+	snapshots, err := m.listSnapshots()
+	if err != nil || len(snapshots) == 0 {
+		return nil, nil
+	}
+
+	configJSON, err := os.ReadFile(snapshots[len(snapshots)-1])
+	if err != nil {
+		return nil, fmt.Errorf("read snapshot: %w", err)
+	}
+
+	var config Config
+	if err := json.Unmarshal(configJSON, &config); err != nil {
+		return nil, fmt.Errorf("unmarshal snapshot: %w", err)
+	}
+	return &config, nil
+}
@@ -0,0 +1,98 @@
+package caddy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/models"
+)
+
+func TestManager_Plan(t *testing.T) {
+	var live *Config
+	loads := 0
+	caddyServer := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.URL.Path == "/load" && r.Method == http.MethodPost:
+			loads++
+			var config Config
+			json.NewDecoder(r.Body).Decode(&config)
+			live = &config
+		case r.URL.Path == "/config/" && r.Method == http.MethodGet:
+			json.NewEncoder(w).Encode(live)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+	defer caddyServer.Close()
+
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.ProxyHost{}, &models.Location{}, &models.UpstreamGroup{}, &models.AccessList{}, &models.Setting{}, &models.CaddyConfig{}))
+
+	manager := NewManager(NewClient(caddyServer.URL), db, t.TempDir())
+
+	require.NoError(t, db.Create(&models.ProxyHost{UUID: "uuid-app", DomainNames: "app.example.com", ForwardHost: "app", ForwardPort: 80}).Error)
+	require.NoError(t, manager.ApplyConfig(context.Background()))
+	require.Equal(t, 1, loads)
+
+	// Nothing changed since the last apply
+	plan, err := manager.Plan(context.Background(), nil)
+	require.NoError(t, err)
+	require.True(t, plan.Valid)
+	require.NotNil(t, plan.Config)
+	require.False(t, plan.SnapshotDiff.Changed)
+	require.False(t, plan.LiveDiff.Changed)
+
+	// Someone changed Caddy behind our back
+	live.Apps.HTTP.Servers["cpm_server"].Routes[0].Handle[1]["upstreams"] = []interface{}{map[string]interface{}{"dial": "other:80"}}
+
+	list := models.AccessList{UUID: "acl", Name: "office", Type: AccessListAllow, Enabled: true, Rules: `[{"address": "10.0.0.0/8"}]`}
+	require.NoError(t, db.Create(&list).Error)
+
+	proposed := &models.ProxyHost{UUID: "uuid-app", DomainNames: "app.example.com", ForwardHost: "app", ForwardPort: 8080, Enabled: true, BlockExploits: true}
+	plan, err = manager.Plan(context.Background(), proposed)
+	require.NoError(t, err)
+	require.True(t, plan.Valid)
+	require.True(t, plan.SnapshotDiff.Changed)
+	require.Len(t, plan.SnapshotDiff.Hosts, 1)
+	require.Equal(t, "app.example.com", plan.SnapshotDiff.Hosts[0].Host)
+	require.Equal(t, "changed", plan.SnapshotDiff.Hosts[0].Status)
+	require.Len(t, plan.LiveDiff.Hosts, 1)
+	require.Equal(t, []Change{{Path: "/0/handle/1/upstreams/0/dial", Op: ChangeReplace, Before: "other:80", After: "app:8080"}}, plan.LiveDiff.Hosts[0].Changes)
+
+	// Access lists referenced by ID are loaded
+	proposed.AccessListID = &list.ID
+	plan, err = manager.Plan(context.Background(), proposed)
+	require.NoError(t, err)
+	require.True(t, plan.Valid)
+	require.Equal(t, "subroute", plan.Config.Apps.HTTP.Servers["cpm_server"].Routes[0].Handle[1]["handler"])
+
+	// A new host is added alongside the existing ones
+	plan, err = manager.Plan(context.Background(), &models.ProxyHost{DomainNames: "new.example.com", ForwardHost: "new", ForwardPort: 80, Enabled: true})
+	require.NoError(t, err)
+	require.Len(t, plan.SnapshotDiff.Hosts, 1)
+	require.Equal(t, "new.example.com", plan.SnapshotDiff.Hosts[0].Host)
+	require.Equal(t, "added", plan.SnapshotDiff.Hosts[0].Status)
+
+	// Errors are reported in the plan
+	plan, err = manager.Plan(context.Background(), &models.ProxyHost{DomainNames: "bad.example.com", ForwardHost: "bad", ForwardPort: 80, Enabled: true, WAFMode: "strict"})
+	require.NoError(t, err)
+	require.False(t, plan.Valid)
+	require.Contains(t, plan.Error, "invalid WAF mode")
+	require.Nil(t, plan.Config)
+
+	_, err = manager.Plan(context.Background(), &models.ProxyHost{DomainNames: "acl.example.com", Enabled: true, AccessListID: new(uint)})
+	require.Error(t, err)
+
+	// Planning never loads anything
+	require.Equal(t, 1, loads)
+}
@@ -0,0 +1,304 @@
+package caddy
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// Apply job states.
+const (
+	JobQueued   = "queued"
+	JobApplying = "applying"
+	JobApplied  = "applied"
+	JobFailed   = "failed"
+)
+
+// ErrJobNotFound is returned for unknown or expired jobs.
+var ErrJobNotFound = errors.New("apply job not found")
+
+// finishedJobTTL is how long finished jobs stay available for status queries.
+const finishedJobTTL = time.Hour
+
+// ApplyJob is a queued request to apply the config.
+type ApplyJob struct {
+	ID         string     `json:"id"`
+	Status     string     `json:"status"`
+	Reason     string     `json:"reason,omitempty"`
+	Error      string     `json:"error,omitempty"`
+	Coalesced  int        `json:"coalesced,omitempty"` // Jobs applied together with this one, itself included
+	QueuedAt   time.Time  `json:"queued_at"`
+	FinishedAt *time.Time `json:"finished_at,omitempty"`
+	// Reverted is set when the job's change was undone after its apply failed.
+	Reverted    bool   `json:"reverted,omitempty"`
+	RevertError string `json:"revert_error,omitempty"`
+
+	userID uint
+	change HostChange
+	err    error
+	done   chan struct{}
+}
+
+// HostChange is a database change to one proxy host that a job applies.
+// Revert undoes it when the apply fails because of it.
+type HostChange struct {
+	HostUUID string
+	Revert   func() error
+}
+
+// ApplyQueue funnels config applies through a single worker. Jobs queued
+// within the debounce window of the first one are applied together, so a
+// bulk change reloads Caddy once.
+type ApplyQueue struct {
+	manager *Manager
+	window  time.Duration
+
+	mu      sync.Mutex
+	jobs    map[string]*ApplyJob
+	pending []*ApplyJob
+	wake    chan struct{}
+}
+
+// NewApplyQueue creates a queue applying through manager, coalescing jobs
+// queued within window.
+func NewApplyQueue(manager *Manager, window time.Duration) *ApplyQueue {
+	return &ApplyQueue{
+		manager: manager,
+		window:  window,
+		jobs:    make(map[string]*ApplyJob),
+		wake:    make(chan struct{}, 1),
+	}
+}
+
+// Enqueue queues an apply and returns its job.
+func (q *ApplyQueue) Enqueue(info ApplyInfo) ApplyJob {
+	return q.EnqueueChange(info, HostChange{})
+}
+
+// EnqueueChange queues the apply of a change to a proxy host and returns its
+// job. The change is reverted by the worker when the job ran alone and
+// failed, or when the apply failed because of the changed host.
+func (q *ApplyQueue) EnqueueChange(info ApplyInfo, change HostChange) ApplyJob {
+	job := &ApplyJob{
+		ID:       uuid.NewString(),
+		Status:   JobQueued,
+		Reason:   info.Reason,
+		QueuedAt: time.Now(),
+		userID:   info.UserID,
+		change:   change,
+		done:     make(chan struct{}),
+	}
+
+	q.mu.Lock()
+	q.pruneJobs()
+	q.jobs[job.ID] = job
+	q.pending = append(q.pending, job)
+	snapshot := *job
+	q.mu.Unlock()
+
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+	return snapshot
+}
+
+// Apply queues an apply and waits for its outcome.
+func (q *ApplyQueue) Apply(ctx context.Context, info ApplyInfo) error {
+	job := q.Enqueue(info)
+	return q.Wait(ctx, job.ID)
+}
+
+// Wait blocks until the job is applied or failed, or ctx is done.
+func (q *ApplyQueue) Wait(ctx context.Context, id string) error {
+	q.mu.Lock()
+	job, ok := q.jobs[id]
+	q.mu.Unlock()
+	if !ok {
+		return ErrJobNotFound
+	}
+
+	select {
+	case <-job.done:
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	return job.err
+}
+
+// Job returns the current state of a job.
+func (q *ApplyQueue) Job(id string) (ApplyJob, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	job, ok := q.jobs[id]
+	if !ok {
+		return ApplyJob{}, ErrJobNotFound
+	}
+	return *job, nil
+}
+
+// Run applies queued jobs until ctx is done.
+func (q *ApplyQueue) Run(ctx context.Context) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-q.wake:
+		}
+
+		// Let the rest of a bulk change arrive
+		timer := time.NewTimer(q.window)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+
+		q.applyPending(ctx)
+	}
+}
+
+// applyPending applies all queued jobs.
+func (q *ApplyQueue) applyPending(ctx context.Context) {
+	q.mu.Lock()
+	jobs := q.pending
+	q.pending = nil
+	for _, job := range jobs {
+		job.Status = JobApplying
+		job.Coalesced = len(jobs)
+	}
+	q.mu.Unlock()
+	if len(jobs) == 0 {
+		return
+	}
+	q.apply(ctx, jobs)
+}
+
+// apply applies jobs with a single ApplyConfig call. When it fails because
+// of some of the changes, those are reverted and the rest are applied again
+// without them.
+func (q *ApplyQueue) apply(ctx context.Context, jobs []*ApplyJob) {
+	err := q.manager.ApplyConfig(WithApplyInfo(ctx, mergeApplyInfo(jobs)))
+	for err != nil {
+		faulty, rest := faultyJobs(jobs, err)
+		if len(faulty) == 0 {
+			break
+		}
+		q.revert(faulty)
+		q.finish(faulty, err)
+		if jobs = rest; len(jobs) == 0 {
+			return
+		}
+		err = q.manager.ApplyConfig(WithApplyInfo(ctx, mergeApplyInfo(jobs)))
+	}
+	q.finish(jobs, err)
+}
+
+// faultyJobs splits jobs into those whose change caused err and can be
+// reverted, and the rest. A job that ran alone is at fault for any error.
+func faultyJobs(jobs []*ApplyJob, err error) (faulty, rest []*ApplyJob) {
+	hostUUID := ""
+	var applyErr *ApplyError
+	if errors.As(err, &applyErr) {
+		hostUUID = applyErr.HostUUID
+	}
+
+	for _, job := range jobs {
+		revertible := job.change.Revert != nil
+		if revertible && (len(jobs) == 1 || (hostUUID != "" && job.change.HostUUID == hostUUID)) {
+			faulty = append(faulty, job)
+		} else {
+			rest = append(rest, job)
+		}
+	}
+	return faulty, rest
+}
+
+// revert undoes the changes of jobs, newest first, so that each host ends up
+// as it was before the oldest of them. A change to a host that a queued job
+// changes again is left to that job: its revert takes over, so a failure
+// there goes back to the state before both.
+func (q *ApplyQueue) revert(jobs []*ApplyJob) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	for i := len(jobs) - 1; i >= 0; i-- {
+		job := jobs[i]
+		if later := q.pendingChange(job.change.HostUUID); later != nil {
+			later.change.Revert = job.change.Revert
+			continue
+		}
+		if err := job.change.Revert(); err != nil {
+			job.RevertError = err.Error()
+			continue
+		}
+		job.Reverted = true
+	}
+}
+
+// pendingChange returns the first queued job changing the host, nil if none.
+func (q *ApplyQueue) pendingChange(hostUUID string) *ApplyJob {
+	if hostUUID == "" {
+		return nil
+	}
+	for _, job := range q.pending {
+		if job.change.HostUUID == hostUUID && job.change.Revert != nil {
+			return job
+		}
+	}
+	return nil
+}
+
+// finish records the outcome of jobs and wakes their waiters.
+func (q *ApplyQueue) finish(jobs []*ApplyJob, err error) {
+	now := time.Now()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, job := range jobs {
+		job.Status = JobApplied
+		if err != nil {
+			job.Status = JobFailed
+			job.Error = err.Error()
+			job.err = err
+		}
+		job.FinishedAt = &now
+		close(job.done)
+	}
+}
+
+// mergeApplyInfo combines the reasons of coalesced jobs, keeping the user
+// when they were all queued by the same one.
+func mergeApplyInfo(jobs []*ApplyJob) ApplyInfo {
+	info := ApplyInfo{UserID: jobs[0].userID}
+	reasons := make([]string, 0, len(jobs))
+	seen := make(map[string]bool)
+	for _, job := range jobs {
+		if job.userID != info.UserID {
+			info.UserID = 0
+		}
+		if job.Reason != "" && !seen[job.Reason] {
+			seen[job.Reason] = true
+			reasons = append(reasons, job.Reason)
+		}
+	}
+	info.Reason = strings.Join(reasons, "; ")
+	return info
+}
+
+// pruneJobs forgets jobs that finished more than finishedJobTTL ago.
+func (q *ApplyQueue) pruneJobs() {
+	cutoff := time.Now().Add(-finishedJobTTL)
+	for id, job := range q.jobs {
+		if job.FinishedAt != nil && job.FinishedAt.Before(cutoff) {
+			delete(q.jobs, id)
+		}
+	}
+}
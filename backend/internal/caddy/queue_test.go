@@ -0,0 +1,253 @@
+package caddy
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/models"
+)
+
+func TestApplyQueue_Coalesces(t *testing.T) {
+	admin := &fakeAdmin{}
+	manager, db := setupHistoryTest(t, admin.ServeHTTP)
+	require.NoError(t, db.Create(&models.ProxyHost{UUID: "uuid-app", DomainNames: "app.example.com", ForwardHost: "app", ForwardPort: 80}).Error)
+
+	queue := NewApplyQueue(manager, 50*time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go queue.Run(ctx)
+
+	jobs := []ApplyJob{
+		queue.Enqueue(ApplyInfo{UserID: 1, Reason: "create proxy host a"}),
+		queue.Enqueue(ApplyInfo{UserID: 1, Reason: "create proxy host b"}),
+		queue.Enqueue(ApplyInfo{UserID: 1, Reason: "create proxy host b"}),
+	}
+	assert.Equal(t, JobQueued, jobs[0].Status)
+
+	for _, job := range jobs {
+		require.NoError(t, queue.Wait(context.Background(), job.ID))
+	}
+	assert.Equal(t, 1, admin.loads)
+
+	job, err := queue.Job(jobs[1].ID)
+	require.NoError(t, err)
+	assert.Equal(t, JobApplied, job.Status)
+	assert.Equal(t, 3, job.Coalesced)
+	assert.NotNil(t, job.FinishedAt)
+
+	history, err := manager.History()
+	require.NoError(t, err)
+	require.Len(t, history, 1)
+	assert.Equal(t, "create proxy host a; create proxy host b", history[0].Reason)
+	assert.Equal(t, uint(1), history[0].AppliedBy)
+
+	// A later change is a separate apply
+	require.NoError(t, queue.Apply(context.Background(), ApplyInfo{UserID: 2, Reason: "delete proxy host a"}))
+	history, err = manager.History()
+	require.NoError(t, err)
+	assert.Len(t, history, 2)
+	assert.Equal(t, 1, admin.loads) // Caddy already runs the unchanged config
+
+	_, err = queue.Job("unknown")
+	assert.ErrorIs(t, err, ErrJobNotFound)
+}
+
+func TestApplyQueue_Failure(t *testing.T) {
+	admin := &fakeAdmin{down: true}
+	manager, _ := setupHistoryTest(t, admin.ServeHTTP)
+
+	queue := NewApplyQueue(manager, time.Millisecond)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go queue.Run(ctx)
+
+	job := queue.Enqueue(ApplyInfo{Reason: "update proxy host a"})
+	err := queue.Wait(context.Background(), job.ID)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "apply failed")
+
+	job, err = queue.Job(job.ID)
+	require.NoError(t, err)
+	assert.Equal(t, JobFailed, job.Status)
+	assert.Contains(t, job.Error, "apply failed")
+}
+
+func TestApplyQueue_WaitCanceled(t *testing.T) {
+	manager, _ := setupHistoryTest(t, func(w http.ResponseWriter, r *http.Request) {})
+	queue := NewApplyQueue(manager, time.Millisecond) // Not running
+
+	job := queue.Enqueue(ApplyInfo{})
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, queue.Wait(ctx, job.ID), context.DeadlineExceeded)
+}
+
+func TestManager_ApplyConfigSerialized(t *testing.T) {
+	var inFlight, overlaps int32
+	manager, _ := setupHistoryTest(t, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&inFlight, 1) > 1 {
+			atomic.AddInt32(&overlaps, 1)
+		}
+		time.Sleep(5 * time.Millisecond)
+		atomic.AddInt32(&inFlight, -1)
+	})
+
+	var wg sync.WaitGroup
+	for i := 0; i < 5; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			assert.NoError(t, manager.ApplyConfig(context.Background()))
+		}()
+	}
+	wg.Wait()
+
+	assert.Zero(t, atomic.LoadInt32(&overlaps))
+	history, err := manager.History()
+	require.NoError(t, err)
+	assert.Len(t, history, 5)
+}
+
+func TestApplyQueue_RevertsOnlyFaultyChanges(t *testing.T) {
+	admin := &fakeAdmin{}
+	manager, db := setupHistoryTest(t, admin.ServeHTTP)
+	require.NoError(t, db.Create(&models.ProxyHost{UUID: "uuid-app", DomainNames: "app.example.com", ForwardHost: "app", ForwardPort: 80}).Error)
+
+	queue := NewApplyQueue(manager, 50*time.Millisecond)
+	var reverts []string
+	change := func(hostUUID, name string, revert func() error) HostChange {
+		return HostChange{HostUUID: hostUUID, Revert: func() error {
+			reverts = append(reverts, name)
+			return revert()
+		}}
+	}
+
+	// Two changes to a host that breaks the config, batched with a valid one
+	require.NoError(t, db.Create(&models.ProxyHost{UUID: "uuid-typo", DomainNames: "typo.example.com", ForwardHost: "typo", ForwardPort: 80}).Error)
+	jobs := []ApplyJob{
+		queue.EnqueueChange(ApplyInfo{Reason: "create proxy host typo"}, change("uuid-typo", "create typo", func() error {
+			return db.Where("uuid = ?", "uuid-typo").Delete(&models.ProxyHost{}).Error
+		})),
+		queue.EnqueueChange(ApplyInfo{Reason: "update proxy host app"}, change("uuid-app", "update app", func() error { return nil })),
+		queue.EnqueueChange(ApplyInfo{Reason: "update proxy host typo"}, change("uuid-typo", "update typo", func() error {
+			return db.Model(&models.ProxyHost{}).Where("uuid = ?", "uuid-typo").Update("canonical_host", "").Error
+		})),
+	}
+	require.NoError(t, db.Model(&models.ProxyHost{}).Where("uuid = ?", "uuid-typo").Update("canonical_host", "bogus").Error)
+
+	queue.applyPending(context.Background())
+
+	var applyErr *ApplyError
+	require.ErrorAs(t, queue.Wait(context.Background(), jobs[0].ID), &applyErr)
+	assert.Equal(t, "uuid-typo", applyErr.HostUUID)
+	require.NoError(t, queue.Wait(context.Background(), jobs[1].ID))
+	require.Error(t, queue.Wait(context.Background(), jobs[2].ID))
+
+	// Newest first, and the valid change is kept and applied
+	assert.Equal(t, []string{"update typo", "create typo"}, reverts)
+	for _, id := range []string{jobs[0].ID, jobs[2].ID} {
+		job, err := queue.Job(id)
+		require.NoError(t, err)
+		assert.Equal(t, JobFailed, job.Status)
+		assert.True(t, job.Reverted)
+	}
+	job, err := queue.Job(jobs[1].ID)
+	require.NoError(t, err)
+	assert.Equal(t, JobApplied, job.Status)
+	assert.False(t, job.Reverted)
+	assert.Equal(t, 1, admin.loads)
+
+	var count int64
+	db.Model(&models.ProxyHost{}).Where("uuid = ?", "uuid-typo").Count(&count)
+	assert.Zero(t, count)
+}
+
+func TestApplyQueue_RevertsChangeCaddyRejects(t *testing.T) {
+	// Caddy fails to provision the route of typo.example.com
+	admin := &fakeAdmin{}
+	manager, db := setupHistoryTest(t, func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/load" {
+			body, _ := io.ReadAll(r.Body)
+			r.Body = io.NopCloser(bytes.NewReader(body))
+			var config Config
+			require.NoError(t, json.Unmarshal(body, &config))
+			for i, route := range config.Apps.HTTP.Servers["cpm_server"].Routes {
+				if len(route.Match) > 0 && len(route.Match[0].Host) > 0 && route.Match[0].Host[0] == "typo.example.com" {
+					w.WriteHeader(http.StatusBadRequest)
+					fmt.Fprintf(w, `{"error":"loading config: loading new config: loading http app module: provision http: server cpm_server: setting up route handlers: route %d: loading handler modules: unknown module"}`, i)
+					return
+				}
+			}
+		}
+		admin.ServeHTTP(w, r)
+	})
+	require.NoError(t, db.Create(&models.ProxyHost{UUID: "uuid-app", DomainNames: "app.example.com", ForwardHost: "app", ForwardPort: 80}).Error)
+
+	queue := NewApplyQueue(manager, 50*time.Millisecond)
+	require.NoError(t, db.Create(&models.ProxyHost{UUID: "uuid-typo", DomainNames: "typo.example.com", ForwardHost: "typo", ForwardPort: 80}).Error)
+	typo := queue.EnqueueChange(ApplyInfo{Reason: "create proxy host typo"}, HostChange{HostUUID: "uuid-typo", Revert: func() error {
+		return db.Where("uuid = ?", "uuid-typo").Delete(&models.ProxyHost{}).Error
+	}})
+	app := queue.EnqueueChange(ApplyInfo{Reason: "update proxy host app"}, HostChange{HostUUID: "uuid-app", Revert: func() error { return nil }})
+
+	queue.applyPending(context.Background())
+
+	var applyErr *ApplyError
+	require.ErrorAs(t, queue.Wait(context.Background(), typo.ID), &applyErr)
+	assert.Equal(t, ApplyStageLoad, applyErr.Stage)
+	assert.Equal(t, "uuid-typo", applyErr.HostUUID)
+	job, err := queue.Job(typo.ID)
+	require.NoError(t, err)
+	assert.True(t, job.Reverted)
+
+	// The rest of the batch is applied without the rejected host
+	require.NoError(t, queue.Wait(context.Background(), app.ID))
+	assert.Equal(t, 1, admin.loads)
+	assert.Contains(t, liveDomains(t, admin), "app.example.com")
+	assert.NotContains(t, liveDomains(t, admin), "typo.example.com")
+}
+
+func TestApplyQueue_RevertHandedToQueuedChange(t *testing.T) {
+	admin := &fakeAdmin{down: true}
+	manager, _ := setupHistoryTest(t, admin.ServeHTTP)
+	queue := NewApplyQueue(manager, time.Millisecond)
+
+	var reverts []string
+	first := queue.EnqueueChange(ApplyInfo{}, HostChange{HostUUID: "uuid-app", Revert: func() error {
+		reverts = append(reverts, "first")
+		return nil
+	}})
+	queue.mu.Lock()
+	batch := queue.pending
+	queue.pending = nil
+	queue.mu.Unlock()
+
+	// A second change to the host is queued while the first one applies
+	second := queue.EnqueueChange(ApplyInfo{}, HostChange{HostUUID: "uuid-app", Revert: func() error {
+		reverts = append(reverts, "second")
+		return nil
+	}})
+	queue.apply(context.Background(), batch)
+	assert.Empty(t, reverts)
+
+	queue.applyPending(context.Background())
+	require.Error(t, queue.Wait(context.Background(), second.ID))
+
+	// Restores the state from before the first change, not the second
+	assert.Equal(t, []string{"first"}, reverts)
+	job, err := queue.Job(first.ID)
+	require.NoError(t, err)
+	assert.Equal(t, JobFailed, job.Status)
+	assert.False(t, job.Reverted)
+}
@@ -0,0 +1,111 @@
+package caddy
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/models"
+)
+
+const expressionRoute = `{"handle":[{"body":"OK","handler":"static_response"}],"match":[{"expression":"path('/health')","host":["health.example.com"]}]}`
+
+func TestRoute_RawRoundTrip(t *testing.T) {
+	// Fields Route doesn't model are kept
+	var route Route
+	require.NoError(t, json.Unmarshal([]byte(expressionRoute), &route))
+	assert.Equal(t, []string{"health.example.com"}, route.Match[0].Host)
+	assert.NotNil(t, route.Raw)
+	raw, err := json.Marshal(&route)
+	require.NoError(t, err)
+	assert.JSONEq(t, expressionRoute, string(raw))
+
+	// Modeled routes are written from their fields
+	route = Route{}
+	require.NoError(t, json.Unmarshal([]byte(`{"match": [{"host": ["a.example.com"]}], "handle": [{"handler": "reverse_proxy"}], "terminal": true}`), &route))
+	assert.Nil(t, route.Raw)
+	route.Terminal = false
+	raw, err = json.Marshal(route)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"match": [{"host": ["a.example.com"]}], "handle": [{"handler": "reverse_proxy"}]}`, string(raw))
+}
+
+func TestGenerateConfig_RawRoutes(t *testing.T) {
+	hosts := []models.ProxyHost{
+		{UUID: "uuid-app", DomainNames: "app.example.com", ForwardHost: "app", ForwardPort: 80, Enabled: true},
+		{UUID: "uuid-any", DomainNames: "any", ForwardHost: "any", ForwardPort: 80, Enabled: true, OnDemandTLS: true},
+	}
+	opts := ConfigOptions{RawRoutes: []models.RawRoute{
+		{UUID: "raw-1", Route: expressionRoute, Enabled: true},
+		{UUID: "raw-2", Route: `{"handle": [{"handler": "static_response"}]}`},
+	}}
+
+	config, err := GenerateConfig(hosts, "/tmp/caddy-data", opts)
+	require.NoError(t, err)
+	routes := config.Apps.HTTP.Servers["cpm_server"].Routes
+	require.Len(t, routes, 3)
+	assert.Equal(t, "host_uuid-app", routes[0].ID)
+	raw, err := json.Marshal(routes[1])
+	require.NoError(t, err)
+	assert.JSONEq(t, expressionRoute, string(raw))
+	// The on-demand catch-all stays last
+	assert.Equal(t, "host_uuid-any", routes[2].ID)
+
+	// Raw routes alone still make a server
+	config, err = GenerateConfig(nil, "/tmp/caddy-data", opts)
+	require.NoError(t, err)
+	assert.Len(t, config.Apps.HTTP.Servers["cpm_server"].Routes, 1)
+
+	opts.RawRoutes = []models.RawRoute{{UUID: "raw-bad", Route: `{invalid`, Enabled: true}}
+	_, err = GenerateConfig(hosts, "/tmp/caddy-data", opts)
+	assert.ErrorContains(t, err, "raw route raw-bad")
+}
+
+func TestManager_RawRoutes(t *testing.T) {
+	admin := &fakeAdmin{}
+	manager, db := setupHistoryTest(t, admin.ServeHTTP)
+	require.NoError(t, db.AutoMigrate(&models.RawRoute{}))
+	require.NoError(t, db.Create(&models.ProxyHost{UUID: "uuid-app", DomainNames: "app.example.com", ForwardHost: "app", ForwardPort: 80, Enabled: true}).Error)
+	require.NoError(t, db.Create(&models.RawRoute{UUID: "raw-1", Route: expressionRoute, Enabled: true}).Error)
+
+	reconciler := NewReconciler(manager, &recordingNotifier{}, time.Minute)
+	require.NoError(t, reconciler.ApplyStartup(context.Background()))
+
+	// The adopted route reaches Caddy verbatim and doesn't look like drift
+	assert.Contains(t, liveDomains(t, admin), "health.example.com")
+	require.NoError(t, reconciler.Reconcile(context.Background()))
+	assert.True(t, reconciler.Status().InSync)
+	assert.Equal(t, 1, admin.loads)
+}
+
+func TestManager_AdoptedRoutesValidate(t *testing.T) {
+	admin := &fakeAdmin{}
+	manager, db := setupHistoryTest(t, admin.ServeHTTP)
+	require.NoError(t, db.AutoMigrate(&models.RawRoute{}))
+
+	// As adapted by Caddy, so handler fields decode to generic JSON shapes
+	adopted := []string{
+		`{"match":[{"host":["upload.example.com"]}],"handle":[{"handler":"request_body","max_size":10485760},{"handler":"reverse_proxy","upstreams":[{"dial":"app:80"}]}]}`,
+		`{"match":[{"host":["legacy.example.com"]}],"handle":[{"handler":"rewrite","path_regexp":[{"find":"^/old","replace":"/new"}]},{"handler":"reverse_proxy","upstreams":[{"dial":"unix//run/legacy.sock"}]}]}`,
+		`{"handle":[{"handler":"reverse_proxy","upstreams":[{"dial":"app:80"}]}]}`,
+	}
+	for i, route := range adopted {
+		require.NoError(t, db.Create(&models.RawRoute{UUID: fmt.Sprintf("raw-%d", i), Route: route, Enabled: true}).Error)
+	}
+
+	require.NoError(t, manager.ApplyConfig(context.Background()))
+
+	// ...and keep validating on later applies
+	require.NoError(t, db.Create(&models.ProxyHost{UUID: "uuid-app", DomainNames: "app.example.com", ForwardHost: "app", ForwardPort: 80, Enabled: true}).Error)
+	require.NoError(t, manager.ApplyConfig(context.Background()))
+	assert.Equal(t, 2, admin.loads)
+	assert.Contains(t, liveDomains(t, admin), "upload.example.com")
+
+	require.NoError(t, db.Create(&models.RawRoute{UUID: "raw-bad", Route: `{"handle":[{"handler":"reverse_proxy","upstreams":[{"dial":"app"}]}]}`, Enabled: true}).Error)
+	assert.ErrorContains(t, manager.ApplyConfig(context.Background()), "invalid dial address")
+}
@@ -0,0 +1,302 @@
+package caddy
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/models"
+)
+
+// DriftActionSetting selects what the reconciler does when Caddy's running
+// config no longer matches the database.
+const DriftActionSetting = "caddy.drift_action"
+
+// Drift actions.
+const (
+	DriftActionReapply = "reapply" // Default, load the generated config again
+	DriftActionNotify  = "notify"  // Leave Caddy alone and raise a notification
+)
+
+// Notifier raises user-facing notifications, e.g. services.NotificationService.
+type Notifier interface {
+	Create(nType models.NotificationType, title, message string) (*models.Notification, error)
+}
+
+// ReconcileStatus is the outcome of the last reconcile pass.
+type ReconcileStatus struct {
+	Applied      bool       `json:"applied"` // The startup apply succeeded
+	InSync       bool       `json:"in_sync"`
+	LastCheck    *time.Time `json:"last_check,omitempty"`
+	LastDrift    *time.Time `json:"last_drift,omitempty"`
+	LastAction   string     `json:"last_action,omitempty"` // "applied", "reapplied" or "notified"
+	ExpectedHash string     `json:"expected_hash,omitempty"`
+	LiveHash     string     `json:"live_hash,omitempty"`
+	Error        string     `json:"error,omitempty"`
+}
+
+// startupRetryInterval is how often a failed startup apply is retried when
+// there is no reconcile interval to retry at.
+const startupRetryInterval = 10 * time.Second
+
+// Reconciler applies the config at startup and then periodically checks
+// that Caddy still runs it, catching edits made through the admin API and
+// Caddy restarts with an empty config.
+type Reconciler struct {
+	manager  *Manager
+	queue    *ApplyQueue // Optional, re-applies go through it when set
+	notifier Notifier
+	interval time.Duration
+	retry    time.Duration // Startup apply retries when interval is 0
+
+	mu            sync.Mutex
+	status        ReconcileStatus
+	notifiedHash  string          // Live config hash already notified about
+	notifiedNodes map[uint]string // Same, per Caddy node
+}
+
+// NewReconciler creates a reconciler checking every interval, 0 only
+// applies the config at startup.
+func NewReconciler(manager *Manager, notifier Notifier, interval time.Duration) *Reconciler {
+	return &Reconciler{
+		manager:       manager,
+		notifier:      notifier,
+		interval:      interval,
+		retry:         startupRetryInterval,
+		notifiedNodes: make(map[uint]string),
+	}
+}
+
+// SetApplyQueue makes drift re-applies go through queue, serialized with
+// the edits queued there and after those still being debounced.
+func (r *Reconciler) SetApplyQueue(queue *ApplyQueue) {
+	r.queue = queue
+}
+
+// Run applies the config, retrying until it succeeds, and then reconciles
+// every interval until ctx is done. Without an interval it returns once the
+// config is applied.
+func (r *Reconciler) Run(ctx context.Context) {
+	period := r.interval
+	if period <= 0 {
+		period = r.retry
+	}
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	for {
+		if r.Status().Applied {
+			if err := r.Reconcile(ctx); err != nil {
+				log.Printf("caddy reconcile: %v", err)
+			}
+			if err := r.ReconcileNodes(ctx); err != nil {
+				log.Printf("caddy node reconcile: %v", err)
+			}
+		} else if err := r.ApplyStartup(ctx); err != nil {
+			log.Printf("caddy startup apply: %v", err)
+		}
+
+		// Without an interval there are no drift checks to wait for
+		if r.interval <= 0 && r.Status().Applied {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// ApplyStartup applies the config generated from the database.
+func (r *Reconciler) ApplyStartup(ctx context.Context) error {
+	err := r.manager.ApplyConfig(WithApplyInfo(ctx, ApplyInfo{Reason: "startup"}))
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	now := time.Now()
+	r.status.LastCheck = &now
+	if err != nil {
+		r.status.Error = err.Error()
+		return err
+	}
+	r.status.Applied = true
+	r.status.InSync = true
+	r.status.LastAction = "applied"
+	r.status.Error = ""
+	return nil
+}
+
+// Reconcile compares the live config with the generated one by hash and
+// handles drift according to DriftActionSetting.
+func (r *Reconciler) Reconcile(ctx context.Context) error {
+	err := r.reconcile(ctx)
+	if err != nil {
+		r.mu.Lock()
+		r.status.Error = err.Error()
+		r.mu.Unlock()
+	}
+	return err
+}
+
+func (r *Reconciler) reconcile(ctx context.Context) error {
+	hosts, err := r.manager.loadHosts()
+	if err != nil {
+		return err
+	}
+	expected, err := r.manager.generate(hosts)
+	if err != nil {
+		return fmt.Errorf("generate config: %w", err)
+	}
+	live, err := r.manager.client.GetRawConfig(ctx)
+	if err != nil {
+		return fmt.Errorf("get live config: %w", err)
+	}
+
+	expectedHash, err := configHash(expected)
+	if err != nil {
+		return err
+	}
+	liveHash, err := rawConfigHash(live)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now()
+	r.mu.Lock()
+	r.status.LastCheck = &now
+	r.status.ExpectedHash = expectedHash
+	r.status.LiveHash = liveHash
+	r.status.Error = ""
+	if expectedHash == liveHash {
+		r.status.InSync = true
+		r.notifiedHash = ""
+		r.mu.Unlock()
+		return nil
+	}
+	r.status.InSync = false
+	r.status.LastDrift = &now
+	alreadyNotified := r.notifiedHash == liveHash
+	r.mu.Unlock()
+
+	if r.manager.loadSettings()[DriftActionSetting] == DriftActionNotify {
+		if alreadyNotified || r.notifier == nil {
+			return nil
+		}
+		message := "Caddy's running configuration differs from CPM+"
+		var liveConfig Config
+		if json.Unmarshal(live, &liveConfig) == nil {
+			if hosts := changedHosts(&liveConfig, expected); len(hosts) > 0 {
+				message += " for: " + strings.Join(hosts, "; ")
+			}
+		}
+		if _, err := r.notifier.Create(models.NotificationTypeWarning, "Caddy configuration drift", message); err != nil {
+			return fmt.Errorf("notify drift: %w", err)
+		}
+
+		r.mu.Lock()
+		r.notifiedHash = liveHash
+		r.status.LastAction = "notified"
+		r.mu.Unlock()
+		return nil
+	}
+
+	info := ApplyInfo{Reason: "reconcile drift"}
+	if r.queue != nil {
+		err = r.queue.Apply(ctx, info)
+	} else {
+		err = r.manager.ApplyConfig(WithApplyInfo(ctx, info))
+	}
+	if err != nil {
+		return fmt.Errorf("reapply: %w", err)
+	}
+
+	r.mu.Lock()
+	r.status.InSync = true
+	r.status.LiveHash = expectedHash
+	r.status.LastAction = "reapplied"
+	r.mu.Unlock()
+	return nil
+}
+
+// ReconcileNodes checks every enabled Caddy node and handles drift
+// according to DriftActionSetting, like Reconcile does for the local Caddy.
+func (r *Reconciler) ReconcileNodes(ctx context.Context) error {
+	nodes, err := r.manager.enabledNodes()
+	if err != nil {
+		return err
+	}
+	notify := r.manager.loadSettings()[DriftActionSetting] == DriftActionNotify
+
+	var errs []error
+	for i := range nodes {
+		node := &nodes[i]
+		if err := r.manager.CheckNode(ctx, node); err != nil {
+			errs = append(errs, fmt.Errorf("check node %s: %w", node.Name, err))
+			continue
+		}
+
+		r.mu.Lock()
+		alreadyNotified := r.notifiedNodes[node.ID] == node.LiveHash
+		if node.InSync {
+			delete(r.notifiedNodes, node.ID)
+		}
+		r.mu.Unlock()
+
+		switch {
+		case node.InSync:
+		case notify:
+			if alreadyNotified || r.notifier == nil {
+				continue
+			}
+			message := fmt.Sprintf("Caddy node %s runs a configuration that differs from CPM+", node.Name)
+			if _, err := r.notifier.Create(models.NotificationTypeWarning, "Caddy node configuration drift", message); err != nil {
+				errs = append(errs, fmt.Errorf("notify node %s drift: %w", node.Name, err))
+				continue
+			}
+			r.mu.Lock()
+			r.notifiedNodes[node.ID] = node.LiveHash
+			r.mu.Unlock()
+		default:
+			if err := r.manager.ApplyNode(ctx, node); err != nil {
+				errs = append(errs, fmt.Errorf("reapply node %s: %w", node.Name, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Status returns the outcome of the last reconcile pass.
+func (r *Reconciler) Status() ReconcileStatus {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.status
+}
+
+// configHash hashes a config in a canonical form, with object keys sorted,
+// so that the live config and the generated one compare equal.
+func configHash(config *Config) (string, error) {
+	raw, err := json.Marshal(config)
+	if err != nil {
+		return "", fmt.Errorf("marshal config: %w", err)
+	}
+	return rawConfigHash(raw)
+}
+
+// rawConfigHash hashes config JSON in the canonical form of configHash.
+// Live configs are hashed as Caddy returns them, so that edits to apps and
+// fields Config doesn't model count as drift too.
+func rawConfigHash(raw []byte) (string, error) {
+	canonical, err := canonicalJSON(raw)
+	if err != nil {
+		return "", fmt.Errorf("canonicalize config: %w", err)
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(canonical)), nil
+}
@@ -0,0 +1,277 @@
+package caddy
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/models"
+)
+
+// fakeAdmin stores the last loaded config and serves it back, applying
+// targeted updates to routes by @id.
+type fakeAdmin struct {
+	mu      sync.Mutex
+	live    json.RawMessage
+	loads   int
+	updates int
+	down    bool
+}
+
+func (f *fakeAdmin) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.down {
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	switch {
+	case r.URL.Path == "/load" && r.Method == http.MethodPost:
+		var body json.RawMessage
+		json.NewDecoder(r.Body).Decode(&body)
+		f.live = body
+		f.loads++
+	case strings.HasPrefix(r.URL.Path, "/id/"):
+		if !f.updateRoute(r) {
+			w.WriteHeader(http.StatusNotFound)
+			return
+		}
+		f.updates++
+	case r.URL.Path == "/config/" && r.Method == http.MethodGet:
+		if f.live == nil {
+			w.Write([]byte("null"))
+			return
+		}
+		w.Write(f.live)
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+// updateRoute patches or deletes the route of the live config with the
+// requested @id.
+func (f *fakeAdmin) updateRoute(r *http.Request) bool {
+	var config Config
+	if f.live == nil || json.Unmarshal(f.live, &config) != nil {
+		return false
+	}
+	if config.Apps.HTTP == nil || config.Apps.HTTP.Servers["cpm_server"] == nil {
+		return false
+	}
+	server := config.Apps.HTTP.Servers["cpm_server"]
+	id := strings.TrimPrefix(r.URL.Path, "/id/")
+	for i, route := range server.Routes {
+		if route.ID != id {
+			continue
+		}
+		switch r.Method {
+		case http.MethodPatch:
+			var replacement Route
+			if json.NewDecoder(r.Body).Decode(&replacement) != nil {
+				return false
+			}
+			server.Routes[i] = &replacement
+		case http.MethodDelete:
+			server.Routes = append(server.Routes[:i], server.Routes[i+1:]...)
+		default:
+			return false
+		}
+		f.live, _ = json.Marshal(config)
+		return true
+	}
+	return false
+}
+
+func (f *fakeAdmin) set(live string) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	f.live = json.RawMessage(live)
+}
+
+type recordingNotifier struct {
+	notifications []models.Notification
+}
+
+func (n *recordingNotifier) Create(nType models.NotificationType, title, message string) (*models.Notification, error) {
+	notification := models.Notification{Type: nType, Title: title, Message: message}
+	n.notifications = append(n.notifications, notification)
+	return &notification, nil
+}
+
+func TestReconciler_Reapply(t *testing.T) {
+	admin := &fakeAdmin{down: true}
+	manager, db := setupHistoryTest(t, admin.ServeHTTP)
+	require.NoError(t, db.Create(&models.ProxyHost{UUID: "uuid-app", DomainNames: "app.example.com", ForwardHost: "app", ForwardPort: 80}).Error)
+
+	reconciler := NewReconciler(manager, &recordingNotifier{}, time.Minute)
+
+	// Caddy not up yet
+	require.Error(t, reconciler.ApplyStartup(context.Background()))
+	assert.False(t, reconciler.Status().Applied)
+	assert.NotEmpty(t, reconciler.Status().Error)
+
+	admin.down = false
+	require.NoError(t, reconciler.ApplyStartup(context.Background()))
+	status := reconciler.Status()
+	assert.True(t, status.Applied)
+	assert.Equal(t, "applied", status.LastAction)
+	assert.Empty(t, status.Error)
+
+	// No drift
+	require.NoError(t, reconciler.Reconcile(context.Background()))
+	status = reconciler.Status()
+	assert.True(t, status.InSync)
+	assert.Equal(t, status.ExpectedHash, status.LiveHash)
+	assert.Equal(t, 1, admin.loads)
+
+	// Caddy restarted with an empty config
+	admin.set(`{"apps": {}}`)
+	require.NoError(t, reconciler.Reconcile(context.Background()))
+	status = reconciler.Status()
+	assert.True(t, status.InSync)
+	assert.Equal(t, "reapplied", status.LastAction)
+	assert.NotNil(t, status.LastDrift)
+	assert.Equal(t, 2, admin.loads)
+
+	history, err := manager.History()
+	require.NoError(t, err)
+	assert.Equal(t, "reconcile drift", history[0].Reason)
+	assert.Equal(t, "startup", history[1].Reason)
+}
+
+func TestReconciler_DriftOutsideConfigModel(t *testing.T) {
+	admin := &fakeAdmin{}
+	manager, db := setupHistoryTest(t, admin.ServeHTTP)
+	require.NoError(t, db.Create(&models.ProxyHost{UUID: "uuid-app", DomainNames: "app.example.com", ForwardHost: "app", ForwardPort: 80}).Error)
+
+	reconciler := NewReconciler(manager, &recordingNotifier{}, time.Minute)
+	require.NoError(t, reconciler.ApplyStartup(context.Background()))
+
+	// An app Config doesn't model, added through the admin API
+	var live map[string]interface{}
+	require.NoError(t, json.Unmarshal(admin.live, &live))
+	live["apps"].(map[string]interface{})["pki"] = map[string]interface{}{"certificate_authorities": map[string]interface{}{}}
+	raw, err := json.Marshal(live)
+	require.NoError(t, err)
+	admin.set(string(raw))
+
+	require.NoError(t, reconciler.Reconcile(context.Background()))
+	assert.Equal(t, "reapplied", reconciler.Status().LastAction)
+	assert.Equal(t, 2, admin.loads)
+	assert.NotContains(t, string(admin.live), "pki")
+}
+
+func TestReconciler_ReapplyThroughQueue(t *testing.T) {
+	admin := &fakeAdmin{}
+	manager, db := setupHistoryTest(t, admin.ServeHTTP)
+	require.NoError(t, db.Create(&models.ProxyHost{UUID: "uuid-app", DomainNames: "app.example.com", ForwardHost: "app", ForwardPort: 80}).Error)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	queue := NewApplyQueue(manager, 10*time.Millisecond)
+	go queue.Run(ctx)
+
+	reconciler := NewReconciler(manager, &recordingNotifier{}, time.Minute)
+	reconciler.SetApplyQueue(queue)
+	require.NoError(t, reconciler.ApplyStartup(ctx))
+
+	admin.set(`{"apps": {}}`)
+	require.NoError(t, reconciler.Reconcile(ctx))
+	assert.Equal(t, "reapplied", reconciler.Status().LastAction)
+	assert.Equal(t, 2, admin.loads)
+
+	queue.mu.Lock()
+	defer queue.mu.Unlock()
+	require.Len(t, queue.jobs, 1)
+	for _, job := range queue.jobs {
+		assert.Equal(t, JobApplied, job.Status)
+		assert.Equal(t, "reconcile drift", job.Reason)
+	}
+}
+
+func TestReconciler_Notify(t *testing.T) {
+	admin := &fakeAdmin{}
+	manager, db := setupHistoryTest(t, admin.ServeHTTP)
+	require.NoError(t, db.Create(&models.ProxyHost{UUID: "uuid-app", DomainNames: "app.example.com", ForwardHost: "app", ForwardPort: 80}).Error)
+	require.NoError(t, db.Create(&models.Setting{Key: DriftActionSetting, Value: DriftActionNotify}).Error)
+
+	notifier := &recordingNotifier{}
+	reconciler := NewReconciler(manager, notifier, time.Minute)
+	require.NoError(t, reconciler.ApplyStartup(context.Background()))
+
+	// Someone edited Caddy through the admin API
+	admin.set(`{"apps": {"http": {"servers": {"cpm_server": {"listen": [":80"], "routes": []}}}}}`)
+	require.NoError(t, reconciler.Reconcile(context.Background()))
+	status := reconciler.Status()
+	assert.False(t, status.InSync)
+	assert.Equal(t, "notified", status.LastAction)
+	assert.Equal(t, 1, admin.loads)
+	require.Len(t, notifier.notifications, 1)
+	assert.Equal(t, models.NotificationTypeWarning, notifier.notifications[0].Type)
+	assert.Contains(t, notifier.notifications[0].Message, "app.example.com")
+
+	// The same drift is reported once
+	require.NoError(t, reconciler.Reconcile(context.Background()))
+	assert.Len(t, notifier.notifications, 1)
+
+	// Back in sync
+	require.NoError(t, manager.ApplyConfig(context.Background()))
+	require.NoError(t, reconciler.Reconcile(context.Background()))
+	assert.True(t, reconciler.Status().InSync)
+}
+
+func TestReconciler_Run(t *testing.T) {
+	admin := &fakeAdmin{}
+	manager, _ := setupHistoryTest(t, admin.ServeHTTP)
+	reconciler := NewReconciler(manager, nil, 10*time.Millisecond)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		reconciler.Run(ctx)
+		close(done)
+	}()
+
+	require.Eventually(t, func() bool {
+		status := reconciler.Status()
+		return status.Applied && status.InSync && status.ExpectedHash != ""
+	}, time.Second, 10*time.Millisecond)
+
+	cancel()
+	<-done
+}
+
+func TestReconciler_RunWithoutInterval(t *testing.T) {
+	admin := &fakeAdmin{down: true}
+	manager, _ := setupHistoryTest(t, admin.ServeHTTP)
+	reconciler := NewReconciler(manager, nil, 0)
+	reconciler.retry = 10 * time.Millisecond
+
+	done := make(chan struct{})
+	go func() {
+		reconciler.Run(context.Background())
+		close(done)
+	}()
+
+	// The startup apply is retried until Caddy is up, then Run returns
+	time.Sleep(30 * time.Millisecond)
+	assert.False(t, reconciler.Status().Applied)
+	admin.mu.Lock()
+	admin.down = false
+	admin.mu.Unlock()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("Run did not return after the startup apply")
+	}
+	assert.True(t, reconciler.Status().Applied)
+	assert.Equal(t, 1, admin.loads)
+}
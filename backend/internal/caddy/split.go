@@ -0,0 +1,135 @@
+package caddy
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/models"
+)
+
+// tokenPattern matches valid HTTP header and cookie names (RFC 7230 token).
+var tokenPattern = regexp.MustCompile("^[A-Za-z0-9!#$%&'*+.^_`|~-]+$")
+
+// ValidateUpstreamGroups checks a host's traffic split before it is saved or rendered.
+// Weights are percentages and must add up to 100.
+func ValidateUpstreamGroups(groups []models.UpstreamGroup, stickyCookie, overrideHeader string) error {
+	if len(groups) == 0 {
+		return nil
+	}
+
+	seen := make(map[string]bool)
+	total := 0
+	scheme := groupScheme(groups[0])
+	for _, g := range groups {
+		if g.Name == "" {
+			return fmt.Errorf("upstream group name is required")
+		}
+		if seen[g.Name] {
+			return fmt.Errorf("duplicate upstream group %q", g.Name)
+		}
+		seen[g.Name] = true
+
+		if g.ForwardHost == "" || g.ForwardPort < 1 || g.ForwardPort > 65535 {
+			return fmt.Errorf("upstream group %q has an invalid forward target", g.Name)
+		}
+		// The weighted pool shares one transport, so every group needs the same scheme
+		if s := groupScheme(g); s != "http" && s != "https" {
+			return fmt.Errorf("upstream group %q has an invalid forward scheme %q", g.Name, g.ForwardScheme)
+		} else if s != scheme {
+			return fmt.Errorf("upstream groups must all use the same forward scheme, %q uses %s", g.Name, s)
+		}
+		if g.Weight < 0 || g.Weight > 100 {
+			return fmt.Errorf("upstream group %q weight %d out of range (0-100)", g.Name, g.Weight)
+		}
+		total += g.Weight
+	}
+
+	if total != 100 {
+		return fmt.Errorf("upstream group weights must add up to 100, got %d", total)
+	}
+
+	if stickyCookie != "" && !tokenPattern.MatchString(stickyCookie) {
+		return fmt.Errorf("invalid sticky cookie name: %s", stickyCookie)
+	}
+	if overrideHeader != "" && !tokenPattern.MatchString(overrideHeader) {
+		return fmt.Errorf("invalid override header name: %s", overrideHeader)
+	}
+
+	return nil
+}
+
+// TrafficSplitHandler renders a host's upstream groups as a subroute.
+// Requests carrying the override header are sent to the named group; everything
+// else is balanced with weighted_round_robin, optionally pinned by a cookie.
+// The groups must share a forward scheme, see ValidateUpstreamGroups.
+func TrafficSplitHandler(host models.ProxyHost, f routeFeatures) Handler {
+	routes := make([]*Route, 0, len(host.UpstreamGroups)+1)
+
+	if host.SplitOverrideHeader != "" {
+		for _, g := range host.UpstreamGroups {
+			proxy := proxyHandler(host, f, groupScheme(g), g.ForwardHost, g.ForwardPort)
+			routes = append(routes, &Route{
+				Match: []Match{
+					{Header: map[string][]string{host.SplitOverrideHeader: {g.Name}}},
+				},
+				Handle:   []Handler{proxy},
+				Terminal: true,
+			})
+		}
+	}
+
+	// Groups at 0% only stay reachable through the override header
+	upstreams := make([]map[string]interface{}, 0, len(host.UpstreamGroups))
+	weights := make([]int, 0, len(host.UpstreamGroups))
+	for _, g := range host.UpstreamGroups {
+		if g.Weight == 0 {
+			continue
+		}
+		upstreams = append(upstreams, map[string]interface{}{"dial": upstreamDial(g)})
+		weights = append(weights, g.Weight)
+	}
+
+	policy := map[string]interface{}{
+		"policy":  "weighted_round_robin",
+		"weights": weights,
+	}
+	if host.SplitStickyCookie != "" {
+		policy = map[string]interface{}{
+			"policy":   "cookie",
+			"name":     host.SplitStickyCookie,
+			"fallback": policy,
+		}
+	}
+
+	var tls map[string]interface{}
+	if groupScheme(host.UpstreamGroups[0]) == "https" {
+		tls = upstreamTLS(f)
+	}
+
+	proxy := ReverseProxyHandler("", f.websocket)
+	proxy["upstreams"] = upstreams
+	proxy["load_balancing"] = map[string]interface{}{
+		"selection_policy": policy,
+	}
+	if transport := upstreamTransport(host, tls); transport != nil {
+		proxy["transport"] = transport
+	}
+
+	routes = append(routes, &Route{
+		Handle: []Handler{proxy},
+	})
+
+	return SubrouteHandler(routes)
+}
+
+// groupScheme returns the group's forward scheme, http when unset.
+func groupScheme(g models.UpstreamGroup) string {
+	if g.ForwardScheme == "" {
+		return "http"
+	}
+	return g.ForwardScheme
+}
+
+func upstreamDial(g models.UpstreamGroup) string {
+	return fmt.Sprintf("%s:%d", g.ForwardHost, g.ForwardPort)
+}
@@ -0,0 +1,145 @@
+package caddy
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/models"
+)
+
+func canaryHost() models.ProxyHost {
+	return models.ProxyHost{
+		UUID:        "uuid-canary",
+		DomainNames: "app.example.com",
+		ForwardHost: "app",
+		ForwardPort: 8080,
+		Enabled:     true,
+		UpstreamGroups: []models.UpstreamGroup{
+			{Name: "stable", ForwardHost: "app-v1", ForwardPort: 8080, Weight: 95},
+			{Name: "canary", ForwardHost: "app-v2", ForwardPort: 8080, Weight: 5},
+		},
+	}
+}
+
+func TestGenerateConfig_WeightedSplit(t *testing.T) {
+	config, err := GenerateConfig([]models.ProxyHost{canaryHost()}, "/tmp/caddy-data", ConfigOptions{})
+	require.NoError(t, err)
+	require.NoError(t, Validate(config))
+
+	route := config.Apps.HTTP.Servers["cpm_server"].Routes[0]
+	require.Len(t, route.Handle, 1)
+	require.Equal(t, "subroute", route.Handle[0]["handler"])
+
+	subroutes := route.Handle[0]["routes"].([]*Route)
+	require.Len(t, subroutes, 1)
+
+	raw, err := json.Marshal(subroutes[0].Handle[0])
+	require.NoError(t, err)
+	require.JSONEq(t, `{
+		"handler": "reverse_proxy",
+		"upstreams": [{"dial": "app-v1:8080"}, {"dial": "app-v2:8080"}],
+		"load_balancing": {
+			"selection_policy": {"policy": "weighted_round_robin", "weights": [95, 5]}
+		}
+	}`, string(raw))
+}
+
+func TestGenerateConfig_WeightedSplitStickyWithOverride(t *testing.T) {
+	host := canaryHost()
+	host.SplitStickyCookie = "cpm_split"
+	host.SplitOverrideHeader = "X-Upstream-Group"
+	host.UpstreamGroups[0].Weight = 100
+	host.UpstreamGroups[1].Weight = 0
+
+	config, err := GenerateConfig([]models.ProxyHost{host}, "/tmp/caddy-data", ConfigOptions{})
+	require.NoError(t, err)
+	require.NoError(t, Validate(config))
+
+	subroutes := config.Apps.HTTP.Servers["cpm_server"].Routes[0].Handle[0]["routes"].([]*Route)
+	require.Len(t, subroutes, 3)
+
+	// Override routes come first, one per group, including groups at 0%
+	require.Equal(t, map[string][]string{"X-Upstream-Group": {"stable"}}, subroutes[0].Match[0].Header)
+	require.Equal(t, map[string][]string{"X-Upstream-Group": {"canary"}}, subroutes[1].Match[0].Header)
+	require.True(t, subroutes[1].Terminal)
+
+	raw, err := json.Marshal(subroutes[2].Handle[0])
+	require.NoError(t, err)
+	require.JSONEq(t, `{
+		"handler": "reverse_proxy",
+		"upstreams": [{"dial": "app-v1:8080"}],
+		"load_balancing": {
+			"selection_policy": {
+				"policy": "cookie",
+				"name": "cpm_split",
+				"fallback": {"policy": "weighted_round_robin", "weights": [100]}
+			}
+		}
+	}`, string(raw))
+}
+
+func TestGenerateConfig_WeightedSplitHTTPS(t *testing.T) {
+	host := canaryHost()
+	host.SplitOverrideHeader = "X-Upstream-Group"
+	host.UpstreamTLSServerName = "app.internal"
+	for i := range host.UpstreamGroups {
+		host.UpstreamGroups[i].ForwardScheme = "https"
+	}
+
+	config, err := GenerateConfig([]models.ProxyHost{host}, "/tmp/caddy-data", ConfigOptions{})
+	require.NoError(t, err)
+	require.NoError(t, Validate(config))
+
+	subroutes := config.Apps.HTTP.Servers["cpm_server"].Routes[0].Handle[0]["routes"].([]*Route)
+	require.Len(t, subroutes, 3)
+
+	for _, sub := range subroutes {
+		raw, err := json.Marshal(sub.Handle[0]["transport"])
+		require.NoError(t, err)
+		require.JSONEq(t, `{"protocol": "http", "tls": {"server_name": "app.internal"}}`, string(raw))
+	}
+}
+
+func TestValidateUpstreamGroups(t *testing.T) {
+	valid := canaryHost().UpstreamGroups
+	require.NoError(t, ValidateUpstreamGroups(valid, "cpm_split", "X-Group"))
+	require.NoError(t, ValidateUpstreamGroups(nil, "", ""))
+
+	tests := []struct {
+		name   string
+		mutate func(groups []models.UpstreamGroup) []models.UpstreamGroup
+		cookie string
+		header string
+		want   string
+	}{
+		{"weights not 100", func(g []models.UpstreamGroup) []models.UpstreamGroup { g[1].Weight = 10; return g }, "", "", "add up to 100"},
+		{"negative weight", func(g []models.UpstreamGroup) []models.UpstreamGroup { g[0].Weight = 105; g[1].Weight = -5; return g }, "", "", "out of range"},
+		{"duplicate name", func(g []models.UpstreamGroup) []models.UpstreamGroup { g[1].Name = "stable"; return g }, "", "", "duplicate upstream group"},
+		{"missing name", func(g []models.UpstreamGroup) []models.UpstreamGroup { g[0].Name = ""; return g }, "", "", "name is required"},
+		{"bad port", func(g []models.UpstreamGroup) []models.UpstreamGroup { g[0].ForwardPort = 0; return g }, "", "", "invalid forward target"},
+		{"bad scheme", func(g []models.UpstreamGroup) []models.UpstreamGroup { g[0].ForwardScheme = "ftp"; return g }, "", "", "invalid forward scheme"},
+		{"mixed schemes", func(g []models.UpstreamGroup) []models.UpstreamGroup { g[1].ForwardScheme = "https"; return g }, "", "", "same forward scheme"},
+		{"bad cookie", func(g []models.UpstreamGroup) []models.UpstreamGroup { return g }, "bad cookie", "", "invalid sticky cookie"},
+		{"bad header", func(g []models.UpstreamGroup) []models.UpstreamGroup { return g }, "", "X Group", "invalid override header"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			groups := tt.mutate(canaryHost().UpstreamGroups)
+			err := ValidateUpstreamGroups(groups, tt.cookie, tt.header)
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tt.want)
+		})
+	}
+}
+
+func TestGenerateConfig_InvalidSplit(t *testing.T) {
+	host := canaryHost()
+	host.UpstreamGroups[0].Weight = 50
+
+	_, err := GenerateConfig([]models.ProxyHost{host}, "/tmp/caddy-data", ConfigOptions{})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "uuid-canary")
+}
@@ -0,0 +1,121 @@
+package caddy
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/models"
+)
+
+// DefaultStaticBaseDir is the directory static host roots must live under
+// unless configured otherwise.
+const DefaultStaticBaseDir = "/srv"
+
+// ValidateStaticRoot ensures root is an absolute directory inside baseDir,
+// so a host cannot serve arbitrary files from the container.
+func ValidateStaticRoot(root, baseDir string) error {
+	if baseDir == "" {
+		baseDir = DefaultStaticBaseDir
+	}
+	if root == "" {
+		return fmt.Errorf("static root is required")
+	}
+	if !filepath.IsAbs(root) {
+		return fmt.Errorf("static root %s must be an absolute path", root)
+	}
+
+	if !withinDir(filepath.Clean(root), filepath.Clean(baseDir)) {
+		return fmt.Errorf("static root %s is outside the allowed base directory %s", root, baseDir)
+	}
+
+	// Symlinks could still point outside the base directory
+	resolvedRoot, err := filepath.EvalSymlinks(root)
+	if err != nil {
+		return nil // Root may only exist in the Caddy container
+	}
+	resolvedBase, err := filepath.EvalSymlinks(baseDir)
+	if err != nil {
+		resolvedBase = filepath.Clean(baseDir)
+	}
+	if !withinDir(resolvedRoot, resolvedBase) {
+		return fmt.Errorf("static root %s resolves outside the allowed base directory %s", root, baseDir)
+	}
+
+	return nil
+}
+
+func withinDir(path, dir string) bool {
+	rel, err := filepath.Rel(dir, path)
+	if err != nil {
+		return false
+	}
+	return rel != ".." && !strings.HasPrefix(rel, ".."+string(os.PathSeparator))
+}
+
+// staticIndexNames returns the index files of a static host.
+func staticIndexNames(host models.ProxyHost) []string {
+	names := make([]string, 0)
+	for _, name := range strings.Split(host.StaticIndexFiles, ",") {
+		if name = strings.TrimSpace(name); name != "" {
+			names = append(names, name)
+		}
+	}
+	if len(names) == 0 {
+		names = []string{"index.html"}
+	}
+	return names
+}
+
+// staticHandlers builds the handlers serving a static host's files:
+// cache-control rules, the SPA try_files rewrite and the file server.
+func staticHandlers(host models.ProxyHost, baseDir string) ([]Handler, error) {
+	if err := ValidateStaticRoot(host.StaticRoot, baseDir); err != nil {
+		return nil, err
+	}
+	if len(host.UpstreamGroups) > 0 {
+		return nil, fmt.Errorf("static hosts cannot use upstream groups")
+	}
+
+	root := filepath.Clean(host.StaticRoot)
+	indexNames := staticIndexNames(host)
+	handlers := make([]Handler, 0, 3)
+
+	if len(host.StaticCacheControl) > 0 {
+		// A terminal route would end the whole handler chain before the
+		// file server, so later matching rules overwrite the header instead
+		// and the first matching rule is added last
+		routes := make([]*Route, 0, len(host.StaticCacheControl))
+		for i := len(host.StaticCacheControl) - 1; i >= 0; i-- {
+			rule := host.StaticCacheControl[i]
+			if rule.Path == "" || rule.Value == "" {
+				return nil, fmt.Errorf("cache-control rules need a path and a value")
+			}
+			routes = append(routes, &Route{
+				Match: []Match{{Path: []string{rule.Path}}},
+				Handle: []Handler{HeaderHandler(map[string][]string{
+					"Cache-Control": {rule.Value},
+				})},
+			})
+		}
+		handlers = append(handlers, SubrouteHandler(routes))
+	}
+
+	if host.StaticSPAFallback {
+		// Same as try_files {path} {path}/ /index.html
+		handlers = append(handlers, SubrouteHandler([]*Route{
+			{
+				Match: []Match{{File: &MatchFile{
+					Root:     root,
+					TryFiles: []string{"{http.request.uri.path}", "{http.request.uri.path}/", "/" + indexNames[0]},
+				}}},
+				Handle: []Handler{RewriteURIHandler("{http.matchers.file.relative}")},
+			},
+		}))
+	}
+
+	handlers = append(handlers, FileServerHandler(root, indexNames, host.StaticBrowse, host.StaticPrecompressed))
+
+	return handlers, nil
+}
@@ -0,0 +1,205 @@
+package caddy
+
+import (
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/models"
+)
+
+func TestGenerateConfig_StaticHost(t *testing.T) {
+	hosts := []models.ProxyHost{
+		{
+			UUID:                "uuid-spa",
+			DomainNames:         "spa.example.com",
+			HostType:            models.HostTypeStatic,
+			Enabled:             true,
+			StaticRoot:          "/srv/sites/spa/",
+			StaticIndexFiles:    "app.html, index.html",
+			StaticSPAFallback:   true,
+			StaticBrowse:        true,
+			StaticPrecompressed: true,
+			StaticCacheControl: []models.CacheControlRule{
+				{Path: "/assets/*", Value: "public, max-age=31536000, immutable"},
+				{Path: "*", Value: "no-cache"},
+			},
+			Locations: []models.Location{
+				{Path: "/api", ForwardScheme: "http", ForwardHost: "api", ForwardPort: 9000},
+			},
+		},
+	}
+
+	config, err := GenerateConfig(hosts, "/tmp/caddy-data", ConfigOptions{})
+	require.NoError(t, err)
+	require.NoError(t, Validate(config))
+
+	routes := config.Apps.HTTP.Servers["cpm_server"].Routes
+	require.Len(t, routes, 2)
+	require.Equal(t, "reverse_proxy", routes[0].Handle[0]["handler"])
+
+	handlers := routes[1].Handle
+	require.Equal(t, []string{"subroute", "subroute", "file_server"}, handlerTypes(handlers))
+
+	// Matching a cache-control rule still serves the file, with the first
+	// matching rule's header
+	files := map[string]bool{"/assets/app.js": true, "/app.html": true}
+	served, headers := serveStatic(handlers, "/assets/app.js", files)
+	require.Equal(t, "/assets/app.js", served)
+	require.Equal(t, "public, max-age=31536000, immutable", headers.Get("Cache-Control"))
+	served, headers = serveStatic(handlers, "/settings", files)
+	require.Equal(t, "/app.html", served)
+	require.Equal(t, "no-cache", headers.Get("Cache-Control"))
+
+	tryFiles := handlers[1]["routes"].([]*Route)[0]
+	require.Equal(t, &MatchFile{
+		Root:     "/srv/sites/spa",
+		TryFiles: []string{"{http.request.uri.path}", "{http.request.uri.path}/", "/app.html"},
+	}, tryFiles.Match[0].File)
+	require.Equal(t, RewriteURIHandler("{http.matchers.file.relative}"), tryFiles.Handle[0])
+
+	fileServer := handlers[2]
+	require.Equal(t, "/srv/sites/spa", fileServer["root"])
+	require.Equal(t, []string{"app.html", "index.html"}, fileServer["index_names"])
+	require.Contains(t, fileServer, "browse")
+	require.Equal(t, []string{"br", "zstd", "gzip"}, fileServer["precompressed_order"])
+}
+
+// serveStatic runs a static host's handlers for a request path the way
+// Caddy does, returning the file served, if any, and the response headers.
+// files lists the paths that exist under the root.
+func serveStatic(handlers []Handler, path string, files map[string]bool) (string, http.Header) {
+	headers := make(http.Header)
+	served, relative := "", ""
+
+	// run reports whether the handler chain ended
+	var run func(handlers []Handler) bool
+	run = func(handlers []Handler) bool {
+		for _, handler := range handlers {
+			switch handler["handler"] {
+			case "headers":
+				for name, values := range handler["response"].(map[string]interface{})["set"].(map[string][]string) {
+					headers[name] = values
+				}
+			case "rewrite":
+				if handler["uri"] == "{http.matchers.file.relative}" {
+					path = relative
+				}
+			case "subroute":
+				for _, route := range handler["routes"].([]*Route) {
+					matched, file := matchStatic(route.Match, path, files)
+					if !matched {
+						continue
+					}
+					relative = file
+					// A terminal route ends the whole chain, not just the subroute
+					if run(route.Handle) || route.Terminal {
+						return true
+					}
+				}
+			case "file_server":
+				if files[path] {
+					served = path
+				}
+				return true
+			}
+		}
+		return false
+	}
+	run(handlers)
+	return served, headers
+}
+
+// matchStatic evaluates the path and try_files matchers of static routes,
+// returning the file try_files picked.
+func matchStatic(matches []Match, path string, files map[string]bool) (bool, string) {
+	for _, match := range matches {
+		for _, pattern := range match.Path {
+			if pattern == path || (strings.HasSuffix(pattern, "*") && strings.HasPrefix(path, strings.TrimSuffix(pattern, "*"))) {
+				return true, ""
+			}
+		}
+		if match.File != nil {
+			for _, try := range match.File.TryFiles {
+				try = strings.ReplaceAll(try, "{http.request.uri.path}", path)
+				if files[try] {
+					return true, try
+				}
+			}
+		}
+	}
+	return false, ""
+}
+
+func TestGenerateConfig_StaticHostDefaults(t *testing.T) {
+	hosts := []models.ProxyHost{
+		{UUID: "uuid-docs", DomainNames: "docs.example.com", HostType: models.HostTypeStatic, Enabled: true, StaticRoot: "/data/docs"},
+	}
+
+	config, err := GenerateConfig(hosts, "/tmp/caddy-data", ConfigOptions{StaticBaseDir: "/data"})
+	require.NoError(t, err)
+
+	handlers := config.Apps.HTTP.Servers["cpm_server"].Routes[0].Handle
+	require.Equal(t, []Handler{FileServerHandler("/data/docs", []string{"index.html"}, false, false)}, handlers)
+}
+
+func TestGenerateConfig_StaticRootOutsideBase(t *testing.T) {
+	for _, root := range []string{"/etc", "/srv/../etc/passwd", "relative/site", ""} {
+		hosts := []models.ProxyHost{
+			{UUID: "uuid-bad", DomainNames: "bad.example.com", HostType: models.HostTypeStatic, Enabled: true, StaticRoot: root},
+		}
+		_, err := GenerateConfig(hosts, "/tmp/caddy-data", ConfigOptions{})
+		require.Error(t, err, root)
+	}
+}
+
+func TestValidateStaticRoot(t *testing.T) {
+	base := t.TempDir()
+	outside := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(base, "site"), 0o755))
+	require.NoError(t, os.Symlink(outside, filepath.Join(base, "escape")))
+
+	require.NoError(t, ValidateStaticRoot(filepath.Join(base, "site"), base))
+	require.NoError(t, ValidateStaticRoot(base, base))
+	// Roots that only exist inside the Caddy container are checked lexically
+	require.NoError(t, ValidateStaticRoot(filepath.Join(base, "missing"), base))
+
+	err := ValidateStaticRoot(filepath.Join(base, "..", "other"), base)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "outside the allowed base directory")
+
+	err = ValidateStaticRoot(filepath.Join(base, "escape"), base)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "resolves outside")
+
+	err = ValidateStaticRoot(base+"-sibling", base)
+	require.Error(t, err)
+}
+
+func TestValidate_FileServerRoot(t *testing.T) {
+	config := &Config{
+		Apps: Apps{
+			HTTP: &HTTPApp{
+				Servers: map[string]*Server{
+					"srv": {
+						Listen: []string{":80"},
+						Routes: []*Route{
+							{
+								Match:  []Match{{Host: []string{"test.com"}}},
+								Handle: []Handler{FileServerHandler("site", nil, false, false)},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	err := Validate(config)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "must be an absolute path")
+}
@@ -0,0 +1,234 @@
+package caddy
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/models"
+)
+
+const (
+	letsEncryptDirectory        = "https://acme-v02.api.letsencrypt.org/directory"
+	letsEncryptStagingDirectory = "https://acme-staging-v02.api.letsencrypt.org/directory"
+	zeroSSLDirectory            = "https://acme.zerossl.com/v2/DV90"
+)
+
+// Per-host certificate issuer overrides (ProxyHost.CertificateIssuer).
+const (
+	IssuerDefault            = ""
+	IssuerLetsEncrypt        = "letsencrypt"
+	IssuerLetsEncryptStaging = "letsencrypt_staging"
+	IssuerZeroSSL            = "zerossl"
+	IssuerCustom             = "custom"
+	IssuerInternal           = "internal"
+)
+
+// DefaultOnDemandAskURL is the CPM+ endpoint Caddy asks before issuing
+// on-demand certificates, when no public URL is configured.
+const DefaultOnDemandAskURL = "http://localhost:8080" + onDemandAskPath
+
+const onDemandAskPath = "/api/v1/tls/ask"
+
+// OnDemandAskURL returns the ask endpoint of the CPM+ instance at publicURL.
+func OnDemandAskURL(publicURL string) string {
+	return strings.TrimRight(publicURL, "/") + onDemandAskPath
+}
+
+// buildTLSApp assembles certificate automation policies from the global ACME
+// settings and any per-host issuer overrides. It returns nil when nothing
+// needs configuring so Caddy falls back to its own defaults.
+func buildTLSApp(hosts []models.ProxyHost, opts ConfigOptions) (*TLSApp, error) {
+	acme := opts.ACME
+	if err := validateACMEOptions(acme); err != nil {
+		return nil, err
+	}
+
+	policies := make([]*AutomationPolicy, 0)
+	managedSubjects := make([]string, 0)
+	onDemand := false
+
+	// Host-specific policies must come before the catch-all policy,
+	// Caddy uses the first policy whose subjects match.
+	for _, host := range hosts {
+		if !host.Enabled {
+			continue
+		}
+
+		if host.OnDemandTLS {
+			onDemand = true
+			continue
+		}
+
+		if host.CertificateIssuer == IssuerDefault {
+			managedSubjects = append(managedSubjects, hostSubjects(host)...)
+			continue
+		}
+
+		issuers, err := hostIssuers(host.CertificateIssuer, acme)
+		if err != nil {
+			return nil, fmt.Errorf("proxy host %s: %w", host.UUID, err)
+		}
+
+		policies = append(policies, &AutomationPolicy{
+			Subjects:   hostSubjects(host),
+			IssuersRaw: issuers,
+		})
+	}
+
+	defaults := defaultIssuers(acme)
+
+	if onDemand {
+		askURL := opts.OnDemand.AskURL
+		if askURL == "" {
+			askURL = DefaultOnDemandAskURL
+		}
+
+		// Known hosts keep getting their certificates at startup,
+		// everything else is issued on demand once the ask endpoint approves it.
+		if len(managedSubjects) > 0 {
+			policies = append(policies, &AutomationPolicy{
+				Subjects:   managedSubjects,
+				IssuersRaw: defaults,
+			})
+		}
+		policies = append(policies, &AutomationPolicy{
+			IssuersRaw: defaults,
+			OnDemand:   true,
+		})
+
+		return &TLSApp{
+			Automation: &AutomationConfig{
+				Policies: policies,
+				OnDemand: &OnDemandConfig{
+					Permission: &OnDemandPermission{
+						Module:   "http",
+						Endpoint: askURL,
+					},
+				},
+			},
+		}, nil
+	}
+
+	if len(defaults) > 0 {
+		policies = append(policies, &AutomationPolicy{IssuersRaw: defaults})
+	}
+
+	if len(policies) == 0 {
+		return nil, nil
+	}
+
+	return &TLSApp{
+		Automation: &AutomationConfig{
+			Policies: policies,
+		},
+	}, nil
+}
+
+// defaultIssuers returns the issuers used for every host without an override.
+func defaultIssuers(acme ACMEOptions) []interface{} {
+	switch {
+	case acme.Directory != "":
+		return []interface{}{customACMEIssuer(acme)}
+	case acme.Staging:
+		return []interface{}{acmeIssuer(acme.Email, letsEncryptStagingDirectory)}
+	case acme.Email != "":
+		return []interface{}{
+			acmeIssuer(acme.Email, ""),
+			zeroSSLIssuer(acme),
+		}
+	default:
+		return nil
+	}
+}
+
+// hostIssuers returns the issuers for a per-host override.
+func hostIssuers(issuer string, acme ACMEOptions) ([]interface{}, error) {
+	switch issuer {
+	case IssuerLetsEncrypt:
+		return []interface{}{acmeIssuer(acme.Email, letsEncryptDirectory)}, nil
+	case IssuerLetsEncryptStaging:
+		return []interface{}{acmeIssuer(acme.Email, letsEncryptStagingDirectory)}, nil
+	case IssuerZeroSSL:
+		return []interface{}{zeroSSLIssuer(acme)}, nil
+	case IssuerCustom:
+		if acme.Directory == "" {
+			return nil, fmt.Errorf("issuer %q requires a custom ACME directory", issuer)
+		}
+		return []interface{}{customACMEIssuer(acme)}, nil
+	case IssuerInternal:
+		return []interface{}{map[string]interface{}{"module": "internal"}}, nil
+	default:
+		return nil, fmt.Errorf("unknown certificate issuer %q", issuer)
+	}
+}
+
+// acmeIssuer creates an ACME issuer. An empty directory uses Caddy's default CA.
+func acmeIssuer(email, directory string) map[string]interface{} {
+	issuer := map[string]interface{}{
+		"module": "acme",
+	}
+	if email != "" {
+		issuer["email"] = email
+	}
+	if directory != "" {
+		issuer["ca"] = directory
+	}
+	return issuer
+}
+
+// zeroSSLIssuer creates a ZeroSSL issuer. External Account Binding belongs to
+// ZeroSSL unless a custom directory is set, which then owns the credentials.
+func zeroSSLIssuer(acme ACMEOptions) map[string]interface{} {
+	issuer := map[string]interface{}{
+		"module": "zerossl",
+	}
+	if acme.Email != "" {
+		issuer["email"] = acme.Email
+	}
+	if acme.EABKeyID != "" && acme.Directory == "" {
+		issuer["external_account"] = externalAccount(acme)
+	}
+	return issuer
+}
+
+// customACMEIssuer creates an ACME issuer for the custom directory,
+// including the trusted CA root and External Account Binding when set.
+func customACMEIssuer(acme ACMEOptions) map[string]interface{} {
+	issuer := acmeIssuer(acme.Email, acme.Directory)
+	if acme.CARoot != "" {
+		issuer["trusted_roots_pem_files"] = []string{acme.CARoot}
+	}
+	if acme.EABKeyID != "" {
+		issuer["external_account"] = externalAccount(acme)
+	}
+	return issuer
+}
+
+// externalAccount returns the External Account Binding credentials.
+func externalAccount(acme ACMEOptions) map[string]interface{} {
+	return map[string]interface{}{
+		"key_id":  acme.EABKeyID,
+		"mac_key": acme.EABMACKey,
+	}
+}
+
+// validateACMEOptions rejects incomplete or inconsistent ACME settings.
+func validateACMEOptions(acme ACMEOptions) error {
+	if acme.Directory != "" {
+		u, err := url.Parse(acme.Directory)
+		if err != nil || (u.Scheme != "https" && u.Scheme != "http") || u.Host == "" {
+			return fmt.Errorf("invalid ACME directory URL: %s", acme.Directory)
+		}
+	}
+
+	if (acme.EABKeyID == "") != (acme.EABMACKey == "") {
+		return fmt.Errorf("external account binding requires both key ID and HMAC key")
+	}
+
+	if acme.CARoot != "" && acme.Directory == "" {
+		return fmt.Errorf("ACME CA root requires a custom ACME directory")
+	}
+
+	return nil
+}
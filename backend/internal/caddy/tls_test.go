@@ -0,0 +1,314 @@
+package caddy
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/models"
+)
+
+func issuersJSON(t *testing.T, policy *AutomationPolicy) string {
+	t.Helper()
+	b, err := json.Marshal(policy.IssuersRaw)
+	require.NoError(t, err)
+	return string(b)
+}
+
+func TestGenerateConfig_DefaultIssuers(t *testing.T) {
+	config, err := GenerateConfig([]models.ProxyHost{}, "/tmp/caddy-data", ConfigOptions{ACME: ACMEOptions{Email: "admin@example.com"}})
+	require.NoError(t, err)
+	require.NotNil(t, config.Apps.TLS)
+	require.Len(t, config.Apps.TLS.Automation.Policies, 1)
+	require.JSONEq(t, `[
+		{"module": "acme", "email": "admin@example.com"},
+		{"module": "zerossl", "email": "admin@example.com"}
+	]`, issuersJSON(t, config.Apps.TLS.Automation.Policies[0]))
+}
+
+func TestGenerateConfig_NoACMESettings(t *testing.T) {
+	config, err := GenerateConfig([]models.ProxyHost{}, "/tmp/caddy-data", ConfigOptions{})
+	require.NoError(t, err)
+	require.Nil(t, config.Apps.TLS)
+}
+
+func TestGenerateConfig_ACMEStaging(t *testing.T) {
+	opts := ConfigOptions{ACME: ACMEOptions{Email: "admin@example.com", Staging: true}}
+	config, err := GenerateConfig([]models.ProxyHost{}, "/tmp/caddy-data", opts)
+	require.NoError(t, err)
+	require.Len(t, config.Apps.TLS.Automation.Policies, 1)
+	require.JSONEq(t, `[
+		{"module": "acme", "email": "admin@example.com", "ca": "https://acme-staging-v02.api.letsencrypt.org/directory"}
+	]`, issuersJSON(t, config.Apps.TLS.Automation.Policies[0]))
+}
+
+func TestGenerateConfig_CustomDirectoryWithEAB(t *testing.T) {
+	opts := ConfigOptions{ACME: ACMEOptions{
+		Email:     "admin@example.com",
+		Directory: "https://ca.internal:9000/acme/acme/directory",
+		CARoot:    "/certs/root_ca.crt",
+		EABKeyID:  "kid-123",
+		EABMACKey: "c2VjcmV0",
+	}}
+	config, err := GenerateConfig([]models.ProxyHost{}, "/tmp/caddy-data", opts)
+	require.NoError(t, err)
+	require.Len(t, config.Apps.TLS.Automation.Policies, 1)
+	require.JSONEq(t, `[{
+		"module": "acme",
+		"email": "admin@example.com",
+		"ca": "https://ca.internal:9000/acme/acme/directory",
+		"trusted_roots_pem_files": ["/certs/root_ca.crt"],
+		"external_account": {"key_id": "kid-123", "mac_key": "c2VjcmV0"}
+	}]`, issuersJSON(t, config.Apps.TLS.Automation.Policies[0]))
+}
+
+func TestGenerateConfig_ZeroSSLWithEAB(t *testing.T) {
+	hosts := []models.ProxyHost{
+		{UUID: "uuid-zerossl", DomainNames: "z.example.com", ForwardHost: "app", ForwardPort: 80, Enabled: true, CertificateIssuer: IssuerZeroSSL},
+	}
+	opts := ConfigOptions{ACME: ACMEOptions{Email: "admin@example.com", EABKeyID: "kid-123", EABMACKey: "c2VjcmV0"}}
+	config, err := GenerateConfig(hosts, "/tmp/caddy-data", opts)
+	require.NoError(t, err)
+
+	policies := config.Apps.TLS.Automation.Policies
+	require.Len(t, policies, 2)
+	require.JSONEq(t, `[{
+		"module": "zerossl",
+		"email": "admin@example.com",
+		"external_account": {"key_id": "kid-123", "mac_key": "c2VjcmV0"}
+	}]`, issuersJSON(t, policies[0]))
+
+	// The default Let's Encrypt issuer never gets the ZeroSSL credentials
+	require.JSONEq(t, `[
+		{"module": "acme", "email": "admin@example.com"},
+		{"module": "zerossl", "email": "admin@example.com", "external_account": {"key_id": "kid-123", "mac_key": "c2VjcmV0"}}
+	]`, issuersJSON(t, policies[1]))
+}
+
+func TestGenerateConfig_PerHostIssuerOverride(t *testing.T) {
+	hosts := []models.ProxyHost{
+		{
+			UUID:              "uuid-internal",
+			DomainNames:       "intranet.example.com, wiki.example.com",
+			ForwardHost:       "app",
+			ForwardPort:       8080,
+			Enabled:           true,
+			CertificateIssuer: IssuerInternal,
+		},
+		{
+			UUID:              "uuid-staging",
+			DomainNames:       "test.example.com",
+			ForwardHost:       "app",
+			ForwardPort:       8081,
+			Enabled:           true,
+			CertificateIssuer: IssuerLetsEncryptStaging,
+		},
+		{
+			UUID:              "uuid-disabled",
+			DomainNames:       "off.example.com",
+			ForwardHost:       "app",
+			ForwardPort:       8082,
+			Enabled:           false,
+			CertificateIssuer: IssuerZeroSSL,
+		},
+	}
+
+	config, err := GenerateConfig(hosts, "/tmp/caddy-data", ConfigOptions{ACME: ACMEOptions{Email: "admin@example.com"}})
+	require.NoError(t, err)
+
+	policies := config.Apps.TLS.Automation.Policies
+	require.Len(t, policies, 3)
+
+	require.Equal(t, []string{"intranet.example.com", "wiki.example.com"}, policies[0].Subjects)
+	require.JSONEq(t, `[{"module": "internal"}]`, issuersJSON(t, policies[0]))
+
+	require.Equal(t, []string{"test.example.com"}, policies[1].Subjects)
+	require.JSONEq(t, `[
+		{"module": "acme", "email": "admin@example.com", "ca": "https://acme-staging-v02.api.letsencrypt.org/directory"}
+	]`, issuersJSON(t, policies[1]))
+
+	// Catch-all default policy comes last
+	require.Empty(t, policies[2].Subjects)
+	require.Len(t, policies[2].IssuersRaw, 2)
+}
+
+func TestGenerateConfig_InvalidACMESettings(t *testing.T) {
+	tests := []struct {
+		name string
+		opts ACMEOptions
+		want string
+	}{
+		{"bad directory", ACMEOptions{Directory: "not a url"}, "invalid ACME directory"},
+		{"partial EAB", ACMEOptions{Directory: "https://ca.example.com/dir", EABKeyID: "kid"}, "both key ID and HMAC key"},
+		{"CA root without directory", ACMEOptions{CARoot: "/certs/root.crt"}, "requires a custom ACME directory"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := GenerateConfig([]models.ProxyHost{}, "/tmp/caddy-data", ConfigOptions{ACME: tt.opts})
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tt.want)
+		})
+	}
+}
+
+func TestGenerateConfig_InvalidHostIssuer(t *testing.T) {
+	hosts := []models.ProxyHost{
+		{UUID: "uuid-custom", DomainNames: "a.example.com", ForwardHost: "app", ForwardPort: 80, Enabled: true, CertificateIssuer: IssuerCustom},
+	}
+	_, err := GenerateConfig(hosts, "/tmp/caddy-data", ConfigOptions{})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "requires a custom ACME directory")
+
+	hosts[0].CertificateIssuer = "bogus"
+	_, err = GenerateConfig(hosts, "/tmp/caddy-data", ConfigOptions{})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "unknown certificate issuer")
+}
+
+func TestManager_LoadConfigOptions(t *testing.T) {
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.Setting{}))
+
+	db.Create(&models.Setting{Key: "caddy.acme_email", Value: "ops@example.com"})
+	db.Create(&models.Setting{Key: "caddy.acme_staging", Value: "true"})
+	db.Create(&models.Setting{Key: "caddy.acme_directory", Value: "https://ca.internal/directory"})
+	db.Create(&models.Setting{Key: "caddy.acme_ca_root", Value: "/certs/root.crt"})
+	db.Create(&models.Setting{Key: "caddy.acme_eab_key_id", Value: "kid"})
+	db.Create(&models.Setting{Key: "caddy.acme_eab_hmac_key", Value: "hmac"})
+	db.Create(&models.Setting{Key: "caddy.server_read_timeout", Value: "30s"})
+	db.Create(&models.Setting{Key: "caddy.server_idle_timeout", Value: "5m"})
+	db.Create(&models.Setting{Key: "caddy.geoip_database", Value: "/data/geoip/GeoLite2-Country.mmdb"})
+	db.Create(&models.Setting{Key: "crowdsec.api_url", Value: "http://crowdsec:8080"})
+	db.Create(&models.Setting{Key: "crowdsec.bouncer_key", Value: "bouncer-key"})
+
+	manager := NewManager(nil, db, t.TempDir())
+	opts := manager.loadConfigOptions()
+
+	require.Equal(t, ACMEOptions{
+		Email:     "ops@example.com",
+		Staging:   true,
+		Directory: "https://ca.internal/directory",
+		CARoot:    "/certs/root.crt",
+		EABKeyID:  "kid",
+		EABMACKey: "hmac",
+	}, opts.ACME)
+	require.Equal(t, ServerOptions{ReadTimeout: "30s", IdleTimeout: "5m"}, opts.Server)
+	require.Equal(t, "/data/geoip/GeoLite2-Country.mmdb", opts.GeoIPDatabase)
+	require.Equal(t, CrowdSecOptions{APIURL: "http://crowdsec:8080", APIKey: "bouncer-key"}, opts.CrowdSec)
+}
+
+func TestManager_OnDemandAskURL(t *testing.T) {
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.Setting{}))
+
+	manager := NewManager(nil, db, t.TempDir())
+	require.Empty(t, manager.loadConfigOptions().OnDemand.AskURL)
+
+	manager.SetPublicURL("https://cpm.example.com:9443/")
+	require.Equal(t, "https://cpm.example.com:9443/api/v1/tls/ask", manager.loadConfigOptions().OnDemand.AskURL)
+
+	// An explicit setting wins over the derived URL
+	db.Create(&models.Setting{Key: "caddy.on_demand_ask_url", Value: "http://cpm.internal/api/v1/tls/ask"})
+	require.Equal(t, "http://cpm.internal/api/v1/tls/ask", manager.loadConfigOptions().OnDemand.AskURL)
+}
+
+func TestGenerateConfig_OnDemandTLS(t *testing.T) {
+	hosts := []models.ProxyHost{
+		{
+			UUID:        "uuid-saas",
+			DomainNames: "app.saas.com",
+			ForwardHost: "saas",
+			ForwardPort: 3000,
+			Enabled:     true,
+			OnDemandTLS: true,
+		},
+		{
+			UUID:        "uuid-admin",
+			DomainNames: "admin.saas.com",
+			ForwardHost: "admin",
+			ForwardPort: 4000,
+			Enabled:     true,
+		},
+	}
+
+	opts := ConfigOptions{
+		ACME:     ACMEOptions{Email: "admin@example.com"},
+		OnDemand: OnDemandOptions{AskURL: "http://127.0.0.1:8080/api/v1/tls/ask"},
+	}
+	config, err := GenerateConfig(hosts, "/tmp/caddy-data", opts)
+	require.NoError(t, err)
+	require.NoError(t, Validate(config))
+
+	// Catch-all route has no host matcher and comes last
+	routes := config.Apps.HTTP.Servers["cpm_server"].Routes
+	require.Len(t, routes, 2)
+	require.Equal(t, []string{"admin.saas.com"}, routes[0].Match[0].Host)
+	require.Empty(t, routes[1].Match)
+
+	automation := config.Apps.TLS.Automation
+	require.Len(t, automation.Policies, 2)
+	require.Equal(t, []string{"admin.saas.com"}, automation.Policies[0].Subjects)
+	require.False(t, automation.Policies[0].OnDemand)
+	require.Empty(t, automation.Policies[1].Subjects)
+	require.True(t, automation.Policies[1].OnDemand)
+	require.Len(t, automation.Policies[1].IssuersRaw, 2)
+
+	require.NotNil(t, automation.OnDemand)
+	require.Equal(t, "http", automation.OnDemand.Permission.Module)
+	require.Equal(t, "http://127.0.0.1:8080/api/v1/tls/ask", automation.OnDemand.Permission.Endpoint)
+}
+
+func TestGenerateConfig_OnDemandTLS_DefaultAskURL(t *testing.T) {
+	hosts := []models.ProxyHost{
+		{UUID: "uuid-saas", DomainNames: "app.saas.com", ForwardHost: "saas", ForwardPort: 3000, Enabled: true, OnDemandTLS: true},
+	}
+
+	config, err := GenerateConfig(hosts, "/tmp/caddy-data", ConfigOptions{})
+	require.NoError(t, err)
+	require.Equal(t, DefaultOnDemandAskURL, config.Apps.TLS.Automation.OnDemand.Permission.Endpoint)
+	require.Len(t, config.Apps.TLS.Automation.Policies, 1)
+	require.True(t, config.Apps.TLS.Automation.Policies[0].OnDemand)
+}
+
+func TestGenerateConfig_OnDemandTLS_OnlyOneCatchAll(t *testing.T) {
+	hosts := []models.ProxyHost{
+		{UUID: "uuid-1", DomainNames: "a.saas.com", ForwardHost: "saas", ForwardPort: 3000, Enabled: true, OnDemandTLS: true},
+		{UUID: "uuid-2", DomainNames: "b.saas.com", ForwardHost: "saas", ForwardPort: 3001, Enabled: true, OnDemandTLS: true},
+	}
+
+	_, err := GenerateConfig(hosts, "/tmp/caddy-data", ConfigOptions{})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "only one on-demand TLS host")
+}
+
+func TestValidate_OnDemandWithoutPermission(t *testing.T) {
+	config := &Config{
+		Apps: Apps{
+			TLS: &TLSApp{
+				Automation: &AutomationConfig{
+					Policies: []*AutomationPolicy{{OnDemand: true}},
+				},
+			},
+		},
+	}
+
+	err := Validate(config)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "without a permission endpoint")
+
+	config.Apps.TLS.Automation.OnDemand = &OnDemandConfig{
+		Permission: &OnDemandPermission{Module: "http", Endpoint: "not-a-url"},
+	}
+	err = Validate(config)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "invalid on-demand permission endpoint")
+}
@@ -1,5 +1,14 @@
 package caddy
 
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"time"
+
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/models"
+)
+
 // Config represents Caddy's top-level JSON configuration structure.
 // Reference: https://caddyserver.com/docs/json/
 type Config struct {
@@ -51,8 +60,16 @@ type Storage struct {
 
 // Apps contains all Caddy app modules.
 type Apps struct {
-	HTTP *HTTPApp `json:"http,omitempty"`
-	TLS  *TLSApp  `json:"tls,omitempty"`
+	HTTP     *HTTPApp     `json:"http,omitempty"`
+	TLS      *TLSApp      `json:"tls,omitempty"`
+	CrowdSec *CrowdSecApp `json:"crowdsec,omitempty"`
+}
+
+// CrowdSecApp configures the caddy-crowdsec-bouncer app, which streams
+// decisions from a CrowdSec Local API for the crowdsec handler.
+type CrowdSecApp struct {
+	APIURL string `json:"api_url"`
+	APIKey string `json:"api_key"`
 }
 
 // HTTPApp configures the HTTP app.
@@ -62,10 +79,43 @@ type HTTPApp struct {
 
 // Server represents an HTTP server instance.
 type Server struct {
-	Listen    []string         `json:"listen"`
-	Routes    []*Route         `json:"routes"`
-	AutoHTTPS *AutoHTTPSConfig `json:"automatic_https,omitempty"`
-	Logs      *ServerLogs      `json:"logs,omitempty"`
+	Listen            []string         `json:"listen"`
+	Routes            []*Route         `json:"routes"`
+	AutoHTTPS         *AutoHTTPSConfig `json:"automatic_https,omitempty"`
+	Logs              *ServerLogs      `json:"logs,omitempty"`
+	ReadTimeout       Duration         `json:"read_timeout,omitempty"`
+	ReadHeaderTimeout Duration         `json:"read_header_timeout,omitempty"`
+	WriteTimeout      Duration         `json:"write_timeout,omitempty"`
+	IdleTimeout       Duration         `json:"idle_timeout,omitempty"`
+}
+
+// Duration is a time.Duration that encodes as a duration string ("30s")
+// and decodes from either a string or integer nanoseconds, as Caddy does.
+type Duration time.Duration
+
+// MarshalJSON encodes the duration as a string.
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(time.Duration(d).String())
+}
+
+// UnmarshalJSON decodes a duration string or integer nanoseconds.
+func (d *Duration) UnmarshalJSON(b []byte) error {
+	var s string
+	if err := json.Unmarshal(b, &s); err == nil {
+		parsed, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("invalid duration %q: %w", s, err)
+		}
+		*d = Duration(parsed)
+		return nil
+	}
+
+	var ns int64
+	if err := json.Unmarshal(b, &ns); err != nil {
+		return fmt.Errorf("invalid duration %s", string(b))
+	}
+	*d = Duration(ns)
+	return nil
 }
 
 // AutoHTTPSConfig controls automatic HTTPS behavior.
@@ -82,15 +132,99 @@ type ServerLogs struct {
 
 // Route represents an HTTP route (matcher + handlers).
 type Route struct {
+	ID       string    `json:"@id,omitempty"` // Addresses the route through the admin API's /id/ endpoint
 	Match    []Match   `json:"match,omitempty"`
 	Handle   []Handler `json:"handle"`
 	Terminal bool      `json:"terminal,omitempty"`
+
+	// Raw is the route's original JSON when it uses fields Route doesn't
+	// model, such as plugin matchers. It is written out instead of the
+	// fields above.
+	Raw json.RawMessage `json:"-"`
+}
+
+// MarshalJSON writes routes with Raw set verbatim.
+func (r Route) MarshalJSON() ([]byte, error) {
+	if r.Raw != nil {
+		return r.Raw, nil
+	}
+	type route Route
+	return json.Marshal(route(r))
+}
+
+// UnmarshalJSON decodes a route, keeping its original JSON in Raw when
+// the fields of Route can't represent all of it.
+func (r *Route) UnmarshalJSON(data []byte) error {
+	type route Route
+	var decoded route
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		return err
+	}
+	*r = Route(decoded)
+	r.Raw = nil
+
+	original, err := canonicalJSON(data)
+	if err != nil {
+		return err
+	}
+	modeled, err := json.Marshal(r)
+	if err != nil {
+		return err
+	}
+	if modeled, err = canonicalJSON(modeled); err != nil {
+		return err
+	}
+	if string(original) != string(modeled) {
+		r.Raw = original
+	}
+	return nil
+}
+
+// canonicalJSON re-encodes data with sorted keys and no whitespace.
+func canonicalJSON(data []byte) ([]byte, error) {
+	var generic interface{}
+	if err := json.Unmarshal(data, &generic); err != nil {
+		return nil, err
+	}
+	return json.Marshal(generic)
 }
 
 // Match represents a request matcher.
 type Match struct {
-	Host []string `json:"host,omitempty"`
-	Path []string `json:"path,omitempty"`
+	Host       []string            `json:"host,omitempty"`
+	Path       []string            `json:"path,omitempty"`
+	PathRegexp *MatchRegexp        `json:"path_regexp,omitempty"`
+	Method     []string            `json:"method,omitempty"`
+	Header     map[string][]string `json:"header,omitempty"`
+	Query      map[string][]string `json:"query,omitempty"`
+	RemoteIP   *MatchRemoteIP      `json:"remote_ip,omitempty"`
+	Not        []Match             `json:"not,omitempty"`
+	File       *MatchFile          `json:"file,omitempty"`
+	// MaxMind requires the caddy-maxmind-geolocation plugin.
+	MaxMind *MatchMaxMind `json:"maxmind_geolocation,omitempty"`
+}
+
+// MatchMaxMind matches the client's country looked up in a MaxMind database.
+type MatchMaxMind struct {
+	DBPath         string   `json:"db_path"`
+	AllowCountries []string `json:"allow_countries,omitempty"`
+}
+
+// MatchFile matches requests whose path resolves to an existing file.
+type MatchFile struct {
+	Root     string   `json:"root,omitempty"`
+	TryFiles []string `json:"try_files,omitempty"`
+}
+
+// MatchRemoteIP matches the client's IP address against CIDR ranges.
+type MatchRemoteIP struct {
+	Ranges []string `json:"ranges"`
+}
+
+// MatchRegexp is a regular expression matcher.
+type MatchRegexp struct {
+	Name    string `json:"name,omitempty"`
+	Pattern string `json:"pattern"`
 }
 
 // Handler is the interface for all handler types.
@@ -121,6 +255,91 @@ func ReverseProxyHandler(dial string, enableWS bool) Handler {
 	return h
 }
 
+// SubrouteHandler creates a handler that evaluates its own list of routes.
+func SubrouteHandler(routes []*Route) Handler {
+	return Handler{
+		"handler": "subroute",
+		"routes":  routes,
+	}
+}
+
+// CrowdSecHandler creates a handler that blocks clients with an active
+// CrowdSec decision. It requires the crowdsec app.
+func CrowdSecHandler() Handler {
+	return Handler{
+		"handler": "crowdsec",
+	}
+}
+
+// RequestBodyHandler creates a handler that limits the request body size in bytes.
+func RequestBodyHandler(maxSize int64) Handler {
+	return Handler{
+		"handler":  "request_body",
+		"max_size": maxSize,
+	}
+}
+
+// StripPrefixHandler creates a rewrite handler that removes a path prefix.
+func StripPrefixHandler(prefix string) Handler {
+	return Handler{
+		"handler":           "rewrite",
+		"strip_path_prefix": prefix,
+	}
+}
+
+// RewriteURIHandler creates a rewrite handler that replaces the request URI.
+func RewriteURIHandler(uri string) Handler {
+	return Handler{
+		"handler": "rewrite",
+		"uri":     uri,
+	}
+}
+
+// FileServerHandler creates a file_server handler for root.
+func FileServerHandler(root string, indexNames []string, browse, precompressed bool) Handler {
+	h := Handler{
+		"handler":     "file_server",
+		"root":        root,
+		"index_names": indexNames,
+	}
+
+	if browse {
+		h["browse"] = map[string]interface{}{}
+	}
+
+	if precompressed {
+		h["precompressed"] = map[string]interface{}{
+			"br":   map[string]interface{}{},
+			"zstd": map[string]interface{}{},
+			"gzip": map[string]interface{}{},
+		}
+		h["precompressed_order"] = []string{"br", "zstd", "gzip"}
+	}
+
+	return h
+}
+
+// PathRegexpHandler creates a rewrite handler that replaces regex matches in the path.
+func PathRegexpHandler(find, replace string) Handler {
+	return Handler{
+		"handler": "rewrite",
+		"path_regexp": []map[string]interface{}{
+			{"find": find, "replace": replace},
+		},
+	}
+}
+
+// RedirectHandler creates a static_response handler that redirects to location.
+func RedirectHandler(location string, status int) Handler {
+	return Handler{
+		"handler": "static_response",
+		"headers": map[string][]string{
+			"Location": {location},
+		},
+		"status_code": status,
+	}
+}
+
 // HeaderHandler creates a handler that sets HTTP response headers.
 func HeaderHandler(headers map[string][]string) Handler {
 	return Handler{
@@ -131,6 +350,78 @@ func HeaderHandler(headers map[string][]string) Handler {
 	}
 }
 
+// CustomHeadersHandler creates a handler that sets request and response headers.
+// Response headers with no values are deleted.
+func CustomHeadersHandler(request, response map[string][]string) Handler {
+	h := Handler{
+		"handler": "headers",
+	}
+
+	if len(request) > 0 {
+		h["request"] = map[string]interface{}{
+			"set": request,
+		}
+	}
+
+	set := make(map[string][]string)
+	var del []string
+	for name, values := range response {
+		if len(values) == 0 {
+			del = append(del, name)
+			continue
+		}
+		set[name] = values
+	}
+	if len(set) > 0 || len(del) > 0 {
+		ops := map[string]interface{}{}
+		if len(set) > 0 {
+			ops["set"] = set
+		}
+		if len(del) > 0 {
+			sort.Strings(del)
+			ops["delete"] = del
+		}
+		h["response"] = ops
+	}
+
+	return h
+}
+
+// EncodeHandler creates a handler that compresses responses with zstd or gzip.
+func EncodeHandler() Handler {
+	return Handler{
+		"handler": "encode",
+		"encodings": map[string]interface{}{
+			"zstd": map[string]interface{}{},
+			"gzip": map[string]interface{}{},
+		},
+		"prefer": []string{"zstd", "gzip"},
+	}
+}
+
+// StatusHandler creates a static_response handler that only sets a status code.
+func StatusHandler(status int) Handler {
+	return Handler{
+		"handler":     "static_response",
+		"status_code": status,
+	}
+}
+
+// BasicAuthHandler creates an authentication handler for bcrypt-hashed accounts.
+func BasicAuthHandler(accounts []map[string]string) Handler {
+	return Handler{
+		"handler": "authentication",
+		"providers": map[string]interface{}{
+			"http_basic": map[string]interface{}{
+				"accounts": accounts,
+				"hash": map[string]interface{}{
+					"algorithm": "bcrypt",
+				},
+			},
+		},
+	}
+}
+
 // BlockExploitsHandler creates a handler that blocks common exploits.
 // This uses Caddy's request matchers to block malicious patterns.
 func BlockExploitsHandler() Handler {
@@ -149,10 +440,66 @@ type TLSApp struct {
 // AutomationConfig controls certificate automation.
 type AutomationConfig struct {
 	Policies []*AutomationPolicy `json:"policies,omitempty"`
+	OnDemand *OnDemandConfig     `json:"on_demand,omitempty"`
 }
 
 // AutomationPolicy defines certificate management for specific domains.
 type AutomationPolicy struct {
 	Subjects   []string      `json:"subjects,omitempty"`
 	IssuersRaw []interface{} `json:"issuers,omitempty"`
+	OnDemand   bool          `json:"on_demand,omitempty"`
+}
+
+// OnDemandConfig configures on-demand certificate issuance.
+type OnDemandConfig struct {
+	Permission *OnDemandPermission `json:"permission,omitempty"`
+}
+
+// OnDemandPermission asks an HTTP endpoint whether a certificate may be obtained.
+type OnDemandPermission struct {
+	Module   string `json:"module"`
+	Endpoint string `json:"endpoint"`
+}
+
+// ACMEOptions holds the global ACME settings used to build certificate issuers.
+type ACMEOptions struct {
+	Email     string
+	Staging   bool   // Use the Let's Encrypt staging directory
+	Directory string // Custom ACME directory URL (e.g. an internal step-ca)
+	CARoot    string // PEM file trusted when talking to the custom directory
+	EABKeyID  string // External Account Binding key ID
+	EABMACKey string // External Account Binding HMAC key (base64url)
+}
+
+// OnDemandOptions configures on-demand TLS for catch-all hosts.
+type OnDemandOptions struct {
+	AskURL string // Endpoint Caddy asks before issuing a certificate
+}
+
+// ServerOptions holds server-level timeouts as duration strings (e.g. "30s").
+type ServerOptions struct {
+	ReadTimeout       string
+	ReadHeaderTimeout string
+	WriteTimeout      string
+	IdleTimeout       string
+}
+
+// ConfigOptions carries the global settings that shape the generated config.
+type ConfigOptions struct {
+	ACME     ACMEOptions
+	OnDemand OnDemandOptions
+	Server   ServerOptions
+	// StaticBaseDir is the directory static host roots must be inside, DefaultStaticBaseDir when empty.
+	StaticBaseDir string
+	// GeoIPDatabase is the MaxMind .mmdb file used by country access rules.
+	GeoIPDatabase string
+	CrowdSec      CrowdSecOptions
+	// RawRoutes are added verbatim after the proxy host routes.
+	RawRoutes []models.RawRoute
+}
+
+// CrowdSecOptions are the CrowdSec Local API settings used by the bouncer.
+type CrowdSecOptions struct {
+	APIURL string // e.g. http://crowdsec:8080
+	APIKey string // Bouncer key from cscli bouncers add
 }
@@ -3,9 +3,15 @@ package caddy
 import (
 	"encoding/json"
 	"fmt"
+	"math"
 	"net"
+	"net/url"
+	"path/filepath"
+	"reflect"
+	"regexp"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // Validate performs pre-flight validation on a Caddy config before applying it.
@@ -14,6 +20,16 @@ func Validate(cfg *Config) error {
 		return fmt.Errorf("config cannot be nil")
 	}
 
+	if err := validateTLS(cfg.Apps.TLS); err != nil {
+		return err
+	}
+
+	if cs := cfg.Apps.CrowdSec; cs != nil {
+		if u, err := url.Parse(cs.APIURL); err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid CrowdSec LAPI URL %q", cs.APIURL)
+		}
+	}
+
 	if cfg.Apps.HTTP == nil {
 		return nil // Empty config is valid
 	}
@@ -26,6 +42,10 @@ func Validate(cfg *Config) error {
 			return fmt.Errorf("server %s has no listen addresses", serverName)
 		}
 
+		if err := validateServerTimeouts(server); err != nil {
+			return fmt.Errorf("server %s: %w", serverName, err)
+		}
+
 		// Validate listen addresses
 		for _, addr := range server.Listen {
 			if err := validateListenAddr(addr); err != nil {
@@ -39,6 +59,10 @@ func Validate(cfg *Config) error {
 				return fmt.Errorf("invalid route %d in server %s: %w", i, serverName, err)
 			}
 		}
+
+		if err := validateShadowing(server.Routes); err != nil {
+			return fmt.Errorf("server %s: %w", serverName, err)
+		}
 	}
 
 	// Validate JSON marshalling works
@@ -49,6 +73,32 @@ func Validate(cfg *Config) error {
 	return nil
 }
 
+func validateTLS(tlsApp *TLSApp) error {
+	if tlsApp == nil || tlsApp.Automation == nil {
+		return nil
+	}
+
+	for i, policy := range tlsApp.Automation.Policies {
+		if !policy.OnDemand {
+			continue
+		}
+		// Without a permission check anyone could make Caddy request certificates
+		if tlsApp.Automation.OnDemand == nil || tlsApp.Automation.OnDemand.Permission == nil {
+			return fmt.Errorf("automation policy %d uses on-demand TLS without a permission endpoint", i)
+		}
+	}
+
+	if tlsApp.Automation.OnDemand != nil && tlsApp.Automation.OnDemand.Permission != nil {
+		endpoint := tlsApp.Automation.OnDemand.Permission.Endpoint
+		u, err := url.Parse(endpoint)
+		if err != nil || u.Scheme == "" || u.Host == "" {
+			return fmt.Errorf("invalid on-demand permission endpoint: %s", endpoint)
+		}
+	}
+
+	return nil
+}
+
 func validateListenAddr(addr string) error {
 	// Strip network type prefix if present (tcp/, udp/)
 	if idx := strings.Index(addr, "/"); idx != -1 {
@@ -83,13 +133,24 @@ func validateRoute(route *Route, seenHosts map[string]bool) error {
 		return fmt.Errorf("route has no handlers")
 	}
 
-	// Check for duplicate host matchers
+	// Check for duplicate host matchers; path-scoped routes such as
+	// locations may share a host with the host's main route.
 	for _, match := range route.Match {
+		if match.PathRegexp != nil {
+			if _, err := regexp.Compile(match.PathRegexp.Pattern); err != nil {
+				return fmt.Errorf("invalid path_regexp matcher: %w", err)
+			}
+		}
+
+		conditions := match
+		conditions.Host = nil
+		conditionsJSON, _ := json.Marshal(conditions)
 		for _, host := range match.Host {
-			if seenHosts[host] {
+			key := host + " " + string(conditionsJSON)
+			if seenHosts[key] {
 				return fmt.Errorf("duplicate host matcher: %s", host)
 			}
-			seenHosts[host] = true
+			seenHosts[key] = true
 		}
 	}
 
@@ -112,7 +173,15 @@ func validateHandler(handler Handler) error {
 	switch handlerType {
 	case "reverse_proxy":
 		return validateReverseProxy(handler)
-	case "file_server", "static_response":
+	case "subroute":
+		return validateSubroute(handler)
+	case "request_body":
+		return validateRequestBody(handler)
+	case "rewrite":
+		return validateRewrite(handler)
+	case "file_server":
+		return validateFileServer(handler)
+	case "static_response":
 		return nil // Accept other common handlers
 	default:
 		// Unknown handlers are allowed (Caddy is extensible)
@@ -120,9 +189,32 @@ func validateHandler(handler Handler) error {
 	}
 }
 
+func validateSubroute(handler Handler) error {
+	routes, ok := handler["routes"].([]*Route)
+	if !ok {
+		return nil // Raw subroutes are passed through as-is
+	}
+
+	for i, route := range routes {
+		if len(route.Handle) == 0 {
+			return fmt.Errorf("subroute %d has no handlers", i)
+		}
+		for j, h := range route.Handle {
+			if err := validateHandler(h); err != nil {
+				return fmt.Errorf("subroute %d handler %d: %w", i, j, err)
+			}
+		}
+	}
+
+	return nil
+}
+
 func validateReverseProxy(handler Handler) error {
-	upstreams, ok := handler["upstreams"].([]map[string]interface{})
+	upstreams, ok := objects(handler["upstreams"])
 	if !ok {
+		if _, dynamic := handler["dynamic_upstreams"]; dynamic {
+			return validateTransport(handler["transport"])
+		}
 		return fmt.Errorf("reverse_proxy missing upstreams")
 	}
 
@@ -130,11 +222,18 @@ func validateReverseProxy(handler Handler) error {
 		return fmt.Errorf("reverse_proxy has no upstreams")
 	}
 
+	if err := validateTransport(handler["transport"]); err != nil {
+		return err
+	}
+
 	for i, upstream := range upstreams {
 		dial, ok := upstream["dial"].(string)
 		if !ok || dial == "" {
 			return fmt.Errorf("upstream %d missing dial address", i)
 		}
+		if strings.HasPrefix(dial, "unix/") {
+			continue // Adopted routes may proxy to a Unix socket
+		}
 
 		// Validate dial address format (host:port)
 		if _, _, err := net.SplitHostPort(dial); err != nil {
@@ -144,3 +243,265 @@ func validateReverseProxy(handler Handler) error {
 
 	return nil
 }
+
+// validateShadowing rejects routes that can never match because an earlier
+// terminal route matches every request they would, such as a location for
+// /api/v2 placed after one for /api.
+func validateShadowing(routes []*Route) error {
+	for i, later := range routes {
+		for j := 0; j < i; j++ {
+			earlier := routes[j]
+			if !earlier.Terminal || !routeCovers(earlier, later) {
+				continue
+			}
+			return fmt.Errorf("route %d (%s) is shadowed by route %d (%s)", i, describeRoute(later), j, describeRoute(earlier))
+		}
+	}
+	return nil
+}
+
+// routeCovers reports whether every request matched by b is also matched by a.
+func routeCovers(a, b *Route) bool {
+	if len(a.Match) == 0 {
+		return true
+	}
+	if len(b.Match) == 0 {
+		return false
+	}
+
+	for _, bm := range b.Match {
+		covered := false
+		for _, am := range a.Match {
+			if matchCovers(am, bm) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			return false
+		}
+	}
+	return true
+}
+
+// matchCovers reports whether matcher set a matches every request b matches.
+func matchCovers(a, b Match) bool {
+	return listCovers(a.Host, b.Host, func(x, y string) bool { return strings.EqualFold(x, y) }) &&
+		pathCovers(a, b) &&
+		listCovers(a.Method, b.Method, func(x, y string) bool { return strings.EqualFold(x, y) }) &&
+		valuesCover(a.Header, b.Header) &&
+		valuesCover(a.Query, b.Query)
+}
+
+// listCovers reports whether allowed list a admits everything allowed list b admits.
+// An empty list allows everything.
+func listCovers(a, b []string, equal func(x, y string) bool) bool {
+	if len(a) == 0 {
+		return true
+	}
+	if len(b) == 0 {
+		return false
+	}
+	for _, y := range b {
+		found := false
+		for _, x := range a {
+			if equal(x, y) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+func pathCovers(a, b Match) bool {
+	if a.PathRegexp != nil && (b.PathRegexp == nil || a.PathRegexp.Pattern != b.PathRegexp.Pattern) {
+		return false
+	}
+	return listCovers(a.Path, b.Path, pathPatternCovers)
+}
+
+// pathPatternCovers reports whether path pattern a matches everything pattern b matches.
+// Only exact paths and trailing * prefixes are compared.
+func pathPatternCovers(a, b string) bool {
+	if a == b || a == "*" {
+		return true
+	}
+	if strings.HasSuffix(a, "*") && !strings.Contains(a[:len(a)-1], "*") {
+		return strings.HasPrefix(b, a[:len(a)-1])
+	}
+	return false
+}
+
+// valuesCover reports whether the header or query matcher a admits every request b admits.
+func valuesCover(a, b map[string][]string) bool {
+	for name, values := range a {
+		bValues, ok := b[name]
+		if !ok {
+			return false
+		}
+		if !listCovers(values, bValues, func(x, y string) bool { return x == y }) {
+			return false
+		}
+	}
+	return true
+}
+
+func describeRoute(route *Route) string {
+	if len(route.Match) == 0 {
+		return "catch-all"
+	}
+	m := route.Match[0]
+	parts := []string{strings.Join(m.Host, ",")}
+	if len(m.Path) > 0 {
+		parts = append(parts, strings.Join(m.Path, ","))
+	}
+	if m.PathRegexp != nil {
+		parts = append(parts, "~"+m.PathRegexp.Pattern)
+	}
+	if len(m.Method) > 0 {
+		parts = append(parts, strings.Join(m.Method, ","))
+	}
+	return strings.Join(parts, " ")
+}
+
+func validateServerTimeouts(server *Server) error {
+	timeouts := []struct {
+		name string
+		d    Duration
+	}{
+		{"read_timeout", server.ReadTimeout},
+		{"read_header_timeout", server.ReadHeaderTimeout},
+		{"write_timeout", server.WriteTimeout},
+		{"idle_timeout", server.IdleTimeout},
+	}
+
+	for _, t := range timeouts {
+		if t.d < 0 {
+			return fmt.Errorf("%s cannot be negative", t.name)
+		}
+	}
+
+	return nil
+}
+
+func validateFileServer(handler Handler) error {
+	root, _ := handler["root"].(string)
+	if root == "" || strings.HasPrefix(root, "{") {
+		return nil // Caddy falls back to the root variable or current directory
+	}
+	if !filepath.IsAbs(root) {
+		return fmt.Errorf("file_server root %s must be an absolute path", root)
+	}
+	return nil
+}
+
+func validateRequestBody(handler Handler) error {
+	maxSize, ok := integer(handler["max_size"])
+	if !ok || maxSize <= 0 {
+		return fmt.Errorf("request_body max_size must be a positive number of bytes")
+	}
+	return nil
+}
+
+// integer converts a whole number to int64, whether it was set in memory or
+// decoded from JSON (float64 or json.Number).
+func integer(v interface{}) (int64, bool) {
+	if n, ok := v.(json.Number); ok {
+		i, err := n.Int64()
+		return i, err == nil
+	}
+
+	rv := reflect.ValueOf(v)
+	switch rv.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return rv.Int(), true
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if rv.Uint() > math.MaxInt64 {
+			return 0, false
+		}
+		return int64(rv.Uint()), true
+	case reflect.Float32, reflect.Float64:
+		f := rv.Float()
+		if f != math.Trunc(f) || math.Abs(f) > math.MaxInt64 {
+			return 0, false
+		}
+		return int64(f), true
+	default:
+		return 0, false
+	}
+}
+
+// objects converts a list of JSON objects, whether it was built in memory
+// or decoded from JSON ([]interface{}), as adopted routes are.
+func objects(v interface{}) ([]map[string]interface{}, bool) {
+	switch list := v.(type) {
+	case []map[string]interface{}:
+		return list, true
+	case []interface{}:
+		result := make([]map[string]interface{}, 0, len(list))
+		for _, item := range list {
+			object, ok := item.(map[string]interface{})
+			if !ok {
+				return nil, false
+			}
+			result = append(result, object)
+		}
+		return result, true
+	default:
+		return nil, false
+	}
+}
+
+func validateRewrite(handler Handler) error {
+	rewrites, ok := objects(handler["path_regexp"])
+	if !ok {
+		return nil
+	}
+
+	for i, rewrite := range rewrites {
+		find, _ := rewrite["find"].(string)
+		if find == "" {
+			return fmt.Errorf("rewrite path_regexp %d missing find pattern", i)
+		}
+		if _, err := regexp.Compile(find); err != nil {
+			return fmt.Errorf("rewrite path_regexp %d has invalid pattern: %w", i, err)
+		}
+	}
+
+	return nil
+}
+
+func validateTransport(raw interface{}) error {
+	transport, ok := raw.(map[string]interface{})
+	if !ok {
+		return nil // No transport or raw passthrough
+	}
+
+	durations := map[string]interface{}{
+		"response_header_timeout": transport["response_header_timeout"],
+	}
+	if keepAlive, ok := transport["keep_alive"].(map[string]interface{}); ok {
+		durations["keep_alive.idle_timeout"] = keepAlive["idle_timeout"]
+		durations["keep_alive.probe_interval"] = keepAlive["probe_interval"]
+	}
+
+	for name, value := range durations {
+		s, ok := value.(string)
+		if !ok {
+			continue
+		}
+		d, err := time.ParseDuration(s)
+		if err != nil {
+			return fmt.Errorf("invalid transport %s %q: %w", name, s, err)
+		}
+		if d <= 0 {
+			return fmt.Errorf("transport %s must be positive", name)
+		}
+	}
+
+	return nil
+}
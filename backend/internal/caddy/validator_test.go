@@ -1,6 +1,7 @@
 package caddy
 
 import (
+	"encoding/json"
 	"testing"
 
 	"github.com/stretchr/testify/require"
@@ -25,7 +26,7 @@ func TestValidate_ValidConfig(t *testing.T) {
 		},
 	}
 
-	config, _ := GenerateConfig(hosts, "/tmp/caddy-data", "admin@example.com")
+	config, _ := GenerateConfig(hosts, "/tmp/caddy-data", ConfigOptions{ACME: ACMEOptions{Email: "admin@example.com"}})
 	err := Validate(config)
 	require.NoError(t, err)
 }
@@ -123,3 +124,65 @@ func TestValidate_NoHandlers(t *testing.T) {
 	require.Error(t, err)
 	require.Contains(t, err.Error(), "no handlers")
 }
+
+func TestValidate_RequestLimitsAndTimeouts(t *testing.T) {
+	newConfig := func(handlers ...Handler) *Config {
+		return &Config{
+			Apps: Apps{
+				HTTP: &HTTPApp{
+					Servers: map[string]*Server{
+						"srv": {
+							Listen: []string{":80"},
+							Routes: []*Route{
+								{
+									Match:  []Match{{Host: []string{"test.com"}}},
+									Handle: handlers,
+								},
+							},
+						},
+					},
+				},
+			},
+		}
+	}
+
+	require.NoError(t, Validate(newConfig(RequestBodyHandler(1<<20), ReverseProxyHandler("app:8080", false))))
+
+	err := Validate(newConfig(RequestBodyHandler(0), ReverseProxyHandler("app:8080", false)))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "max_size must be a positive")
+
+	// Sizes decoded from JSON, such as adopted routes, are accepted too
+	for _, size := range []interface{}{float64(1 << 20), json.Number("1048576"), int(1 << 20), uint32(1 << 20)} {
+		handler := Handler{"handler": "request_body", "max_size": size}
+		require.NoError(t, Validate(newConfig(handler, ReverseProxyHandler("app:8080", false))), "%T", size)
+	}
+	for _, size := range []interface{}{float64(1.5), json.Number("1e3x"), "1MB", float64(-1)} {
+		handler := Handler{"handler": "request_body", "max_size": size}
+		require.Error(t, Validate(newConfig(handler, ReverseProxyHandler("app:8080", false))), "%v", size)
+	}
+
+	proxy := ReverseProxyHandler("app:8080", false)
+	proxy["transport"] = map[string]interface{}{
+		"protocol":                "http",
+		"response_header_timeout": "forever",
+	}
+
+	err = Validate(newConfig(proxy))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "invalid transport response_header_timeout")
+
+	proxy["transport"] = map[string]interface{}{
+		"protocol":   "http",
+		"keep_alive": map[string]interface{}{"idle_timeout": "0s"},
+	}
+	err = Validate(newConfig(proxy))
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "keep_alive.idle_timeout must be positive")
+
+	config := newConfig(ReverseProxyHandler("app:8080", false))
+	config.Apps.HTTP.Servers["srv"].IdleTimeout = Duration(-1)
+	err = Validate(config)
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "idle_timeout cannot be negative")
+}
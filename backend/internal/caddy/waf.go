@@ -0,0 +1,94 @@
+package caddy
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/models"
+)
+
+// WAF modes (models.ProxyHost.WAFMode).
+const (
+	WAFOff       = ""
+	WAFDetection = "detection"
+	WAFBlocking  = "blocking"
+)
+
+// wafExclusionBaseID numbers the rules generated for path-scoped exclusions,
+// outside the CRS range and the IDs custom rules usually use.
+const wafExclusionBaseID = 9000000
+
+var wafPathPattern = regexp.MustCompile(`^/[^\s"'\\]*$`)
+
+// WAFHandler builds the Coraza handler for a host: the recommended Coraza
+// settings and the OWASP CRS at the host's paranoia level, its exclusions
+// and custom rules, with audit entries written as JSON to auditLog.
+// It returns nil when the WAF is off.
+func WAFHandler(host models.ProxyHost, auditLog string) (Handler, error) {
+	var engine string
+	switch host.WAFMode {
+	case WAFOff:
+		return nil, nil
+	case WAFDetection:
+		engine = "DetectionOnly"
+	case WAFBlocking:
+		engine = "On"
+	default:
+		return nil, fmt.Errorf("invalid WAF mode %q", host.WAFMode)
+	}
+
+	paranoia := host.WAFParanoiaLevel
+	if paranoia == 0 {
+		paranoia = 1
+	}
+	if paranoia < 1 || paranoia > 4 {
+		return nil, fmt.Errorf("WAF paranoia level must be between 1 and 4")
+	}
+
+	// Runtime exclusions must be defined before the CRS rules they remove,
+	// configure-time removals after them.
+	var beforeCRS, afterCRS []string
+	for i, exclusion := range host.WAFExclusions {
+		if exclusion.RuleID <= 0 {
+			return nil, fmt.Errorf("invalid WAF exclusion rule ID %d", exclusion.RuleID)
+		}
+		if exclusion.Path == "" {
+			afterCRS = append(afterCRS, fmt.Sprintf("SecRuleRemoveById %d", exclusion.RuleID))
+			continue
+		}
+		if !wafPathPattern.MatchString(exclusion.Path) {
+			return nil, fmt.Errorf("invalid WAF exclusion path %q", exclusion.Path)
+		}
+		beforeCRS = append(beforeCRS, fmt.Sprintf(
+			`SecRule REQUEST_FILENAME "@beginsWith %s" "id:%d,phase:1,pass,t:none,nolog,ctl:ruleRemoveById=%d"`,
+			exclusion.Path, wafExclusionBaseID+i, exclusion.RuleID,
+		))
+	}
+
+	directives := []string{
+		"Include @coraza.conf-recommended",
+		"Include @crs-setup.conf.example",
+		fmt.Sprintf(`SecAction "id:900000,phase:1,pass,t:none,nolog,setvar:tx.blocking_paranoia_level=%d"`, paranoia),
+	}
+	directives = append(directives, beforeCRS...)
+	directives = append(directives, "Include @owasp_crs/*.conf")
+	directives = append(directives, afterCRS...)
+	directives = append(directives,
+		"SecRuleEngine "+engine,
+		"SecAuditEngine RelevantOnly",
+		"SecAuditLogFormat JSON",
+		"SecAuditLogType Serial",
+		"SecAuditLog "+auditLog,
+	)
+
+	if custom := strings.TrimSpace(host.WAFCustomRules); custom != "" {
+		directives = append(directives, custom)
+	}
+
+	return Handler{
+		"handler":        "waf",
+		"load_owasp_crs": true,
+		"directives":     strings.Join(directives, "\n"),
+	}, nil
+}
@@ -0,0 +1,96 @@
+package caddy
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/models"
+)
+
+func TestWAFHandler(t *testing.T) {
+	h, err := WAFHandler(models.ProxyHost{}, "/data/logs/waf-audit.log")
+	require.NoError(t, err)
+	require.Nil(t, h)
+
+	h, err = WAFHandler(models.ProxyHost{
+		WAFMode:          WAFBlocking,
+		WAFParanoiaLevel: 2,
+		WAFExclusions: []models.WAFExclusion{
+			{RuleID: 920350},
+			{RuleID: 942100, Path: "/api/search"},
+		},
+		WAFCustomRules: `SecRule ARGS:debug "@streq 1" "id:1001,phase:1,deny,status:403"`,
+	}, "/data/logs/waf-audit.log")
+	require.NoError(t, err)
+	require.Equal(t, "waf", h["handler"])
+	require.Equal(t, true, h["load_owasp_crs"])
+
+	require.Equal(t, []string{
+		"Include @coraza.conf-recommended",
+		"Include @crs-setup.conf.example",
+		`SecAction "id:900000,phase:1,pass,t:none,nolog,setvar:tx.blocking_paranoia_level=2"`,
+		`SecRule REQUEST_FILENAME "@beginsWith /api/search" "id:9000001,phase:1,pass,t:none,nolog,ctl:ruleRemoveById=942100"`,
+		"Include @owasp_crs/*.conf",
+		"SecRuleRemoveById 920350",
+		"SecRuleEngine On",
+		"SecAuditEngine RelevantOnly",
+		"SecAuditLogFormat JSON",
+		"SecAuditLogType Serial",
+		"SecAuditLog /data/logs/waf-audit.log",
+		`SecRule ARGS:debug "@streq 1" "id:1001,phase:1,deny,status:403"`,
+	}, strings.Split(h["directives"].(string), "\n"))
+
+	h, err = WAFHandler(models.ProxyHost{WAFMode: WAFDetection}, "/data/logs/waf-audit.log")
+	require.NoError(t, err)
+	require.Contains(t, h["directives"], "SecRuleEngine DetectionOnly")
+	require.Contains(t, h["directives"], "tx.blocking_paranoia_level=1")
+}
+
+func TestWAFHandler_Invalid(t *testing.T) {
+	tests := []struct {
+		name string
+		host models.ProxyHost
+		want string
+	}{
+		{"mode", models.ProxyHost{WAFMode: "strict"}, "invalid WAF mode"},
+		{"paranoia", models.ProxyHost{WAFMode: WAFBlocking, WAFParanoiaLevel: 5}, "paranoia level"},
+		{"rule id", models.ProxyHost{WAFMode: WAFBlocking, WAFExclusions: []models.WAFExclusion{{RuleID: 0}}}, "invalid WAF exclusion rule ID"},
+		{"path", models.ProxyHost{WAFMode: WAFBlocking, WAFExclusions: []models.WAFExclusion{{RuleID: 942100, Path: `/a" "id:1,deny`}}}, "invalid WAF exclusion path"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := WAFHandler(tt.host, "/data/logs/waf-audit.log")
+			require.Error(t, err)
+			require.Contains(t, err.Error(), tt.want)
+		})
+	}
+}
+
+func TestGenerateConfig_WAF(t *testing.T) {
+	hosts := []models.ProxyHost{
+		{
+			UUID: "uuid-1", DomainNames: "app.example.com", ForwardHost: "app", ForwardPort: 80, Enabled: true,
+			MaxBodySize: 1 << 20, EnableCompression: true, WAFMode: WAFBlocking,
+			Locations: []models.Location{{Path: "/api", ForwardHost: "api", ForwardPort: 8080}},
+		},
+	}
+
+	config, err := GenerateConfig(hosts, "/app/data/caddy/data", ConfigOptions{})
+	require.NoError(t, err)
+	require.NoError(t, Validate(config))
+
+	// Locations inherit the WAF, which runs after the body limit
+	routes := config.Apps.HTTP.Servers["cpm_server"].Routes
+	require.Len(t, routes, 2)
+	for _, route := range routes {
+		require.Equal(t, []string{"request_body", "waf", "encode", "reverse_proxy"}, handlerTypes(route.Handle))
+		require.Contains(t, route.Handle[1]["directives"], "SecAuditLog /app/data/logs/waf-audit.log")
+	}
+
+	hosts[0].WAFMode = "strict"
+	_, err = GenerateConfig(hosts, "/app/data/caddy/data", ConfigOptions{})
+	require.Error(t, err)
+	require.Contains(t, err.Error(), "proxy host uuid-1")
+}
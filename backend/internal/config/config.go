@@ -4,6 +4,7 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"time"
 )
 
 // Config captures runtime configuration sourced from environment variables.
@@ -18,6 +19,26 @@ type Config struct {
 	ImportCaddyfile string
 	ImportDir       string
 	JWTSecret       string
+	StaticBaseDir   string
+	// CaddyAdminAPI may also be a Unix socket, "unix//path/to/admin.sock".
+	// CaddyAdminOrigin is sent as the Origin header, for admin APIs that
+	// enforce origins.
+	CaddyAdminOrigin string
+	// CaddyAdminCACert, CaddyAdminClientCert and CaddyAdminClientKey are PEM
+	// files for Caddy's remote admin API with mutual TLS.
+	CaddyAdminCACert     string
+	CaddyAdminClientCert string
+	CaddyAdminClientKey  string
+	// ReconcileInterval is how often the running Caddy config is checked
+	// against the database, 0 disables the checks. The config is applied at
+	// startup either way.
+	ReconcileInterval time.Duration
+	// PublicURL is where Caddy, including remote nodes, reaches CPM+, for
+	// callbacks like the on-demand TLS ask endpoint.
+	PublicURL string
+	// ApplyDebounce is how long the apply queue waits for more changes
+	// before reloading Caddy once for all of them.
+	ApplyDebounce time.Duration
 }
 
 // Load reads env vars and falls back to defaults so the server can boot with zero configuration.
@@ -33,7 +54,27 @@ func Load() (Config, error) {
 		ImportCaddyfile: getEnv("CPM_IMPORT_CADDYFILE", "/import/Caddyfile"),
 		ImportDir:       getEnv("CPM_IMPORT_DIR", filepath.Join("data", "imports")),
 		JWTSecret:       getEnv("CPM_JWT_SECRET", "change-me-in-production"),
+		StaticBaseDir:   getEnv("CPM_STATIC_BASE_DIR", "/srv"),
+
+		CaddyAdminOrigin:     os.Getenv("CPM_CADDY_ADMIN_ORIGIN"),
+		CaddyAdminCACert:     os.Getenv("CPM_CADDY_ADMIN_CA_CERT"),
+		CaddyAdminClientCert: os.Getenv("CPM_CADDY_ADMIN_CLIENT_CERT"),
+		CaddyAdminClientKey:  os.Getenv("CPM_CADDY_ADMIN_CLIENT_KEY"),
+	}
+
+	cfg.PublicURL = getEnv("CPM_PUBLIC_URL", "http://localhost:"+cfg.HTTPPort)
+
+	interval, err := time.ParseDuration(getEnv("CPM_RECONCILE_INTERVAL", "1m"))
+	if err != nil {
+		return Config{}, fmt.Errorf("parse CPM_RECONCILE_INTERVAL: %w", err)
+	}
+	cfg.ReconcileInterval = interval
+
+	debounce, err := time.ParseDuration(getEnv("CPM_APPLY_DEBOUNCE", "500ms"))
+	if err != nil {
+		return Config{}, fmt.Errorf("parse CPM_APPLY_DEBOUNCE: %w", err)
 	}
+	cfg.ApplyDebounce = debounce
 
 	if err := os.MkdirAll(filepath.Dir(cfg.DatabasePath), 0o755); err != nil {
 		return Config{}, fmt.Errorf("ensure data directory: %w", err)
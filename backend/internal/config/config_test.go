@@ -4,6 +4,7 @@ import (
 	"os"
 	"path/filepath"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/stretchr/testify/require"
@@ -35,6 +36,7 @@ func TestLoad_Defaults(t *testing.T) {
 	// Clear env vars to test defaults
 	os.Unsetenv("CPM_ENV")
 	os.Unsetenv("CPM_HTTP_PORT")
+	os.Unsetenv("CPM_PUBLIC_URL")
 	// We need to set paths to a temp dir to avoid creating real dirs in test
 	tempDir := t.TempDir()
 	os.Setenv("CPM_DB_PATH", filepath.Join(tempDir, "default.db"))
@@ -46,6 +48,25 @@ func TestLoad_Defaults(t *testing.T) {
 
 	assert.Equal(t, "development", cfg.Environment)
 	assert.Equal(t, "8080", cfg.HTTPPort)
+	assert.Equal(t, "http://localhost:8080", cfg.PublicURL)
+}
+
+func TestLoad_PublicURLFollowsPort(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("CPM_DB_PATH", filepath.Join(tempDir, "cpm.db"))
+	t.Setenv("CPM_CADDY_CONFIG_DIR", filepath.Join(tempDir, "caddy"))
+	t.Setenv("CPM_IMPORT_DIR", filepath.Join(tempDir, "imports"))
+	t.Setenv("CPM_HTTP_PORT", "9090")
+	t.Setenv("CPM_PUBLIC_URL", "")
+
+	cfg, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, "http://localhost:9090", cfg.PublicURL)
+
+	t.Setenv("CPM_PUBLIC_URL", "https://cpm.example.com")
+	cfg, err = Load()
+	require.NoError(t, err)
+	assert.Equal(t, "https://cpm.example.com", cfg.PublicURL)
 }
 
 func TestLoad_Error(t *testing.T) {
@@ -73,3 +94,44 @@ func TestLoad_Error(t *testing.T) {
 	assert.Error(t, err)
 	assert.Contains(t, err.Error(), "ensure import directory")
 }
+
+func TestLoad_ReconcileInterval(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("CPM_DB_PATH", filepath.Join(tempDir, "test.db"))
+	t.Setenv("CPM_CADDY_CONFIG_DIR", filepath.Join(tempDir, "caddy"))
+	t.Setenv("CPM_IMPORT_DIR", filepath.Join(tempDir, "imports"))
+
+	t.Setenv("CPM_RECONCILE_INTERVAL", "")
+	cfg, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, time.Minute, cfg.ReconcileInterval)
+
+	t.Setenv("CPM_RECONCILE_INTERVAL", "0")
+	cfg, err = Load()
+	require.NoError(t, err)
+	assert.Zero(t, cfg.ReconcileInterval)
+
+	t.Setenv("CPM_RECONCILE_INTERVAL", "often")
+	_, err = Load()
+	assert.ErrorContains(t, err, "CPM_RECONCILE_INTERVAL")
+}
+
+func TestLoad_CaddyAdmin(t *testing.T) {
+	tempDir := t.TempDir()
+	t.Setenv("CPM_DB_PATH", filepath.Join(tempDir, "test.db"))
+	t.Setenv("CPM_CADDY_CONFIG_DIR", filepath.Join(tempDir, "caddy"))
+	t.Setenv("CPM_IMPORT_DIR", filepath.Join(tempDir, "imports"))
+
+	t.Setenv("CPM_CADDY_ADMIN_API", "unix//run/caddy/admin.sock")
+	t.Setenv("CPM_CADDY_ADMIN_ORIGIN", "http://cpm.internal")
+	t.Setenv("CPM_CADDY_ADMIN_CA_CERT", "/certs/ca.pem")
+	t.Setenv("CPM_CADDY_ADMIN_CLIENT_CERT", "/certs/cpm.pem")
+	t.Setenv("CPM_CADDY_ADMIN_CLIENT_KEY", "/certs/cpm-key.pem")
+	cfg, err := Load()
+	require.NoError(t, err)
+	assert.Equal(t, "unix//run/caddy/admin.sock", cfg.CaddyAdminAPI)
+	assert.Equal(t, "http://cpm.internal", cfg.CaddyAdminOrigin)
+	assert.Equal(t, "/certs/ca.pem", cfg.CaddyAdminCACert)
+	assert.Equal(t, "/certs/cpm.pem", cfg.CaddyAdminClientCert)
+	assert.Equal(t, "/certs/cpm-key.pem", cfg.CaddyAdminClientKey)
+}
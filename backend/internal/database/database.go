@@ -2,9 +2,11 @@ package database
 
 import (
 	"fmt"
+	"reflect"
 
 	"gorm.io/driver/sqlite"
 	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
 )
 
 // Connect opens a SQLite database connection.
@@ -16,3 +18,15 @@ func Connect(dbPath string) (*gorm.DB, error) {
 
 	return db, nil
 }
+
+// InsertRow inserts a row with its ID and field values as they are, e.g.
+// to restore a deleted row. Create replaces false and zero values with
+// column defaults, so the original values are written back afterwards.
+func InsertRow(tx *gorm.DB, row interface{}) error {
+	original := reflect.New(reflect.TypeOf(row).Elem())
+	original.Elem().Set(reflect.ValueOf(row).Elem())
+	if err := tx.Omit(clause.Associations).Create(row).Error; err != nil {
+		return err
+	}
+	return tx.Model(row).Select("*").Omit(clause.Associations).Updates(original.Interface()).Error
+}
@@ -5,6 +5,7 @@ import (
 	"testing"
 
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 )
 
 func TestConnect(t *testing.T) {
@@ -27,3 +28,20 @@ func TestConnect_Error(t *testing.T) {
 	_, err := Connect(tempDir)
 	assert.Error(t, err)
 }
+
+func TestInsertRow(t *testing.T) {
+	type row struct {
+		ID      uint
+		Name    string
+		Enabled bool `gorm:"default:true"`
+	}
+	db, err := Connect("file:" + t.Name() + "?mode=memory&cache=shared")
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&row{}))
+
+	// The ID and the false value are kept, not replaced by the default
+	require.NoError(t, InsertRow(db, &row{ID: 7, Name: "off", Enabled: false}))
+	var got row
+	require.NoError(t, db.First(&got, 7).Error)
+	assert.Equal(t, row{ID: 7, Name: "off", Enabled: false}, got)
+}
@@ -17,3 +17,11 @@ type AccessList struct {
 	CreatedAt   time.Time `json:"created_at"`
 	UpdatedAt   time.Time `json:"updated_at"`
 }
+
+// AccessListRule is a single entry of AccessList.Rules.
+type AccessListRule struct {
+	Address  string `json:"address,omitempty"`  // IP or CIDR for allow and deny lists
+	Country  string `json:"country,omitempty"`  // ISO 3166-1 alpha-2 country code for allow and deny lists
+	Username string `json:"username,omitempty"` // basic_auth user
+	Password string `json:"password,omitempty"` // bcrypt hash for basic_auth
+}
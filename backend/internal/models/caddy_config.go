@@ -6,9 +6,14 @@ import (
 
 // CaddyConfig stores an audit trail of Caddy configuration changes.
 type CaddyConfig struct {
-	ID         uint      `json:"id" gorm:"primaryKey"`
-	ConfigHash string    `json:"config_hash" gorm:"index"`
-	AppliedAt  time.Time `json:"applied_at"`
-	Success    bool      `json:"success"`
-	ErrorMsg   string    `json:"error_msg"`
+	ID           uint      `json:"id" gorm:"primaryKey"`
+	ConfigHash   string    `json:"config_hash" gorm:"index"`
+	AppliedAt    time.Time `json:"applied_at"`
+	AppliedBy    uint      `json:"applied_by"` // User ID, 0 when unauthenticated or automatic
+	Reason       string    `json:"reason"`     // What triggered the apply, e.g. "update proxy host app.example.com"
+	Success      bool      `json:"success"`
+	ErrorMsg     string    `json:"error_msg"`
+	HostsChanged []string  `json:"hosts_changed" gorm:"serializer:json"` // Diff groups changed since the previous snapshot
+	Snapshot     string    `json:"snapshot"`                             // Snapshot file name, empty when the apply failed or retention pruned it
+	State        string    `json:"-" gorm:"type:text"`                   // JSON of the database rows the config was generated from
 }
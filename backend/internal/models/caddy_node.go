@@ -0,0 +1,63 @@
+package models
+
+import "time"
+
+// LocalNode selects the local Caddy, managed through CPM_CADDY_ADMIN_API,
+// in ProxyHost.Nodes. It cannot be used as a node name.
+const LocalNode = "local"
+
+// Caddy node admin API authentication (CaddyNode.AuthType).
+const (
+	NodeAuthNone   = ""
+	NodeAuthBasic  = "basic"
+	NodeAuthBearer = "bearer"
+)
+
+// CaddyNode is a remote Caddy instance managed through its admin API, e.g.
+// an edge node in another location. Each node runs the config generated
+// from the proxy hosts assigned to it by name or label.
+type CaddyNode struct {
+	ID         uint     `json:"id" gorm:"primaryKey"`
+	UUID       string   `json:"uuid" gorm:"uniqueIndex"`
+	Name       string   `json:"name" gorm:"uniqueIndex"`
+	AdminURL   string   `json:"admin_url"` // Or a Unix socket, "unix//path/to/admin.sock"
+	AuthType   string   `json:"auth_type"` // "" (none), "basic" or "bearer"
+	AuthUser   string   `json:"auth_user"`
+	AuthSecret string   `json:"auth_secret,omitempty"`         // Password or token, write-only through the API
+	Labels     []string `json:"labels" gorm:"serializer:json"` // Groups the node belongs to, e.g. "eu"
+	Enabled    bool     `json:"enabled" gorm:"default:true"`
+
+	// Admin API transport, as CPM_CADDY_ADMIN_* for the local Caddy. The
+	// files are PEM paths on the CPM+ host.
+	Origin         string `json:"origin"` // Sent as the Origin header, for Caddy's enforce_origin
+	CACertFile     string `json:"ca_cert_file"`
+	ClientCertFile string `json:"client_cert_file"` // Mutual TLS with Caddy's remote admin API
+	ClientKeyFile  string `json:"client_key_file"`
+
+	// Outcome of the last apply and check
+	LastApplied *time.Time `json:"last_applied,omitempty"`
+	ApplyError  string     `json:"apply_error"`
+	AppliedHash string     `json:"applied_hash"`
+	LastChecked *time.Time `json:"last_checked,omitempty"`
+	Reachable   bool       `json:"reachable" gorm:"default:false"`
+	InSync      bool       `json:"in_sync" gorm:"default:false"`
+	LiveHash    string     `json:"live_hash"`
+	Version     string     `json:"version"`
+
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// Matches reports whether selector, from ProxyHost.Nodes, names the node
+// or one of its labels.
+func (n CaddyNode) Matches(selector string) bool {
+	if selector == n.Name {
+		return true
+	}
+	for _, label := range n.Labels {
+		if selector == label {
+			return true
+		}
+	}
+	return false
+}
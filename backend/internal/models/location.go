@@ -6,13 +6,33 @@ import (
 
 // Location represents a custom path-based proxy configuration within a ProxyHost.
 type Location struct {
-	ID            uint      `json:"id" gorm:"primaryKey"`
-	UUID          string    `json:"uuid" gorm:"uniqueIndex;not null"`
-	ProxyHostID   uint      `json:"proxy_host_id" gorm:"not null;index"`
-	Path          string    `json:"path" gorm:"not null"` // e.g., /api, /admin
-	ForwardScheme string    `json:"forward_scheme" gorm:"default:http"`
-	ForwardHost   string    `json:"forward_host" gorm:"not null"`
-	ForwardPort   int       `json:"forward_port" gorm:"not null"`
-	CreatedAt     time.Time `json:"created_at"`
-	UpdatedAt     time.Time `json:"updated_at"`
+	ID                    uint                `json:"id" gorm:"primaryKey"`
+	UUID                  string              `json:"uuid" gorm:"uniqueIndex;not null"`
+	ProxyHostID           uint                `json:"proxy_host_id" gorm:"not null;index"`
+	Path                  string              `json:"path" gorm:"not null"`                 // e.g., /api, /admin
+	PathRegex             string              `json:"path_regex"`                           // Matches the path against a regex instead of Path
+	Methods               string              `json:"methods"`                              // Comma-separated HTTP methods, empty matches all
+	MatchHeaders          map[string][]string `json:"match_headers" gorm:"serializer:json"` // Request headers to match, any listed value matches
+	MatchQuery            map[string][]string `json:"match_query" gorm:"serializer:json"`   // Query parameters to match, any listed value matches
+	Priority              int                 `json:"priority" gorm:"default:0"`            // Higher priority locations are matched first
+	ForwardScheme         string              `json:"forward_scheme" gorm:"default:http"`
+	ForwardHost           string              `json:"forward_host" gorm:"not null"`
+	ForwardPort           int                 `json:"forward_port" gorm:"not null"`
+	StripPrefix           bool                `json:"strip_prefix" gorm:"default:false"`            // Remove Path from the URI before proxying
+	ReplacePrefix         string              `json:"replace_prefix"`                               // Prefix substituted for Path, implies StripPrefix
+	RewriteRegex          string              `json:"rewrite_regex"`                                // Regex applied to the path after prefix handling
+	RewriteReplacement    string              `json:"rewrite_replacement"`                          // Replacement for RewriteRegex matches, supports $1 groups
+	TrailingSlashRedirect bool                `json:"trailing_slash_redirect" gorm:"default:false"` // Redirect Path to Path/
+	// Overrides of the parent host's features, nil or empty inherits the host setting
+	WebsocketSupport      *bool               `json:"websocket_support"`
+	EnableCompression     *bool               `json:"enable_compression"`
+	RequestHeaders        map[string][]string `json:"request_headers" gorm:"serializer:json"`  // Merged over the host's request headers
+	ResponseHeaders       map[string][]string `json:"response_headers" gorm:"serializer:json"` // Merged over the host's response headers
+	AccessListID          *uint               `json:"access_list_id"`
+	AccessList            *AccessList         `json:"access_list,omitempty" gorm:"foreignKey:AccessListID"`
+	DisableAccessList     bool                `json:"disable_access_list" gorm:"default:false"` // Serve the location without the host's access list
+	UpstreamTLSSkipVerify *bool               `json:"upstream_tls_skip_verify"`
+	UpstreamTLSServerName string              `json:"upstream_tls_server_name"`
+	CreatedAt             time.Time           `json:"created_at"`
+	UpdatedAt             time.Time           `json:"updated_at"`
 }
@@ -29,6 +29,15 @@ type CaddyAccessLog struct {
 	Size        int                 `json:"size"`
 	Status      int                 `json:"status"`
 	RespHeaders map[string][]string `json:"resp_headers"`
+	Country     string              `json:"country,omitempty"` // Client country code, added by CPM+ from the GeoIP database
+	WAF         *WAFMatch           `json:"waf,omitempty"`     // Set for entries parsed from the WAF audit log
+}
+
+// WAFMatch lists the WAF rules that matched a request.
+type WAFMatch struct {
+	RuleIDs  []int    `json:"rule_ids"`
+	Messages []string `json:"messages"`
+	Blocked  bool     `json:"blocked"`
 }
 
 // LogFilter defines criteria for filtering logs.
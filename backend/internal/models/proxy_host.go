@@ -1,26 +1,148 @@
 package models
 
 import (
+	"net"
+	"strings"
 	"time"
 )
 
+// Host types (ProxyHost.HostType).
+const (
+	HostTypeProxy  = "proxy"
+	HostTypeStatic = "static"
+)
+
+// Canonical host modes (ProxyHost.CanonicalHost).
+const (
+	CanonicalHostNone = ""     // Serve only the listed domains
+	CanonicalHostApex = "apex" // Redirect www.<domain> to <domain>
+	CanonicalHostWWW  = "www"  // Redirect <domain> to www.<domain>
+)
+
 // ProxyHost represents a reverse proxy configuration.
 type ProxyHost struct {
-	ID               uint       `json:"id" gorm:"primaryKey"`
-	UUID             string     `json:"uuid" gorm:"uniqueIndex;not null"`
-	Name             string     `json:"name"`
-	DomainNames      string     `json:"domain_names" gorm:"not null"` // Comma-separated list
-	ForwardScheme    string     `json:"forward_scheme" gorm:"default:http"`
-	ForwardHost      string     `json:"forward_host" gorm:"not null"`
-	ForwardPort      int        `json:"forward_port" gorm:"not null"`
-	SSLForced        bool       `json:"ssl_forced" gorm:"default:false"`
-	HTTP2Support     bool       `json:"http2_support" gorm:"default:true"`
-	HSTSEnabled      bool       `json:"hsts_enabled" gorm:"default:false"`
-	HSTSSubdomains   bool       `json:"hsts_subdomains" gorm:"default:false"`
-	BlockExploits    bool       `json:"block_exploits" gorm:"default:true"`
-	WebsocketSupport bool       `json:"websocket_support" gorm:"default:false"`
-	Enabled          bool       `json:"enabled" gorm:"default:true"`
-	Locations        []Location `json:"locations" gorm:"foreignKey:ProxyHostID;constraint:OnDelete:CASCADE"`
-	CreatedAt        time.Time  `json:"created_at"`
-	UpdatedAt        time.Time  `json:"updated_at"`
+	ID                    uint                `json:"id" gorm:"primaryKey"`
+	UUID                  string              `json:"uuid" gorm:"uniqueIndex;not null"`
+	Name                  string              `json:"name"`
+	DomainNames           string              `json:"domain_names" gorm:"not null"`   // Comma-separated list
+	HostType              string              `json:"host_type" gorm:"default:proxy"` // "proxy" or "static"
+	ForwardScheme         string              `json:"forward_scheme" gorm:"default:http"`
+	ForwardHost           string              `json:"forward_host" gorm:"not null"`
+	ForwardPort           int                 `json:"forward_port" gorm:"not null"`
+	SSLForced             bool                `json:"ssl_forced" gorm:"default:false"`
+	HTTP2Support          bool                `json:"http2_support" gorm:"default:true"`
+	HSTSEnabled           bool                `json:"hsts_enabled" gorm:"default:false"`
+	HSTSSubdomains        bool                `json:"hsts_subdomains" gorm:"default:false"`
+	BlockExploits         bool                `json:"block_exploits" gorm:"default:true"`
+	WebsocketSupport      bool                `json:"websocket_support" gorm:"default:false"`
+	Enabled               bool                `json:"enabled" gorm:"default:true"`
+	OnDemandTLS           bool                `json:"on_demand_tls" gorm:"default:false"`    // Catch-all host with certificates issued on demand
+	CertificateIssuer     string              `json:"certificate_issuer"`                    // "" (global default), "letsencrypt", "letsencrypt_staging", "zerossl", "custom", "internal"
+	CanonicalHost         string              `json:"canonical_host"`                        // "" (off), "apex" or "www", the other name redirects permanently
+	CrowdSecEnabled       bool                `json:"crowdsec_enabled" gorm:"default:false"` // Block clients with an active CrowdSec decision
+	WAFMode               string              `json:"waf_mode"`                              // "" (off), "detection" or "blocking"
+	WAFParanoiaLevel      int                 `json:"waf_paranoia_level"`                    // OWASP CRS paranoia level 1-4, 0 means 1
+	WAFExclusions         []WAFExclusion      `json:"waf_exclusions" gorm:"serializer:json"` // CRS rules disabled for false positives
+	WAFCustomRules        string              `json:"waf_custom_rules" gorm:"type:text"`     // SecLang directives loaded after the CRS
+	Locations             []Location          `json:"locations" gorm:"foreignKey:ProxyHostID;constraint:OnDelete:CASCADE"`
+	UpstreamGroups        []UpstreamGroup     `json:"upstream_groups" gorm:"foreignKey:ProxyHostID;constraint:OnDelete:CASCADE"` // Weighted split, replaces the forward target when set
+	SplitStickyCookie     string              `json:"split_sticky_cookie"`                                                       // Cookie pinning clients to a group, empty disables stickiness
+	SplitOverrideHeader   string              `json:"split_override_header"`                                                     // Request header whose value forces a group by name
+	MaxBodySize           int64               `json:"max_body_size"`                                                             // Request body limit in bytes, 0 means unlimited
+	ResponseHeaderTimeout string              `json:"response_header_timeout"`                                                   // Upstream response header timeout, e.g. "30s"
+	UpstreamIdleTimeout   string              `json:"upstream_idle_timeout"`                                                     // Idle keep-alive connection timeout, e.g. "2m"
+	UpstreamKeepAlive     string              `json:"upstream_keepalive"`                                                        // Keep-alive probe interval, "off" disables keep-alive
+	AccessListID          *uint               `json:"access_list_id"`
+	AccessList            *AccessList         `json:"access_list,omitempty" gorm:"foreignKey:AccessListID"`
+	EnableCompression     bool                `json:"enable_compression" gorm:"default:false"`       // gzip/zstd response compression
+	RequestHeaders        map[string][]string `json:"request_headers" gorm:"serializer:json"`        // Headers set on requests to the upstream
+	ResponseHeaders       map[string][]string `json:"response_headers" gorm:"serializer:json"`       // Headers set on responses, an empty list deletes the header
+	UpstreamTLSSkipVerify bool                `json:"upstream_tls_skip_verify" gorm:"default:false"` // Accept any certificate from an https upstream
+	UpstreamTLSServerName string              `json:"upstream_tls_server_name"`                      // SNI and verification name for an https upstream
+	StaticRoot            string              `json:"static_root"`                                   // Directory served by static hosts, within the allowed base directory
+	StaticIndexFiles      string              `json:"static_index_files"`                            // Comma-separated index file names, defaults to index.html
+	StaticSPAFallback     bool                `json:"static_spa_fallback" gorm:"default:false"`      // Serve the first index file for unknown paths
+	StaticBrowse          bool                `json:"static_browse" gorm:"default:false"`            // Directory listings
+	StaticPrecompressed   bool                `json:"static_precompressed" gorm:"default:false"`     // Serve .br/.zst/.gz siblings when accepted
+	StaticCacheControl    []CacheControlRule  `json:"static_cache_control" gorm:"serializer:json"`   // First matching rule sets Cache-Control
+	Nodes                 []string            `json:"nodes" gorm:"serializer:json"`                  // Caddy node names or labels serving the host, empty means the local Caddy only
+	CreatedAt             time.Time           `json:"created_at"`
+	UpdatedAt             time.Time           `json:"updated_at"`
+}
+
+// OnLocal reports whether the local Caddy serves the host: hosts not
+// assigned to any node, or assigned to LocalNode.
+func (h ProxyHost) OnLocal() bool {
+	if len(h.Nodes) == 0 {
+		return true
+	}
+	for _, selector := range h.Nodes {
+		if selector == LocalNode {
+			return true
+		}
+	}
+	return false
+}
+
+// OnNode reports whether node serves the host, by name or label.
+func (h ProxyHost) OnNode(node CaddyNode) bool {
+	for _, selector := range h.Nodes {
+		if node.Matches(selector) {
+			return true
+		}
+	}
+	return false
+}
+
+// WAFExclusion disables a WAF rule, only under Path when set, e.g. "/api/upload".
+type WAFExclusion struct {
+	RuleID int    `json:"rule_id"`
+	Path   string `json:"path,omitempty"`
+}
+
+// CacheControlRule sets the Cache-Control header for paths matching Path, e.g. "/assets/*".
+type CacheControlRule struct {
+	Path  string `json:"path"`
+	Value string `json:"value"`
+}
+
+// CanonicalAliases returns the secondary names that redirect to domainNames
+// under the given canonical host mode: www.<domain> for "apex" and the bare
+// domain of each www.<domain> for "www". Wildcards, IP addresses and names
+// already listed are skipped.
+func CanonicalAliases(domainNames, canonicalHost string) []string {
+	listed := make(map[string]bool)
+	domains := make([]string, 0)
+	for _, d := range strings.Split(domainNames, ",") {
+		if d = strings.ToLower(strings.TrimSpace(d)); d != "" {
+			listed[d] = true
+			domains = append(domains, d)
+		}
+	}
+
+	aliases := make([]string, 0)
+	for _, d := range domains {
+		if strings.Contains(d, "*") || net.ParseIP(d) != nil {
+			continue
+		}
+
+		var alias string
+		switch canonicalHost {
+		case CanonicalHostApex:
+			if !strings.HasPrefix(d, "www.") {
+				alias = "www." + d
+			}
+		case CanonicalHostWWW:
+			alias = strings.TrimPrefix(d, "www.")
+			if alias == d || !strings.Contains(alias, ".") {
+				alias = ""
+			}
+		}
+
+		if alias != "" && !listed[alias] {
+			listed[alias] = true
+			aliases = append(aliases, alias)
+		}
+	}
+	return aliases
 }
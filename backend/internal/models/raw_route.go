@@ -0,0 +1,19 @@
+package models
+
+import (
+	"time"
+)
+
+// RawRoute is a Caddy route added verbatim to the generated config. Routes
+// adopted from an existing Caddy config that no proxy host can represent
+// are kept this way so they keep working after the first apply.
+type RawRoute struct {
+	ID        uint      `json:"id" gorm:"primaryKey"`
+	UUID      string    `json:"uuid" gorm:"uniqueIndex;not null"`
+	Name      string    `json:"name"`
+	Source    string    `json:"source"`                          // Where the route was adopted from, e.g. "srv0 route 3"
+	Route     string    `json:"route" gorm:"type:text;not null"` // Caddy route JSON
+	Enabled   bool      `json:"enabled" gorm:"default:true"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
@@ -0,0 +1,30 @@
+package models
+
+import (
+	"time"
+)
+
+// UpstreamGroup is a named, weighted upstream target of a ProxyHost,
+// used to split traffic between releases (e.g. "stable" and "canary").
+type UpstreamGroup struct {
+	ID            uint      `json:"id" gorm:"primaryKey"`
+	UUID          string    `json:"uuid" gorm:"uniqueIndex;not null"`
+	ProxyHostID   uint      `json:"proxy_host_id" gorm:"not null;index"`
+	Name          string    `json:"name" gorm:"not null"` // e.g., stable, canary
+	ForwardScheme string    `json:"forward_scheme" gorm:"default:http"`
+	ForwardHost   string    `json:"forward_host" gorm:"not null"`
+	ForwardPort   int       `json:"forward_port" gorm:"not null"`
+	Weight        int       `json:"weight"` // Percentage of traffic (0-100)
+	CreatedAt     time.Time `json:"created_at"`
+	UpdatedAt     time.Time `json:"updated_at"`
+}
+
+// TrafficSplitChange is an audit record of a change to a host's upstream groups.
+type TrafficSplitChange struct {
+	ID          uint      `json:"id" gorm:"primaryKey"`
+	ProxyHostID uint      `json:"proxy_host_id" gorm:"not null;index"`
+	Groups      string    `json:"groups" gorm:"type:text"` // JSON array of {name, target, weight}
+	ChangedBy   uint      `json:"changed_by"`              // User ID, 0 when unauthenticated
+	Reason      string    `json:"reason"`
+	CreatedAt   time.Time `json:"created_at"`
+}
@@ -0,0 +1,129 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net/url"
+	"strings"
+
+	"gorm.io/gorm"
+
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/models"
+)
+
+// CaddyNodeService encapsulates business logic for Caddy node management.
+type CaddyNodeService struct {
+	db *gorm.DB
+}
+
+// NewCaddyNodeService creates a new Caddy node service.
+func NewCaddyNodeService(db *gorm.DB) *CaddyNodeService {
+	return &CaddyNodeService{db: db}
+}
+
+// Validate checks a node's fields and that its name is unique.
+func (s *CaddyNodeService) Validate(node *models.CaddyNode) error {
+	node.Name = strings.TrimSpace(node.Name)
+	if node.Name == "" {
+		return errors.New("name is required")
+	}
+	if node.Name == models.LocalNode {
+		return fmt.Errorf("%q is reserved for the local Caddy", models.LocalNode)
+	}
+
+	if strings.HasPrefix(node.AdminURL, "unix/") {
+		if strings.TrimPrefix(node.AdminURL, "unix/") == "" {
+			return fmt.Errorf("invalid admin URL %q", node.AdminURL)
+		}
+	} else {
+		u, err := url.Parse(node.AdminURL)
+		if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return fmt.Errorf("invalid admin URL %q", node.AdminURL)
+		}
+		node.AdminURL = strings.TrimSuffix(node.AdminURL, "/")
+	}
+
+	if node.CACertFile != "" || node.ClientCertFile != "" || node.ClientKeyFile != "" {
+		if !strings.HasPrefix(node.AdminURL, "https://") {
+			return errors.New("TLS certificates require an https admin URL")
+		}
+		if (node.ClientCertFile == "") != (node.ClientKeyFile == "") {
+			return errors.New("client certificate and key must be set together")
+		}
+	}
+
+	switch node.AuthType {
+	case models.NodeAuthNone:
+	case models.NodeAuthBasic:
+		if node.AuthUser == "" {
+			return errors.New("basic auth requires a user")
+		}
+	case models.NodeAuthBearer:
+		if node.AuthSecret == "" {
+			return errors.New("bearer auth requires a token")
+		}
+	default:
+		return fmt.Errorf("invalid auth type %q", node.AuthType)
+	}
+
+	for _, label := range node.Labels {
+		if strings.TrimSpace(label) == "" || label == models.LocalNode {
+			return fmt.Errorf("invalid label %q", label)
+		}
+	}
+
+	var count int64
+	query := s.db.Model(&models.CaddyNode{}).Where("name = ?", node.Name)
+	if node.ID > 0 {
+		query = query.Where("id != ?", node.ID)
+	}
+	if err := query.Count(&count).Error; err != nil {
+		return fmt.Errorf("checking node uniqueness: %w", err)
+	}
+	if count > 0 {
+		return errors.New("node with same name already exists")
+	}
+
+	return nil
+}
+
+// Create validates and creates a new node.
+func (s *CaddyNodeService) Create(node *models.CaddyNode) error {
+	if err := s.Validate(node); err != nil {
+		return err
+	}
+
+	return s.db.Create(node).Error
+}
+
+// Update validates and updates an existing node.
+func (s *CaddyNodeService) Update(node *models.CaddyNode) error {
+	if err := s.Validate(node); err != nil {
+		return err
+	}
+
+	return s.db.Save(node).Error
+}
+
+// Delete removes a node.
+func (s *CaddyNodeService) Delete(id uint) error {
+	return s.db.Delete(&models.CaddyNode{}, id).Error
+}
+
+// GetByUUID retrieves a node by UUID.
+func (s *CaddyNodeService) GetByUUID(uuid string) (*models.CaddyNode, error) {
+	var node models.CaddyNode
+	if err := s.db.Where("uuid = ?", uuid).First(&node).Error; err != nil {
+		return nil, err
+	}
+	return &node, nil
+}
+
+// List retrieves all nodes ordered by name.
+func (s *CaddyNodeService) List() ([]models.CaddyNode, error) {
+	var nodes []models.CaddyNode
+	if err := s.db.Order("name ASC").Find(&nodes).Error; err != nil {
+		return nil, err
+	}
+	return nodes, nil
+}
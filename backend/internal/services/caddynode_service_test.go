@@ -0,0 +1,78 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/models"
+)
+
+func setupCaddyNodeTestDB(t *testing.T) *gorm.DB {
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.CaddyNode{}, &models.ProxyHost{}, &models.Location{}, &models.UpstreamGroup{}))
+	return db
+}
+
+func TestCaddyNodeService_Validate(t *testing.T) {
+	db := setupCaddyNodeTestDB(t)
+	service := NewCaddyNodeService(db)
+
+	node := &models.CaddyNode{Name: "eu1", AdminURL: "http://10.0.0.1:2019/", Labels: []string{"eu"}}
+	require.NoError(t, service.Create(node))
+	assert.Equal(t, "http://10.0.0.1:2019", node.AdminURL)
+
+	tests := []struct {
+		name string
+		node models.CaddyNode
+		err  string
+	}{
+		{"missing name", models.CaddyNode{AdminURL: "http://10.0.0.2:2019"}, "name is required"},
+		{"reserved name", models.CaddyNode{Name: "local", AdminURL: "http://10.0.0.2:2019"}, "reserved"},
+		{"duplicate name", models.CaddyNode{Name: "eu1", AdminURL: "http://10.0.0.2:2019"}, "already exists"},
+		{"bad url", models.CaddyNode{Name: "eu2", AdminURL: "10.0.0.2:2019"}, "invalid admin URL"},
+		{"bad auth", models.CaddyNode{Name: "eu2", AdminURL: "http://10.0.0.2:2019", AuthType: "digest"}, "invalid auth type"},
+		{"basic without user", models.CaddyNode{Name: "eu2", AdminURL: "http://10.0.0.2:2019", AuthType: models.NodeAuthBasic}, "requires a user"},
+		{"bearer without token", models.CaddyNode{Name: "eu2", AdminURL: "http://10.0.0.2:2019", AuthType: models.NodeAuthBearer}, "requires a token"},
+		{"bad socket", models.CaddyNode{Name: "eu2", AdminURL: "unix/"}, "invalid admin URL"},
+		{"certificate over http", models.CaddyNode{Name: "eu2", AdminURL: "http://10.0.0.2:2019", CACertFile: "/certs/ca.pem"}, "https admin URL"},
+		{"certificate without key", models.CaddyNode{Name: "eu2", AdminURL: "https://10.0.0.2:2019", ClientCertFile: "/certs/cpm.pem"}, "set together"},
+		{"reserved label", models.CaddyNode{Name: "eu2", AdminURL: "http://10.0.0.2:2019", Labels: []string{"local"}}, "invalid label"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := service.Create(&tt.node)
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.err)
+		})
+	}
+
+	socket := &models.CaddyNode{UUID: "uuid-socket", Name: "eu-socket", AdminURL: "unix//run/caddy/admin.sock", Origin: "http://cpm.internal"}
+	require.NoError(t, service.Create(socket))
+	assert.Equal(t, "unix//run/caddy/admin.sock", socket.AdminURL)
+	require.NoError(t, service.Delete(socket.ID))
+
+	// A node doesn't conflict with its own name
+	node.Labels = []string{"eu", "edge"}
+	require.NoError(t, service.Update(node))
+
+	nodes, err := service.List()
+	require.NoError(t, err)
+	require.Len(t, nodes, 1)
+	assert.Equal(t, []string{"eu", "edge"}, nodes[0].Labels)
+
+	// Hosts can only be assigned to known nodes and labels
+	hosts := NewProxyHostService(db)
+	host := &models.ProxyHost{UUID: "uuid-1", DomainNames: "a.example.com", ForwardHost: "a", ForwardPort: 80, Nodes: []string{"edge", "local"}}
+	require.NoError(t, hosts.Create(host))
+	host.Nodes = []string{"us"}
+	err = hosts.Update(host)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), `unknown caddy node or label "us"`)
+}
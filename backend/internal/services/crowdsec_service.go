@@ -0,0 +1,241 @@
+package services
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/http"
+	"strings"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/models"
+)
+
+// CrowdSec settings. The bouncer key is enough to read decisions, pushing
+// a manual ban needs machine (watcher) credentials registered with
+// cscli machines add.
+const (
+	CrowdSecAPIURLSetting          = "crowdsec.api_url"
+	CrowdSecBouncerKeySetting      = "crowdsec.bouncer_key"
+	CrowdSecMachineIDSetting       = "crowdsec.machine_id"
+	CrowdSecMachinePasswordSetting = "crowdsec.machine_password"
+)
+
+var (
+	// ErrCrowdSecNotConfigured is returned when the LAPI settings needed for a call are missing.
+	ErrCrowdSecNotConfigured = errors.New("CrowdSec is not configured")
+	// ErrInvalidCrowdSecBan is returned for a ban with a bad address or duration.
+	ErrInvalidCrowdSecBan = errors.New("invalid ban")
+)
+
+// CrowdSecDecision is an active remediation returned by the CrowdSec Local API.
+type CrowdSecDecision struct {
+	ID       int64  `json:"id"`
+	Origin   string `json:"origin"`
+	Type     string `json:"type"`
+	Scope    string `json:"scope"`
+	Value    string `json:"value"`
+	Duration string `json:"duration"`
+	Scenario string `json:"scenario"`
+}
+
+// CrowdSecBan is a manual ban pushed from CPM+.
+type CrowdSecBan struct {
+	IP       string `json:"ip" binding:"required"`
+	Duration string `json:"duration"` // Go duration, defaults to 4h
+	Reason   string `json:"reason"`
+}
+
+// CrowdSecService talks to a CrowdSec Local API (LAPI).
+type CrowdSecService struct {
+	db     *gorm.DB
+	client *http.Client
+	now    func() time.Time
+}
+
+// NewCrowdSecService creates a new CrowdSec LAPI client.
+func NewCrowdSecService(db *gorm.DB) *CrowdSecService {
+	return &CrowdSecService{
+		db:     db,
+		client: &http.Client{Timeout: 10 * time.Second},
+		now:    time.Now,
+	}
+}
+
+// Decisions lists the active decisions known to the LAPI.
+func (s *CrowdSecService) Decisions(ctx context.Context) ([]CrowdSecDecision, error) {
+	settings := s.settings()
+	apiURL, key := settings[CrowdSecAPIURLSetting], settings[CrowdSecBouncerKeySetting]
+	if apiURL == "" || key == "" {
+		return nil, ErrCrowdSecNotConfigured
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, apiURL+"/v1/decisions", nil)
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("X-Api-Key", key)
+
+	// The LAPI answers null when there are no decisions
+	var decisions []CrowdSecDecision
+	if err := s.do(req, &decisions); err != nil {
+		return nil, fmt.Errorf("list decisions: %w", err)
+	}
+	if decisions == nil {
+		decisions = []CrowdSecDecision{}
+	}
+	return decisions, nil
+}
+
+// Ban pushes a manual ban decision for an IP address or CIDR range.
+func (s *CrowdSecService) Ban(ctx context.Context, ban CrowdSecBan) error {
+	scope := "Ip"
+	value := strings.TrimSpace(ban.IP)
+	if _, _, err := net.ParseCIDR(value); err == nil {
+		scope = "Range"
+	} else if net.ParseIP(value) == nil {
+		return fmt.Errorf("%w: invalid IP address %q", ErrInvalidCrowdSecBan, ban.IP)
+	}
+
+	duration := 4 * time.Hour
+	if ban.Duration != "" {
+		d, err := time.ParseDuration(ban.Duration)
+		if err != nil || d <= 0 {
+			return fmt.Errorf("%w: invalid duration %q", ErrInvalidCrowdSecBan, ban.Duration)
+		}
+		duration = d
+	}
+
+	reason := ban.Reason
+	if reason == "" {
+		reason = "manual ban from CPM+"
+	}
+
+	settings := s.settings()
+	apiURL := settings[CrowdSecAPIURLSetting]
+	machineID, password := settings[CrowdSecMachineIDSetting], settings[CrowdSecMachinePasswordSetting]
+	if apiURL == "" || machineID == "" || password == "" {
+		return ErrCrowdSecNotConfigured
+	}
+
+	token, err := s.login(ctx, apiURL, machineID, password)
+	if err != nil {
+		return err
+	}
+
+	// Decisions are pushed wrapped in an alert, the same way cscli decisions add does
+	now := s.now().UTC().Format(time.RFC3339)
+	alerts := []map[string]interface{}{{
+		"scenario":         reason,
+		"scenario_hash":    "",
+		"scenario_version": "",
+		"message":          reason,
+		"events_count":     1,
+		"start_at":         now,
+		"stop_at":          now,
+		"capacity":         0,
+		"leakspeed":        "0",
+		"simulated":        false,
+		"events":           []interface{}{},
+		"source":           map[string]string{"scope": scope, "value": value},
+		"decisions": []map[string]interface{}{{
+			"duration": duration.String(),
+			"origin":   "cscli",
+			"scenario": reason,
+			"scope":    scope,
+			"value":    value,
+			"type":     "ban",
+		}},
+	}}
+
+	req, err := newJSONRequest(ctx, http.MethodPost, apiURL+"/v1/alerts", alerts)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	if err := s.do(req, nil); err != nil {
+		return fmt.Errorf("push ban: %w", err)
+	}
+	return nil
+}
+
+// login exchanges machine credentials for a LAPI JWT.
+func (s *CrowdSecService) login(ctx context.Context, apiURL, machineID, password string) (string, error) {
+	req, err := newJSONRequest(ctx, http.MethodPost, apiURL+"/v1/watchers/login", map[string]interface{}{
+		"machine_id": machineID,
+		"password":   password,
+		"scenarios":  []string{},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	var resp struct {
+		Token string `json:"token"`
+	}
+	if err := s.do(req, &resp); err != nil {
+		return "", fmt.Errorf("machine login: %w", err)
+	}
+	if resp.Token == "" {
+		return "", fmt.Errorf("machine login: no token returned")
+	}
+	return resp.Token, nil
+}
+
+// settings reads the CrowdSec settings, trimming a trailing slash from the URL.
+func (s *CrowdSecService) settings() map[string]string {
+	values := make(map[string]string)
+
+	var settings []models.Setting
+	if err := s.db.Where("key LIKE ?", "crowdsec.%").Find(&settings).Error; err != nil {
+		return values
+	}
+	for _, setting := range settings {
+		values[setting.Key] = strings.TrimSpace(setting.Value)
+	}
+	values[CrowdSecAPIURLSetting] = strings.TrimSuffix(values[CrowdSecAPIURLSetting], "/")
+
+	return values
+}
+
+func newJSONRequest(ctx context.Context, method, url string, body interface{}) (*http.Request, error) {
+	payload, err := json.Marshal(body)
+	if err != nil {
+		return nil, fmt.Errorf("marshal request: %w", err)
+	}
+	req, err := http.NewRequestWithContext(ctx, method, url, bytes.NewReader(payload))
+	if err != nil {
+		return nil, fmt.Errorf("create request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	return req, nil
+}
+
+// do sends a LAPI request and decodes the JSON response into out when non-nil.
+func (s *CrowdSecService) do(req *http.Request, out interface{}) error {
+	resp, err := s.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		body, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("LAPI returned %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	if out == nil {
+		return nil
+	}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("decode response: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,155 @@
+package services
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/models"
+)
+
+// fakeLAPI is a minimal CrowdSec Local API stand-in.
+type fakeLAPI struct {
+	decisions string
+	alerts    []map[string]interface{}
+}
+
+func (f *fakeLAPI) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	switch {
+	case r.Method == http.MethodGet && r.URL.Path == "/v1/decisions":
+		if r.Header.Get("X-Api-Key") != "bouncer-key" {
+			w.WriteHeader(http.StatusForbidden)
+			return
+		}
+		w.Write([]byte(f.decisions))
+	case r.Method == http.MethodPost && r.URL.Path == "/v1/watchers/login":
+		var creds map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&creds)
+		if creds["machine_id"] != "cpm" || creds["password"] != "secret" {
+			w.WriteHeader(http.StatusUnauthorized)
+			w.Write([]byte(`{"message": "incorrect Username or Password"}`))
+			return
+		}
+		w.Write([]byte(`{"code": 200, "expire": "2030-01-01T00:00:00Z", "token": "jwt-token"}`))
+	case r.Method == http.MethodPost && r.URL.Path == "/v1/alerts":
+		if r.Header.Get("Authorization") != "Bearer jwt-token" {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var alerts []map[string]interface{}
+		json.NewDecoder(r.Body).Decode(&alerts)
+		f.alerts = append(f.alerts, alerts...)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`["1"]`))
+	default:
+		w.WriteHeader(http.StatusNotFound)
+	}
+}
+
+func setupCrowdSecTestDB(t *testing.T, settings map[string]string) *gorm.DB {
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.Setting{}))
+	for key, value := range settings {
+		require.NoError(t, db.Create(&models.Setting{Key: key, Value: value, Category: "crowdsec"}).Error)
+	}
+	return db
+}
+
+func TestCrowdSecService_Decisions(t *testing.T) {
+	lapi := &fakeLAPI{decisions: `[
+		{"id": 7, "origin": "crowdsec", "type": "ban", "scope": "Ip", "value": "203.0.113.9", "duration": "3h59m", "scenario": "crowdsecurity/http-probing"}
+	]`}
+	server := httptest.NewServer(lapi)
+	defer server.Close()
+
+	db := setupCrowdSecTestDB(t, map[string]string{
+		CrowdSecAPIURLSetting:     server.URL + "/",
+		CrowdSecBouncerKeySetting: "bouncer-key",
+	})
+	service := NewCrowdSecService(db)
+
+	decisions, err := service.Decisions(context.Background())
+	require.NoError(t, err)
+	require.Len(t, decisions, 1)
+	assert.Equal(t, CrowdSecDecision{
+		ID: 7, Origin: "crowdsec", Type: "ban", Scope: "Ip", Value: "203.0.113.9", Duration: "3h59m", Scenario: "crowdsecurity/http-probing",
+	}, decisions[0])
+
+	// No active decisions
+	lapi.decisions = "null"
+	decisions, err = service.Decisions(context.Background())
+	require.NoError(t, err)
+	assert.Empty(t, decisions)
+	assert.NotNil(t, decisions)
+
+	// Wrong key
+	require.NoError(t, db.Model(&models.Setting{}).Where("key = ?", CrowdSecBouncerKeySetting).Update("value", "wrong").Error)
+	_, err = service.Decisions(context.Background())
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "LAPI returned 403")
+}
+
+func TestCrowdSecService_NotConfigured(t *testing.T) {
+	service := NewCrowdSecService(setupCrowdSecTestDB(t, nil))
+
+	_, err := service.Decisions(context.Background())
+	assert.ErrorIs(t, err, ErrCrowdSecNotConfigured)
+
+	err = service.Ban(context.Background(), CrowdSecBan{IP: "203.0.113.9"})
+	assert.ErrorIs(t, err, ErrCrowdSecNotConfigured)
+}
+
+func TestCrowdSecService_Ban(t *testing.T) {
+	lapi := &fakeLAPI{}
+	server := httptest.NewServer(lapi)
+	defer server.Close()
+
+	db := setupCrowdSecTestDB(t, map[string]string{
+		CrowdSecAPIURLSetting:          server.URL,
+		CrowdSecMachineIDSetting:       "cpm",
+		CrowdSecMachinePasswordSetting: "secret",
+	})
+	service := NewCrowdSecService(db)
+	service.now = func() time.Time { return time.Date(2025, 1, 2, 3, 4, 5, 0, time.UTC) }
+
+	require.NoError(t, service.Ban(context.Background(), CrowdSecBan{IP: "203.0.113.9", Duration: "24h", Reason: "scanner"}))
+	require.NoError(t, service.Ban(context.Background(), CrowdSecBan{IP: "198.51.100.0/24"}))
+	require.Len(t, lapi.alerts, 2)
+
+	alert := lapi.alerts[0]
+	assert.Equal(t, "scanner", alert["scenario"])
+	assert.Equal(t, "2025-01-02T03:04:05Z", alert["start_at"])
+	assert.Equal(t, map[string]interface{}{"scope": "Ip", "value": "203.0.113.9"}, alert["source"])
+	decision := alert["decisions"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "ban", decision["type"])
+	assert.Equal(t, "24h0m0s", decision["duration"])
+	assert.Equal(t, "203.0.113.9", decision["value"])
+
+	decision = lapi.alerts[1]["decisions"].([]interface{})[0].(map[string]interface{})
+	assert.Equal(t, "Range", decision["scope"])
+	assert.Equal(t, "4h0m0s", decision["duration"])
+
+	// Invalid input is rejected before contacting the LAPI
+	err := service.Ban(context.Background(), CrowdSecBan{IP: "not-an-ip"})
+	assert.ErrorIs(t, err, ErrInvalidCrowdSecBan)
+	err = service.Ban(context.Background(), CrowdSecBan{IP: "203.0.113.9", Duration: "forever"})
+	assert.ErrorIs(t, err, ErrInvalidCrowdSecBan)
+	assert.Len(t, lapi.alerts, 2)
+
+	// Bad machine credentials
+	require.NoError(t, db.Model(&models.Setting{}).Where("key = ?", CrowdSecMachinePasswordSetting).Update("value", "wrong").Error)
+	err = service.Ban(context.Background(), CrowdSecBan{IP: "203.0.113.9"})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "machine login")
+}
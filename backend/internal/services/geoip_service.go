@@ -0,0 +1,129 @@
+package services
+
+import (
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/oschwald/maxminddb-golang"
+	"gorm.io/gorm"
+
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/models"
+)
+
+// GeoIPDatabaseSetting is the setting holding the path of the MaxMind
+// GeoLite2/GeoIP2 country or city database shared with Caddy.
+const GeoIPDatabaseSetting = "caddy.geoip_database"
+
+// geoIPSettingRefresh is how long the configured database path is cached
+// before the setting is read again.
+const geoIPSettingRefresh = 30 * time.Second
+
+// GeoIPService looks up client countries in a local MaxMind database.
+// The database is reopened whenever the configured path changes.
+type GeoIPService struct {
+	db      *gorm.DB
+	mu      sync.RWMutex // Read-held across lookups, so the reader isn't closed under them
+	path    string
+	reader  *maxminddb.Reader
+	err     error     // Error opening path, retried at the next refresh
+	checked time.Time // When the setting was last read
+	now     func() time.Time
+}
+
+// NewGeoIPService creates a new GeoIP lookup service.
+func NewGeoIPService(db *gorm.DB) *GeoIPService {
+	return &GeoIPService{
+		db:  db,
+		now: time.Now,
+	}
+}
+
+type geoIPRecord struct {
+	Country struct {
+		ISOCode string `maxminddb:"iso_code"`
+	} `maxminddb:"country"`
+}
+
+// Country returns the ISO country code of an IP address, or "" when it is
+// unknown or no database is configured.
+func (s *GeoIPService) Country(ip string) (string, error) {
+	addr := net.ParseIP(strings.TrimSpace(ip))
+	if addr == nil {
+		return "", nil
+	}
+
+	if err := s.refresh(); err != nil {
+		return "", err
+	}
+
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+	if s.reader == nil {
+		return "", nil
+	}
+
+	var record geoIPRecord
+	if err := s.reader.Lookup(addr, &record); err != nil {
+		return "", err
+	}
+	return record.Country.ISOCode, nil
+}
+
+// refresh opens the configured database when its path changed, closing the
+// previous one once no lookup uses it. The setting is read at most every
+// geoIPSettingRefresh, not for every lookup.
+func (s *GeoIPService) refresh() error {
+	s.mu.RLock()
+	fresh := !s.checked.IsZero() && s.now().Sub(s.checked) < geoIPSettingRefresh
+	openErr := s.err
+	s.mu.RUnlock()
+	if fresh {
+		return openErr
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := s.now()
+	if !s.checked.IsZero() && now.Sub(s.checked) < geoIPSettingRefresh {
+		return s.err
+	}
+	s.checked = now
+
+	var setting models.Setting
+	path := ""
+	err := s.db.Where("key = ?", GeoIPDatabaseSetting).First(&setting).Error
+	switch {
+	case err == nil:
+		path = strings.TrimSpace(setting.Value)
+	case !errors.Is(err, gorm.ErrRecordNotFound):
+		// Keep the open database until the setting can be read
+		return nil
+	}
+
+	if path == s.path && s.err == nil {
+		return nil
+	}
+
+	if s.reader != nil {
+		s.reader.Close()
+		s.reader = nil
+	}
+	s.path = path
+	s.err = nil
+	if path == "" {
+		return nil
+	}
+
+	reader, err := maxminddb.Open(path)
+	if err != nil {
+		// The file may not be downloaded yet
+		s.err = err
+		return err
+	}
+	s.reader = reader
+	return nil
+}
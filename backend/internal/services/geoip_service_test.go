@@ -0,0 +1,149 @@
+package services
+
+import (
+	"fmt"
+	"net"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/maxmind/mmdbwriter"
+	"github.com/maxmind/mmdbwriter/mmdbtype"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/models"
+)
+
+// writeGeoIPFixture writes a small GeoLite2-Country style database mapping
+// each network to a country code and returns its path.
+func writeGeoIPFixture(t *testing.T, networks map[string]string) string {
+	t.Helper()
+
+	writer, err := mmdbwriter.New(mmdbwriter.Options{DatabaseType: "GeoLite2-Country", RecordSize: 24})
+	require.NoError(t, err)
+
+	for cidr, code := range networks {
+		_, network, err := net.ParseCIDR(cidr)
+		require.NoError(t, err)
+		require.NoError(t, writer.Insert(network, mmdbtype.Map{
+			"country": mmdbtype.Map{"iso_code": mmdbtype.String(code)},
+		}))
+	}
+
+	path := filepath.Join(t.TempDir(), "GeoLite2-Country.mmdb")
+	file, err := os.Create(path)
+	require.NoError(t, err)
+	defer file.Close()
+	_, err = writer.WriteTo(file)
+	require.NoError(t, err)
+
+	return path
+}
+
+func setupGeoIPTestDB(t *testing.T) *gorm.DB {
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.Setting{}))
+	return db
+}
+
+func TestGeoIPService_Country(t *testing.T) {
+	db := setupGeoIPTestDB(t)
+	service := NewGeoIPService(db)
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	service.now = func() time.Time { return now }
+
+	// No database configured
+	country, err := service.Country("1.2.3.4")
+	require.NoError(t, err)
+	assert.Empty(t, country)
+
+	path := writeGeoIPFixture(t, map[string]string{
+		"1.2.3.0/24": "DE",
+		"5.6.0.0/16": "US",
+	})
+	require.NoError(t, db.Create(&models.Setting{Key: GeoIPDatabaseSetting, Value: path}).Error)
+	now = now.Add(geoIPSettingRefresh)
+
+	country, err = service.Country("1.2.3.4")
+	require.NoError(t, err)
+	assert.Equal(t, "DE", country)
+
+	country, err = service.Country("5.6.7.8")
+	require.NoError(t, err)
+	assert.Equal(t, "US", country)
+
+	country, err = service.Country("9.9.9.9")
+	require.NoError(t, err)
+	assert.Empty(t, country)
+
+	country, err = service.Country("not-an-ip")
+	require.NoError(t, err)
+	assert.Empty(t, country)
+
+	// A new path is picked up without restarting
+	other := writeGeoIPFixture(t, map[string]string{"1.2.3.0/24": "FR"})
+	require.NoError(t, db.Model(&models.Setting{}).Where("key = ?", GeoIPDatabaseSetting).Update("value", other).Error)
+
+	// The setting is cached between refreshes, not read for every lookup
+	country, err = service.Country("1.2.3.4")
+	require.NoError(t, err)
+	assert.Equal(t, "DE", country)
+
+	now = now.Add(geoIPSettingRefresh)
+	country, err = service.Country("1.2.3.4")
+	require.NoError(t, err)
+	assert.Equal(t, "FR", country)
+}
+
+func TestGeoIPService_MissingDatabase(t *testing.T) {
+	db := setupGeoIPTestDB(t)
+	require.NoError(t, db.Create(&models.Setting{Key: GeoIPDatabaseSetting, Value: "/nonexistent/GeoLite2-Country.mmdb"}).Error)
+
+	_, err := NewGeoIPService(db).Country("1.2.3.4")
+	assert.Error(t, err)
+}
+
+func TestGeoIPService_PathChangeDuringLookups(t *testing.T) {
+	db := setupGeoIPTestDB(t)
+	paths := []string{
+		writeGeoIPFixture(t, map[string]string{"1.2.3.0/24": "DE"}),
+		writeGeoIPFixture(t, map[string]string{"1.2.3.0/24": "FR"}),
+	}
+	require.NoError(t, db.Create(&models.Setting{Key: GeoIPDatabaseSetting, Value: paths[0]}).Error)
+	// One connection, so sqlite doesn't report the settings table locked
+	sqlDB, err := db.DB()
+	require.NoError(t, err)
+	sqlDB.SetMaxOpenConns(1)
+
+	// Every lookup is due to re-read the setting
+	service := NewGeoIPService(db)
+	var ticks atomic.Int64
+	service.now = func() time.Time {
+		return time.Unix(ticks.Add(int64(geoIPSettingRefresh/time.Second)), 0)
+	}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 4; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 500; j++ {
+				country, err := service.Country("1.2.3.4")
+				assert.NoError(t, err)
+				assert.Contains(t, []string{"DE", "FR"}, country)
+			}
+		}()
+	}
+	for i := 0; i < 200; i++ {
+		require.NoError(t, db.Model(&models.Setting{}).Where("key = ?", GeoIPDatabaseSetting).Update("value", paths[i%2]).Error)
+	}
+	wg.Wait()
+}
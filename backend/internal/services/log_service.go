@@ -17,6 +17,8 @@ import (
 
 type LogService struct {
 	LogDir string
+	// GeoIP adds client countries to queried entries when set.
+	GeoIP *GeoIPService
 }
 
 func NewLogService(cfg *config.Config) *LogService {
@@ -111,7 +113,9 @@ func (s *LogService) QueryLogs(filename string, filter models.LogFilter) ([]mode
 		}
 
 		var entry models.CaddyAccessLog
-		if err := json.Unmarshal([]byte(line), &entry); err != nil {
+		if wafEntry, ok := parseWAFAuditLine(line); ok {
+			entry = wafEntry
+		} else if err := json.Unmarshal([]byte(line), &entry); err != nil {
 			// Handle non-JSON logs (like cpmp.log)
 			// Try to parse standard Go log format: "2006/01/02 15:04:05 msg"
 			parts := strings.SplitN(line, " ", 3)
@@ -157,7 +161,33 @@ func (s *LogService) QueryLogs(filename string, filter models.LogFilter) ([]mode
 		end = len(logs)
 	}
 
-	return logs[start:end], totalMatches, nil
+	page := logs[start:end]
+	s.addCountries(page)
+
+	return page, totalMatches, nil
+}
+
+// addCountries looks up the client country of each entry.
+func (s *LogService) addCountries(logs []models.CaddyAccessLog) {
+	if s.GeoIP == nil {
+		return
+	}
+
+	for i := range logs {
+		ip := logs[i].Request.ClientIP
+		if ip == "" {
+			ip = logs[i].Request.RemoteIP
+		}
+		if ip == "" {
+			continue
+		}
+		country, err := s.GeoIP.Country(ip)
+		if err != nil {
+			// Missing or unreadable database, leave entries as they are
+			return
+		}
+		logs[i].Country = country
+	}
 }
 
 func (s *LogService) matchesFilter(entry models.CaddyAccessLog, filter models.LogFilter) bool {
@@ -196,7 +226,8 @@ func (s *LogService) matchesFilter(entry models.CaddyAccessLog, filter models.Lo
 		if !strings.Contains(strings.ToLower(entry.Request.URI), term) &&
 			!strings.Contains(strings.ToLower(entry.Request.Method), term) &&
 			!strings.Contains(strings.ToLower(entry.Request.RemoteIP), term) &&
-			!strings.Contains(strings.ToLower(entry.Msg), term) {
+			!strings.Contains(strings.ToLower(entry.Msg), term) &&
+			!wafRuleMatches(entry.WAF, term) {
 			return false
 		}
 	}
@@ -166,3 +166,32 @@ func TestLogService(t *testing.T) {
 	assert.Equal(t, int64(1), total)
 	assert.Equal(t, "5.6.7.8", results[0].Request.RemoteIP)
 }
+
+func TestLogService_QueryLogs_Countries(t *testing.T) {
+	dataDir := t.TempDir()
+	logsDir := filepath.Join(dataDir, "logs")
+	require.NoError(t, os.MkdirAll(logsDir, 0755))
+
+	var content string
+	for _, ip := range []string{"1.2.3.4", "9.9.9.9"} {
+		entry := models.CaddyAccessLog{Level: "info", Status: 200}
+		entry.Request.RemoteIP = "10.0.0.1"
+		entry.Request.ClientIP = ip
+		line, _ := json.Marshal(entry)
+		content += string(line) + "\n"
+	}
+	require.NoError(t, os.WriteFile(filepath.Join(logsDir, "access.log"), []byte(content), 0644))
+
+	db := setupGeoIPTestDB(t)
+	path := writeGeoIPFixture(t, map[string]string{"1.2.3.0/24": "DE"})
+	require.NoError(t, db.Create(&models.Setting{Key: GeoIPDatabaseSetting, Value: path}).Error)
+
+	service := NewLogService(&config.Config{DatabasePath: filepath.Join(dataDir, "cpm.db")})
+	service.GeoIP = NewGeoIPService(db)
+
+	results, _, err := service.QueryLogs("access.log", models.LogFilter{Limit: 10})
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	assert.Empty(t, results[0].Country)
+	assert.Equal(t, "DE", results[1].Country)
+}
@@ -0,0 +1,147 @@
+package services
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"gorm.io/gorm"
+
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/models"
+)
+
+// ErrOnDemandRateLimited is returned when too many on-demand certificates were approved recently.
+var ErrOnDemandRateLimited = errors.New("on-demand certificate rate limit exceeded")
+
+// OnDemandService decides whether Caddy may obtain an on-demand certificate
+// for a domain. Only domains known to CPM+ (proxy hosts or the domain list) are approved.
+type OnDemandService struct {
+	db        *gorm.DB
+	mu        sync.Mutex
+	approvals []time.Time
+	now       func() time.Time
+}
+
+// NewOnDemandService creates a new on-demand TLS service.
+func NewOnDemandService(db *gorm.DB) *OnDemandService {
+	return &OnDemandService{
+		db:  db,
+		now: time.Now,
+	}
+}
+
+// Check reports whether a certificate may be issued for the domain.
+// Approvals are rate limited by the caddy.on_demand_interval and
+// caddy.on_demand_burst settings.
+func (s *OnDemandService) Check(domain string) (bool, error) {
+	domain = strings.ToLower(strings.TrimSuffix(strings.TrimSpace(domain), "."))
+	if domain == "" {
+		return false, nil
+	}
+
+	known, err := s.isKnownDomain(domain)
+	if err != nil || !known {
+		return false, err
+	}
+
+	if !s.allow() {
+		return false, ErrOnDemandRateLimited
+	}
+
+	return true, nil
+}
+
+// isKnownDomain looks the domain up in enabled proxy hosts and the domain list.
+func (s *OnDemandService) isKnownDomain(domain string) (bool, error) {
+	var domains []models.Domain
+	if err := s.db.Find(&domains).Error; err != nil {
+		return false, err
+	}
+	for _, d := range domains {
+		if domainMatches(d.Name, domain) {
+			return true, nil
+		}
+	}
+
+	var hosts []models.ProxyHost
+	if err := s.db.Where("enabled = ?", true).Find(&hosts).Error; err != nil {
+		return false, err
+	}
+	for _, host := range hosts {
+		for _, name := range strings.Split(host.DomainNames, ",") {
+			if domainMatches(name, domain) {
+				return true, nil
+			}
+		}
+	}
+
+	return false, nil
+}
+
+// allow records an approval unless the configured rate limit is exhausted.
+func (s *OnDemandService) allow() bool {
+	interval, burst := s.rateLimit()
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if interval <= 0 || burst <= 0 {
+		return true
+	}
+
+	cutoff := s.now().Add(-interval)
+	recent := s.approvals[:0]
+	for _, t := range s.approvals {
+		if t.After(cutoff) {
+			recent = append(recent, t)
+		}
+	}
+	s.approvals = recent
+
+	if len(s.approvals) >= burst {
+		return false
+	}
+
+	s.approvals = append(s.approvals, s.now())
+	return true
+}
+
+// rateLimit reads the approval window and burst size from settings.
+// A zero value for either disables rate limiting.
+func (s *OnDemandService) rateLimit() (time.Duration, int) {
+	var settings []models.Setting
+	if err := s.db.Where("key IN ?", []string{"caddy.on_demand_interval", "caddy.on_demand_burst"}).Find(&settings).Error; err != nil {
+		return 0, 0
+	}
+
+	var interval time.Duration
+	var burst int
+	for _, setting := range settings {
+		switch setting.Key {
+		case "caddy.on_demand_interval":
+			interval, _ = time.ParseDuration(setting.Value)
+		case "caddy.on_demand_burst":
+			burst, _ = strconv.Atoi(setting.Value)
+		}
+	}
+
+	return interval, burst
+}
+
+// domainMatches compares a configured name against a requested domain.
+// A leading "*." wildcard matches exactly one label.
+func domainMatches(pattern, domain string) bool {
+	pattern = strings.ToLower(strings.TrimSpace(pattern))
+	if pattern == domain {
+		return true
+	}
+
+	if strings.HasPrefix(pattern, "*.") {
+		idx := strings.Index(domain, ".")
+		return idx > 0 && domain[idx+1:] == pattern[2:]
+	}
+
+	return false
+}
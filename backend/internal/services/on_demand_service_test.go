@@ -0,0 +1,88 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/models"
+)
+
+func setupOnDemandTestDB(t *testing.T) *gorm.DB {
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.ProxyHost{}, &models.Domain{}, &models.Setting{}))
+	return db
+}
+
+func TestOnDemandService_Check(t *testing.T) {
+	db := setupOnDemandTestDB(t)
+	service := NewOnDemandService(db)
+
+	require.NoError(t, db.Create(&models.Domain{Name: "shop.customer.com"}).Error)
+	require.NoError(t, db.Create(&models.Domain{Name: "*.tenants.example.com"}).Error)
+	require.NoError(t, db.Create(&models.ProxyHost{UUID: "h1", DomainNames: "app.example.com, www.example.com", ForwardHost: "app", ForwardPort: 80, Enabled: true}).Error)
+
+	disabled := &models.ProxyHost{UUID: "h2", DomainNames: "old.example.com", ForwardHost: "app", ForwardPort: 80}
+	require.NoError(t, db.Create(disabled).Error)
+	require.NoError(t, db.Model(disabled).Update("enabled", false).Error)
+
+	tests := []struct {
+		domain  string
+		allowed bool
+	}{
+		{"shop.customer.com", true},
+		{"SHOP.customer.com.", true},
+		{"acme.tenants.example.com", true},
+		{"a.b.tenants.example.com", false},
+		{"www.example.com", true},
+		{"old.example.com", false},
+		{"evil.com", false},
+		{"", false},
+	}
+
+	for _, tt := range tests {
+		allowed, err := service.Check(tt.domain)
+		assert.NoError(t, err, tt.domain)
+		assert.Equal(t, tt.allowed, allowed, tt.domain)
+	}
+}
+
+func TestOnDemandService_RateLimit(t *testing.T) {
+	db := setupOnDemandTestDB(t)
+	service := NewOnDemandService(db)
+
+	now := time.Now()
+	service.now = func() time.Time { return now }
+
+	require.NoError(t, db.Create(&models.Domain{Name: "a.customer.com"}).Error)
+	require.NoError(t, db.Create(&models.Setting{Key: "caddy.on_demand_interval", Value: "1m"}).Error)
+	require.NoError(t, db.Create(&models.Setting{Key: "caddy.on_demand_burst", Value: "2"}).Error)
+
+	for i := 0; i < 2; i++ {
+		allowed, err := service.Check("a.customer.com")
+		require.NoError(t, err)
+		require.True(t, allowed)
+	}
+
+	allowed, err := service.Check("a.customer.com")
+	assert.ErrorIs(t, err, ErrOnDemandRateLimited)
+	assert.False(t, allowed)
+
+	// Unknown domains are rejected without consuming the budget
+	allowed, err = service.Check("unknown.com")
+	assert.NoError(t, err)
+	assert.False(t, allowed)
+
+	// The window slides forward
+	now = now.Add(61 * time.Second)
+	allowed, err = service.Check("a.customer.com")
+	assert.NoError(t, err)
+	assert.True(t, allowed)
+}
@@ -1,14 +1,20 @@
 package services
 
 import (
+	"context"
+	"encoding/json"
 	"errors"
 	"fmt"
 	"net"
+	"reflect"
 	"strconv"
+	"strings"
 	"time"
 
+	"github.com/google/uuid"
 	"gorm.io/gorm"
 
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/database"
 	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/models"
 )
 
@@ -23,37 +29,140 @@ func NewProxyHostService(db *gorm.DB) *ProxyHostService {
 }
 
 // ValidateUniqueDomain ensures no duplicate domains exist before creation/update.
-func (s *ProxyHostService) ValidateUniqueDomain(domainNames string, excludeID uint) error {
-	var count int64
-	query := s.db.Model(&models.ProxyHost{}).Where("domain_names = ?", domainNames)
+// Domains are compared one at a time, as imports do. Secondary names added
+// by a canonical www/apex redirect must not be claimed by another host,
+// either as one of its domains or as its own secondary name.
+func (s *ProxyHostService) ValidateUniqueDomain(domainNames, canonicalHost string, excludeID uint) error {
+	used, err := s.UsedDomains(domainNames, excludeID)
+	if err != nil {
+		return err
+	}
+	if len(used) > 0 {
+		return fmt.Errorf("domain %s already exists", strings.Join(used, ", "))
+	}
+
+	aliases := models.CanonicalAliases(domainNames, canonicalHost)
+	if len(aliases) == 0 {
+		return nil
+	}
+	used, err = s.UsedDomains(strings.Join(aliases, ","), excludeID)
+	if err != nil {
+		return err
+	}
+	if len(used) > 0 {
+		return fmt.Errorf("redirect domain %s is already used by another host", strings.Join(used, ", "))
+	}
+
+	return nil
+}
+
+// ValidateNodes ensures every node a host is assigned to names the local
+// Caddy, a Caddy node or a node label.
+func (s *ProxyHostService) ValidateNodes(selectors []string) error {
+	if len(selectors) == 0 {
+		return nil
+	}
+
+	var nodes []models.CaddyNode
+	if err := s.db.Select("name", "labels").Find(&nodes).Error; err != nil {
+		return fmt.Errorf("checking nodes: %w", err)
+	}
+	for _, selector := range selectors {
+		known := selector == models.LocalNode
+		for _, node := range nodes {
+			known = known || node.Matches(selector)
+		}
+		if !known {
+			return fmt.Errorf("unknown caddy node or label %q", selector)
+		}
+	}
+	return nil
+}
 
+// UsedDomains returns the domains of domainNames that existing hosts other
+// than excludeID already serve, as one of their domains or a canonical
+// redirect, comparing one domain at a time.
+func (s *ProxyHostService) UsedDomains(domainNames string, excludeID uint) ([]string, error) {
+	var hosts []models.ProxyHost
+	query := s.db.Select("id", "domain_names", "canonical_host")
 	if excludeID > 0 {
 		query = query.Where("id != ?", excludeID)
 	}
+	if err := query.Find(&hosts).Error; err != nil {
+		return nil, fmt.Errorf("checking domain uniqueness: %w", err)
+	}
 
-	if err := query.Count(&count).Error; err != nil {
-		return fmt.Errorf("checking domain uniqueness: %w", err)
+	served := make(map[string]bool)
+	for _, host := range hosts {
+		for _, name := range splitDomainNames(host.DomainNames) {
+			served[name] = true
+		}
+		for _, name := range models.CanonicalAliases(host.DomainNames, host.CanonicalHost) {
+			served[name] = true
+		}
 	}
 
-	if count > 0 {
-		return errors.New("domain already exists")
+	used := make([]string, 0)
+	for _, name := range splitDomainNames(domainNames) {
+		if served[name] {
+			used = append(used, name)
+		}
 	}
+	return used, nil
+}
 
-	return nil
+// splitDomainNames parses a comma-separated domain list into lower-case names.
+func splitDomainNames(domainNames string) []string {
+	domains := make([]string, 0)
+	for _, d := range strings.Split(domainNames, ",") {
+		if d = strings.ToLower(strings.TrimSpace(d)); d != "" {
+			domains = append(domains, d)
+		}
+	}
+	return domains
 }
 
 // Create validates and creates a new proxy host.
 func (s *ProxyHostService) Create(host *models.ProxyHost) error {
-	if err := s.ValidateUniqueDomain(host.DomainNames, 0); err != nil {
+	if err := s.ValidateUniqueDomain(host.DomainNames, host.CanonicalHost, 0); err != nil {
+		return err
+	}
+	if err := s.ValidateNodes(host.Nodes); err != nil {
 		return err
 	}
 
 	return s.db.Create(host).Error
 }
 
+// ApplyDefaults fills the zero fields of a host that is not saved yet with
+// their column defaults, the values Create would store for them.
+func (s *ProxyHostService) ApplyDefaults(host *models.ProxyHost) error {
+	stmt := &gorm.Statement{DB: s.db}
+	if err := stmt.Parse(host); err != nil {
+		return fmt.Errorf("parse proxy host schema: %w", err)
+	}
+
+	ctx := context.Background()
+	value := reflect.ValueOf(host).Elem()
+	for _, field := range stmt.Schema.Fields {
+		if !field.HasDefaultValue || field.DefaultValueInterface == nil {
+			continue
+		}
+		if _, zero := field.ValueOf(ctx, value); zero {
+			if err := field.Set(ctx, value, field.DefaultValueInterface); err != nil {
+				return fmt.Errorf("default %s: %w", field.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
 // Update validates and updates an existing proxy host.
 func (s *ProxyHostService) Update(host *models.ProxyHost) error {
-	if err := s.ValidateUniqueDomain(host.DomainNames, host.ID); err != nil {
+	if err := s.ValidateUniqueDomain(host.DomainNames, host.CanonicalHost, host.ID); err != nil {
+		return err
+	}
+	if err := s.ValidateNodes(host.Nodes); err != nil {
 		return err
 	}
 
@@ -65,6 +174,50 @@ func (s *ProxyHostService) Delete(id uint) error {
 	return s.db.Delete(&models.ProxyHost{}, id).Error
 }
 
+// Restore puts back a host, with its locations and upstream groups, as it
+// was loaded before a change, undoing the change.
+func (s *ProxyHostService) Restore(host *models.ProxyHost) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		if err := purgeHost(tx, host.ID); err != nil {
+			return err
+		}
+		if err := database.InsertRow(tx, host); err != nil {
+			return fmt.Errorf("restore proxy host %s: %w", host.DomainNames, err)
+		}
+		for i := range host.Locations {
+			if err := database.InsertRow(tx, &host.Locations[i]); err != nil {
+				return fmt.Errorf("restore location %s: %w", host.Locations[i].Path, err)
+			}
+		}
+		for i := range host.UpstreamGroups {
+			if err := database.InsertRow(tx, &host.UpstreamGroups[i]); err != nil {
+				return fmt.Errorf("restore upstream group %s: %w", host.UpstreamGroups[i].Name, err)
+			}
+		}
+		return nil
+	})
+}
+
+// Purge removes a host with its locations and upstream groups, undoing its creation.
+func (s *ProxyHostService) Purge(id uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		return purgeHost(tx, id)
+	})
+}
+
+func purgeHost(tx *gorm.DB, id uint) error {
+	if err := tx.Where("proxy_host_id = ?", id).Delete(&models.Location{}).Error; err != nil {
+		return fmt.Errorf("delete locations: %w", err)
+	}
+	if err := tx.Where("proxy_host_id = ?", id).Delete(&models.UpstreamGroup{}).Error; err != nil {
+		return fmt.Errorf("delete upstream groups: %w", err)
+	}
+	if err := tx.Delete(&models.ProxyHost{}, id).Error; err != nil {
+		return fmt.Errorf("delete proxy host: %w", err)
+	}
+	return nil
+}
+
 // GetByID retrieves a proxy host by ID.
 func (s *ProxyHostService) GetByID(id uint) (*models.ProxyHost, error) {
 	var host models.ProxyHost
@@ -77,7 +230,7 @@ func (s *ProxyHostService) GetByID(id uint) (*models.ProxyHost, error) {
 // GetByUUID finds a proxy host by UUID.
 func (s *ProxyHostService) GetByUUID(uuid string) (*models.ProxyHost, error) {
 	var host models.ProxyHost
-	if err := s.db.Preload("Locations").Where("uuid = ?", uuid).First(&host).Error; err != nil {
+	if err := s.db.Preload("Locations").Preload("UpstreamGroups").Where("uuid = ?", uuid).First(&host).Error; err != nil {
 		return nil, err
 	}
 	return &host, nil
@@ -86,12 +239,112 @@ func (s *ProxyHostService) GetByUUID(uuid string) (*models.ProxyHost, error) {
 // List returns all proxy hosts.
 func (s *ProxyHostService) List() ([]models.ProxyHost, error) {
 	var hosts []models.ProxyHost
-	if err := s.db.Preload("Locations").Order("updated_at desc").Find(&hosts).Error; err != nil {
+	if err := s.db.Preload("Locations").Preload("UpstreamGroups").Order("updated_at desc").Find(&hosts).Error; err != nil {
 		return nil, err
 	}
 	return hosts, nil
 }
 
+// TrafficSplitUpdate describes a new traffic split for a proxy host.
+type TrafficSplitUpdate struct {
+	Groups         []models.UpstreamGroup `json:"groups"`
+	StickyCookie   string                 `json:"sticky_cookie"`
+	OverrideHeader string                 `json:"override_header"`
+	Reason         string                 `json:"reason"`
+}
+
+// UpdateTrafficSplit replaces a host's upstream groups and split options and
+// records the change in the audit trail. Groups are matched by name so their
+// UUIDs survive weight changes.
+func (s *ProxyHostService) UpdateTrafficSplit(host *models.ProxyHost, update TrafficSplitUpdate, changedBy uint) error {
+	return s.db.Transaction(func(tx *gorm.DB) error {
+		var existing []models.UpstreamGroup
+		if err := tx.Where("proxy_host_id = ?", host.ID).Find(&existing).Error; err != nil {
+			return fmt.Errorf("fetch upstream groups: %w", err)
+		}
+
+		byName := make(map[string]models.UpstreamGroup)
+		for _, g := range existing {
+			byName[g.Name] = g
+		}
+
+		type auditGroup struct {
+			Name   string `json:"name"`
+			Target string `json:"target"`
+			Weight int    `json:"weight"`
+		}
+		audit := make([]auditGroup, 0, len(update.Groups))
+
+		for _, g := range update.Groups {
+			if prev, ok := byName[g.Name]; ok {
+				g.ID = prev.ID
+				g.UUID = prev.UUID
+				g.CreatedAt = prev.CreatedAt
+				delete(byName, g.Name)
+			} else {
+				g.ID = 0
+				g.UUID = uuid.NewString()
+			}
+			g.ProxyHostID = host.ID
+			if g.ForwardScheme == "" {
+				g.ForwardScheme = "http"
+			}
+
+			if err := tx.Save(&g).Error; err != nil {
+				return fmt.Errorf("save upstream group %s: %w", g.Name, err)
+			}
+
+			audit = append(audit, auditGroup{
+				Name:   g.Name,
+				Target: fmt.Sprintf("%s:%d", g.ForwardHost, g.ForwardPort),
+				Weight: g.Weight,
+			})
+		}
+
+		for _, g := range byName {
+			if err := tx.Delete(&g).Error; err != nil {
+				return fmt.Errorf("delete upstream group %s: %w", g.Name, err)
+			}
+		}
+
+		if err := tx.Model(&models.ProxyHost{}).Where("id = ?", host.ID).Updates(map[string]interface{}{
+			"split_sticky_cookie":   update.StickyCookie,
+			"split_override_header": update.OverrideHeader,
+		}).Error; err != nil {
+			return fmt.Errorf("update proxy host: %w", err)
+		}
+		host.SplitStickyCookie = update.StickyCookie
+		host.SplitOverrideHeader = update.OverrideHeader
+
+		groupsJSON, err := json.Marshal(audit)
+		if err != nil {
+			return fmt.Errorf("marshal audit record: %w", err)
+		}
+
+		change := models.TrafficSplitChange{
+			ProxyHostID: host.ID,
+			Groups:      string(groupsJSON),
+			ChangedBy:   changedBy,
+			Reason:      update.Reason,
+		}
+		if err := tx.Create(&change).Error; err != nil {
+			return fmt.Errorf("record traffic split change: %w", err)
+		}
+
+		host.UpstreamGroups = nil
+		return tx.Where("proxy_host_id = ?", host.ID).Order("id").Find(&host.UpstreamGroups).Error
+	})
+}
+
+// ListTrafficSplitChanges returns the traffic split audit trail for a host, newest first.
+func (s *ProxyHostService) ListTrafficSplitChanges(hostID uint) ([]models.TrafficSplitChange, error) {
+	var changes []models.TrafficSplitChange
+	if err := s.db.Where("proxy_host_id = ?", hostID).Order("created_at desc, id desc").Find(&changes).Error; err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
 // TestConnection attempts to connect to the target host and port.
 func (s *ProxyHostService) TestConnection(host string, port int) error {
 	if host == "" || port <= 0 {
@@ -16,7 +16,7 @@ func setupProxyHostTestDB(t *testing.T) *gorm.DB {
 	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())
 	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
 	require.NoError(t, err)
-	require.NoError(t, db.AutoMigrate(&models.ProxyHost{}, &models.Location{}))
+	require.NoError(t, db.AutoMigrate(&models.ProxyHost{}, &models.Location{}, &models.UpstreamGroup{}))
 	return db
 }
 
@@ -26,7 +26,7 @@ func TestProxyHostService_ValidateUniqueDomain(t *testing.T) {
 
 	// Create existing host
 	existing := &models.ProxyHost{
-		DomainNames: "example.com",
+		DomainNames: "example.com, api.example.com",
 		ForwardHost: "127.0.0.1",
 		ForwardPort: 8080,
 	}
@@ -50,6 +50,12 @@ func TestProxyHostService_ValidateUniqueDomain(t *testing.T) {
 			excludeID:   0,
 			wantErr:     true,
 		},
+		{
+			name:        "One of the host's domains, in another case",
+			domainNames: "new.example.com, API.example.com",
+			excludeID:   0,
+			wantErr:     true,
+		},
 		{
 			name:        "Same domain but excluded ID (update self)",
 			domainNames: "example.com",
@@ -60,7 +66,7 @@ func TestProxyHostService_ValidateUniqueDomain(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			err := service.ValidateUniqueDomain(tt.domainNames, tt.excludeID)
+			err := service.ValidateUniqueDomain(tt.domainNames, "", tt.excludeID)
 			if tt.wantErr {
 				assert.Error(t, err)
 			} else {
@@ -70,6 +76,62 @@ func TestProxyHostService_ValidateUniqueDomain(t *testing.T) {
 	}
 }
 
+func TestProxyHostService_ValidateUniqueDomain_CanonicalHost(t *testing.T) {
+	db := setupProxyHostTestDB(t)
+	service := NewProxyHostService(db)
+
+	require.NoError(t, db.Create(&models.ProxyHost{UUID: "uuid-blog", DomainNames: "www.blog.com", ForwardHost: "blog", ForwardPort: 80}).Error)
+	require.NoError(t, db.Create(&models.ProxyHost{UUID: "uuid-shop", DomainNames: "shop.com", CanonicalHost: models.CanonicalHostApex, ForwardHost: "shop", ForwardPort: 80}).Error)
+
+	tests := []struct {
+		name          string
+		domainNames   string
+		canonicalHost string
+		wantErr       string
+	}{
+		{"alias claimed as domain", "blog.com", models.CanonicalHostApex, "redirect domain www.blog.com is already used"},
+		{"domain and alias claimed", "www.shop.com", models.CanonicalHostWWW, "domain www.shop.com already exists"},
+		{"domain claimed as alias", "www.shop.com", "", "domain www.shop.com already exists"},
+		{"no conflict", "example.com", models.CanonicalHostApex, ""},
+		{"canonical off", "blog.com", "", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := service.ValidateUniqueDomain(tt.domainNames, tt.canonicalHost, 0)
+			if tt.wantErr == "" {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tt.wantErr)
+		})
+	}
+}
+
+func TestProxyHostService_UsedDomains(t *testing.T) {
+	db := setupProxyHostTestDB(t)
+	service := NewProxyHostService(db)
+
+	require.NoError(t, db.Create(&models.ProxyHost{UUID: "uuid-app", DomainNames: "a.com, b.com", ForwardHost: "app", ForwardPort: 80}).Error)
+	require.NoError(t, db.Create(&models.ProxyHost{UUID: "uuid-shop", DomainNames: "shop.com", CanonicalHost: models.CanonicalHostApex, ForwardHost: "shop", ForwardPort: 80}).Error)
+
+	used, err := service.UsedDomains("B.com, c.com, www.shop.com", 0)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"b.com", "www.shop.com"}, used)
+
+	used, err = service.UsedDomains("c.com", 0)
+	require.NoError(t, err)
+	assert.Empty(t, used)
+
+	// A host doesn't conflict with itself
+	var app models.ProxyHost
+	require.NoError(t, db.Where("uuid = ?", "uuid-app").First(&app).Error)
+	used, err = service.UsedDomains("b.com", app.ID)
+	require.NoError(t, err)
+	assert.Empty(t, used)
+}
+
 func TestProxyHostService_CRUD(t *testing.T) {
 	db := setupProxyHostTestDB(t)
 	service := NewProxyHostService(db)
@@ -140,6 +202,52 @@ func TestProxyHostService_CRUD(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestProxyHostService_RestorePurge(t *testing.T) {
+	db := setupProxyHostTestDB(t)
+	service := NewProxyHostService(db)
+
+	host := &models.ProxyHost{
+		UUID:        "uuid-1",
+		DomainNames: "test.example.com",
+		ForwardHost: "127.0.0.1",
+		ForwardPort: 8080,
+		Locations:   []models.Location{{Path: "/api", ForwardHost: "api", ForwardPort: 8081}},
+	}
+	require.NoError(t, service.Create(host))
+	require.NoError(t, db.Model(host).Update("block_exploits", false).Error)
+	previous, err := service.GetByUUID("uuid-1")
+	require.NoError(t, err)
+	require.False(t, previous.BlockExploits)
+
+	// Restore undoes an update, locations included
+	host.ForwardPort = 9090
+	host.Locations = nil
+	require.NoError(t, service.Update(host))
+	require.NoError(t, db.Where("proxy_host_id = ?", host.ID).Delete(&models.Location{}).Error)
+	require.NoError(t, service.Restore(previous))
+
+	restored, err := service.GetByUUID("uuid-1")
+	require.NoError(t, err)
+	assert.Equal(t, 8080, restored.ForwardPort)
+	assert.False(t, restored.BlockExploits)
+	require.Len(t, restored.Locations, 1)
+	assert.Equal(t, previous.Locations[0].ID, restored.Locations[0].ID)
+
+	// Restore undoes a delete
+	require.NoError(t, service.Delete(host.ID))
+	require.NoError(t, service.Restore(previous))
+	_, err = service.GetByUUID("uuid-1")
+	require.NoError(t, err)
+
+	// Purge undoes a create
+	require.NoError(t, service.Purge(host.ID))
+	_, err = service.GetByID(host.ID)
+	assert.Error(t, err)
+	var locations int64
+	db.Model(&models.Location{}).Count(&locations)
+	assert.Zero(t, locations)
+}
+
 func TestProxyHostService_TestConnection(t *testing.T) {
 	db := setupProxyHostTestDB(t)
 	service := NewProxyHostService(db)
@@ -167,3 +275,84 @@ func TestProxyHostService_TestConnection(t *testing.T) {
 	err = service.TestConnection(addr.IP.String(), addr.Port)
 	assert.NoError(t, err)
 }
+
+func TestProxyHostService_UpdateTrafficSplit(t *testing.T) {
+	db := setupProxyHostTestDB(t)
+	require.NoError(t, db.AutoMigrate(&models.TrafficSplitChange{}))
+	service := NewProxyHostService(db)
+
+	host := &models.ProxyHost{UUID: "split-host", DomainNames: "app.example.com", ForwardHost: "app", ForwardPort: 80}
+	require.NoError(t, service.Create(host))
+
+	// Start the canary at 5%
+	err := service.UpdateTrafficSplit(host, TrafficSplitUpdate{
+		Groups: []models.UpstreamGroup{
+			{Name: "stable", ForwardHost: "app-v1", ForwardPort: 80, Weight: 95},
+			{Name: "canary", ForwardHost: "app-v2", ForwardPort: 80, Weight: 5},
+		},
+		StickyCookie: "cpm_split",
+		Reason:       "start canary",
+	}, 7)
+	require.NoError(t, err)
+	require.Len(t, host.UpstreamGroups, 2)
+	canaryUUID := host.UpstreamGroups[1].UUID
+	require.NotEmpty(t, canaryUUID)
+
+	// Promote the canary and drop stable
+	err = service.UpdateTrafficSplit(host, TrafficSplitUpdate{
+		Groups: []models.UpstreamGroup{
+			{Name: "canary", ForwardHost: "app-v2", ForwardPort: 80, Weight: 100},
+		},
+		Reason: "promote",
+	}, 7)
+	require.NoError(t, err)
+	require.Len(t, host.UpstreamGroups, 1)
+	assert.Equal(t, canaryUUID, host.UpstreamGroups[0].UUID)
+	assert.Equal(t, 100, host.UpstreamGroups[0].Weight)
+
+	fetched, err := service.GetByUUID("split-host")
+	require.NoError(t, err)
+	assert.Len(t, fetched.UpstreamGroups, 1)
+	assert.Empty(t, fetched.SplitStickyCookie)
+
+	changes, err := service.ListTrafficSplitChanges(host.ID)
+	require.NoError(t, err)
+	require.Len(t, changes, 2)
+	assert.Equal(t, "promote", changes[0].Reason)
+	assert.Equal(t, uint(7), changes[0].ChangedBy)
+	assert.JSONEq(t, `[{"name":"canary","target":"app-v2:80","weight":100}]`, changes[0].Groups)
+	assert.Equal(t, "start canary", changes[1].Reason)
+}
+
+func TestProxyHostService_LocationMatchersPersist(t *testing.T) {
+	db := setupProxyHostTestDB(t)
+	service := NewProxyHostService(db)
+
+	host := &models.ProxyHost{
+		UUID:        "uuid-matchers",
+		DomainNames: "app.example.com",
+		ForwardHost: "app",
+		ForwardPort: 8080,
+		Locations: []models.Location{
+			{
+				UUID:         "loc-1",
+				Path:         "/api",
+				ForwardHost:  "api",
+				ForwardPort:  9000,
+				Methods:      "GET,POST",
+				MatchHeaders: map[string][]string{"X-Tenant": {"acme", "globex"}},
+				MatchQuery:   map[string][]string{"debug": {"1"}},
+				Priority:     5,
+			},
+		},
+	}
+	require.NoError(t, service.Create(host))
+
+	loaded, err := service.GetByUUID("uuid-matchers")
+	require.NoError(t, err)
+	require.Len(t, loaded.Locations, 1)
+	assert.Equal(t, map[string][]string{"X-Tenant": {"acme", "globex"}}, loaded.Locations[0].MatchHeaders)
+	assert.Equal(t, map[string][]string{"debug": {"1"}}, loaded.Locations[0].MatchQuery)
+	assert.Equal(t, "GET,POST", loaded.Locations[0].Methods)
+	assert.Equal(t, 5, loaded.Locations[0].Priority)
+}
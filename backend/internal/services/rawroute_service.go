@@ -0,0 +1,98 @@
+package services
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+
+	"gorm.io/gorm"
+
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/models"
+)
+
+// ErrRawRouteExists is returned when the same route was already adopted.
+var ErrRawRouteExists = errors.New("route already adopted")
+
+// RawRouteService encapsulates business logic for routes adopted verbatim.
+type RawRouteService struct {
+	db *gorm.DB
+}
+
+// NewRawRouteService creates a new raw route service.
+func NewRawRouteService(db *gorm.DB) *RawRouteService {
+	return &RawRouteService{db: db}
+}
+
+// Validate checks that the route is a JSON object with handlers, stores it
+// in canonical form and checks that it wasn't adopted already.
+func (s *RawRouteService) Validate(route *models.RawRoute) error {
+	var decoded map[string]interface{}
+	if err := json.Unmarshal([]byte(route.Route), &decoded); err != nil {
+		return fmt.Errorf("invalid route JSON: %w", err)
+	}
+	if handle, ok := decoded["handle"].([]interface{}); !ok || len(handle) == 0 {
+		return errors.New("route has no handlers")
+	}
+
+	// Sorted keys and no whitespace, so the same route always compares equal
+	canonical, err := json.Marshal(decoded)
+	if err != nil {
+		return fmt.Errorf("invalid route JSON: %w", err)
+	}
+	route.Route = string(canonical)
+
+	var count int64
+	query := s.db.Model(&models.RawRoute{}).Where("route = ?", route.Route)
+	if route.ID > 0 {
+		query = query.Where("id != ?", route.ID)
+	}
+	if err := query.Count(&count).Error; err != nil {
+		return fmt.Errorf("checking route uniqueness: %w", err)
+	}
+	if count > 0 {
+		return ErrRawRouteExists
+	}
+
+	return nil
+}
+
+// Create validates and creates a new raw route.
+func (s *RawRouteService) Create(route *models.RawRoute) error {
+	if err := s.Validate(route); err != nil {
+		return err
+	}
+
+	return s.db.Create(route).Error
+}
+
+// Update validates and updates an existing raw route.
+func (s *RawRouteService) Update(route *models.RawRoute) error {
+	if err := s.Validate(route); err != nil {
+		return err
+	}
+
+	return s.db.Save(route).Error
+}
+
+// Delete removes a raw route.
+func (s *RawRouteService) Delete(id uint) error {
+	return s.db.Delete(&models.RawRoute{}, id).Error
+}
+
+// GetByUUID retrieves a raw route by UUID.
+func (s *RawRouteService) GetByUUID(uuid string) (*models.RawRoute, error) {
+	var route models.RawRoute
+	if err := s.db.Where("uuid = ?", uuid).First(&route).Error; err != nil {
+		return nil, err
+	}
+	return &route, nil
+}
+
+// List retrieves all raw routes in the order they are added to the config.
+func (s *RawRouteService) List() ([]models.RawRoute, error) {
+	var routes []models.RawRoute
+	if err := s.db.Order("id").Find(&routes).Error; err != nil {
+		return nil, err
+	}
+	return routes, nil
+}
@@ -0,0 +1,62 @@
+package services
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/models"
+)
+
+func setupRawRouteTestDB(t *testing.T) *gorm.DB {
+	dsn := fmt.Sprintf("file:%s?mode=memory&cache=shared", t.Name())
+	db, err := gorm.Open(sqlite.Open(dsn), &gorm.Config{})
+	require.NoError(t, err)
+	require.NoError(t, db.AutoMigrate(&models.RawRoute{}))
+	return db
+}
+
+func TestRawRouteService_Validate(t *testing.T) {
+	service := NewRawRouteService(setupRawRouteTestDB(t))
+
+	route := &models.RawRoute{UUID: "raw-1", Route: `{
+		"match": [{"host": ["health.example.com"]}],
+		"handle": [{"handler": "static_response", "body": "OK"}]
+	}`}
+	require.NoError(t, service.Create(route))
+	assert.Equal(t, `{"handle":[{"body":"OK","handler":"static_response"}],"match":[{"host":["health.example.com"]}]}`, route.Route)
+
+	// A route doesn't conflict with itself
+	route.Name = "health"
+	require.NoError(t, service.Update(route))
+
+	tests := []struct {
+		name  string
+		route string
+		err   error
+		msg   string
+	}{
+		{"duplicate", `{"handle":[{"handler":"static_response","body":"OK"}],"match":[{"host":["health.example.com"]}]}`, ErrRawRouteExists, ""},
+		{"invalid JSON", `{invalid`, nil, "invalid route JSON"},
+		{"no handlers", `{"match":[{"host":["a.example.com"]}]}`, nil, "no handlers"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := service.Create(&models.RawRoute{UUID: "raw-2", Route: tt.route})
+			require.Error(t, err)
+			if tt.err != nil {
+				assert.ErrorIs(t, err, tt.err)
+			} else {
+				assert.Contains(t, err.Error(), tt.msg)
+			}
+		})
+	}
+
+	routes, err := service.List()
+	require.NoError(t, err)
+	assert.Len(t, routes, 1)
+}
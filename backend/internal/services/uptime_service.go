@@ -44,7 +44,8 @@ func (s *UptimeService) CheckAllHosts() {
 	}
 
 	for _, host := range hosts {
-		if !host.Enabled {
+		// Static hosts have no upstream to check
+		if !host.Enabled || host.HostType == models.HostTypeStatic {
 			continue
 		}
 		// Assuming ProxyHost has ForwardHost and ForwardPort
@@ -0,0 +1,125 @@
+package services
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/models"
+)
+
+// corazaAuditLog is an entry of Coraza's JSON audit log (SecAuditLogFormat JSON).
+type corazaAuditLog struct {
+	Transaction *struct {
+		UnixTimestamp int64  `json:"unix_timestamp"` // Nanoseconds
+		ClientIP      string `json:"client_ip"`
+		ClientPort    int    `json:"client_port"`
+		ServerID      string `json:"server_id"`
+		Request       *struct {
+			Method   string              `json:"method"`
+			Protocol string              `json:"protocol"`
+			URI      string              `json:"uri"`
+			Headers  map[string][]string `json:"headers"`
+		} `json:"request"`
+		Response *struct {
+			Status int `json:"status"`
+		} `json:"response"`
+		IsInterrupted bool `json:"is_interrupted"`
+	} `json:"transaction"`
+	Messages []struct {
+		Message string `json:"message"`
+		Data    *struct {
+			ID  int    `json:"id"`
+			Msg string `json:"msg"`
+		} `json:"data"`
+	} `json:"messages"`
+}
+
+// parseWAFAuditLine parses lines that look like WAF audit entries,
+// sparing access log lines a second decode.
+func parseWAFAuditLine(line string) (models.CaddyAccessLog, bool) {
+	if !strings.Contains(line, `"transaction"`) {
+		return models.CaddyAccessLog{}, false
+	}
+	return parseWAFAuditEntry([]byte(line))
+}
+
+// wafRuleMatches reports whether a search term is one of the matched rule IDs.
+func wafRuleMatches(waf *models.WAFMatch, term string) bool {
+	if waf == nil {
+		return false
+	}
+	for _, id := range waf.RuleIDs {
+		if strconv.Itoa(id) == term {
+			return true
+		}
+	}
+	return false
+}
+
+// parseWAFAuditEntry converts a Coraza audit log line into a log entry.
+// It reports false for lines that are not WAF audit entries.
+func parseWAFAuditEntry(line []byte) (models.CaddyAccessLog, bool) {
+	var audit corazaAuditLog
+	if err := json.Unmarshal(line, &audit); err != nil || audit.Transaction == nil {
+		return models.CaddyAccessLog{}, false
+	}
+
+	tx := audit.Transaction
+	entry := models.CaddyAccessLog{
+		Level:  "warn",
+		Ts:     float64(tx.UnixTimestamp) / 1e9,
+		Logger: "http.handlers.waf",
+		WAF:    &models.WAFMatch{RuleIDs: []int{}, Messages: []string{}, Blocked: tx.IsInterrupted},
+	}
+	entry.Request.RemoteIP = tx.ClientIP
+	entry.Request.ClientIP = tx.ClientIP
+	if tx.ClientPort > 0 {
+		entry.Request.RemotePort = strconv.Itoa(tx.ClientPort)
+	}
+	entry.Request.Host = tx.ServerID
+
+	if req := tx.Request; req != nil {
+		entry.Request.Method = req.Method
+		entry.Request.Proto = req.Protocol
+		entry.Request.URI = req.URI
+		entry.Request.Headers = req.Headers
+		for name, values := range req.Headers {
+			if strings.EqualFold(name, "Host") && len(values) > 0 {
+				entry.Request.Host = values[0]
+			}
+		}
+	}
+	if tx.Response != nil {
+		entry.Status = tx.Response.Status
+	}
+
+	for _, msg := range audit.Messages {
+		text := msg.Message
+		if msg.Data != nil {
+			entry.WAF.RuleIDs = append(entry.WAF.RuleIDs, msg.Data.ID)
+			if text == "" {
+				text = msg.Data.Msg
+			}
+		}
+		entry.WAF.Messages = append(entry.WAF.Messages, text)
+	}
+
+	if tx.IsInterrupted {
+		entry.Level = "error"
+		if entry.Status == 0 {
+			entry.Status = http.StatusForbidden
+		}
+	}
+
+	entry.Msg = "WAF rule matched"
+	if tx.IsInterrupted {
+		entry.Msg = "WAF blocked request"
+	}
+	if len(entry.WAF.Messages) > 0 {
+		entry.Msg += ": " + entry.WAF.Messages[0]
+	}
+
+	return entry, true
+}
@@ -0,0 +1,71 @@
+package services
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/config"
+	"github.com/Wikid82/CaddyProxyManagerPlus/backend/internal/models"
+)
+
+const wafBlockedEntry = `{"transaction":{"timestamp":"2025/01/02 03:04:05","unix_timestamp":1735787045000000000,"id":"tx1","client_ip":"203.0.113.9","client_port":51234,"host_ip":"","host_port":0,"server_id":"app.example.com","request":{"method":"GET","protocol":"HTTP/2.0","uri":"/search?q=1'+or+1=1","http_version":"","headers":{"host":["app.example.com"]},"body":"","files":null,"args":{},"length":0},"response":{"protocol":"","status":403,"headers":{},"body":""},"producer":{"connector":"","version":"","server":"","rule_engine":"On","stopwatch":"","rulesets":null},"highest_severity":"","is_interrupted":true},"messages":[{"actionset":"","message":"SQL Injection Attack Detected via libinjection","data":{"file":"","line":0,"id":942100,"rev":"","msg":"SQL Injection Attack Detected via libinjection","data":"","severity":2,"ver":"","maturity":0,"accuracy":0,"tags":["attack-sqli"],"raw":""}},{"actionset":"","message":"Inbound Anomaly Score Exceeded (Total Score: 5)","data":{"id":949110,"msg":"Inbound Anomaly Score Exceeded (Total Score: 5)","severity":0}}]}`
+
+const wafDetectedEntry = `{"transaction":{"unix_timestamp":1735787105000000000,"client_ip":"198.51.100.4","server_id":"app.example.com","request":{"method":"POST","uri":"/upload"},"response":{"status":200},"is_interrupted":false},"messages":[{"message":"Restricted File Access Attempt","data":{"id":930130}}]}`
+
+func TestParseWAFAuditEntry(t *testing.T) {
+	entry, ok := parseWAFAuditEntry([]byte(wafBlockedEntry))
+	require.True(t, ok)
+	assert.Equal(t, "error", entry.Level)
+	assert.Equal(t, float64(1735787045), entry.Ts)
+	assert.Equal(t, "WAF blocked request: SQL Injection Attack Detected via libinjection", entry.Msg)
+	assert.Equal(t, "203.0.113.9", entry.Request.RemoteIP)
+	assert.Equal(t, "51234", entry.Request.RemotePort)
+	assert.Equal(t, "app.example.com", entry.Request.Host)
+	assert.Equal(t, "GET", entry.Request.Method)
+	assert.Equal(t, "/search?q=1'+or+1=1", entry.Request.URI)
+	assert.Equal(t, 403, entry.Status)
+	require.NotNil(t, entry.WAF)
+	assert.Equal(t, []int{942100, 949110}, entry.WAF.RuleIDs)
+	assert.True(t, entry.WAF.Blocked)
+
+	entry, ok = parseWAFAuditEntry([]byte(wafDetectedEntry))
+	require.True(t, ok)
+	assert.Equal(t, "warn", entry.Level)
+	assert.Equal(t, "WAF rule matched: Restricted File Access Attempt", entry.Msg)
+	assert.Equal(t, 200, entry.Status)
+	assert.False(t, entry.WAF.Blocked)
+
+	_, ok = parseWAFAuditEntry([]byte(`{"level":"info","msg":"handled request","request":{"uri":"/"}}`))
+	assert.False(t, ok)
+	_, ok = parseWAFAuditEntry([]byte("not json"))
+	assert.False(t, ok)
+}
+
+func TestLogService_QueryLogs_WAFAudit(t *testing.T) {
+	dataDir := t.TempDir()
+	logsDir := filepath.Join(dataDir, "logs")
+	require.NoError(t, os.MkdirAll(logsDir, 0755))
+	content := wafBlockedEntry + "\n" + wafDetectedEntry + "\n"
+	require.NoError(t, os.WriteFile(filepath.Join(logsDir, "waf-audit.log"), []byte(content), 0644))
+
+	service := NewLogService(&config.Config{DatabasePath: filepath.Join(dataDir, "cpm.db")})
+
+	logs, err := service.ListLogs()
+	require.NoError(t, err)
+	require.Len(t, logs, 1)
+
+	results, total, err := service.QueryLogs("waf-audit.log", models.LogFilter{Status: "403", Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), total)
+	assert.Equal(t, []int{942100, 949110}, results[0].WAF.RuleIDs)
+
+	// Rule IDs are searchable
+	results, total, err = service.QueryLogs("waf-audit.log", models.LogFilter{Search: "930130", Limit: 10})
+	require.NoError(t, err)
+	assert.Equal(t, int64(1), total)
+	assert.Equal(t, "/upload", results[0].Request.URI)
+}
@@ -0,0 +1,18 @@
+import { describe, it, expect, afterEach } from 'vitest'
+import { downloadCaddyfile } from '../configHistory'
+
+describe('Config history API', () => {
+  const location = window.location
+
+  afterEach(() => {
+    Object.defineProperty(window, 'location', { value: location, writable: true })
+  })
+
+  it('downloadCaddyfile navigates to the export', () => {
+    Object.defineProperty(window, 'location', { value: { href: '' }, writable: true })
+
+    downloadCaddyfile()
+
+    expect(window.location.href).toBe('/api/v1/config/caddyfile')
+  })
+})
@@ -1,6 +1,6 @@
 import { describe, it, expect, vi, afterEach } from 'vitest'
 import client from '../client'
-import { checkUpdates, getNotifications, markNotificationRead, markAllNotificationsRead } from '../system'
+import { checkUpdates, getCaddyInfo, getNotifications, markNotificationRead, markAllNotificationsRead } from '../system'
 
 vi.mock('../client', () => ({
   default: {
@@ -24,6 +24,16 @@ describe('System API', () => {
     expect(result).toEqual(mockData)
   })
 
+  it('getCaddyInfo calls /system/caddy', async () => {
+    const mockData = { available: true, version: 'v2.9.1', modules: ['http.handlers.waf'], features: { waf: true } }
+    vi.mocked(client.get).mockResolvedValue({ data: mockData })
+
+    const result = await getCaddyInfo()
+
+    expect(client.get).toHaveBeenCalledWith('/system/caddy')
+    expect(result).toEqual(mockData)
+  })
+
   it('getNotifications calls /notifications', async () => {
     const mockData = [{ id: '1', title: 'Test' }]
     vi.mocked(client.get).mockResolvedValue({ data: mockData })
@@ -0,0 +1,67 @@
+import client from './client';
+
+export type CaddyNodeAuthType = '' | 'basic' | 'bearer';
+
+export interface CaddyNode {
+  uuid: string;
+  name: string;
+  admin_url: string;
+  auth_type: CaddyNodeAuthType;
+  auth_user: string;
+  auth_secret?: string; // Write-only
+  labels: string[];
+  enabled: boolean;
+  origin: string;
+  ca_cert_file: string;
+  client_cert_file: string;
+  client_key_file: string;
+  last_applied?: string;
+  apply_error: string;
+  applied_hash: string;
+  last_checked?: string;
+  reachable: boolean;
+  in_sync: boolean;
+  live_hash: string;
+  version: string;
+  created_at: string;
+  updated_at: string;
+}
+
+export const getCaddyNodes = async (): Promise<CaddyNode[]> => {
+  const { data } = await client.get<CaddyNode[]>('/caddy-nodes');
+  return data;
+};
+
+export const getCaddyNode = async (uuid: string): Promise<CaddyNode> => {
+  const { data } = await client.get<CaddyNode>(`/caddy-nodes/${uuid}`);
+  return data;
+};
+
+export const createCaddyNode = async (node: Partial<CaddyNode>): Promise<CaddyNode> => {
+  const { data } = await client.post<CaddyNode>('/caddy-nodes', node);
+  return data;
+};
+
+export const updateCaddyNode = async (uuid: string, node: Partial<CaddyNode>): Promise<CaddyNode> => {
+  const { data } = await client.put<CaddyNode>(`/caddy-nodes/${uuid}`, node);
+  return data;
+};
+
+export const deleteCaddyNode = async (uuid: string): Promise<void> => {
+  await client.delete(`/caddy-nodes/${uuid}`);
+};
+
+export const getCaddyNodeConfig = async (uuid: string): Promise<Record<string, unknown>> => {
+  const { data } = await client.get<Record<string, unknown>>(`/caddy-nodes/${uuid}/config`);
+  return data;
+};
+
+export const applyCaddyNode = async (uuid: string): Promise<CaddyNode> => {
+  const { data } = await client.post<CaddyNode>(`/caddy-nodes/${uuid}/apply`);
+  return data;
+};
+
+export const checkCaddyNode = async (uuid: string): Promise<CaddyNode> => {
+  const { data } = await client.post<CaddyNode>(`/caddy-nodes/${uuid}/check`);
+  return data;
+};
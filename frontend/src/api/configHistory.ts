@@ -0,0 +1,66 @@
+import client from './client'
+import type { ConfigDiff } from './proxyHosts'
+
+export interface ConfigHistoryEntry {
+  id: number
+  config_hash: string
+  applied_at: string
+  applied_by: number
+  reason: string
+  success: boolean
+  error_msg: string
+  hosts_changed: string[]
+  snapshot: string
+}
+
+export interface ConfigSnapshot extends ConfigHistoryEntry {
+  config: Record<string, unknown> | null
+}
+
+export const getConfigHistory = async (): Promise<ConfigHistoryEntry[]> => {
+  const { data } = await client.get<ConfigHistoryEntry[]>('/config/history')
+  return data
+}
+
+export const getConfigSnapshot = async (id: number): Promise<ConfigSnapshot> => {
+  const { data } = await client.get<ConfigSnapshot>(`/config/history/${id}`)
+  return data
+}
+
+export const diffConfigSnapshots = async (id: number, other: number): Promise<ConfigDiff> => {
+  const { data } = await client.get<ConfigDiff>(`/config/history/${id}/diff/${other}`)
+  return data
+}
+
+export const rollbackConfig = async (id: number): Promise<void> => {
+  await client.post(`/config/history/${id}/rollback`)
+}
+
+// Downloads the current configuration as a Caddyfile named after its generation time.
+export const downloadCaddyfile = () => {
+  window.location.href = '/api/v1/config/caddyfile'
+}
+
+export interface ApplyJob {
+  id: string
+  status: 'queued' | 'applying' | 'applied' | 'failed'
+  reason?: string
+  error?: string
+  coalesced?: number
+  queued_at: string
+  finished_at?: string
+}
+
+export const getApplyJob = async (id: string): Promise<ApplyJob> => {
+  const { data } = await client.get<ApplyJob>(`/config/jobs/${id}`)
+  return data
+}
+
+// Error body returned when Caddy rejects the config produced by a host change.
+export interface ApplyFailure {
+  error: string
+  stage: 'generate' | 'validate' | 'load'
+  host?: { uuid: string; domain_names: string }
+  reverted?: boolean
+  revert_error?: string
+}
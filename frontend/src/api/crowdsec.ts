@@ -0,0 +1,26 @@
+import client from './client'
+
+export interface CrowdSecDecision {
+  id: number
+  origin: string
+  type: string
+  scope: string
+  value: string
+  duration: string
+  scenario: string
+}
+
+export interface CrowdSecBan {
+  ip: string
+  duration?: string
+  reason?: string
+}
+
+export const getDecisions = async (): Promise<CrowdSecDecision[]> => {
+  const { data } = await client.get<CrowdSecDecision[]>('/crowdsec/decisions')
+  return data
+}
+
+export const banIP = async (ban: CrowdSecBan): Promise<void> => {
+  await client.post('/crowdsec/decisions', ban)
+}
@@ -1,11 +1,23 @@
 import client from './client';
 
+export interface ReconcileStatus {
+  applied: boolean;
+  in_sync: boolean;
+  last_check?: string;
+  last_drift?: string;
+  last_action?: 'applied' | 'reapplied' | 'notified';
+  expected_hash?: string;
+  live_hash?: string;
+  error?: string;
+}
+
 export interface HealthResponse {
   status: string;
   service: string;
   version: string;
   git_commit: string;
   build_time: string;
+  reconcile?: ReconcileStatus;
 }
 
 export const checkHealth = async (): Promise<HealthResponse> => {
@@ -7,12 +7,19 @@ export interface ImportSession {
   updated_at: string;
 }
 
+export interface PassthroughRoute {
+  name: string;
+  reason: string;
+  route: Record<string, unknown>;
+}
+
 export interface ImportPreview {
   session: ImportSession;
   preview: {
     hosts: Array<{ domain_names: string; [key: string]: unknown }>;
     conflicts: string[];
     errors: string[];
+    passthrough?: PassthroughRoute[];
   };
   caddyfile_content?: string;
 }
@@ -22,6 +29,15 @@ export const uploadCaddyfile = async (content: string): Promise<ImportPreview> =
   return data;
 };
 
+export const uploadCaddyJSON = async (content: string): Promise<ImportPreview> => {
+  const { data } = await client.post<ImportPreview>('/import/upload', { content, format: 'json' });
+  return data;
+};
+
+export const importLiveConfig = async (): Promise<void> => {
+  await client.post('/import/live');
+};
+
 export const getImportPreview = async (): Promise<ImportPreview> => {
   const { data } = await client.get<ImportPreview>('/import/preview');
   return data;
@@ -21,6 +21,14 @@ export interface CaddyAccessLog {
   status: number;
   duration: number;
   size: number;
+  country?: string;
+  waf?: WAFMatch;
+}
+
+export interface WAFMatch {
+  rule_ids: number[];
+  messages: string[];
+  blocked: boolean;
 }
 
 export interface LogResponse {
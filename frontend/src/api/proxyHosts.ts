@@ -3,14 +3,67 @@ import client from './client';
 export interface Location {
   uuid?: string;
   path: string;
+  path_regex?: string;
+  methods?: string;
+  match_headers?: Record<string, string[]>;
+  match_query?: Record<string, string[]>;
+  priority?: number;
   forward_scheme: string;
   forward_host: string;
   forward_port: number;
+  strip_prefix?: boolean;
+  replace_prefix?: string;
+  rewrite_regex?: string;
+  rewrite_replacement?: string;
+  trailing_slash_redirect?: boolean;
+  websocket_support?: boolean | null;
+  enable_compression?: boolean | null;
+  request_headers?: Record<string, string[]>;
+  response_headers?: Record<string, string[]>;
+  access_list_id?: number | null;
+  disable_access_list?: boolean;
+  upstream_tls_skip_verify?: boolean | null;
+  upstream_tls_server_name?: string;
+}
+
+export interface UpstreamGroup {
+  uuid?: string;
+  name: string;
+  forward_scheme: string;
+  forward_host: string;
+  forward_port: number;
+  weight: number;
+}
+
+export interface TrafficSplit {
+  groups: UpstreamGroup[];
+  sticky_cookie: string;
+  override_header: string;
+}
+
+export interface TrafficSplitChange {
+  id: number;
+  proxy_host_id: number;
+  groups: string;
+  changed_by: number;
+  reason: string;
+  created_at: string;
+}
+
+export interface WAFExclusion {
+  rule_id: number;
+  path?: string;
+}
+
+export interface CacheControlRule {
+  path: string;
+  value: string;
 }
 
 export interface ProxyHost {
   uuid: string;
   domain_names: string;
+  host_type?: 'proxy' | 'static';
   forward_scheme: string;
   forward_host: string;
   forward_port: number;
@@ -21,12 +74,67 @@ export interface ProxyHost {
   block_exploits: boolean;
   websocket_support: boolean;
   locations: Location[];
+  upstream_groups?: UpstreamGroup[];
+  split_sticky_cookie?: string;
+  split_override_header?: string;
+  on_demand_tls?: boolean;
+  certificate_issuer?: string;
+  canonical_host?: '' | 'apex' | 'www';
+  crowdsec_enabled?: boolean;
+  waf_mode?: '' | 'detection' | 'blocking';
+  waf_paranoia_level?: number;
+  waf_exclusions?: WAFExclusion[];
+  waf_custom_rules?: string;
+  max_body_size?: number;
+  response_header_timeout?: string;
+  upstream_idle_timeout?: string;
+  upstream_keepalive?: string;
+  access_list_id?: number | null;
+  enable_compression?: boolean;
+  request_headers?: Record<string, string[]>;
+  response_headers?: Record<string, string[]>;
+  upstream_tls_skip_verify?: boolean;
+  upstream_tls_server_name?: string;
+  static_root?: string;
+  static_index_files?: string;
+  static_spa_fallback?: boolean;
+  static_browse?: boolean;
+  static_precompressed?: boolean;
+  static_cache_control?: CacheControlRule[];
+  nodes?: string[];
   advanced_config?: string;
   enabled: boolean;
   created_at: string;
   updated_at: string;
 }
 
+export interface ConfigChange {
+  path: string;
+  op: 'add' | 'remove' | 'replace';
+  before?: unknown;
+  after?: unknown;
+}
+
+export interface HostDiff {
+  host: string;
+  status: 'added' | 'removed' | 'changed';
+  changes: ConfigChange[];
+}
+
+export interface ConfigDiff {
+  changed: boolean;
+  hosts: HostDiff[];
+}
+
+export interface ConfigPlan {
+  valid: boolean;
+  error?: string;
+  config?: Record<string, unknown>;
+  snapshot_diff?: ConfigDiff;
+  live_diff?: ConfigDiff;
+  live_error?: string;
+}
+
 export const getProxyHosts = async (): Promise<ProxyHost[]> => {
   const { data } = await client.get<ProxyHost[]>('/proxy-hosts');
   return data;
@@ -54,3 +162,24 @@ export const deleteProxyHost = async (uuid: string): Promise<void> => {
 export const testProxyHostConnection = async (host: string, port: number): Promise<void> => {
   await client.post('/proxy-hosts/test', { forward_host: host, forward_port: port });
 };
+
+// Previews the Caddy config without saving, optionally with a proposed host.
+export const planProxyHosts = async (host?: Partial<ProxyHost>): Promise<ConfigPlan> => {
+  const { data } = await client.post<ConfigPlan>('/proxy-hosts/plan', host);
+  return data;
+};
+
+export const getTrafficSplit = async (uuid: string): Promise<TrafficSplit> => {
+  const { data } = await client.get<TrafficSplit>(`/proxy-hosts/${uuid}/split`);
+  return data;
+};
+
+export const updateTrafficSplit = async (uuid: string, split: TrafficSplit & { reason?: string }): Promise<TrafficSplit> => {
+  const { data } = await client.put<TrafficSplit>(`/proxy-hosts/${uuid}/split`, split);
+  return data;
+};
+
+export const getTrafficSplitHistory = async (uuid: string): Promise<TrafficSplitChange[]> => {
+  const { data } = await client.get<TrafficSplitChange[]>(`/proxy-hosts/${uuid}/split/history`);
+  return data;
+};
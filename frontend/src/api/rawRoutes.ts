@@ -0,0 +1,35 @@
+import client from './client';
+
+export interface RawRoute {
+  uuid: string;
+  name: string;
+  source: string;
+  route: string; // Caddy route JSON
+  enabled: boolean;
+  created_at: string;
+  updated_at: string;
+}
+
+export const getRawRoutes = async (): Promise<RawRoute[]> => {
+  const { data } = await client.get<RawRoute[]>('/raw-routes');
+  return data;
+};
+
+export const getRawRoute = async (uuid: string): Promise<RawRoute> => {
+  const { data } = await client.get<RawRoute>(`/raw-routes/${uuid}`);
+  return data;
+};
+
+export const createRawRoute = async (route: Partial<RawRoute>): Promise<RawRoute> => {
+  const { data } = await client.post<RawRoute>('/raw-routes', route);
+  return data;
+};
+
+export const updateRawRoute = async (uuid: string, route: Partial<RawRoute>): Promise<RawRoute> => {
+  const { data } = await client.put<RawRoute>(`/raw-routes/${uuid}`, route);
+  return data;
+};
+
+export const deleteRawRoute = async (uuid: string): Promise<void> => {
+  await client.delete(`/raw-routes/${uuid}`);
+};
@@ -6,6 +6,14 @@ export interface UpdateInfo {
   changelog_url: string;
 }
 
+export interface CaddyInfo {
+  available: boolean;
+  version?: string;
+  modules?: string[];
+  features: Partial<Record<'waf' | 'crowdsec' | 'geoip', boolean>>;
+  error?: string;
+}
+
 export interface Notification {
   id: string;
   type: 'info' | 'success' | 'warning' | 'error';
@@ -20,6 +28,11 @@ export const checkUpdates = async (): Promise<UpdateInfo> => {
   return response.data;
 };
 
+export const getCaddyInfo = async (): Promise<CaddyInfo> => {
+  const response = await client.get('/system/caddy');
+  return response.data;
+};
+
 export const getNotifications = async (unreadOnly = false): Promise<Notification[]> => {
   const response = await client.get('/notifications', { params: { unread: unreadOnly } });
   return response.data;
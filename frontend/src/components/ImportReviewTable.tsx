@@ -2,6 +2,7 @@ import { useState } from 'react'
 
 interface HostPreview {
   domain_names: string
+  warnings?: string[] | null
   [key: string]: unknown
 }
 
@@ -14,10 +15,20 @@ interface Props {
   onCancel: () => void
 }
 
+// A host of several domains conflicts when any of its domains does. Conflicts
+// are domains or messages quoting them, such as "Domain 'a.com' already exists".
+const hasConflict = (domainNames: string, conflicts: string[]) =>
+  [domainNames, ...domainNames.split(',').map(d => d.trim())].some(d =>
+    conflicts.some(c => c === d || c.includes(`'${d}'`))
+  )
+
 export default function ImportReviewTable({ hosts, conflicts, errors, caddyfileContent, onCommit, onCancel }: Props) {
   const [resolutions, setResolutions] = useState<Record<string, string>>(() => {
     const init: Record<string, string> = {}
     conflicts.forEach((d: string) => { init[d] = 'keep' })
+    hosts.forEach(h => {
+      if (hasConflict(h.domain_names, conflicts)) init[h.domain_names] = 'keep'
+    })
     return init
   })
   const [submitting, setSubmitting] = useState(false)
@@ -104,14 +115,17 @@ export default function ImportReviewTable({ hosts, conflicts, errors, caddyfileC
           <tbody className="divide-y divide-gray-800">
             {hosts.map((h, idx) => {
               const domain = h.domain_names
-              const hasConflict = conflicts.includes(domain)
+              const conflicting = hasConflict(domain, conflicts)
               return (
                 <tr key={`${domain}-${idx}`} className="hover:bg-gray-900/50">
                   <td className="px-6 py-4 whitespace-nowrap">
                     <div className="text-sm font-medium text-white">{domain}</div>
+                    {h.warnings?.map(w => (
+                      <div key={w} className="text-xs text-yellow-400 mt-1">{w}</div>
+                    ))}
                   </td>
                   <td className="px-6 py-4 whitespace-nowrap">
-                    {hasConflict ? (
+                    {conflicting ? (
                       <select
                         value={resolutions[domain]}
                         onChange={e => setResolutions({ ...resolutions, [domain]: e.target.value })}
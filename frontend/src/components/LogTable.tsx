@@ -89,6 +89,11 @@ export const LogTable: React.FC<LogTableProps> = ({ logs, isLoading }) => {
                 {log.duration > 0 ? (log.duration * 1000).toFixed(2) + 'ms' : ''}
               </td>
               <td className="px-6 py-4 text-sm text-gray-500 dark:text-gray-400 max-w-xs truncate" title={log.msg}>
+                {log.waf && log.waf.rule_ids.length > 0 && (
+                  <span className="mr-2 px-2 inline-flex text-xs leading-5 font-semibold rounded-full bg-red-100 text-red-800 dark:bg-red-900 dark:text-red-200">
+                    WAF {log.waf.rule_ids.join(', ')}
+                  </span>
+                )}
                 {log.msg}
               </td>
             </tr>
@@ -42,6 +42,36 @@ describe('ImportReviewTable', () => {
     expect(screen.getByRole('combobox')).toBeInTheDocument()
   })
 
+  it('offers a resolution for a host with one conflicting domain', () => {
+    const hosts = [{ domain_names: 'a.example.com, b.example.com' }]
+    render(
+      <ImportReviewTable
+        hosts={hosts}
+        conflicts={["Domain 'b.example.com' already exists in CPM+"]}
+        errors={[]}
+        onCommit={mockOnCommit}
+        onCancel={mockOnCancel}
+      />
+    )
+
+    expect(screen.getByRole('combobox')).toHaveValue('keep')
+  })
+
+  it('displays the warnings of each host', () => {
+    const hosts = [{ domain_names: 'app.example.com', warnings: ["Handler 'metrics' is not supported - manual configuration required"] }]
+    render(
+      <ImportReviewTable
+        hosts={hosts}
+        conflicts={[]}
+        errors={[]}
+        onCommit={mockOnCommit}
+        onCancel={mockOnCancel}
+      />
+    )
+
+    expect(screen.getByText("Handler 'metrics' is not supported - manual configuration required")).toBeInTheDocument()
+  })
+
   it('displays errors', () => {
     const errors = ['Invalid Caddyfile syntax', 'Missing required field']
 
@@ -1,5 +1,6 @@
 import { useState } from 'react'
 import { useImport } from '../hooks/useImport'
+import { downloadCaddyfile } from '../api/configHistory'
 import ImportBanner from '../components/ImportBanner'
 import ImportReviewTable from '../components/ImportReviewTable'
 
@@ -54,7 +55,15 @@ export default function ImportCaddy() {
 
   return (
     <div className="p-8">
-      <h1 className="text-3xl font-bold text-white mb-6">Import Caddyfile</h1>
+      <div className="flex items-center justify-between mb-6">
+        <h1 className="text-3xl font-bold text-white">Import Caddyfile</h1>
+        <button
+          onClick={downloadCaddyfile}
+          className="px-4 py-2 bg-gray-800 hover:bg-gray-700 text-white rounded-lg font-medium transition-colors"
+        >
+          Export Caddyfile
+        </button>
+      </div>
 
       {session && (
         <ImportBanner